@@ -0,0 +1,132 @@
+package pie_cache
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"strings"
+)
+
+// ErrAccessDenied is returned by an Authorizer that rejects a request
+var ErrAccessDenied = errors.New("cache access denied")
+
+// Operation names a cache operation for access control
+type Operation string
+
+const (
+	OpRead   Operation = "read"   // Get, Exists
+	OpWrite  Operation = "write"  // Set
+	OpDelete Operation = "delete" // Delete
+	OpAdmin  Operation = "admin"  // Stats, PurgeExpired and other maintenance
+)
+
+// NamespaceOf returns the namespace of key: the part before the first ':',
+// or "" if the key has none
+func NamespaceOf(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// AccessRequest describes a remote call to be authorized. Frontends fill in
+// what their transport knows; authorizers may set Principal for later ones.
+type AccessRequest struct {
+	Op               Operation
+	Key              string              // Empty for admin operations
+	Namespace        string              // NamespaceOf(Key)
+	APIKey           string              // Credential presented by the client, if any
+	PeerCertificates []*x509.Certificate // Verified client certificate chain with mTLS
+	RemoteAddr       string
+	TraceID          string // Request ID supplied by the client, for audit records
+	Principal        string // Identity established by an authorizer
+}
+
+// Authorizer decides whether a remote request may proceed. The httpserver
+// and memcached frontends given one with WithAuthorizer call it before
+// every operation; returning an error rejects the request.
+type Authorizer interface {
+	Authorize(r *AccessRequest) error
+}
+
+// AuthorizerFunc adapts an ordinary function to the Authorizer interface
+type AuthorizerFunc func(r *AccessRequest) error
+
+// Authorize calls f(r)
+func (f AuthorizerFunc) Authorize(r *AccessRequest) error {
+	return f(r)
+}
+
+// Chain returns an Authorizer that runs auths in order and fails on the
+// first rejection
+func Chain(auths ...Authorizer) Authorizer {
+	return AuthorizerFunc(func(r *AccessRequest) error {
+		for _, a := range auths {
+			if err := a.Authorize(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// APIKeys authenticates requests by API key. keys maps each accepted key to
+// the principal name it identifies.
+func APIKeys(keys map[string]string) Authorizer {
+	return AuthorizerFunc(func(r *AccessRequest) error {
+		for key, principal := range keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(r.APIKey)) == 1 {
+				r.Principal = principal
+				return nil
+			}
+		}
+		return ErrAccessDenied
+	})
+}
+
+// ClientCerts authenticates requests by the common name of their verified
+// mTLS client certificate. If names is empty any verified certificate is
+// accepted.
+func ClientCerts(names ...string) Authorizer {
+	return AuthorizerFunc(func(r *AccessRequest) error {
+		if len(r.PeerCertificates) == 0 {
+			return ErrAccessDenied
+		}
+		cn := r.PeerCertificates[0].Subject.CommonName
+		if len(names) > 0 {
+			allowed := false
+			for _, n := range names {
+				if n == cn {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return ErrAccessDenied
+			}
+		}
+		r.Principal = cn
+		return nil
+	})
+}
+
+// NamespaceACL grants principals operations per namespace:
+// principal -> namespace -> allowed operations. The namespace "*" matches
+// any namespace. Chain it after an authenticating Authorizer.
+type NamespaceACL map[string]map[string][]Operation
+
+// Authorize implements Authorizer
+func (acl NamespaceACL) Authorize(r *AccessRequest) error {
+	grants, ok := acl[r.Principal]
+	if !ok {
+		return ErrAccessDenied
+	}
+	for _, ns := range []string{r.Namespace, "*"} {
+		for _, op := range grants[ns] {
+			if op == r.Op {
+				return nil
+			}
+		}
+	}
+	return ErrAccessDenied
+}
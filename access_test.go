@@ -0,0 +1,55 @@
+package pie_cache
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestNamespaceOf(t *testing.T) {
+	for key, want := range map[string]string{"user:1": "user", "a:b:c": "a", "plain": ""} {
+		if got := NamespaceOf(key); got != want {
+			t.Errorf("NamespaceOf(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestAuthorizers(t *testing.T) {
+	auth := Chain(
+		APIKeys(map[string]string{"k1": "billing", "k2": "web"}),
+		NamespaceACL{
+			"billing": {"invoice": {OpRead, OpWrite, OpDelete}},
+			"web":     {"*": {OpRead}},
+		},
+	)
+
+	tests := []struct {
+		req  AccessRequest
+		want error
+	}{
+		{AccessRequest{Op: OpWrite, Namespace: "invoice", APIKey: "k1"}, nil},
+		{AccessRequest{Op: OpWrite, Namespace: "page", APIKey: "k1"}, ErrAccessDenied},
+		{AccessRequest{Op: OpRead, Namespace: "invoice", APIKey: "k2"}, nil},
+		{AccessRequest{Op: OpDelete, Namespace: "invoice", APIKey: "k2"}, ErrAccessDenied},
+		{AccessRequest{Op: OpRead, Namespace: "invoice", APIKey: "bad"}, ErrAccessDenied},
+	}
+	for _, tt := range tests {
+		req := tt.req
+		if err := auth.Authorize(&req); err != tt.want {
+			t.Errorf("Authorize(%+v) = %v, want %v", tt.req, err, tt.want)
+		}
+	}
+
+	certs := ClientCerts("svc-a")
+	ok := &AccessRequest{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "svc-a"}}}}
+	if err := certs.Authorize(ok); err != nil || ok.Principal != "svc-a" {
+		t.Errorf("Expected svc-a to be accepted, got %v (%q)", err, ok.Principal)
+	}
+	other := &AccessRequest{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "svc-b"}}}}
+	if err := certs.Authorize(other); err != ErrAccessDenied {
+		t.Errorf("Expected svc-b to be denied, got %v", err)
+	}
+	if err := certs.Authorize(&AccessRequest{}); err != ErrAccessDenied {
+		t.Errorf("Expected request without certificate to be denied, got %v", err)
+	}
+}
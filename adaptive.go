@@ -0,0 +1,134 @@
+package pie_cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultAdaptiveKeys is how many keys AdaptiveTTLPolicy tracks unless
+// MaxKeys is set
+const defaultAdaptiveKeys = 100000
+
+// AdaptiveTTLPolicy tunes entry lifetimes by how often they are read.
+// Keys read at least HotHits times get their expiry pushed out by Extension,
+// never beyond MaxTTL after creation. Keys read no more than ColdHits times
+// during their previous lifetime get their next TTL multiplied by
+// ShrinkFactor, never below MinTTL.
+type AdaptiveTTLPolicy struct {
+	MinTTL       time.Duration // Lower bound for shortened TTLs
+	MaxTTL       time.Duration // Upper bound for extended lifetimes, measured from creation
+	HotHits      int           // Hits that trigger an extension
+	Extension    time.Duration // How far past now a hot key's expiry is moved
+	ColdHits     int           // Hits per lifetime at or below which a key is cold
+	ShrinkFactor float64       // TTL multiplier applied to cold keys on their next Set
+	MaxKeys      int           // Most keys whose hits are tracked, least recently used dropped first; 100000 if 0
+}
+
+// WithAdaptiveTTL enables hit-rate based TTL tuning. Hits served from the
+// hot cache are not counted.
+func WithAdaptiveTTL(policy AdaptiveTTLPolicy) Option {
+	return func(fc *FileCache) {
+		fc.adaptive = newAdaptiveTTL(policy)
+	}
+}
+
+func newAdaptiveTTL(policy AdaptiveTTLPolicy) *adaptiveTTL {
+	if policy.MaxKeys <= 0 {
+		policy.MaxKeys = defaultAdaptiveKeys
+	}
+	return &adaptiveTTL{policy: policy, hits: make(map[string]*list.Element), order: list.New()}
+}
+
+// adaptiveTTL tracks per-key hit counts for the current lifetime of each entry
+type adaptiveTTL struct {
+	policy AdaptiveTTLPolicy
+	mu     sync.Mutex
+	hits   map[string]*list.Element // Elements of order, by key
+	order  *list.List               // *keyHits, most recently used first
+}
+
+// keyHits is the hit count of a key
+type keyHits struct {
+	key  string
+	hits int
+}
+
+// track returns the hit count of key, creating it if needed, and marks it
+// as recently used. The caller must hold a.mu.
+func (a *adaptiveTTL) track(key string) (*keyHits, bool) {
+	if e, ok := a.hits[key]; ok {
+		a.order.MoveToFront(e)
+		return e.Value.(*keyHits), true
+	}
+	kh := &keyHits{key: key}
+	a.hits[key] = a.order.PushFront(kh)
+	for a.order.Len() > a.policy.MaxKeys {
+		oldest := a.order.Back()
+		a.order.Remove(oldest)
+		delete(a.hits, oldest.Value.(*keyHits).key)
+	}
+	return kh, false
+}
+
+// ttlForSet returns the TTL to use for a new write of key and starts a new
+// lifetime for it
+func (a *adaptiveTTL) ttlForSet(key string, ttl time.Duration) time.Duration {
+	a.mu.Lock()
+	kh, seen := a.track(key)
+	hits := kh.hits
+	kh.hits = 0
+	a.mu.Unlock()
+
+	p := a.policy
+	if !seen || hits > p.ColdHits || p.ShrinkFactor <= 0 || p.ShrinkFactor >= 1 {
+		return ttl
+	}
+
+	shrunk := time.Duration(float64(ttl) * p.ShrinkFactor)
+	if shrunk < p.MinTTL {
+		shrunk = p.MinTTL
+	}
+	if shrunk > ttl {
+		return ttl
+	}
+	return shrunk
+}
+
+// recordHit counts a read of item and extends its expiry when it becomes
+// hot. It reports whether item was modified and needs to be written back.
+func (a *adaptiveTTL) recordHit(item *CacheItem, now time.Time) bool {
+	p := a.policy
+	a.mu.Lock()
+	kh, _ := a.track(item.Key)
+	kh.hits++
+	hits := kh.hits
+	a.mu.Unlock()
+
+	if p.HotHits <= 0 || p.Extension <= 0 || hits%p.HotHits != 0 {
+		return false
+	}
+
+	expireAt := now.Add(p.Extension)
+	if p.MaxTTL > 0 {
+		if limit := item.Created.Add(p.MaxTTL); expireAt.After(limit) {
+			expireAt = limit
+		}
+	}
+	if !expireAt.After(item.ExpireAt) {
+		return false
+	}
+
+	item.ExpireAt = expireAt
+	return true
+}
+
+// forget drops the hit count of key
+func (a *adaptiveTTL) forget(key string) {
+	a.mu.Lock()
+	if e, ok := a.hits[key]; ok {
+		a.order.Remove(e)
+		delete(a.hits, key)
+	}
+	a.mu.Unlock()
+}
@@ -0,0 +1,119 @@
+package pie_cache
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// readItem loads the raw item stored for key
+func readItem(t *testing.T, fc *FileCache, key string) CacheItem {
+	t.Helper()
+	filePath, err := fc.getFilePath(key)
+	if err != nil {
+		t.Fatalf("getFilePath failed: %v", err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var item CacheItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	return item
+}
+
+func TestAdaptiveTTL(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_adaptive")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithAdaptiveTTL(AdaptiveTTLPolicy{
+		MinTTL:       20 * time.Second,
+		MaxTTL:       2 * time.Hour,
+		HotHits:      2,
+		Extension:    time.Hour,
+		ColdHits:     0,
+		ShrinkFactor: 0.25,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Hot key: the second hit extends expiry by an hour
+	if err := cache.Set("hot", []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get("hot"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if item := readItem(t, cache, "hot"); time.Until(item.ExpireAt) < 50*time.Minute {
+		t.Errorf("Expected hot key to be extended, expires in %v", time.Until(item.ExpireAt))
+	}
+
+	// Cold key: never read, so its next lifetime is shortened (clamped at MinTTL)
+	if err := cache.Set("cold", []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := cache.Set("cold", []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	remaining := time.Until(readItem(t, cache, "cold").ExpireAt)
+	if remaining > 25*time.Second || remaining < 15*time.Second {
+		t.Errorf("Expected cold key TTL near MinTTL, got %v", remaining)
+	}
+}
+
+func TestAdaptiveTTLMaxTTL(t *testing.T) {
+	a := newAdaptiveTTL(AdaptiveTTLPolicy{MaxTTL: time.Minute, HotHits: 1, Extension: time.Hour})
+	now := time.Now()
+	item := &CacheItem{Key: "k", Created: now, ExpireAt: now.Add(time.Second)}
+	if !a.recordHit(item, now) {
+		t.Fatal("Expected extension")
+	}
+	if !item.ExpireAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected expiry capped at MaxTTL, got %v", item.ExpireAt.Sub(now))
+	}
+	if a.recordHit(item, now) {
+		t.Error("Expected no further extension past MaxTTL")
+	}
+}
+
+func TestAdaptiveTTLMaxKeys(t *testing.T) {
+	a := newAdaptiveTTL(AdaptiveTTLPolicy{HotHits: 100, MaxKeys: 2})
+	now := time.Now()
+	for _, key := range []string{"a", "b", "a", "c"} {
+		a.recordHit(&CacheItem{Key: key, Created: now, ExpireAt: now}, now)
+	}
+	if len(a.hits) != 2 || a.hits["b"] != nil || a.hits["a"] == nil {
+		t.Errorf("Expected the least recently read key dropped, got %d keys", len(a.hits))
+	}
+}
+
+func TestAdaptiveTTLConcurrentSet(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithAdaptiveTTL(AdaptiveTTLPolicy{HotHits: 1, Extension: time.Hour}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("k", []byte("old"))
+	name, _ := cache.entryName("k")
+	data, _ := store.Fetch(name)
+	item, _ := decodeItem(data)
+
+	// A Set landing between a read and its extension must survive it
+	_ = cache.Set("k", []byte("new"))
+	item.ExpireAt = item.ExpireAt.Add(time.Hour)
+	if err := cache.rewriteItem(name, data, item); err != errEntryChanged {
+		t.Errorf("Expected errEntryChanged, got %v", err)
+	}
+	if got, err := cache.GetString("k"); err != nil || got != "new" {
+		t.Errorf("Expected the concurrent value, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,132 @@
+package pie_cache
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+)
+
+// appendLeasePrefix holds the leases of keys being appended to
+const appendLeasePrefix = metaPrefix + "appends/"
+
+// appendLease is how long an append may hold its key across processes
+const appendLease = 10 * time.Second
+
+// appendStripes is the number of locks serializing appends in a process
+const appendStripes = 64
+
+// Append adds data to the end of the value stored under key, creating it
+// with the default TTL if it is missing or expired; an existing entry keeps
+// its expiry. Appends to the same key are serialized, across processes on
+// a LeaseStore, so none is lost to a concurrent one. Each call adds a
+// segment that GetSegments returns separately. Set replaces the value and
+// its segments.
+func (fc *FileCache) Append(key string, data []byte) error {
+	name, err := fc.entryName(key)
+	if err != nil {
+		return err
+	}
+
+	mu := &fc.appendLocks[appendStripe(key)]
+	mu.Lock()
+	defer mu.Unlock()
+	if ls, ok := fc.store.(LeaseStore); ok {
+		lease := appendLeasePrefix + leaseHash(key)
+		for {
+			release, ok, err := ls.Lease(lease, appendLease)
+			if err != nil {
+				return err
+			}
+			if ok {
+				defer release()
+				break
+			}
+			time.Sleep(fc.loadPolicy.Poll)
+		}
+	}
+
+	ctx := context.Background()
+	item := CacheItem{Key: key}
+	old, err := fc.readItem(ctx, key, false)
+	switch err {
+	case nil:
+		item = CacheItem{Key: key, ExpireAt: old.ExpireAt, Created: old.Created, Group: old.Group, Epoch: old.Epoch,
+			Deadline: old.Deadline, Cost: old.Cost, Tags: old.Tags, Priority: old.Priority, Provenance: old.Provenance}
+		item.Data = make([]byte, 0, len(old.Data)+len(data))
+		item.Data = append(item.Data, old.Data...)
+		item.Segments = append([]int(nil), old.Segments...)
+		if item.Segments == nil && len(old.Data) > 0 {
+			item.Segments = []int{len(old.Data)}
+		}
+		releaseItem(old)
+	case ErrNotFound, ErrExpired:
+		fc.stamp(&item, fc.ttl)
+	default:
+		return err
+	}
+	item.Data = append(item.Data, data...)
+	item.Segments = append(item.Segments, len(data))
+	if fc.async != nil {
+		// The queued value was read above and is part of the new one
+		fc.async.cancel(key)
+	}
+
+	size := len(item.Data)
+	if err := fc.checkSize(int64(size)); err != nil {
+		return fc.finishWrite(ctx, key, name, size, err)
+	}
+	if err := fc.checkSpace(); err != nil {
+		return fc.finishWrite(ctx, key, name, size, err)
+	}
+	value := item.Data
+	if fc.checksum {
+		item.Checksum = Checksum(item.Data)
+	}
+	if err = fc.encodeItem(&item); err == nil {
+		wmu := &fc.writeLocks[appendStripe(key)]
+		wmu.Lock()
+		err = fc.writeItem(name, &item)
+		wmu.Unlock()
+	}
+	if err = fc.finishWrite(ctx, key, name, size, err); err != nil {
+		return err
+	}
+	fc.mirrorSet(key, value, item.ExpireAt)
+	return nil
+}
+
+// GetSegments retrieves a cache item split into the parts added by Append.
+// A value written by Set is returned as a single segment.
+func (fc *FileCache) GetSegments(key string) ([][]byte, error) {
+	item, err := fc.getItem(context.Background(), key)
+	fc.recordRead(key, err)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseItem(item)
+
+	if item.Segments == nil {
+		return [][]byte{item.Data}, nil
+	}
+	segments := make([][]byte, 0, len(item.Segments))
+	off := 0
+	for _, n := range item.Segments {
+		if n < 0 || off+n > len(item.Data) {
+			return nil, ErrCorrupted
+		}
+		segments = append(segments, item.Data[off:off+n:off+n])
+		off += n
+	}
+	if off != len(item.Data) {
+		return nil, ErrCorrupted
+	}
+	return segments, nil
+}
+
+// appendStripe returns the index of the locks serializing appends to and
+// writes of key
+func appendStripe(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % appendStripes)
+}
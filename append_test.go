@@ -0,0 +1,74 @@
+package pie_cache
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppend(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_append")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithHotCache(8))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	other, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Appends from two caches sharing the directory are all kept
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := cache
+			if i%2 == 1 {
+				c = other
+			}
+			if err := c.Append("log", []byte(strconv.Itoa(i%10))); err != nil {
+				t.Errorf("Append failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	segments, err := cache.GetSegments("log")
+	if err != nil {
+		t.Fatalf("GetSegments failed: %v", err)
+	}
+	if len(segments) != 20 {
+		t.Errorf("Expected 20 segments, got %d", len(segments))
+	}
+	if data, _ := cache.Get("log"); len(data) != 20 {
+		t.Errorf("Expected 20 bytes, got %q", data)
+	}
+
+	// Appending keeps the expiry and treats a plain value as one segment
+	_ = cache.SetWithTTL("acc", []byte("ab"), time.Hour)
+	before, _ := cache.Inspect("acc")
+	if err := cache.Append("acc", []byte("cde")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	after, _ := cache.Inspect("acc")
+	if !after.ExpireAt.Equal(before.ExpireAt) {
+		t.Errorf("Expected the expiry kept, got %v instead of %v", after.ExpireAt, before.ExpireAt)
+	}
+	segments, err = cache.GetSegments("acc")
+	if err != nil || len(segments) != 2 || string(segments[0]) != "ab" || string(segments[1]) != "cde" {
+		t.Errorf("Expected segments ab and cde, got %q, %v", segments, err)
+	}
+
+	_ = cache.Set("acc", []byte("new"))
+	if segments, _ := cache.GetSegments("acc"); len(segments) != 1 || string(segments[0]) != "new" {
+		t.Errorf("Expected Set to replace the segments, got %q", segments)
+	}
+}
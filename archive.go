@@ -0,0 +1,173 @@
+package pie_cache
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Export writes the live entries of the cache to w as a tar archive, one
+// file per entry holding the entry as stored, metadata included. Wrap w in
+// a gzip.Writer for a tar.gz; Import reads both.
+func (fc *FileCache) Export(w io.Writer) error {
+	if err := fc.Flush(); err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	now := fc.now()
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			return nil
+		}
+		defer releaseItem(item)
+		if fc.isExpired(item, now) {
+			return nil
+		}
+
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: item.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write archive: %v", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return fmt.Errorf("failed to write archive: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	return nil
+}
+
+// metadataRecord is a line of ExportMetadata
+type metadataRecord struct {
+	Key      string    `json:"key"`
+	Size     int       `json:"size"`
+	Created  time.Time `json:"created"`
+	ExpireAt time.Time `json:"expireAt"`
+	Tags     []string  `json:"tags"`
+}
+
+// ExportMetadata writes one JSON object per line to w for every live
+// entry, with its key, payload size, creation and expiry time and tags,
+// the invalidation group it was written through. Payloads are not
+// written, so it is much cheaper than Export for analytics and capacity
+// planning.
+func (fc *FileCache) ExportMetadata(w io.Writer) error {
+	if err := fc.Flush(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	now := fc.now()
+	err := fc.walkItems(func(name string, item *CacheItem) error {
+		if fc.isExpired(item, now) {
+			return nil
+		}
+		rec := metadataRecord{Key: item.Key, Size: len(item.Data), Created: item.Created, ExpireAt: fc.retainUntil(item), Tags: []string{}}
+		if item.Group != "" {
+			rec.Tags = append(rec.Tags, item.Group)
+		}
+		rec.Tags = append(rec.Tags, item.Tags...)
+		if err := enc.Encode(&rec); err != nil {
+			return fmt.Errorf("failed to write metadata: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	return nil
+}
+
+// Import stores the entries of an archive written by Export, plain or
+// gzipped, and returns how many it stored. Entries keep their creation and
+// expiry times and replace what the cache holds for their keys; they are
+// placed where this cache's layout puts their keys, so archives move
+// between caches with different path schemes. Expired entries and entries
+// failing signature checks are skipped.
+func (fc *FileCache) Import(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read archive: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	imported := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return imported, nil
+		}
+		if err != nil {
+			return imported, fmt.Errorf("failed to read archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return imported, fmt.Errorf("failed to read archive: %v", err)
+		}
+		ok, err := fc.importEntry(hdr.Name, data)
+		if err != nil {
+			return imported, err
+		}
+		if ok {
+			imported++
+		}
+	}
+}
+
+// importEntry stores an entry read from an archive member named name and
+// reports whether it was stored
+func (fc *FileCache) importEntry(name string, data []byte) (bool, error) {
+	item, err := decodeItem(data)
+	if err == nil {
+		err = fc.verify(item)
+	}
+	if err != nil {
+		fc.logEvent(Event{Type: EventCorrupt, Path: name, Err: err})
+		return false, nil
+	}
+	defer releaseItem(item)
+	if fc.isExpired(item, fc.now()) {
+		return false, nil
+	}
+
+	want, err := fc.entryName(item.Key)
+	if err != nil {
+		return false, nil
+	}
+	if fc.async != nil {
+		fc.async.cancel(item.Key)
+	}
+	err = fc.store.Put(want, data)
+	if err == nil {
+		fc.stored(want, item, len(item.Data), len(data))
+	}
+	return err == nil, fc.finishWrite(context.Background(), item.Key, want, len(item.Data), err)
+}
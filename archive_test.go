@@ -0,0 +1,94 @@
+package pie_cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	src, err := NewWithStore(NewMemoryStore(), time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = src.SetWithTTL("a", []byte("alpha"), time.Hour)
+	_ = src.SetFromReader("b", bytes.NewReader([]byte("beta")), time.Hour)
+	_ = src.SetWithTTL("gone", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	var plain, zipped bytes.Buffer
+	if err := src.Export(&plain); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	zw := gzip.NewWriter(&zipped)
+	if err := src.Export(zw); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	zw.Close()
+
+	for _, archive := range []*bytes.Buffer{&plain, &zipped} {
+		dst, err := NewWithStore(NewMemoryStore(), time.Minute, WithPathScheme(1, 4), WithIndex(2))
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		n, err := dst.Import(archive)
+		if err != nil || n != 2 {
+			t.Fatalf("Expected 2 entries imported, got %d, %v", n, err)
+		}
+		for key, want := range map[string]string{"a": "alpha", "b": "beta"} {
+			if v, err := dst.GetString(key); err != nil || v != want {
+				t.Errorf("Get(%q) returned %q, %v", key, v, err)
+			}
+		}
+		meta, _ := dst.Inspect("a")
+		if meta.TTLRemaining(time.Now()) < 59*time.Minute {
+			t.Errorf("Expected the expiry preserved, got %v", meta.ExpireAt)
+		}
+		if keys, _ := dst.ListKeys(); len(keys) != 2 {
+			t.Errorf("Expected the imported keys indexed, got %v", keys)
+		}
+	}
+}
+
+func TestExportMetadata(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache, err := NewMemoryCache(time.Minute, WithClock(clock))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	_ = cache.SetWithTTL("a", []byte("alpha"), time.Hour)
+	_ = cache.Group("pages").Set("b", []byte("beta"))
+	_ = cache.SetWithTTL("gone", []byte("x"), time.Second)
+	clock.Advance(2 * time.Second)
+
+	var buf bytes.Buffer
+	if err := cache.ExportMetadata(&buf); err != nil {
+		t.Fatalf("ExportMetadata failed: %v", err)
+	}
+	records := map[string]metadataRecord{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec metadataRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("Failed to decode line: %v", err)
+		}
+		records[rec.Key] = rec
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 live entries, got %v", records)
+	}
+	a := records["a"]
+	if a.Size != 5 || !a.Created.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !a.ExpireAt.Equal(a.Created.Add(time.Hour)) || len(a.Tags) != 0 {
+		t.Errorf("Unexpected record %+v", a)
+	}
+	if b := records["b"]; len(b.Tags) != 1 || b.Tags[0] != "pages" {
+		t.Errorf("Expected b tagged with its group, got %+v", b)
+	}
+	if strings.Contains(buf.String(), "alpha") {
+		t.Error("Expected no payloads in the export")
+	}
+}
@@ -0,0 +1,194 @@
+package pie_cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithAsyncWrites makes Set and SetWithTTL return as soon as the write is
+// queued, leaving workers goroutines to persist it with the retry policy of
+// WithWriteRetry. Reads see queued writes. At most queue writes wait at
+// a time; once the queue is full, Set writes synchronously instead of
+// dropping the value. A failed write is reported by the next Flush and as
+// an EventWriteFailed event. Close writes everything still queued.
+func WithAsyncWrites(queue, workers int) Option {
+	return func(fc *FileCache) {
+		if queue > 0 {
+			fc.asyncQueue, fc.asyncWorkers = queue, max(workers, 1)
+		}
+	}
+}
+
+// asyncWrite is a queued Set
+type asyncWrite struct {
+	ctx  context.Context
+	item CacheItem
+}
+
+// asyncWriter persists queued writes in the background
+type asyncWriter struct {
+	fc    *FileCache
+	queue chan *asyncWrite
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[string]*asyncWrite // Latest queued write by key
+	writing map[string]bool        // Keys a worker is writing
+	closed  bool
+	err     error // First failure since the last Flush
+}
+
+// startAsyncWrites starts the write workers if WithAsyncWrites was given
+func (fc *FileCache) startAsyncWrites() {
+	if fc.asyncQueue == 0 {
+		return
+	}
+	w := &asyncWriter{
+		fc:      fc,
+		queue:   make(chan *asyncWrite, fc.asyncQueue),
+		pending: make(map[string]*asyncWrite),
+		writing: make(map[string]bool),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	for i := 0; i < fc.asyncWorkers; i++ {
+		w.wg.Add(1)
+		go w.run()
+	}
+	fc.async = w
+}
+
+// enqueue queues a write of data under key and reports whether it did.
+// It does not when the queue is full or closed.
+func (w *asyncWriter) enqueue(ctx context.Context, key string, data []byte, ttl time.Duration) bool {
+	now := w.fc.now()
+	// The write outlives the call, so only the values of ctx are kept
+	aw := &asyncWrite{ctx: context.WithoutCancel(ctx), item: CacheItem{Key: key, Data: copyBytes(data), Created: now, ExpireAt: now.Add(ttl)}}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.queue <- aw:
+		// A write still queued for the key is skipped by the worker
+		w.pending[key] = aw
+		return true
+	default:
+		return false
+	}
+}
+
+// run writes queued entries until the queue is closed
+func (w *asyncWriter) run() {
+	defer w.wg.Done()
+	for aw := range w.queue {
+		key := aw.item.Key
+		w.mu.Lock()
+		// Keep writes of a key in order across workers
+		for w.writing[key] {
+			w.cond.Wait()
+		}
+		if w.pending[key] != aw {
+			w.mu.Unlock()
+			continue
+		}
+		w.writing[key] = true
+		w.mu.Unlock()
+
+		var err error
+		if ttl := aw.item.ExpireAt.Sub(w.fc.now()); ttl > 0 {
+			err = w.fc.setWithRetry(aw.ctx, key, aw.item.Data, ttl)
+		}
+
+		w.mu.Lock()
+		delete(w.writing, key)
+		if w.pending[key] == aw {
+			delete(w.pending, key)
+		}
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+// lookup returns the queued value of key, if any
+func (w *asyncWriter) lookup(key string) (CacheItem, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	aw, ok := w.pending[key]
+	if !ok {
+		return CacheItem{}, false
+	}
+	item := aw.item
+	item.Data = copyBytes(item.Data)
+	return item, true
+}
+
+// cancel drops the queued write of key and waits for one in progress, so
+// that a synchronous write or delete that follows is not overtaken. It
+// reports whether a write was dropped.
+func (w *asyncWriter) cancel(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, dropped := w.pending[key]
+	delete(w.pending, key)
+	for w.writing[key] {
+		w.cond.Wait()
+	}
+	return dropped
+}
+
+// take drops the queued write of key like cancel and returns its value
+func (w *asyncWriter) take(key string) (CacheItem, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	aw, ok := w.pending[key]
+	delete(w.pending, key)
+	for w.writing[key] {
+		w.cond.Wait()
+	}
+	if !ok {
+		return CacheItem{}, false
+	}
+	return aw.item, true
+}
+
+// flush waits until every queued write is done and returns the first
+// failure since the previous flush
+func (w *asyncWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) > 0 || len(w.writing) > 0 {
+		w.cond.Wait()
+	}
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// close writes the queued entries and stops the workers
+func (w *asyncWriter) close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	return w.flush()
+}
+
+// Flush waits until the writes queued by WithAsyncWrites are on disk and
+// returns the first error among them since the previous Flush. It does
+// nothing on caches without async writes.
+func (fc *FileCache) Flush() error {
+	if fc.async == nil {
+		return nil
+	}
+	return fc.async.flush()
+}
@@ -0,0 +1,119 @@
+package pie_cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowStore delays every Put until released
+type slowStore struct {
+	*MemoryStore
+	gate chan struct{}
+}
+
+func (s *slowStore) Put(name string, data []byte) error {
+	if !isMetaName(name) {
+		<-s.gate
+	}
+	return s.MemoryStore.Put(name, data)
+}
+
+func TestAsyncWrites(t *testing.T) {
+	store := &slowStore{MemoryStore: NewMemoryStore(), gate: make(chan struct{})}
+	cache, err := NewWithStore(store, time.Minute, WithAsyncWrites(2, 1))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Set returns before the store accepts the write, and reads see it
+	if err := cache.Set("a", []byte("1")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, err := cache.GetString("a"); err != nil || v != "1" {
+		t.Errorf("Expected queued value, got %q, %v", v, err)
+	}
+	if !cache.Exists("a") {
+		t.Error("Expected queued key to exist")
+	}
+	name, _ := cache.entryName("a")
+	if _, err := store.MemoryStore.Fetch(name); err != ErrNotFound {
+		t.Errorf("Expected a not to be stored yet, got %v", err)
+	}
+
+	// Deleting a queued key drops the write
+	_ = cache.Set("b", []byte("2"))
+	if err := cache.Delete("b"); err != nil {
+		t.Errorf("Delete of queued key failed: %v", err)
+	}
+	if _, err := cache.Get("b"); err != ErrNotFound {
+		t.Errorf("Expected b to be gone, got %v", err)
+	}
+
+	close(store.gate)
+	if err := cache.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if _, err := store.MemoryStore.Fetch(name); err != nil {
+		t.Errorf("Expected a to be stored after Flush, got %v", err)
+	}
+	bName, _ := cache.entryName("b")
+	if _, err := store.MemoryStore.Fetch(bName); err != ErrNotFound {
+		t.Errorf("Expected deleted b not to be written, got %v", err)
+	}
+
+	// Later writes of a key win, even with the queue overflowing
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = cache.Set(fmt.Sprintf("k%d", i), []byte("v"))
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 50; i++ {
+		_ = cache.Set("c", []byte(fmt.Sprint(i)))
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if v, err := cache.GetString("c"); err != nil || v != "49" {
+		t.Errorf("Expected last write of c, got %q, %v", v, err)
+	}
+	for i := 0; i < 4; i++ {
+		if !cache.Exists(fmt.Sprintf("k%d", i)) {
+			t.Errorf("Expected k%d to be written", i)
+		}
+	}
+
+	// After Close, Set writes synchronously
+	if err := cache.Set("d", []byte("4")); err != nil {
+		t.Fatalf("Set after Close failed: %v", err)
+	}
+	dName, _ := cache.entryName("d")
+	if _, err := store.MemoryStore.Fetch(dName); err != nil {
+		t.Errorf("Expected d to be stored, got %v", err)
+	}
+}
+
+func TestAsyncWriteFailure(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Minute, WithAsyncWrites(4, 2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	store.mu.Lock()
+	store.failures = 1
+	store.mu.Unlock()
+	_ = cache.Set("a", []byte("1"))
+	if err := cache.Flush(); err == nil {
+		t.Error("Expected Flush to report the failed write")
+	}
+	if err := cache.Flush(); err != nil {
+		t.Errorf("Expected the failure to be reported once, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package pie_cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultBatchParallelism bounds batch operations unless configured
+const defaultBatchParallelism = 8
+
+// WithBatchParallelism bounds how many entries batch operations such as
+// GetMulti and SetMulti process concurrently
+func WithBatchParallelism(n int) Option {
+	return func(fc *FileCache) {
+		if n > 0 {
+			fc.batchParallelism = n
+		}
+	}
+}
+
+// runBatch calls fn for indexes 0..n-1 with the configured parallelism
+func (fc *FileCache) runBatch(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	limit := fc.batchParallelism
+	if limit <= 0 {
+		limit = defaultBatchParallelism
+	}
+	return fc.runLimited(ctx, limit, n, fn)
+}
+
+// runLimited calls fn for indexes 0..n-1 with at most limit calls running
+// at once. It stops scheduling work on the first error or when ctx is
+// done, and only returns once every started call has finished, so no
+// goroutines outlive it.
+func (fc *FileCache) runLimited(ctx context.Context, limit, n int, fn func(ctx context.Context, i int) error) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+	for i := 0; i < n; i++ {
+		if gctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			return fn(gctx, i)
+		})
+	}
+	err := g.Wait()
+	// Report the caller's cancellation rather than the derived context's
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// GetMulti retrieves several keys concurrently. Missing and expired keys
+// are left out of the result. If ctx is cancelled, outstanding reads are
+// abandoned and ctx.Err() is returned.
+func (fc *FileCache) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	var mu sync.Mutex
+	result := make(map[string][]byte, len(keys))
+
+	err := fc.runBatch(ctx, len(keys), func(ctx context.Context, i int) error {
+		data, err := fc.GetContext(ctx, keys[i])
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		result[keys[i]] = data
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetMulti writes several items with the default TTL concurrently and
+// returns the first error. Items already written stay in the cache when a
+// later one fails or ctx is cancelled.
+func (fc *FileCache) SetMulti(ctx context.Context, items map[string][]byte) error {
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	return fc.runBatch(ctx, len(keys), func(ctx context.Context, i int) error {
+		return fc.SetContext(ctx, keys[i], items[keys[i]])
+	})
+}
@@ -0,0 +1,82 @@
+package pie_cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_batch")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithBatchParallelism(3))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	items := map[string][]byte{}
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		items[key] = []byte(fmt.Sprintf("value%d", i))
+		keys = append(keys, key)
+	}
+	if err := cache.SetMulti(context.Background(), items); err != nil {
+		t.Fatalf("SetMulti failed: %v", err)
+	}
+
+	got, err := cache.GetMulti(context.Background(), append(keys, "missing"))
+	if err != nil {
+		t.Fatalf("GetMulti failed: %v", err)
+	}
+	if len(got) != len(items) {
+		t.Errorf("Expected %d results, got %d", len(items), len(got))
+	}
+	for k, v := range items {
+		if string(got[k]) != string(v) {
+			t.Errorf("Expected %q for %s, got %q", v, k, got[k])
+		}
+	}
+
+	// A caller that has already given up gets its error back and no
+	// goroutines are left behind
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.GetMulti(ctx, keys); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from GetMulti, got %v", err)
+	}
+	if err := cache.SetMulti(ctx, items); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from SetMulti, got %v", err)
+	}
+
+	// Cancelling mid-batch stops scheduling further work
+	ctx, cancel = context.WithCancel(context.Background())
+	var calls atomic.Int32
+	err = cache.runBatch(ctx, 100, func(ctx context.Context, i int) error {
+		if i == 5 {
+			cancel()
+		}
+		calls.Add(1)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled from runBatch, got %v", err)
+	}
+	if calls.Load() >= 100 {
+		t.Errorf("Expected cancellation to stop the batch early, ran %d calls", calls.Load())
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected no leaked goroutines, had %d before and %d after", before, after)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/ser163/pie_cache/boltstore
+
+go 1.24.1
+
+require (
+	github.com/ser163/pie_cache v0.0.0
+	go.etcd.io/bbolt v1.4.3
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	golang.org/x/sync v0.19.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
+
+replace github.com/ser163/pie_cache => ../
@@ -0,0 +1,146 @@
+// Package boltstore implements a pie_cache.Store in a single bbolt database
+// file, for filesystems where millions of small cache files exhaust inodes
+// or make directory walks slow.
+package boltstore
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ser163/pie_cache"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketName = []byte("entries")
+
+// walkBatch is how many entries Walk reads per read transaction
+const walkBatch = 256
+
+// Store is a pie_cache.Store backed by a bbolt database
+type Store struct {
+	db *bolt.DB
+}
+
+var _ pie_cache.SeekStore = (*Store)(nil)
+
+// Open opens or creates the database file at path. Only one process may
+// have the file open at a time; Open waits up to a second for the lock.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise cache database: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put implements pie_cache.Store
+func (s *Store) Put(name string, data []byte) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(name), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+	return nil
+}
+
+// Fetch implements pie_cache.Store
+func (s *Store) Fetch(name string) ([]byte, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketName).Get([]byte(name)); v != nil {
+			// Values are only valid inside the transaction
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry: %v", err)
+	}
+	if data == nil {
+		return nil, pie_cache.ErrNotFound
+	}
+	return data, nil
+}
+
+// Remove implements pie_cache.Store
+func (s *Store) Remove(name string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		if b.Get([]byte(name)) == nil {
+			return pie_cache.ErrNotFound
+		}
+		return b.Delete([]byte(name))
+	})
+	if err == pie_cache.ErrNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete cache entry: %v", err)
+	}
+	return nil
+}
+
+type kv struct {
+	name string
+	data []byte
+}
+
+// Walk implements pie_cache.Store. Entries are read in batches and fn is
+// called outside any transaction, so it may modify the store.
+func (s *Store) Walk(prefix string, fn func(name string, data []byte) error) error {
+	return s.WalkAfter(prefix, "", fn)
+}
+
+// WalkAfter implements pie_cache.SeekStore
+func (s *Store) WalkAfter(prefix, after string, fn func(name string, data []byte) error) error {
+	p := []byte(prefix)
+	start := p
+	first := true
+	if after > prefix {
+		start, first = []byte(after), false
+	}
+
+	for {
+		var batch []kv
+		err := s.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(bucketName).Cursor()
+			k, v := c.Seek(start)
+			if !first && k != nil && bytes.Equal(k, start) {
+				k, v = c.Next()
+			}
+			for ; k != nil && bytes.HasPrefix(k, p) && len(batch) < walkBatch; k, v = c.Next() {
+				batch = append(batch, kv{name: string(k), data: append([]byte(nil), v...)})
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to walk cache entries: %v", err)
+		}
+
+		for _, e := range batch {
+			if err := fn(e.name, e.data); err != nil {
+				return err
+			}
+		}
+		if len(batch) < walkBatch {
+			return nil
+		}
+		start = []byte(batch[len(batch)-1].name)
+		first = false
+	}
+}
@@ -0,0 +1,82 @@
+package boltstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Fetch("missing"); err != pie_cache.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.Remove("missing"); err != pie_cache.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// More entries than one walk batch, removed while walking
+	for i := 0; i < walkBatch*2+10; i++ {
+		if err := store.Put(fmt.Sprintf("aa/%04d", i), []byte("x")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	_ = store.Put("bb/1", []byte("y"))
+
+	after := 0
+	err = store.WalkAfter("", fmt.Sprintf("aa/%04d", walkBatch), func(name string, data []byte) error {
+		after++
+		return nil
+	})
+	if err != nil || after != walkBatch+10 {
+		t.Errorf("WalkAfter visited %d entries, %v", after, err)
+	}
+
+	seen := 0
+	last := ""
+	err = store.Walk("aa/", func(name string, data []byte) error {
+		if name <= last {
+			t.Fatalf("Walk out of order: %q after %q", name, last)
+		}
+		last = name
+		seen++
+		return store.Remove(name)
+	})
+	if err != nil || seen != walkBatch*2+10 {
+		t.Errorf("Walk visited %d entries, %v", seen, err)
+	}
+	if data, err := store.Fetch("bb/1"); err != nil || string(data) != "y" {
+		t.Errorf("Fetch returned %q, %v", data, err)
+	}
+}
+
+func TestCacheOnBolt(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	cache, err := pie_cache.NewWithStore(store, time.Minute)
+	if err != nil {
+		t.Fatalf("NewWithStore failed: %v", err)
+	}
+	_ = cache.Set("k", []byte("v"))
+	_ = cache.SetWithTTL("short", []byte("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	keys, _ := cache.ListKeys()
+	if len(keys) != 1 || keys[0] != "k" {
+		t.Errorf("ListKeys returned %v", keys)
+	}
+}
@@ -1,48 +1,289 @@
 package pie_cache
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrNotFound is returned when a key is not in the cache
+	ErrNotFound = errors.New("cache not found")
+	// ErrExpired is returned when a key is in the cache but has expired
+	ErrExpired = errors.New("cache expired")
+	// ErrInvalidKey is returned for keys that are empty or longer than
+	// MaxKeyLength or the limit of WithMaxKeyLength
+	ErrInvalidKey = errors.New("cache key invalid")
+	// ErrCollision is returned when the entry stored where a key maps to
+	// belongs to another key, e.g. one differing only in case on a
+	// case-insensitive file system
+	ErrCollision = errors.New("cache key collision")
 )
 
+// MaxKeyLength is the length in bytes of the longest key the cache accepts
+const MaxKeyLength = 4096
+
+// maxFileNameLength leaves room below the common 255 byte file name limit
+// for the temporary file prefix
+const maxFileNameLength = 200
+
+// hashedNamePrefix starts the file names of keys that are stored under
+// their hash
+const hashedNamePrefix = "~"
+
 // CacheItem represents an item in the cache
 type CacheItem struct {
-	Key      string    `json:"key"`      // Cache key
-	Data     []byte    `json:"data"`     // Cached data
-	ExpireAt time.Time `json:"expireAt"` // Expiration time
-	Created  time.Time `json:"created"`  // Creation time
+	Key       string    `json:"key"`               // Cache key
+	Data      []byte    `json:"data"`              // Cached data
+	ExpireAt  time.Time `json:"expireAt"`          // Expiration time
+	Created   time.Time `json:"created"`           // Creation time
+	Signature string    `json:"sig,omitempty"`     // HMAC of the entry when signing is enabled
+	Group     string    `json:"group,omitempty"`   // Invalidation group, if any
+	Epoch     int64     `json:"epoch,omitempty"`   // Group epoch the entry was written in
+	Encoding  string    `json:"enc,omitempty"`     // Transform applied to Data, if any
+	Checksum  string    `json:"sum,omitempty"`     // CRC-32C of the payload when checksums are enabled
+	Deadline  time.Time `json:"deadline,omitzero"` // Time no extension may push the expiry past, if any
+	Cost      float64   `json:"cost,omitempty"`    // Cost of recomputing the value, from SetWithCost
+	Segments  []int     `json:"segs,omitempty"`    // Sizes of the parts added by Append, if any
+	Tags      []string  `json:"tags,omitempty"`    // Labels from WithTagsOpt, if any
+	Priority  Priority  `json:"prio,omitempty"`    // Eviction priority from WithPriority
+
+	Provenance *Provenance `json:"prov,omitempty"` // Writer of the entry when recorded
+}
+
+// metaPrefix starts the store names the cache uses for its own bookkeeping.
+// Entry walks skip them.
+const metaPrefix = "_pie/"
+
+// isMetaName reports whether name holds cache bookkeeping rather than an entry
+func isMetaName(name string) bool {
+	return strings.HasPrefix(name, metaPrefix)
 }
 
 // FileCache represents a file-based cache system
 type FileCache struct {
-	baseDir     string        // Base directory for cache files
-	ttl         time.Duration // Default time-to-live for cache items
-	dirLevels   int           // Number of directory levels
-	prefixLen   int           // Length of directory name prefixes
-	purgeOnLoad bool          // Whether to purge expired items on load
+	store         Store         // Backend holding encoded entries
+	baseDir       string        // Base directory for cache files, empty for non-file stores
+	ttl           time.Duration // Default time-to-live for cache items
+	dirLevels     int           // Number of directory levels
+	prefixLen     int           // Length of directory name prefixes
+	purgeOnLoad   bool          // Whether to purge expired items on load
+	readOnly      bool          // Reject every change, from WithReadOnly
+	hot           *hotCache     // Optional in-process cache of decoded payloads
+	adaptive      *adaptiveTTL  // Optional hit-rate based TTL tuning
+	stats         cacheStats    // Operation counters
+	readMode      ReadMode      // Ownership of slices returned by Get
+	mutationCheck bool          // Detect callers modifying shared payloads
+	logger        Logger        // Optional receiver of cache events
+	logKey        keyRedactor   // Rewrites keys in logged events, nil to log them as is
+	signingKey    []byte        // HMAC secret for entry signatures
+
+	batchParallelism int // Concurrency bound for batch operations
+
+	janitorInterval time.Duration               // Period of background purges, 0 to disable
+	pacing          *JanitorPacing              // Adaptive janitor bounds, nil for a fixed interval
+	pace            atomic.Pointer[janitorPace] // Current janitor pace
+	expiryQueue     chan string                 // Expired entries awaiting deferred deletion
+	janitorStop     chan struct{}               // Closed by Close to stop the janitor
+	janitorDone     chan struct{}               // Closed when the janitor has exited
+	closeOnce       sync.Once
+
+	provenance bool   // Record the writer of each entry
+	hostname   string // Cached hostname for provenance
+
+	indexShards  int       // Number of key index shards, 0 without index
+	compactIndex bool      // Index key fingerprints instead of keys
+	index        *keyIndex // Optional sharded key index
+
+	indexCheck     bool // Compare index and entries on open
+	indexReconcile bool // Fix divergences the open check finds
+
+	transformPolicy TransformPolicy // Configured payload transforms
+	transforms      *transformer    // Compiled transformPolicy
+
+	retry RetryPolicy // Retries of background writes
+
+	prefetch int            // Entries to load into the hot cache on open
+	access   *accessTracker // Read counts per key, with WithPrefetch
+
+	loadPolicy LoadPolicy         // Coordination of GetOrLoad across processes
+	loads      singleflight.Group // GetOrLoad calls in flight, by key
+
+	purgeListener func(key string) // Told about every purged key
+	secondary     CacheInterface   // Mirror of writes and deletes, from WithSecondary
+
+	checksum      bool // Store and check payload checksums
+	removeCorrupt bool // Delete entries reads find damaged
+
+	hash          HashFunc      // Hash naming the directories of entries
+	keyNormalizer KeyNormalizer // Maps keys to what hash places them by, nil for the identity
+	layoutPolicy  LayoutPolicy  // What to do when the stored layout differs
+
+	readRepair bool // Fix entries whose metadata drifted on read
+
+	maxValueSize int64          // Largest payload accepted, 0 for no limit
+	maxKeyLength int            // Longest key accepted, 0 for MaxKeyLength
+	space        *spaceGuard    // Nil unless WithMinFreeSpace is set
+	maxAge       time.Duration  // Longest time any entry is kept, 0 for no cap
+	ttlJitter    float64        // Fraction TTLs are spread by
+	maxSize      int64          // Most bytes entries may take, 0 for no limit
+	maxEntries   int            // Most entries kept, 0 for no limit
+	maxFiles     int            // Most inodes entries and their directories may take, 0 for no limit
+	quota        *quotaState    // Nil unless WithSoftQuota is set
+	scorer       EvictionScorer // Order of eviction under the size limits, nil for ExpiryScorer
+
+	loader    LoaderFunc            // Loads misses of Get, from WithLoader
+	loadersMu sync.RWMutex          // Guards loaders
+	loaders   map[string]LoaderFunc // Loaders of Get by namespace
+	refresh   *refreshAhead         // Nil unless WithRefreshAhead is set
+
+	refreshLimit int // Most refresh-ahead reloads at once, 0 for no limit
+
+	clock     Clock           // Time source of stamps and expiry, nil for the wall clock
+	monotonic *monotonicClock // Bound on the time expiry is checked against, from WithMonotonicExpiry
+
+	appendLocks [appendStripes]sync.Mutex // Serialize appends by key hash
+	writeLocks  [appendStripes]sync.Mutex // Serialize writes with rewrites of what a read found, by key hash
+	idle        *idleWatch                // Nil unless WithHibernateAfter is set
+
+	stampedes *stampedeDetector // Nil unless WithStampedeDetection is set
+
+	groups groupEpochs // Cached epochs of invalidation groups
+
+	asyncQueue   int          // Queued writes allowed by WithAsyncWrites
+	asyncWorkers int          // Goroutines persisting queued writes
+	async        *asyncWriter // Nil unless WithAsyncWrites is set
+}
+
+// Option configures a FileCache
+type Option func(*FileCache)
+
+// WithHotCache keeps the payloads of the last n read items in memory so
+// repeated reads skip the file read and JSON decode. Entries honour their
+// expiration time; writes from other processes are not observed until the
+// in-memory copy expires.
+func WithHotCache(n int) Option {
+	return func(fc *FileCache) {
+		if n > 0 {
+			fc.hot = newHotCache(n)
+		}
+	}
+}
+
+// WithPathScheme spreads entries over levels directories, each named by the
+// next prefixLen characters of the key hash. The default is 3 levels of 2;
+// small caches do well with fewer. Like WithHash, changing it on an
+// existing cache needs Relocate.
+func WithPathScheme(levels, prefixLen int) Option {
+	return func(fc *FileCache) {
+		fc.dirLevels = levels
+		fc.prefixLen = prefixLen
+	}
+}
+
+// validateLayout checks that the directory layout fits in a key hash of
+// hashLen hex characters
+func validateLayout(levels, prefixLen, hashLen int) error {
+	if levels < 0 {
+		return fmt.Errorf("invalid directory levels %d: must be 0 or more", levels)
+	}
+	if levels == 0 {
+		return nil
+	}
+	if prefixLen < 1 {
+		return fmt.Errorf("invalid prefix length %d: must be between 1 and %d for %d levels",
+			prefixLen, hashLen/levels, levels)
+	}
+	if levels*prefixLen > hashLen {
+		if levels > hashLen {
+			return fmt.Errorf("invalid directory levels %d: must be at most %d", levels, hashLen)
+		}
+		return fmt.Errorf("invalid layout: %d levels of %d characters need %d hash characters but only %d exist; use a prefix length between 1 and %d",
+			levels, prefixLen, levels*prefixLen, hashLen, hashLen/levels)
+	}
+	return nil
 }
 
 // NewFileCache creates a new FileCache instance
-func NewFileCache(baseDir string, ttl time.Duration) (*FileCache, error) {
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+func NewFileCache(baseDir string, ttl time.Duration, opts ...Option) (*FileCache, error) {
+	store, err := NewFileStore(baseDir)
+	if err != nil {
+		return nil, err
 	}
 
+	cache, err := NewWithStore(store, ttl, opts...)
+	if err != nil {
+		return nil, err
+	}
+	cache.baseDir = baseDir
+
+	return cache, nil
+}
+
+// NewWithStore creates a cache on top of an arbitrary Store, keeping the
+// same TTL, encoding and maintenance behaviour as NewFileCache. Calls to a
+// store reporting through ConcurrencyReporter that it is not safe for
+// concurrent use are serialized.
+func NewWithStore(store Store, ttl time.Duration, opts ...Option) (*FileCache, error) {
+	if !concurrentSafe(store) {
+		store = &lockedStore{store: store}
+	}
 	cache := &FileCache{
-		baseDir:     baseDir,
+		store:       store,
 		ttl:         ttl,
 		dirLevels:   3,    // Three-level directory structure
 		prefixLen:   2,    // 2-character prefix for each level
 		purgeOnLoad: true, // Purge expired items by default
+		loadPolicy:  defaultLoadPolicy,
+	}
+
+	for _, opt := range opts {
+		opt(cache)
+	}
+	if cache.readOnly {
+		cache.store = readOnlyStore{store: cache.store}
+	}
+	if err := validateLayout(cache.dirLevels, cache.prefixLen, cache.hash.hexLen()); err != nil {
+		return nil, err
+	}
+	if err := cache.compileTransforms(); err != nil {
+		return nil, err
 	}
+	if cache.hot != nil {
+		cache.hot.verify = cache.mutationCheck
+	}
+	if cache.indexShards > 0 {
+		if err := cache.openIndex(); err != nil {
+			return nil, err
+		}
+	} else if cache.quota != nil {
+		return nil, errQuotaNeedsIndex
+	}
+	if err := cache.checkIndexOnOpen(); err != nil {
+		return nil, err
+	}
+	if err := cache.checkLayout(); err != nil {
+		return nil, err
+	}
+	if cache.access != nil {
+		cache.loadAccessStats()
+	}
+	cache.startAsyncWrites()
+	cache.startJanitor()
+	cache.startIdleWatch()
 
 	return cache, nil
 }
@@ -52,66 +293,334 @@ func (fc *FileCache) Set(key string, data []byte) error {
 	return fc.SetWithTTL(key, data, fc.ttl)
 }
 
+// SetContext is Set tagging the events it logs with the trace ID of ctx
+func (fc *FileCache) SetContext(ctx context.Context, key string, data []byte) error {
+	return fc.SetWithTTLContext(ctx, key, data, fc.ttl)
+}
+
 // SetWithTTL adds or updates a cache item with specified TTL
 func (fc *FileCache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
-	expireAt := time.Now().Add(ttl)
+	return fc.SetWithTTLContext(context.Background(), key, data, ttl)
+}
 
-	item := CacheItem{
-		Key:      key,
-		Data:     data,
-		ExpireAt: expireAt,
-		Created:  time.Now(),
+// SetWithTTLContext is SetWithTTL tagging the events it logs with the
+// trace ID of ctx
+func (fc *FileCache) SetWithTTLContext(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if fc.async != nil {
+		if _, err := fc.entryName(key); err != nil {
+			return err
+		}
+		if err := fc.checkSize(int64(len(data))); err != nil {
+			return err
+		}
+		if err := fc.checkSpace(); err != nil {
+			return err
+		}
+		if fc.async.enqueue(ctx, key, data, ttl) {
+			return nil
+		}
+		fc.async.cancel(key)
 	}
+	return fc.set(ctx, CacheItem{Key: key, Data: data}, ttl)
+}
+
+// set stamps item with its creation and expiration time and writes it
+func (fc *FileCache) set(ctx context.Context, item CacheItem, ttl time.Duration) error {
+	return fc.setItem(ctx, item, ttl, true)
+}
 
-	filePath, err := fc.getFilePath(key)
+// setItem is set, applying the transform policy only if transform is true
+func (fc *FileCache) setItem(ctx context.Context, item CacheItem, ttl time.Duration, transform bool) error {
+	fc.used()
+	fc.stamp(&item, ttl)
+
+	name, err := fc.entryName(item.Key)
 	if err != nil {
 		return err
 	}
+	if err := fc.checkSize(int64(len(item.Data))); err != nil {
+		return fc.finishWrite(ctx, item.Key, name, len(item.Data), err)
+	}
+	if err := fc.checkSpace(); err != nil {
+		return fc.finishWrite(ctx, item.Key, name, len(item.Data), err)
+	}
 
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %v", err)
+	data := item.Data
+	if fc.checksum {
+		item.Checksum = Checksum(item.Data)
+	}
+	if transform {
+		err = fc.encodeItem(&item)
+	}
+	if err == nil {
+		mu := &fc.writeLocks[appendStripe(item.Key)]
+		mu.Lock()
+		err = fc.writeItem(name, &item)
+		mu.Unlock()
 	}
+	if err = fc.finishWrite(ctx, item.Key, name, len(data), err); err != nil {
+		return err
+	}
+	fc.mirrorSet(item.Key, data, item.ExpireAt)
+	return nil
+}
 
-	jsonData, err := json.Marshal(item)
+// stamp sets the creation and expiration time of an item about to be
+// written, and its provenance if enabled
+func (fc *FileCache) stamp(item *CacheItem, ttl time.Duration) {
+	if fc.adaptive != nil {
+		ttl = fc.adaptive.ttlForSet(item.Key, ttl)
+	}
+	ttl = fc.jitter(ttl)
+	now := fc.now()
+	item.ExpireAt = now.Add(ttl)
+	item.Created = now
+	item.ExpireAt = fc.retainUntil(item)
+	if fc.provenance {
+		item.Provenance = fc.callerProvenance()
+	}
+}
+
+// finishWrite records the outcome of writing size payload bytes for key
+func (fc *FileCache) finishWrite(ctx context.Context, key, name string, size int, err error) error {
 	if err != nil {
+		fc.logEventContext(ctx, Event{Type: EventWriteFailed, Key: key, Path: name, Err: err})
+		return err
+	}
+	fc.stats.sets.Add(1)
+	fc.logEventContext(ctx, Event{Type: EventWrite, Key: key, Path: name, Size: size})
+	fc.checkQuota(ctx, key)
+
+	if fc.hot != nil {
+		fc.hot.remove(key)
+	}
+
+	return nil
+}
+
+// writeItem encodes item and stores it under name
+func (fc *FileCache) writeItem(name string, item *CacheItem) error {
+	fc.sign(item)
+	// Encoding into a pooled buffer saves json.Marshal's copy of the
+	// base64 payload
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := json.NewEncoder(buf).Encode(item); err != nil {
 		return fmt.Errorf("failed to marshal cache item: %v", err)
 	}
+	jsonData := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
 
-	if err := ioutil.WriteFile(filePath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write cache file: %v", err)
+	if err := fc.store.Put(name, jsonData); err != nil {
+		return err
 	}
+	fc.stored(name, item, len(item.Data), len(jsonData))
 
 	return nil
 }
 
-// Get retrieves a cache item
+// errEntryChanged is returned by rewriteItem when the entry was replaced
+// after it was read
+var errEntryChanged = errors.New("entry changed since it was read")
+
+// rewriteItem writes item, a modified copy of the entry data read from
+// name, unless the entry changed since, so a concurrent Set is not
+// overwritten with the old payload
+func (fc *FileCache) rewriteItem(name string, data []byte, item *CacheItem) error {
+	return fc.compareAndWrite(name, data, item.Key, func() error {
+		return fc.writeItem(name, item)
+	})
+}
+
+// compareAndWrite calls write while the entry of key stored under name is
+// still data, and returns errEntryChanged otherwise. Writes in this
+// process are locked out; other processes can only slip in between the
+// check and the write.
+func (fc *FileCache) compareAndWrite(name string, data []byte, key string, write func() error) error {
+	mu := &fc.writeLocks[appendStripe(key)]
+	mu.Lock()
+	defer mu.Unlock()
+	current, err := fc.store.Fetch(name)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, data) {
+		return errEntryChanged
+	}
+	return write()
+}
+
+// stored updates counters and the index after item was written under name
+// as encoded bytes holding size payload bytes
+func (fc *FileCache) stored(name string, item *CacheItem, size, encoded int) {
+	fc.stats.bytesWritten.Add(int64(encoded))
+	if fc.index != nil {
+		fc.index.put(item.Key, indexEntry{Name: name, ExpireAt: fc.retainUntil(item), Size: size, Bytes: encoded})
+	}
+}
+
+// decodeItem parses an encoded cache entry in either format
+func decodeItem(data []byte) (*CacheItem, error) {
+	if isBinary(data) {
+		return decodeBinary(data)
+	}
+
+	item := newItem()
+	if err := json.Unmarshal(data, item); err != nil {
+		releaseItem(item)
+		return nil, fmt.Errorf("failed to parse cache file: %v", err)
+	}
+	return item, nil
+}
+
+// Get retrieves a cache item. A miss is loaded if WithLoader or
+// RegisterLoader gave the key a loader.
 func (fc *FileCache) Get(key string) ([]byte, error) {
-	filePath, err := fc.getFilePath(key)
+	return fc.GetContext(context.Background(), key)
+}
+
+// GetContext is Get tagging the events it logs with the trace ID of ctx
+func (fc *FileCache) GetContext(ctx context.Context, key string) ([]byte, error) {
+	if load := fc.loaderFor(key); load != nil {
+		return fc.GetOrLoad(key, load)
+	}
+	data, err := fc.get(ctx, key)
+	fc.recordRead(key, err)
+	return data, err
+}
+
+// get retrieves a cache item without recording hit/miss statistics
+func (fc *FileCache) get(ctx context.Context, key string) ([]byte, error) {
+	item, err := fc.getItem(ctx, key)
 	if err != nil {
 		return nil, err
 	}
+	data := item.Data
+	releaseItem(item)
+	return data, nil
+}
 
-	data, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, errors.New("cache not found")
+// getItem loads and validates the item stored under key
+func (fc *FileCache) getItem(ctx context.Context, key string) (*CacheItem, error) {
+	return fc.readItem(ctx, key, false)
+}
+
+// readItem does the work of getItem. With keepStale set, an expired entry
+// is left in place and returned along with ErrExpired.
+func (fc *FileCache) readItem(ctx context.Context, key string, keepStale bool) (*CacheItem, error) {
+	item, _, err := fc.readEntry(ctx, key, keepStale)
+	return item, err
+}
+
+// readEntry is readItem, also returning the stored bytes the item was
+// decoded from, or nil if it was served from memory
+func (fc *FileCache) readEntry(ctx context.Context, key string, keepStale bool) (*CacheItem, []byte, error) {
+	fc.used()
+	if fc.async != nil {
+		if item, ok := fc.async.lookup(key); ok {
+			if fc.expiryNow().After(item.ExpireAt) {
+				if keepStale {
+					return &item, nil, ErrExpired
+				}
+				return nil, nil, ErrExpired
+			}
+			return &item, nil, nil
+		}
+	}
+	if fc.hot != nil {
+		if item, ok := fc.hot.get(key, fc.expiryNow()); ok && !fc.groupStale(&item) {
+			item.Data = fc.share(item.Data)
+			fc.refreshIfDue(key, &item)
+			return &item, nil, nil
 		}
-		return nil, fmt.Errorf("failed to read cache file: %v", err)
 	}
 
-	var item CacheItem
-	if err := json.Unmarshal(data, &item); err != nil {
-		return nil, fmt.Errorf("failed to parse cache file: %v", err)
+	name, err := fc.entryName(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hotGen uint64
+	if fc.hot != nil {
+		hotGen = fc.hot.generation(key)
+	}
+	data, err := fc.store.Fetch(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	fc.stats.bytesRead.Add(int64(len(data)))
+
+	item, err := decodeItem(data)
+	if err != nil {
+		fc.corrupt(ctx, key, name, err)
+		return nil, nil, err
+	}
+
+	if err := fc.verify(item); err != nil {
+		fc.logEventContext(ctx, Event{Type: EventCorrupt, Key: key, Path: name, Err: err})
+		return nil, nil, err
+	}
+	rewrite, err := fc.checkDrift(ctx, key, name, item, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if fc.isExpired(item, fc.now()) {
+		if keepStale {
+			if err := fc.decodeItemData(item); err != nil {
+				return nil, nil, err
+			}
+			if err := fc.verifyChecksum(item); err != nil {
+				return nil, nil, err
+			}
+			return item, data, ErrExpired
+		}
+		fc.expire(ctx, key, name)
+		return nil, nil, ErrExpired
 	}
 
-	if time.Now().After(item.ExpireAt) {
-		if fc.purgeOnLoad {
-			_ = os.Remove(filePath)
+	if fc.adaptive != nil && fc.adaptive.recordHit(item, fc.now()) {
+		rewrite = true
+	}
+	if rewrite {
+		if err := fc.rewriteItem(name, data, item); err != nil && err != errEntryChanged {
+			fc.logEventContext(ctx, Event{Type: EventWriteFailed, Key: key, Path: name, Err: err})
 		}
-		return nil, errors.New("cache expired")
 	}
 
-	return item.Data, nil
+	if err := fc.decodeItemData(item); err != nil {
+		fc.logEventContext(ctx, Event{Type: EventCorrupt, Key: key, Path: name, Err: err})
+		return nil, nil, err
+	}
+	if err := fc.verifyChecksum(item); err != nil {
+		fc.corrupt(ctx, key, name, err)
+		return nil, nil, err
+	}
+	if !rewrite {
+		fc.checkIndex(ctx, key, name, item, len(data))
+	}
+
+	if fc.hot != nil {
+		shared := *item
+		shared.Data = fc.share(item.Data)
+		shared.ExpireAt = fc.retainUntil(item)
+		fc.hot.put(key, shared, hotGen)
+	}
+	fc.refreshIfDue(key, item)
+
+	return item, data, nil
+}
+
+// expire handles a read that found the entry name of key expired
+func (fc *FileCache) expire(ctx context.Context, key, name string) {
+	if !fc.purgeOnLoad {
+		return
+	}
+	if fc.expiryQueue != nil {
+		fc.queueExpired(name)
+		return
+	}
+	_ = fc.removeEntry(name, key)
+	fc.logEventContext(ctx, Event{Type: EventExpired, Key: key, Path: name})
 }
 
 // GetString retrieves a cache item as string
@@ -123,126 +632,441 @@ func (fc *FileCache) GetString(key string) (string, error) {
 	return string(data), nil
 }
 
-// Exists checks if a cache item exists and is not expired
-func (fc *FileCache) Exists(key string) bool {
-	filePath, err := fc.getFilePath(key)
+// SetJSON stores the JSON encoding of v under key with the specified TTL
+func (fc *FileCache) SetJSON(key string, v any, ttl time.Duration) error {
+	data, err := json.Marshal(v)
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to encode value: %v", err)
+	}
+	return fc.SetWithTTL(key, data, ttl)
+}
+
+// GetJSON decodes the JSON value stored under key into out, which must be
+// a pointer as for json.Unmarshal
+func (fc *FileCache) GetJSON(key string, out any) error {
+	data, err := fc.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode value: %v", err)
+	}
+	return nil
+}
+
+// SetGob stores the gob encoding of v under key with the specified TTL.
+// Unlike JSON, gob keeps time zones and the concrete types of interface
+// values, which must be registered with gob.Register, so it suits caching
+// Go values for other Go programs.
+func (fc *FileCache) SetGob(key string, v any, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("failed to encode value: %v", err)
+	}
+	return fc.SetWithTTL(key, buf.Bytes(), ttl)
+}
+
+// GetGob decodes the gob value stored under key into out, which must be a
+// pointer as for gob.Decoder.Decode
+func (fc *FileCache) GetGob(key string, out any) error {
+	data, err := fc.Get(key)
+	if err != nil {
+		return err
 	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode value: %v", err)
+	}
+	return nil
+}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+// Exists checks if a cache item exists and is not expired
+func (fc *FileCache) Exists(key string) bool {
+	name, err := fc.entryName(key)
+	if err != nil {
 		return false
 	}
 
 	if fc.purgeOnLoad {
-		if _, err := fc.Get(key); err != nil {
+		if _, err := fc.get(context.Background(), key); err != nil {
 			return false
 		}
 		return true
 	}
 
-	return true
+	if fc.async != nil {
+		if item, ok := fc.async.lookup(key); ok {
+			return !fc.expiryNow().After(item.ExpireAt)
+		}
+	}
+	_, err = fc.store.Fetch(name)
+	return err == nil
 }
 
 // Delete removes a cache item
 func (fc *FileCache) Delete(key string) error {
-	filePath, err := fc.getFilePath(key)
+	fc.used()
+	name, err := fc.entryName(key)
 	if err != nil {
 		return err
 	}
 
-	if err := os.Remove(filePath); err != nil {
-		if os.IsNotExist(err) {
-			return errors.New("cache not found")
+	if fc.hot != nil {
+		fc.hot.remove(key)
+	}
+	if fc.adaptive != nil {
+		fc.adaptive.forget(key)
+	}
+	queued := fc.async != nil && fc.async.cancel(key)
+
+	if err := fc.removeEntry(name, key); err != nil {
+		// A write still queued never reached the store
+		if err != ErrNotFound || !queued {
+			return err
 		}
-		return fmt.Errorf("failed to delete cache file: %v", err)
 	}
+	fc.stats.deletes.Add(1)
+	fc.mirrorDelete(key)
 
 	return nil
 }
 
-// PurgeExpired removes all expired cache items
-func (fc *FileCache) PurgeExpired() error {
-	return filepath.Walk(fc.baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
+// Take retrieves a cache item and removes it, for one-time tokens and
+// handoff queues. Of several callers taking the same key, in this process
+// or others sharing the store, only one gets the value; the others get
+// ErrNotFound.
+func (fc *FileCache) Take(key string) ([]byte, error) {
+	data, err := fc.take(key)
+	fc.stats.recordGet(err)
+	return data, err
+}
+
+// takeAttempts is how often Take retries when the entry is replaced while
+// it is removed
+const takeAttempts = 3
+
+// take is Take without hit/miss statistics
+func (fc *FileCache) take(key string) ([]byte, error) {
+	name, err := fc.entryName(key)
+	if err != nil {
+		return nil, err
+	}
+	if fc.adaptive != nil {
+		fc.adaptive.forget(key)
+	}
+
+	for i := 0; i < takeAttempts; i++ {
+		data, err := fc.takeEntry(name, key)
+		if err == errEntryChanged {
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
+		fc.stats.deletes.Add(1)
+		fc.mirrorDelete(key)
+		return data, nil
+	}
+	return nil, fmt.Errorf("failed to take %q: entry keeps changing", key)
+}
 
-		if filepath.Ext(path) != ".json" {
-			return nil
+// takeEntry does one attempt of take, on a queued write or the stored
+// entry name. It returns errEntryChanged if the entry was replaced after
+// it was read, so a concurrent Set is neither removed nor lost. Writes in
+// this process are locked out; another process can only slip in between
+// the check and the removal, and of several callers only one removal
+// succeeds.
+func (fc *FileCache) takeEntry(name, key string) ([]byte, error) {
+	if fc.async != nil {
+		if item, ok := fc.async.take(key); ok {
+			// An older value may be stored underneath the queued one
+			if err := fc.removeEntry(name, key); err != nil && err != ErrNotFound {
+				return nil, err
+			}
+			if fc.hot != nil {
+				fc.hot.remove(key)
+			}
+			if fc.expiryNow().After(item.ExpireAt) {
+				return nil, ErrExpired
+			}
+			return item.Data, nil
 		}
+	}
 
-		data, err := ioutil.ReadFile(path)
-		if err != nil {
-			_ = os.Remove(path)
+	// The stored entry decides who wins, so the hot copy must not answer
+	if fc.hot != nil {
+		fc.hot.remove(key)
+	}
+	item, stored, err := fc.readEntry(context.Background(), key, false)
+	if err != nil {
+		return nil, err
+	}
+	data := item.Data
+	releaseItem(item)
+	if stored == nil {
+		// A write was queued or cached since the hot copy was dropped
+		return nil, errEntryChanged
+	}
+
+	mu := &fc.writeLocks[appendStripe(key)]
+	mu.Lock()
+	current, err := fc.store.Fetch(name)
+	if err == nil && !bytes.Equal(current, stored) {
+		err = errEntryChanged
+	}
+	if err == nil {
+		err = fc.removeEntry(name, key)
+	}
+	mu.Unlock()
+	if fc.hot != nil {
+		fc.hot.remove(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// PurgeExpired removes all expired cache items
+func (fc *FileCache) PurgeExpired() error {
+	_, err := fc.purge(1, nil)
+	return err
+}
+
+// purgeCandidate is an entry PurgeExpired found expired or unreadable
+type purgeCandidate struct {
+	name string
+	key  string // Empty for entries that could not be decoded
+}
+
+// purge removes expired entries using up to workers concurrent removals,
+// reports corrupt ones and returns how many were removed. The keys of
+// removed entries are passed to notify, if given, and to the purge
+// listener.
+func (fc *FileCache) purge(workers int, notify func(key string)) (int, error) {
+	if fc.readOnly {
+		return 0, ErrReadOnly
+	}
+	now := fc.now()
+	var candidates []purgeCandidate
+	var err error
+	if fc.index != nil {
+		candidates = fc.index.expired(fc.expiryTime(now))
+	} else {
+		err = fc.store.Walk("", func(name string, data []byte) error {
+			if isMetaName(name) {
+				return nil
+			}
+			item, err := decodeItem(data)
+			if err != nil {
+				candidates = append(candidates, purgeCandidate{name: name})
+				return nil
+			}
+			if fc.isExpired(item, now) {
+				candidates = append(candidates, purgeCandidate{name: name, key: item.Key})
+			}
+			releaseItem(item)
 			return nil
-		}
+		})
+	}
 
-		var item CacheItem
-		if err := json.Unmarshal(data, &item); err != nil {
-			_ = os.Remove(path)
+	var removed atomic.Int64
+	var notifyMu sync.Mutex
+	_ = fc.runLimited(context.Background(), workers, len(candidates), func(_ context.Context, i int) error {
+		key, ok := fc.evict(candidates[i], now)
+		if !ok {
 			return nil
 		}
-
-		if time.Now().After(item.ExpireAt) {
-			_ = os.Remove(path)
+		removed.Add(1)
+		if key != "" && (notify != nil || fc.purgeListener != nil) {
+			// Listeners see one key at a time even with parallel removal
+			notifyMu.Lock()
+			if notify != nil {
+				notify(key)
+			}
+			if fc.purgeListener != nil {
+				fc.purgeListener(key)
+			}
+			notifyMu.Unlock()
 		}
-
 		return nil
 	})
+
+	n := int(removed.Load())
+	fc.logEvent(Event{Type: EventPurge, Count: n, Err: err})
+	return n, err
 }
 
-// ListKeys lists all cache keys (may be slow for large caches)
+// evict re-reads a purge candidate and removes it if it is still expired,
+// so entries rewritten since the scan survive. It returns the key of the
+// removed entry. Files that are not entries of this cache are reported
+// and left alone.
+func (fc *FileCache) evict(c purgeCandidate, now time.Time) (string, bool) {
+	data, err := fc.store.Fetch(c.name)
+	if err != nil {
+		if err == ErrNotFound && fc.index != nil && c.key != "" {
+			fc.index.remove(c.key)
+		}
+		return "", false
+	}
+
+	item, err := decodeItem(data)
+	if err != nil {
+		fc.logEvent(Event{Type: EventCorrupt, Key: c.key, Path: c.name, Err: err})
+		return "", false
+	}
+	defer releaseItem(item)
+	if !fc.owned(c.name, item) || !fc.isExpired(item, now) {
+		return "", false
+	}
+
+	_ = fc.removeEntry(c.name, item.Key)
+	fc.stats.evictions.Add(1)
+	fc.logEvent(Event{Type: EventEvict, Key: item.Key, Path: c.name})
+	if fc.adaptive != nil {
+		fc.adaptive.forget(item.Key)
+	}
+	return item.Key, true
+}
+
+// owned reports whether name is where this cache puts item, so that
+// maintenance only ever deletes files holding entries at the path their
+// key maps to. Other files are reported as EventForeign.
+func (fc *FileCache) owned(name string, item *CacheItem) bool {
+	want, err := fc.entryName(item.Key)
+	if err == nil && want == name {
+		return true
+	}
+	if err == nil {
+		err = fmt.Errorf("entry for key %q belongs at %s", item.Key, want)
+	}
+	fc.logEvent(Event{Type: EventForeign, Key: item.Key, Path: name, Err: err})
+	return false
+}
+
+// ListKeys lists all cache keys (may be slow for large caches; see Iterate
+// and Keys for streaming and paged traversal)
 func (fc *FileCache) ListKeys() ([]string, error) {
 	var keys []string
+	if fc.index != nil {
+		fc.index.each(func(key string, e indexEntry) {
+			keys = append(keys, key)
+		})
+		return keys, nil
+	}
 
-	err := filepath.Walk(fc.baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-
-		if filepath.Ext(path) != ".json" {
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
 			return nil
 		}
-
-		relPath, err := filepath.Rel(fc.baseDir, path)
+		item, err := decodeItem(data)
 		if err != nil {
 			return nil
 		}
-
-		relPath = filepath.ToSlash(relPath)
-		parts := strings.Split(relPath, "/")
-		if len(parts) < fc.dirLevels+1 {
+		// Copies of entries elsewhere in the store are not entries
+		if want, err := fc.entryName(item.Key); err != nil || want != name {
 			return nil
 		}
+		keys = append(keys, item.Key)
+		releaseItem(item)
+		return nil
+	})
 
-		key := parts[fc.dirLevels]
-		key = strings.TrimSuffix(key, ".json")
+	return keys, err
+}
 
-		keys = append(keys, key)
+// removeEntry deletes the entry name holding key from the store and index
+func (fc *FileCache) removeEntry(name, key string) error {
+	err := fc.store.Remove(name)
+	if fc.index != nil {
+		fc.index.remove(key)
+	}
+	return err
+}
 
+// checkKey returns an error if item, read from name for key, is the entry
+// of another key: ErrCollision if both keys map to the same stored entry,
+// which then belongs to the other key and is left in place, or ErrNotFound
+// if the entry is merely misplaced
+func (fc *FileCache) checkKey(ctx context.Context, key, name string, item *CacheItem) error {
+	if item.Key == key {
 		return nil
-	})
+	}
+	if fc.collides(name, item.Key) {
+		fc.logEventContext(ctx, Event{Type: EventCollision, Key: key, Path: name, Err: ErrCollision})
+		return ErrCollision
+	}
+	return ErrNotFound
+}
 
-	return keys, err
+// collides reports whether other, whose entry was read from name, maps to
+// the same stored entry. Names differing only in case share a file on
+// case-insensitive file systems, so they are taken to collide as well.
+func (fc *FileCache) collides(name, other string) bool {
+	want, err := fc.entryName(other)
+	return err == nil && strings.EqualFold(want, name)
 }
 
-// getFilePath generates the file path for a cache key
-func (fc *FileCache) getFilePath(key string) (string, error) {
-	hasKey := strings.ReplaceAll(key, "_info.json", "")
-	hasKey = strings.ReplaceAll(hasKey, "_toc.json", "")
-	hash := sha256.Sum256([]byte(hasKey))
-	hashStr := hex.EncodeToString(hash[:])
+// copyBytes returns a copy of b that the caller may modify freely
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
 
-	path := fc.baseDir
+// entryName generates the store name for a cache key. Keys are used as
+// file names as they are when that is safe; keys that could escape their
+// directory, hold characters file systems reject or are too long for a
+// file name are stored under a name derived from their hash instead. The
+// directory is derived from the key as mapped by WithKeyNormalizer.
+func (fc *FileCache) entryName(key string) (string, error) {
+	if key == "" || fc.keyTooLong(key) {
+		return "", ErrInvalidKey
+	}
+
+	placed := key
+	if fc.keyNormalizer != nil {
+		placed = fc.keyNormalizer(key)
+	}
+	hashStr := fc.hash.sum(placed)
+
+	parts := make([]string, 0, fc.dirLevels+1)
 	for i := 0; i < fc.dirLevels; i++ {
 		start := i * fc.prefixLen
-		end := start + fc.prefixLen
-		if end > len(hashStr) {
-			return "", errors.New("invalid prefix length")
-		}
-		path = filepath.Join(path, hashStr[start:end])
+		parts = append(parts, hashStr[start:start+fc.prefixLen])
+	}
+	return path.Join(append(parts, fileName(key))...), nil
+}
+
+// fileName returns the file name an entry for key is stored under
+func fileName(key string) string {
+	if isSafeFileName(key) {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hashedNamePrefix + hex.EncodeToString(sum[:])
+}
+
+// isSafeFileName reports whether key can be used as a file name unchanged.
+// Names starting with hashedNamePrefix are reserved for hashed names and
+// names starting with a dot for temporary files.
+func isSafeFileName(key string) bool {
+	if len(key) > maxFileNameLength || key == strings.TrimSuffix(metaPrefix, "/") {
+		return false
 	}
+	if strings.HasPrefix(key, ".") || strings.HasPrefix(key, hashedNamePrefix) {
+		return false
+	}
+	return !strings.ContainsAny(key, "/\\\x00")
+}
 
-	return filepath.Join(path, key), nil
+// getFilePath generates the file path for a cache key in a file-backed cache
+func (fc *FileCache) getFilePath(key string) (string, error) {
+	name, err := fc.entryName(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(fc.baseDir, filepath.FromSlash(name)), nil
 }
@@ -1,7 +1,13 @@
 package pie_cache
 
 import (
+	"encoding/gob"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -81,3 +87,433 @@ func TestFileCache(t *testing.T) {
 		t.Error("Valid item was purged")
 	}
 }
+
+func TestPathScheme(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_layout")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, bad := range [][2]int{{-1, 2}, {2, 0}, {3, 30}, {65, 1}} {
+		if _, err := NewFileCache(tempDir, time.Minute, WithPathScheme(bad[0], bad[1])); err == nil {
+			t.Errorf("Expected error for %d levels of %d", bad[0], bad[1])
+		}
+	}
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithPathScheme(2, 32))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := cache.Set("key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	path, _ := cache.getFilePath("key")
+	rel, _ := filepath.Rel(tempDir, path)
+	if parts := strings.Split(filepath.ToSlash(rel), "/"); len(parts) != 3 || len(parts[0]) != 32 {
+		t.Errorf("Expected two 32 character directories, got %s", rel)
+	}
+
+}
+
+func TestKeySanitization(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_keys")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, levels := range []int{3, 0} {
+		dir := filepath.Join(tempDir, strconv.Itoa(levels))
+		cache, err := NewFileCache(dir, time.Minute, WithPathScheme(levels, 2))
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		keys := []string{"../../escape", "..", "a/../../b", "dir/key", "nul\x00byte",
+			"back\\slash", ".hidden", "~tilde", "_pie", "_pie/index/0", strings.Repeat("k", 1000)}
+		for _, key := range keys {
+			if err := cache.Set(key, []byte(key)); err != nil {
+				t.Errorf("Set(%q) failed: %v", key, err)
+				continue
+			}
+			path, _ := cache.getFilePath(key)
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || strings.HasPrefix(rel, "..") || strings.Count(filepath.ToSlash(rel), "/") != levels {
+				t.Errorf("Key %q stored at %s", key, rel)
+			}
+			if len(filepath.Base(path)) > 255 {
+				t.Errorf("Key %q has a file name of %d bytes", key, len(filepath.Base(path)))
+			}
+			if data, err := cache.Get(key); err != nil || string(data) != key {
+				t.Errorf("Get(%q) returned %q, %v", key, data, err)
+			}
+		}
+		if listed, _ := cache.ListKeys(); len(listed) != len(keys) {
+			t.Errorf("Expected %d keys listed, got %d", len(keys), len(listed))
+		}
+		for _, key := range keys {
+			_ = cache.Delete(key)
+		}
+
+		for _, key := range []string{"", strings.Repeat("k", MaxKeyLength+1)} {
+			if err := cache.Set(key, []byte("x")); err != ErrInvalidKey {
+				t.Errorf("Expected ErrInvalidKey for a key of %d bytes, got %v", len(key), err)
+			}
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	cache, err := NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	type profile struct {
+		Name  string   `json:"name"`
+		Roles []string `json:"roles"`
+	}
+	want := profile{Name: "ann", Roles: []string{"admin"}}
+	if err := cache.SetJSON("profile:1", want, time.Minute); err != nil {
+		t.Fatalf("SetJSON failed: %v", err)
+	}
+	var got profile
+	if err := cache.GetJSON("profile:1", &got); err != nil || got.Name != want.Name || len(got.Roles) != 1 || got.Roles[0] != "admin" {
+		t.Errorf("Expected %+v, got %+v, %v", want, got, err)
+	}
+	if v, _ := cache.GetString("profile:1"); v != `{"name":"ann","roles":["admin"]}` {
+		t.Errorf("Expected the JSON encoding stored, got %s", v)
+	}
+
+	if err := cache.GetJSON("missing", &got); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	_ = cache.Set("raw", []byte("not json"))
+	if err := cache.GetJSON("raw", &got); err == nil {
+		t.Error("Expected an error decoding a value that is not JSON")
+	}
+	if err := cache.SetJSON("bad", make(chan int), time.Minute); err == nil {
+		t.Error("Expected an error encoding a channel")
+	}
+}
+
+// gobShape is an interface value that TestGob stores through gob
+type gobShape interface{ Area() float64 }
+
+type gobSquare struct{ Side float64 }
+
+func (s gobSquare) Area() float64 { return s.Side * s.Side }
+
+func TestGob(t *testing.T) {
+	gob.Register(gobSquare{})
+	cache, err := NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	type drawing struct {
+		Shape   gobShape
+		Created time.Time
+	}
+	want := drawing{Shape: gobSquare{Side: 3}, Created: time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600))}
+	if err := cache.SetGob("drawing", want, time.Minute); err != nil {
+		t.Fatalf("SetGob failed: %v", err)
+	}
+	var got drawing
+	if err := cache.GetGob("drawing", &got); err != nil {
+		t.Fatalf("GetGob failed: %v", err)
+	}
+	if got.Shape == nil || got.Shape.Area() != 9 {
+		t.Errorf("Expected the concrete shape kept, got %#v", got.Shape)
+	}
+	if !got.Created.Equal(want.Created) || got.Created.Format(time.RFC3339) != want.Created.Format(time.RFC3339) {
+		t.Errorf("Expected the time and its zone kept, got %v", got.Created)
+	}
+
+	if err := cache.GetGob("missing", &got); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	_ = cache.Set("raw", []byte("not gob"))
+	if err := cache.GetGob("raw", &got); err == nil {
+		t.Error("Expected an error decoding a value that is not gob")
+	}
+}
+
+func TestTake(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_take")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i, opts := range [][]Option{nil, {WithHotCache(8)}, {WithAsyncWrites(8, 1)}} {
+		cache, err := NewFileCache(filepath.Join(tempDir, strconv.Itoa(i)), time.Minute, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		if err := cache.Set("token", []byte("once")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		_, _ = cache.Get("token")
+
+		var wg sync.WaitGroup
+		var won atomic.Int32
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := cache.Take("token")
+				if err == nil {
+					won.Add(1)
+					if string(data) != "once" {
+						t.Errorf("Take returned %q", data)
+					}
+				} else if err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound for a taken key, got %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := won.Load(); n != 1 {
+			t.Errorf("Expected one successful Take, got %d", n)
+		}
+		if cache.Exists("token") {
+			t.Error("Exists returned true for a taken key")
+		}
+		cache.Close()
+	}
+}
+
+// hookStore calls onFetch once after the next Fetch
+type hookStore struct {
+	*MemoryStore
+	mu      sync.Mutex
+	onFetch func()
+}
+
+func (s *hookStore) Fetch(name string) ([]byte, error) {
+	data, err := s.MemoryStore.Fetch(name)
+	s.mu.Lock()
+	hook := s.onFetch
+	s.onFetch = nil
+	s.mu.Unlock()
+	if hook != nil {
+		hook()
+	}
+	return data, err
+}
+
+func TestTakeConcurrentSet(t *testing.T) {
+	store := &hookStore{MemoryStore: NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("token", []byte("old"))
+
+	// A Set landing between the read and the removal must not be lost
+	store.onFetch = func() { _ = cache.Set("token", []byte("new")) }
+	data, err := cache.Take("token")
+	if err != nil || string(data) != "new" {
+		t.Errorf("Expected the new value taken, got %q, %v", data, err)
+	}
+	if cache.Exists("token") {
+		t.Error("Exists returned true for a taken key")
+	}
+
+	// The last of racing writes is either taken or kept
+	const writes = 200
+	var wg sync.WaitGroup
+	var last atomic.Bool
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= writes; i++ {
+			_ = cache.Set("queue", []byte(strconv.Itoa(i)))
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		prev := 0
+		for i := 0; i < writes*2; i++ {
+			data, err := cache.Take("queue")
+			if err != nil {
+				continue
+			}
+			n, _ := strconv.Atoi(string(data))
+			if n <= prev {
+				t.Errorf("Take returned %d after %d", n, prev)
+			}
+			prev = n
+			if n == writes {
+				last.Store(true)
+			}
+		}
+	}()
+	wg.Wait()
+	<-done
+	if data, err := cache.Get("queue"); !last.Load() && string(data) != strconv.Itoa(writes) {
+		t.Errorf("Expected the last write taken or kept, got %q, %v", data, err)
+	}
+}
+
+func TestMaintenanceOwnership(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithIndex(2)}} {
+		var foreign atomic.Int32
+		logger := LoggerFunc(func(e Event) {
+			if e.Type == EventForeign {
+				foreign.Add(1)
+			}
+		})
+		store := NewMemoryStore()
+		cache, err := NewWithStore(store, time.Minute, append(opts, WithLogger(logger), WithMaxSize(1))...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+
+		// An expired entry copied to a path its key does not map to
+		_ = cache.SetWithTTL("moved", []byte("x"), time.Millisecond)
+		name := mustEntryName(t, cache, "moved")
+		data, err := store.Fetch(name)
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		_ = store.Put("elsewhere/file", data)
+		_ = store.Put(mustEntryName(t, cache, "other"), data)
+		time.Sleep(5 * time.Millisecond)
+
+		if err := cache.PurgeExpired(); err != nil {
+			t.Fatalf("PurgeExpired failed: %v", err)
+		}
+		if _, err := cache.Shrink(); err != nil {
+			t.Fatalf("Shrink failed: %v", err)
+		}
+		if _, err := store.Fetch(name); err != ErrNotFound {
+			t.Errorf("Expected the expired entry purged, got %v", err)
+		}
+		for _, kept := range []string{"elsewhere/file", mustEntryName(t, cache, "other")} {
+			if _, err := store.Fetch(kept); err != nil {
+				t.Errorf("Expected %s left alone, got %v", kept, err)
+			}
+		}
+		if opts == nil && foreign.Load() == 0 {
+			t.Error("Expected the misplaced entries reported")
+		}
+		cache.Close()
+	}
+}
+
+// foldStore maps names differing only in case to one entry, like a
+// case-insensitive file system
+type foldStore struct {
+	*MemoryStore
+}
+
+func (s foldStore) Put(name string, data []byte) error {
+	return s.MemoryStore.Put(strings.ToLower(name), data)
+}
+
+func (s foldStore) Fetch(name string) ([]byte, error) {
+	return s.MemoryStore.Fetch(strings.ToLower(name))
+}
+
+func (s foldStore) Remove(name string) error {
+	return s.MemoryStore.Remove(strings.ToLower(name))
+}
+
+func TestKeyCollision(t *testing.T) {
+	var collisions atomic.Int32
+	logger := LoggerFunc(func(e Event) {
+		if e.Type == EventCollision {
+			collisions.Add(1)
+		}
+	})
+	store := foldStore{NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Minute, WithPathScheme(0, 0), WithReadRepair(), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	_ = cache.Set("Name", []byte("upper"))
+	if data, err := cache.Get("name"); err != ErrCollision {
+		t.Errorf("Expected ErrCollision instead of another key's data, got %q, %v", data, err)
+	}
+	if _, err := cache.Inspect("name"); err != ErrCollision {
+		t.Errorf("Expected ErrCollision from Inspect, got %v", err)
+	}
+	if cache.Exists("name") {
+		t.Error("Expected colliding key not to exist")
+	}
+	if collisions.Load() == 0 {
+		t.Error("Expected the collision logged")
+	}
+	// Read repair must not take the entry from its owner
+	if data, err := cache.Get("Name"); err != nil || string(data) != "upper" {
+		t.Errorf("Expected the owner to read its value, got %q, %v", data, err)
+	}
+}
+
+// benchmarkSizes are the payload sizes the benchmarks run with
+var benchmarkSizes = []int{64, 4 << 10, 256 << 10}
+
+// newBenchmarkCache returns a cache in a temporary directory
+func newBenchmarkCache(b *testing.B) *FileCache {
+	b.Helper()
+	cache, err := NewFileCache(b.TempDir(), time.Hour)
+	if err != nil {
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	b.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func BenchmarkSet(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			cache := newBenchmarkCache(b)
+			data := make([]byte, size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				if err := cache.Set("key"+strconv.Itoa(i%100), data); err != nil {
+					b.Fatalf("Set failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			cache := newBenchmarkCache(b)
+			_ = cache.Set("key", make([]byte, size))
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := cache.Get("key"); err != nil {
+					b.Fatalf("Get failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExists(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			cache := newBenchmarkCache(b)
+			_ = cache.Set("key", make([]byte, size))
+			b.ReportAllocs()
+			for b.Loop() {
+				if !cache.Exists("key") {
+					b.Fatal("Exists returned false")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package pie_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// ErrCorrupted is returned by Get when checksums are enabled and a payload
+// no longer matches the checksum stored with it
+var ErrCorrupted = errors.New("cache entry corrupted")
+
+// checksumTable is CRC-32C, which most CPUs compute in hardware
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WithChecksum stores a CRC-32C of every written payload in its entry and
+// checks it on reads, which then fail with ErrCorrupted when the data has
+// been damaged on disk. Entries written without a checksum are read as
+// before.
+func WithChecksum(enabled bool) Option {
+	return func(fc *FileCache) {
+		fc.checksum = enabled
+	}
+}
+
+// WithRemoveCorrupt deletes entries that reads find damaged, because they
+// do not parse or fail their checksum, so the next write replaces them
+// instead of every read failing until the entry expires
+func WithRemoveCorrupt(enabled bool) Option {
+	return func(fc *FileCache) {
+		fc.removeCorrupt = enabled
+	}
+}
+
+// formatChecksum renders a CRC-32C as stored in entries
+func formatChecksum(sum uint32) string {
+	return fmt.Sprintf("%08x", sum)
+}
+
+// Checksum returns the CRC-32C of data in the form the cache stores and
+// reports it, so consumers can check payloads they received
+func Checksum(data []byte) string {
+	return formatChecksum(crc32.Checksum(data, checksumTable))
+}
+
+// verifyChecksum checks the decoded payload of item against its checksum
+// when checksums are enabled
+func (fc *FileCache) verifyChecksum(item *CacheItem) error {
+	if !fc.checksum || item.Checksum == "" {
+		return nil
+	}
+	if Checksum(item.Data) != item.Checksum {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// GetWithChecksum retrieves a cache item together with the checksum of its
+// payload, so consumers that pass the data on can verify it end to end
+// without hashing it again. The checksum stored by WithChecksum is
+// returned; for entries written without one it is computed.
+func (fc *FileCache) GetWithChecksum(key string) ([]byte, string, error) {
+	item, err := fc.getItem(context.Background(), key)
+	fc.recordRead(key, err)
+	if err != nil {
+		return nil, "", err
+	}
+	if item.Checksum == "" {
+		return item.Data, Checksum(item.Data), nil
+	}
+	return item.Data, item.Checksum, nil
+}
+
+// corrupt reports a damaged entry found by a read of key, removing it when
+// configured to
+func (fc *FileCache) corrupt(ctx context.Context, key, name string, err error) {
+	removed := fc.removeCorrupt && fc.removeEntry(name, key) == nil
+	fc.logEventContext(ctx, Event{Type: EventCorrupt, Key: key, Path: name, Removed: removed, Err: err})
+}
@@ -0,0 +1,106 @@
+package pie_cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestChecksum(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithChecksum(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("key", []byte("payload"))
+	if data, err := cache.Get("key"); err != nil || string(data) != "payload" {
+		t.Fatalf("Get returned %q, %v", data, err)
+	}
+
+	// Flip a bit of the stored payload, leaving the checksum
+	name, _ := cache.entryName("key")
+	raw, _ := store.Fetch(name)
+	item, _ := decodeItem(raw)
+	if item.Checksum == "" {
+		t.Fatal("Expected a stored checksum")
+	}
+	item.Data[0] ^= 1
+	raw, _ = json.Marshal(item)
+	_ = store.Put(name, raw)
+
+	if _, err := cache.Get("key"); err != ErrCorrupted {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+	if report, _ := cache.Verify(false); len(report.Corrupt) != 1 {
+		t.Errorf("Expected Verify to report the entry, got %+v", report)
+	}
+	if _, err := store.Fetch(name); err != nil {
+		t.Errorf("Expected corrupt entry to be kept by default, got %v", err)
+	}
+
+	removing, _ := NewWithStore(store, time.Minute, WithChecksum(true), WithRemoveCorrupt(true))
+	if _, err := removing.Get("key"); err != ErrCorrupted {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+	if _, err := store.Fetch(name); err != ErrNotFound {
+		t.Errorf("Expected corrupt entry to be removed, got %v", err)
+	}
+
+	// Without checksums enabled the damage goes unnoticed
+	_ = store.Put(name, raw)
+	plain, _ := NewWithStore(store, time.Minute)
+	if _, err := plain.Get("key"); err != nil {
+		t.Errorf("Expected unchecked read to succeed, got %v", err)
+	}
+}
+
+func TestChecksumStream(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_checksum")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithChecksum(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	payload := bytes.Repeat([]byte("stream"), 1000)
+	if err := cache.SetFromReader("big", bytes.NewReader(payload), time.Minute); err != nil {
+		t.Fatalf("SetFromReader failed: %v", err)
+	}
+	if data, err := cache.Get("big"); err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("Get of streamed entry failed: %v", err)
+	}
+
+	path, _ := cache.getFilePath("big")
+	raw, _ := os.ReadFile(path)
+	raw[len(binaryMagic)+10] ^= 1
+	_ = os.WriteFile(path, raw, 0644)
+	if _, err := cache.GetReadSeeker("big"); err != ErrCorrupted {
+		t.Errorf("Expected ErrCorrupted from GetReadSeeker, got %v", err)
+	}
+	if _, err := cache.Get("big"); err != ErrCorrupted {
+		t.Errorf("Expected ErrCorrupted from Get, got %v", err)
+	}
+}
+
+func TestGetWithChecksum(t *testing.T) {
+	checked, _ := NewWithStore(NewMemoryStore(), time.Minute, WithChecksum(true))
+	plain, _ := NewWithStore(NewMemoryStore(), time.Minute)
+	for _, cache := range []*FileCache{checked, plain} {
+		_ = cache.Set("k", []byte("payload"))
+		data, sum, err := cache.GetWithChecksum("k")
+		if err != nil || string(data) != "payload" || sum != Checksum([]byte("payload")) {
+			t.Errorf("GetWithChecksum returned %q, %q, %v", data, sum, err)
+		}
+	}
+	if meta, _ := checked.Inspect("k"); meta.Checksum != Checksum([]byte("payload")) {
+		t.Errorf("Expected checksum in metadata, got %q", meta.Checksum)
+	}
+	if _, _, err := plain.GetWithChecksum("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
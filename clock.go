@@ -0,0 +1,75 @@
+package pie_cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source entries are stamped and expired by
+type Clock interface {
+	Now() time.Time
+}
+
+// WithClock stamps and expires entries by c instead of the wall clock,
+// e.g. a FakeClock in tests of TTL handling. Background work such as the
+// janitor still runs on real timers.
+func WithClock(c Clock) Option {
+	return func(fc *FileCache) {
+		fc.clock = c
+	}
+}
+
+// now returns the time entries are stamped and expired by
+func (fc *FileCache) now() time.Time {
+	if fc.clock != nil {
+		return fc.clock.Now()
+	}
+	return time.Now()
+}
+
+// expiryTime returns the time expiry is checked against at now, bounded by
+// the process uptime with WithMonotonicExpiry
+func (fc *FileCache) expiryTime(now time.Time) time.Time {
+	if fc.monotonic != nil {
+		return fc.monotonic.bound(now)
+	}
+	return now
+}
+
+// expiryNow is expiryTime of the current time
+func (fc *FileCache) expiryNow() time.Time {
+	return fc.expiryTime(fc.now())
+}
+
+// FakeClock is a Clock that only moves when told to. It is safe for
+// concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock reading now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements Clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
@@ -0,0 +1,40 @@
+package pie_cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithIndex(2), WithHotCache(8)}} {
+		clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		cache, err := NewMemoryCache(time.Minute, append(opts, WithClock(clock))...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+
+		_ = cache.SetWithTTL("key", []byte("value"), time.Hour)
+		_ = cache.Set("short", []byte("x"))
+		meta, err := cache.Inspect("key")
+		if err != nil || !meta.Created.Equal(clock.Now()) {
+			t.Errorf("Expected the entry stamped by the clock, got %v, %v", meta.Created, err)
+		}
+
+		clock.Advance(59 * time.Minute)
+		if data, err := cache.Get("key"); err != nil || string(data) != "value" {
+			t.Errorf("Expected a hit before the TTL, got %q, %v", data, err)
+		}
+		if _, err := cache.Get("short"); err != ErrExpired {
+			t.Errorf("Expected the short entry expired, got %v", err)
+		}
+
+		clock.Advance(2 * time.Minute)
+		if err := cache.PurgeExpired(); err != nil {
+			t.Fatalf("PurgeExpired failed: %v", err)
+		}
+		if cache.Exists("key") {
+			t.Error("Expected the entry purged after the TTL")
+		}
+		cache.Close()
+	}
+}
@@ -0,0 +1,508 @@
+// Command piecache performs maintenance tasks on pie_cache directories and
+// serves them over HTTP.
+//
+// Usage:
+//
+//	piecache sync [-dry-run] SRC DST
+//	piecache purge [-list] DIR
+//	piecache verify [-repair] DIR
+//	piecache migrate [-hash sha256] [-levels 3] [-prefix 2] DIR
+//	piecache recode [-binary] [-gzip PATTERNS] [-checksum] [-rate N] [-dry-run] DIR
+//	piecache export [-gzip | -meta] DIR > ARCHIVE
+//	piecache import DIR < ARCHIVE
+//	piecache bench [-dir DIR] [-size 4k] [-concurrency 32] [-n 10000]
+//	piecache serve [-addr 127.0.0.1:8080] [-ttl 1h] [-read-only] [-tls-cert FILE -tls-key FILE [-client-ca FILE]] [-memcached ADDR] DIR
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ser163/pie_cache"
+	"github.com/ser163/pie_cache/httpserver"
+	"github.com/ser163/pie_cache/memcached"
+	"github.com/ser163/pie_cache/tlsconfig"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "sync":
+		err = runSync(os.Args[2:])
+	case "purge":
+		err = runPurge(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "recode":
+		err = runRecode(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "piecache: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "piecache: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  piecache sync [-dry-run] SRC DST   copy missing or newer entries from SRC to DST")
+	fmt.Fprintln(os.Stderr, "  piecache purge [-list] DIR          remove expired entries from DIR")
+	fmt.Fprintln(os.Stderr, "  piecache verify [-repair] DIR       check DIR for corrupt or stray files")
+	fmt.Fprintln(os.Stderr, "  piecache migrate [flags] DIR        move entries of DIR to a new path scheme")
+	fmt.Fprintln(os.Stderr, "  piecache recode [flags] DIR         rewrite entries of DIR in a new format or compression")
+	fmt.Fprintln(os.Stderr, "  piecache export [-gzip|-meta] DIR   write the live entries of DIR to stdout as tar")
+	fmt.Fprintln(os.Stderr, "  piecache import DIR                 store the entries of a tar archive on stdin in DIR")
+	fmt.Fprintln(os.Stderr, "  piecache bench [flags]              measure set, get and purge speed (see piecache bench -h)")
+	fmt.Fprintln(os.Stderr, "  piecache serve [flags] DIR          serve DIR over HTTP (see piecache serve -h)")
+}
+
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be copied without writing")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("sync needs SRC and DST directories")
+	}
+
+	res, err := pie_cache.Sync(fs.Arg(0), fs.Arg(1), pie_cache.SyncOptions{DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("copied %d, up to date %d, expired %d, failed %d\n",
+		res.Copied, res.Skipped, res.Expired, res.Failed)
+	return nil
+}
+
+func runPurge(args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	list := fs.Bool("list", false, "print the key of every removed entry on stdout")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("purge needs a cache directory")
+	}
+
+	cache, err := pie_cache.NewFileCache(fs.Arg(0), time.Hour)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	if *list {
+		n, err = cache.PurgeExpiredTo(os.Stdout)
+	} else {
+		n, err = cache.PurgeExpiredFunc(nil)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "removed %d entries\n", n)
+	return nil
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "remove or move the problems found")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("verify needs a cache directory")
+	}
+
+	cache, err := pie_cache.NewFileCache(fs.Arg(0), time.Hour)
+	if err != nil {
+		return err
+	}
+	report, err := cache.Verify(*repair)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range []struct {
+		what  string
+		names []string
+	}{
+		{"corrupt", report.Corrupt},
+		{"misplaced", report.Misplaced},
+		{"temp file", report.TempFiles},
+		{"empty dir", report.EmptyDirs},
+	} {
+		for _, name := range problem.names {
+			fmt.Printf("%s\t%s\n", problem.what, name)
+		}
+	}
+	fmt.Printf("scanned %d, repaired %d\n", report.Scanned, report.Repaired)
+	if !report.OK() && !*repair {
+		return fmt.Errorf("problems found; run with -repair to fix them")
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	compress := fs.Bool("gzip", false, "compress the archive with gzip")
+	meta := fs.Bool("meta", false, "write the metadata of each entry as a JSON line instead")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("export needs a cache directory")
+	}
+
+	cache, err := pie_cache.NewFileCache(fs.Arg(0), time.Hour)
+	if err != nil {
+		return err
+	}
+	if *meta {
+		return cache.ExportMetadata(os.Stdout)
+	}
+	if !*compress {
+		return cache.Export(os.Stdout)
+	}
+	zw := gzip.NewWriter(os.Stdout)
+	if err := cache.Export(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("import needs a cache directory")
+	}
+
+	cache, err := pie_cache.NewFileCache(fs.Arg(0), time.Hour)
+	if err != nil {
+		return err
+	}
+	n, err := cache.Import(os.Stdin)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d entries\n", n)
+	return nil
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	hashName := fs.String("hash", "sha256", "hash naming directories: sha256, fnv or xxhash")
+	levels := fs.Int("levels", 3, "directory levels")
+	prefixLen := fs.Int("prefix", 2, "hash characters per directory level")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("migrate needs a cache directory")
+	}
+	hash, err := pie_cache.ParseHashFunc(*hashName)
+	if err != nil {
+		return err
+	}
+
+	cache, err := pie_cache.NewFileCache(fs.Arg(0), time.Hour,
+		pie_cache.WithHash(hash), pie_cache.WithPathScheme(*levels, *prefixLen),
+		pie_cache.WithLayoutPolicy(pie_cache.LayoutMigrate))
+	if err != nil {
+		return err
+	}
+	// Opening migrates caches with a recorded layout; older ones are
+	// assumed to match and need a full pass
+	moved, err := cache.Relocate()
+	if err != nil {
+		return err
+	}
+	if _, err := cache.CompactDirs(); err != nil {
+		return err
+	}
+
+	fmt.Printf("layout %v %dx%d, moved %d\n", hash, *levels, *prefixLen, moved)
+	return nil
+}
+
+func runRecode(args []string) error {
+	fs := flag.NewFlagSet("recode", flag.ExitOnError)
+	binary := fs.Bool("binary", false, "rewrite entries in the JSON format in the binary format")
+	gzipKeys := fs.String("gzip", "", "comma-separated key patterns to compress, e.g. html:*; other entries are decompressed")
+	checksum := fs.Bool("checksum", false, "add checksums to entries without one")
+	rate := fs.Int("rate", 0, "most entries rewritten per second, 0 for no limit")
+	dryRun := fs.Bool("dry-run", false, "report what would be rewritten without writing")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("recode needs a cache directory")
+	}
+
+	opts := []pie_cache.Option{pie_cache.WithChecksum(*checksum)}
+	if *gzipKeys != "" {
+		policy := pie_cache.TransformPolicy{}
+		for _, pattern := range strings.Split(*gzipKeys, ",") {
+			policy[pattern] = pie_cache.Gzip()
+		}
+		opts = append(opts, pie_cache.WithTransformPolicy(policy))
+	}
+	cache, err := pie_cache.NewFileCache(fs.Arg(0), time.Hour, opts...)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	res, err := cache.Recode(context.Background(), pie_cache.RecodeOptions{
+		Binary: *binary,
+		From:   []pie_cache.Transform{pie_cache.Gzip()},
+		Rate:   *rate,
+		DryRun: *dryRun,
+		Progress: func(r pie_cache.RecodeResult) {
+			if r.Scanned%10000 == 0 {
+				fmt.Fprintf(os.Stderr, "scanned %d, recoded %d\n", r.Scanned, r.Recoded)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("recoded %d, unchanged %d, expired %d, failed %d\n",
+		res.Recoded, res.Skipped, res.Expired, res.Failed)
+	return nil
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "listen address; other hosts may only connect with -client-ca")
+	ttl := fs.Duration("ttl", time.Hour, "default TTL for stored values")
+	certFile := fs.String("tls-cert", "", "serve HTTPS with this certificate")
+	keyFile := fs.String("tls-key", "", "private key for -tls-cert")
+	clientCA := fs.String("client-ca", "", "require client certificates signed by this CA")
+	memcachedAddr := fs.String("memcached", "", "also serve the memcached text protocol on this loopback address")
+	readOnly := fs.Bool("read-only", false, "serve reads only and never change DIR, e.g. another service's cache")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("serve needs a cache directory")
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+	if *clientCA != "" && *certFile == "" {
+		return fmt.Errorf("-client-ca needs -tls-cert and -tls-key; client certificates are only checked over TLS")
+	}
+	// Nothing else authenticates clients, so only mTLS opens the cache to
+	// other hosts
+	if !isLoopback(*addr) && *clientCA == "" {
+		return fmt.Errorf("serving on %s needs -client-ca; use a loopback address such as 127.0.0.1:8080 otherwise", *addr)
+	}
+	if *memcachedAddr != "" && !isLoopback(*memcachedAddr) {
+		return fmt.Errorf("the memcached protocol has no authentication; serve it on a loopback address such as 127.0.0.1:11211")
+	}
+
+	var opts []pie_cache.Option
+	var handlerOpts []httpserver.Option
+	if *readOnly {
+		opts = append(opts, pie_cache.WithReadOnly(), pie_cache.WithLayoutPolicy(pie_cache.LayoutAdopt))
+		handlerOpts = append(handlerOpts, httpserver.WithReadOnly())
+	}
+	cache, err := pie_cache.NewFileCache(fs.Arg(0), *ttl, opts...)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: *addr, Handler: httpserver.NewHandler(cache, handlerOpts...)}
+
+	if *memcachedAddr != "" {
+		mc := memcached.NewServer(cache)
+		go func() {
+			if err := mc.ListenAndServe(*memcachedAddr); err != nil {
+				fmt.Fprintf(os.Stderr, "piecache: memcached: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+		fmt.Printf("serving %s over memcached protocol on %s\n", fs.Arg(0), *memcachedAddr)
+	}
+
+	if *certFile == "" {
+		fmt.Printf("serving %s on http://%s\n", fs.Arg(0), *addr)
+		return srv.ListenAndServe()
+	}
+
+	tlsConfig, _, err := tlsconfig.Server(*certFile, *keyFile, *clientCA)
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = tlsConfig
+	fmt.Printf("serving %s on https://%s\n", fs.Arg(0), *addr)
+	return srv.ListenAndServeTLS("", "")
+}
+
+// isLoopback reports whether addr only accepts connections from this host
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	dir := fs.String("dir", os.TempDir(), "directory on the file system to measure; a scratch cache is created and removed inside it")
+	size := fs.String("size", "4k", "payload size, with an optional k or m suffix")
+	concurrency := fs.Int("concurrency", 32, "operations in flight at once")
+	n := fs.Int("n", 10000, "operations per benchmark")
+	fs.Parse(args)
+
+	payload, err := parseSize(*size)
+	if err != nil {
+		return err
+	}
+	if *concurrency < 1 || *n < 1 {
+		return fmt.Errorf("bench needs a positive -concurrency and -n")
+	}
+
+	scratch, err := os.MkdirTemp(*dir, "piecache-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+	cache, err := pie_cache.NewFileCache(scratch, time.Hour)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	data := make([]byte, payload)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	fmt.Printf("%d ops of %d bytes, %d at once, in %s\n", *n, payload, *concurrency, *dir)
+
+	res := benchOps(*n, *concurrency, func(i int) error {
+		return cache.Set("bench:"+strconv.Itoa(i), data)
+	})
+	res.print("set", payload)
+	res = benchOps(*n, *concurrency, func(i int) error {
+		_, err := cache.Get("bench:" + strconv.Itoa(i))
+		return err
+	})
+	res.print("get", payload)
+
+	// Purge the same number of expired entries next to the live ones
+	benchOps(*n, *concurrency, func(i int) error {
+		return cache.SetWithTTL("bench:expired:"+strconv.Itoa(i), data, time.Millisecond)
+	})
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	removed, err := cache.PurgeExpiredFunc(nil)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("%-5s %8d entries in %v, %.0f entries/s\n", "purge", removed, elapsed.Round(time.Millisecond),
+		float64(removed)/elapsed.Seconds())
+	return nil
+}
+
+// benchResult holds the latencies of one benchmark
+type benchResult struct {
+	latencies []time.Duration
+	elapsed   time.Duration
+	failed    int64
+}
+
+// benchOps runs fn for 0 to n-1 on concurrency goroutines
+func benchOps(n, concurrency int, fn func(i int) error) benchResult {
+	res := benchResult{latencies: make([]time.Duration, n)}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				t := time.Now()
+				if err := fn(i); err != nil {
+					atomic.AddInt64(&res.failed, 1)
+				}
+				res.latencies[i] = time.Since(t)
+			}
+		}()
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// print reports throughput and latency percentiles of res
+func (res benchResult) print(name string, payload int) {
+	lat := res.latencies
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	pct := func(p float64) time.Duration {
+		return lat[int(p*float64(len(lat)-1))].Round(time.Microsecond)
+	}
+	ops := float64(len(lat)) / res.elapsed.Seconds()
+	fmt.Printf("%-5s %8.0f ops/s %8.1f MB/s  p50 %v  p90 %v  p99 %v  max %v",
+		name, ops, ops*float64(payload)/(1<<20), pct(0.5), pct(0.9), pct(0.99), pct(1))
+	if res.failed > 0 {
+		fmt.Printf("  failed %d", res.failed)
+	}
+	fmt.Println()
+}
+
+// parseSize parses a byte count such as 512, 4k or 1m
+func parseSize(s string) (int, error) {
+	digits, mult := s, 1
+	switch {
+	case strings.HasSuffix(strings.ToLower(s), "k"):
+		digits, mult = s[:len(s)-1], 1<<10
+	case strings.HasSuffix(strings.ToLower(s), "m"):
+		digits, mult = s[:len(s)-1], 1<<20
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunServeFlags(t *testing.T) {
+	dir, err := os.MkdirTemp("", "piecache_serve")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, args := range [][]string{
+		{},
+		{"-addr", "0.0.0.0:0", dir},
+		{"-addr", "0.0.0.0:0", "-client-ca", "ca.pem", dir},
+		{"-client-ca", "ca.pem", dir},
+		{"-tls-cert", "cert.pem", dir},
+		{"-tls-key", "key.pem", dir},
+		{"-memcached", "0.0.0.0:0", dir},
+	} {
+		if err := runServe(args); err == nil {
+			t.Errorf("Expected serve %s to be rejected", strings.Join(args, " "))
+		}
+	}
+
+	// Rejected flags must not open the cache
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected %s untouched, found %d files", dir, len(entries))
+	}
+}
@@ -0,0 +1,96 @@
+package pie_cache
+
+import (
+	"sync"
+)
+
+// ConcurrencyReporter is implemented by types that report whether they
+// may be used by several goroutines at once, so wrappers can add locking
+// only where it is needed. The caches and stores in this module all
+// report true, a SplitStore only if both of its layers do.
+type ConcurrencyReporter interface {
+	ConcurrentSafe() bool
+}
+
+// ConcurrentSafe implements ConcurrencyReporter
+func (fc *FileCache) ConcurrentSafe() bool { return true }
+
+// ConcurrentSafe implements ConcurrencyReporter
+func (tc *TieredCache) ConcurrentSafe() bool { return true }
+
+// ConcurrentSafe implements ConcurrencyReporter
+func (sc *ShardedCache) ConcurrentSafe() bool { return true }
+
+// ConcurrentSafe implements ConcurrencyReporter
+func (fs *FileStore) ConcurrentSafe() bool { return true }
+
+// ConcurrentSafe implements ConcurrencyReporter
+func (ms *MemoryStore) ConcurrentSafe() bool { return true }
+
+// ConcurrentSafe implements ConcurrencyReporter
+func (s *SplitStore) ConcurrentSafe() bool {
+	return concurrentSafe(s.local) && concurrentSafe(s.shared)
+}
+
+// concurrentSafe reports whether v may be used concurrently, assuming so
+// unless it says otherwise
+func concurrentSafe(v any) bool {
+	if r, ok := v.(ConcurrencyReporter); ok {
+		return r.ConcurrentSafe()
+	}
+	return true
+}
+
+// lockedStore serializes the calls to a Store that is not safe for
+// concurrent use. It offers none of the optional store interfaces.
+type lockedStore struct {
+	mu    sync.Mutex
+	store Store
+}
+
+// Put implements Store
+func (ls *lockedStore) Put(name string, data []byte) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.store.Put(name, data)
+}
+
+// Fetch implements Store
+func (ls *lockedStore) Fetch(name string) ([]byte, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.store.Fetch(name)
+}
+
+// Remove implements Store
+func (ls *lockedStore) Remove(name string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.store.Remove(name)
+}
+
+// Walk implements Store. The entries are collected first so that fn may
+// use the store.
+func (ls *lockedStore) Walk(prefix string, fn func(name string, data []byte) error) error {
+	var names []string
+	var values [][]byte
+	ls.mu.Lock()
+	err := ls.store.Walk(prefix, func(name string, data []byte) error {
+		names = append(names, name)
+		values = append(values, copyBytes(data))
+		return nil
+	})
+	ls.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		if err := fn(name, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConcurrentSafe implements ConcurrencyReporter
+func (ls *lockedStore) ConcurrentSafe() bool { return true }
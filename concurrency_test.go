@@ -0,0 +1,116 @@
+package pie_cache
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mapStore is a Store without any locking
+type mapStore struct {
+	entries map[string][]byte
+}
+
+func (m *mapStore) Put(name string, data []byte) error {
+	m.entries[name] = copyBytes(data)
+	return nil
+}
+
+func (m *mapStore) Fetch(name string) ([]byte, error) {
+	data, ok := m.entries[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *mapStore) Remove(name string) error {
+	if _, ok := m.entries[name]; !ok {
+		return ErrNotFound
+	}
+	delete(m.entries, name)
+	return nil
+}
+
+func (m *mapStore) Walk(prefix string, fn func(name string, data []byte) error) error {
+	var names []string
+	for name := range m.entries {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(name, m.entries[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mapStore) ConcurrentSafe() bool { return false }
+
+// stress runs a mix of operations on cache from several goroutines
+func stress(t *testing.T, cache *FileCache) {
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				key := "k" + strconv.Itoa((g*7+i)%20)
+				switch i % 6 {
+				case 0:
+					_ = cache.SetWithTTL(key, []byte(key), time.Duration(i%3)*time.Millisecond+time.Millisecond)
+				case 1:
+					_, _ = cache.Get(key)
+				case 2:
+					_ = cache.Delete(key)
+				case 3:
+					_ = cache.Append(key, []byte("x"))
+				case 4:
+					_, _ = cache.ListKeys()
+				case 5:
+					_ = cache.PurgeExpired()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := cache.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	configs := map[string][]Option{
+		"plain": nil,
+		"full": {WithIndex(4), WithHotCache(8), WithAsyncWrites(16, 2), WithChecksum(true),
+			WithAdaptiveTTL(AdaptiveTTLPolicy{HotHits: 2, Extension: time.Millisecond})},
+	}
+	for name, opts := range configs {
+		t.Run(name, func(t *testing.T) {
+			cache, err := NewWithStore(NewMemoryStore(), time.Minute, opts...)
+			if err != nil {
+				t.Fatalf("Failed to create cache: %v", err)
+			}
+			if !cache.ConcurrentSafe() {
+				t.Error("Expected FileCache to report concurrent safety")
+			}
+			stress(t, cache)
+		})
+	}
+
+	// A store that is not safe for concurrent use gets serialized
+	cache, err := NewWithStore(&mapStore{entries: make(map[string][]byte)}, time.Minute, WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if _, ok := cache.store.(*lockedStore); !ok {
+		t.Fatalf("Expected the store to be wrapped, got %T", cache.store)
+	}
+	stress(t, cache)
+}
@@ -0,0 +1,21 @@
+package pie_cache
+
+import (
+	"context"
+	"time"
+)
+
+// SetWithCost stores data under key with the specified TTL and records
+// cost, the effort of recomputing the value in milliseconds or any other
+// unit used consistently. CostScorer evicts cheap entries first, and
+// WithRefreshLimit refreshes expensive ones first.
+func (fc *FileCache) SetWithCost(key string, data []byte, ttl time.Duration, cost float64) error {
+	return fc.set(context.Background(), CacheItem{Key: key, Data: data, Cost: cost}, ttl)
+}
+
+// CostScorer evicts the entries that are cheapest to recompute for the
+// space they take first, so entries written without a cost go before any
+// written with SetWithCost
+var CostScorer EvictionScorer = EvictionScorerFunc(func(item *ItemMeta) float64 {
+	return item.Cost / float64(max(item.Size, 1))
+})
@@ -0,0 +1,30 @@
+package pie_cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetWithCost(t *testing.T) {
+	probe, _ := NewWithStore(NewMemoryStore(), time.Minute)
+	_ = probe.SetWithCost("report:cheap", make([]byte, 100), time.Hour, 5)
+	entry, _, _ := probe.DiskUsage()
+
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithMaxSize(entry+entry/2), WithEvictionScorer(CostScorer))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.SetWithCost("report:costly", make([]byte, 100), time.Minute, 500)
+	_ = cache.SetWithCost("report:cheap", make([]byte, 100), time.Hour, 5)
+
+	meta, err := cache.Inspect("report:costly")
+	if err != nil || meta.Cost != 500 {
+		t.Fatalf("Expected a cost of 500, got %v, %v", meta.Cost, err)
+	}
+	if n, err := cache.Shrink(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 eviction, got %d, %v", n, err)
+	}
+	if !cache.Exists("report:costly") || cache.Exists("report:cheap") {
+		t.Error("Expected the cheap entry to be evicted first")
+	}
+}
@@ -0,0 +1,79 @@
+package pie_cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoSpace is returned for writes refused because the file system of
+// the cache is low on free space, see WithMinFreeSpace
+var ErrNoSpace = errors.New("cache disk space low")
+
+// errSpaceUnsupported is returned by diskSpace where free space cannot be
+// queried
+var errSpaceUnsupported = errors.New("free space not supported on this platform")
+
+// spaceCheckInterval is how long a free space reading is trusted
+const spaceCheckInterval = time.Second
+
+// statDisk returns the free and total bytes of the file system holding
+// dir. Tests replace it.
+var statDisk = diskSpace
+
+// WithMinFreeSpace refuses writes with ErrNoSpace while the file system
+// holding the cache has less than bytes or less than percent of its size
+// free, so the cache cannot take down its host; either may be 0 to leave
+// it out. Before refusing, expired entries are purged to make room. It
+// applies to caches on a FileStore on Linux, macOS and FreeBSD and does
+// nothing elsewhere.
+func WithMinFreeSpace(bytes int64, percent float64) Option {
+	return func(fc *FileCache) {
+		if bytes > 0 || percent > 0 {
+			fc.space = &spaceGuard{minBytes: bytes, minPercent: percent}
+		}
+	}
+}
+
+// spaceGuard caches whether free space is below the watermark
+type spaceGuard struct {
+	minBytes   int64
+	minPercent float64
+
+	mu      sync.Mutex
+	checked time.Time
+	low     bool
+}
+
+// lowOn reports whether the file system holding dir is below the
+// watermark, querying it at most once per spaceCheckInterval unless force
+// is set
+func (g *spaceGuard) lowOn(dir string, force bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !force && time.Since(g.checked) < spaceCheckInterval {
+		return g.low
+	}
+	g.checked = time.Now()
+	free, total, err := statDisk(dir)
+	if err != nil {
+		g.low = false
+		return false
+	}
+	g.low = g.minBytes > 0 && free < uint64(g.minBytes) ||
+		g.minPercent > 0 && total > 0 && float64(free)*100 < float64(total)*g.minPercent
+	return g.low
+}
+
+// checkSpace returns ErrNoSpace if the cache is too low on free space to
+// accept a write, purging expired entries first
+func (fc *FileCache) checkSpace() error {
+	fs, ok := fc.store.(*FileStore)
+	if fc.space == nil || !ok || !fc.space.lowOn(fs.baseDir, false) {
+		return nil
+	}
+	if n, _ := fc.purge(1, nil); n > 0 && !fc.space.lowOn(fs.baseDir, true) {
+		return nil
+	}
+	return ErrNoSpace
+}
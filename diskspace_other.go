@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package pie_cache
+
+// diskSpace is not supported on this platform
+func diskSpace(dir string) (free, total uint64, err error) {
+	return 0, 0, errSpaceUnsupported
+}
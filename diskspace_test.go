@@ -0,0 +1,61 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMinFreeSpace(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_space")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var free uint64 = 100
+	statDisk = func(string) (uint64, uint64, error) { return free, 1000, nil }
+	defer func() { statDisk = diskSpace }()
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithMinFreeSpace(50, 0))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := cache.Set("a", []byte("v")); err != nil {
+		t.Fatalf("Expected write above the watermark to succeed, got %v", err)
+	}
+
+	// Below the watermark writes are refused, after purging what expired
+	_ = cache.SetWithTTL("old", []byte("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	free = 40
+	cache.space.checked = time.Time{}
+	if err := cache.Set("b", []byte("v")); err != ErrNoSpace {
+		t.Errorf("Expected ErrNoSpace, got %v", err)
+	}
+	if path, _ := cache.getFilePath("old"); fileExists(path) {
+		t.Error("Expected expired entries to be purged for room")
+	}
+
+	// A percentage watermark works the same way
+	free = 200
+	pct, _ := NewFileCache(tempDir, time.Minute, WithMinFreeSpace(0, 25))
+	if err := pct.Set("c", []byte("v")); err != ErrNoSpace {
+		t.Errorf("Expected ErrNoSpace below 25%% free, got %v", err)
+	}
+	free = 300
+	pct.space.checked = time.Time{}
+	if err := pct.Set("c", []byte("v")); err != nil {
+		t.Errorf("Expected write above 25%% free to succeed, got %v", err)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	free, total, err := diskSpace(os.TempDir())
+	if err == errSpaceUnsupported {
+		t.Skip("free space not supported on this platform")
+	}
+	if err != nil || total == 0 || free > total {
+		t.Errorf("Unexpected disk space %d of %d, %v", free, total, err)
+	}
+}
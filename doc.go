@@ -0,0 +1,15 @@
+// Package pie_cache is a file-based cache with TTL support.
+//
+// # Concurrency
+//
+// Every exported method of FileCache, TieredCache, ShardedCache,
+// ShadowCache and the stores in this package is safe for concurrent use
+// by multiple goroutines, including Close, which may race with other
+// calls. Several FileCache values, in one process or in several, may
+// share a cache directory. The package's tests exercise these guarantees
+// under the race detector.
+//
+// Stores supplied by callers are expected to be safe for concurrent use as
+// well. A Store that is not can say so by implementing ConcurrencyReporter;
+// the cache then serializes its calls to it.
+package pie_cache
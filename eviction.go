@@ -0,0 +1,201 @@
+package pie_cache
+
+import (
+	"math"
+	"path"
+	"sort"
+)
+
+// EvictionScorer ranks entries for removal once the cache outgrows
+// WithMaxSize, WithMaxEntries or WithMaxFiles. Entries with the lowest
+// score are evicted first.
+type EvictionScorer interface {
+	Score(item *ItemMeta) float64
+}
+
+// EvictionScorerFunc adapts an ordinary function to the EvictionScorer
+// interface
+type EvictionScorerFunc func(item *ItemMeta) float64
+
+// Score calls f(item)
+func (f EvictionScorerFunc) Score(item *ItemMeta) float64 {
+	return f(item)
+}
+
+// ExpiryScorer evicts the entries closest to expiring first. It is the
+// default scorer.
+var ExpiryScorer EvictionScorer = EvictionScorerFunc(func(item *ItemMeta) float64 {
+	return float64(item.ExpireAt.UnixNano())
+})
+
+// WithMaxSize limits the bytes the entries take in the store. The limit
+// is enforced by the janitor after each purge and by Shrink, so writes in
+// between can exceed it.
+func WithMaxSize(bytes int64) Option {
+	return func(fc *FileCache) {
+		if bytes > 0 {
+			fc.maxSize = bytes
+		}
+	}
+}
+
+// WithMaxEntries limits the number of entries in the store. Like
+// WithMaxSize it is enforced by the janitor and Shrink, and the two can be
+// combined; eviction then goes on until every limit holds.
+func WithMaxEntries(n int) Option {
+	return func(fc *FileCache) {
+		if n > 0 {
+			fc.maxEntries = n
+		}
+	}
+}
+
+// WithMaxFiles limits the inodes the entries take: one for each entry and
+// one for each directory holding entries, which FileStore removes once it
+// is empty. Use it where the file system runs out of inodes before it runs
+// out of space. Like WithMaxSize it is enforced by the janitor and Shrink
+// and can be combined with the other limits. Counting directories needs
+// every entry name, so Shrink lists the store even with WithIndex.
+func WithMaxFiles(n int) Option {
+	return func(fc *FileCache) {
+		if n > 0 {
+			fc.maxFiles = n
+		}
+	}
+}
+
+// WithEvictionScorer decides which entries the size limits evict first, e.g.
+// to keep entries that are expensive to recompute for their size
+func WithEvictionScorer(s EvictionScorer) Option {
+	return func(fc *FileCache) {
+		fc.scorer = s
+	}
+}
+
+// evictionCandidate is an entry Shrink may remove
+type evictionCandidate struct {
+	name     string
+	key      string
+	bytes    int64
+	priority Priority // From WithPriority; lower goes first, whatever the score
+	score    float64
+}
+
+// footprint is what the entries take in the store, as limited by
+// WithMaxSize, WithMaxEntries and WithMaxFiles
+type footprint struct {
+	bytes   int64
+	entries int
+	files   int
+}
+
+// exceeds reports whether f is over any of the limits of fc
+func (fc *FileCache) exceeds(f footprint) bool {
+	return fc.maxSize > 0 && f.bytes > fc.maxSize ||
+		fc.maxEntries > 0 && f.entries > fc.maxEntries ||
+		fc.maxFiles > 0 && f.files > fc.maxFiles
+}
+
+// Shrink evicts entries, expired ones and then those with the lowest
+// WithPriority and, within a priority, those scored lowest, until
+// the entries are within every limit of WithMaxSize, WithMaxEntries and
+// WithMaxFiles or only pinned ones are left, and returns how many it
+// removed. With WithIndex and no WithMaxFiles nothing is read while the
+// cache is within its limits.
+func (fc *FileCache) Shrink() (int, error) {
+	if fc.maxSize <= 0 && fc.maxEntries <= 0 && fc.maxFiles <= 0 {
+		return 0, nil
+	}
+	if fc.readOnly {
+		return 0, ErrReadOnly
+	}
+	if fc.index != nil && fc.maxFiles <= 0 {
+		bytes, entries, err := fc.DiskUsage()
+		if err != nil || !fc.exceeds(footprint{bytes: bytes, entries: entries}) {
+			return 0, err
+		}
+	}
+
+	scorer := fc.scorer
+	if scorer == nil {
+		scorer = ExpiryScorer
+	}
+	now := fc.now()
+	var total footprint
+	var candidates []evictionCandidate
+	dirs := make(map[string]int) // Entries below each directory
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			// Reported by PurgeExpired
+			return nil
+		}
+		defer releaseItem(item)
+		if !fc.owned(name, item) {
+			return nil
+		}
+		c := evictionCandidate{name: name, key: item.Key, bytes: int64(len(data)), priority: math.MinInt, score: math.Inf(-1)}
+		if !fc.isExpired(item, now) {
+			meta := item.meta()
+			c.priority, c.score = item.Priority, scorer.Score(&meta)
+		}
+		total.bytes += c.bytes
+		total.entries++
+		total.files++
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if dirs[dir]++; dirs[dir] == 1 {
+				total.files++
+			}
+		}
+		candidates = append(candidates, c)
+		return nil
+	})
+	if err != nil || !fc.exceeds(total) {
+		return 0, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].score < candidates[j].score
+	})
+	removed := 0
+	for _, c := range candidates {
+		if !fc.exceeds(total) || c.priority >= PriorityPinned {
+			// Pinned entries sort last and may leave the cache over its limits
+			break
+		}
+		err := fc.removeEntry(c.name, c.key)
+		if err != nil && err != ErrNotFound {
+			return removed, err
+		}
+		total.bytes -= c.bytes
+		total.entries--
+		total.files--
+		for dir := path.Dir(c.name); dir != "."; dir = path.Dir(dir) {
+			if dirs[dir]--; dirs[dir] == 0 {
+				total.files--
+			}
+		}
+		if err != nil {
+			continue
+		}
+		removed++
+		fc.stats.evictions.Add(1)
+		fc.logEvent(Event{Type: EventEvict, Key: c.key, Path: c.name})
+		if fc.hot != nil {
+			fc.hot.remove(c.key)
+		}
+		if fc.adaptive != nil {
+			fc.adaptive.forget(c.key)
+		}
+		if fc.purgeListener != nil {
+			fc.purgeListener(c.key)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,116 @@
+package pie_cache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShrink(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithIndex(2)}} {
+		probe, err := NewWithStore(NewMemoryStore(), time.Minute, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		_ = probe.Set("k0", make([]byte, 100))
+		entry, _, _ := probe.DiskUsage()
+
+		cache, err := NewWithStore(NewMemoryStore(), time.Minute, append(opts, WithMaxSize(3*entry+entry/2))...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		for i := 0; i < 6; i++ {
+			_ = cache.SetWithTTL("k"+strconv.Itoa(i), make([]byte, 100), time.Duration(i+1)*time.Minute)
+		}
+		n, err := cache.Shrink()
+		if err != nil || n != 3 {
+			t.Errorf("Expected 3 evictions, got %d, %v", n, err)
+		}
+		// The entries closest to expiring go first
+		for i := 0; i < 6; i++ {
+			if got, want := cache.Exists("k"+strconv.Itoa(i)), i >= 3; got != want {
+				t.Errorf("Expected Exists(k%d) %v after Shrink", i, want)
+			}
+		}
+		if n, _ := cache.Shrink(); n != 0 {
+			t.Errorf("Expected nothing to evict within the limit, got %d", n)
+		}
+	}
+
+	// A custom scorer decides what stays
+	probe, _ := NewWithStore(NewMemoryStore(), time.Minute)
+	_ = probe.Set("keep:a", make([]byte, 100))
+	entry, _, _ := probe.DiskUsage()
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithMaxSize(entry+entry/2),
+		WithEvictionScorer(EvictionScorerFunc(func(item *ItemMeta) float64 {
+			if strings.HasPrefix(item.Key, "keep:") {
+				return 1
+			}
+			return 0
+		})))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.SetWithTTL("keep:a", make([]byte, 100), time.Minute)
+	_ = cache.SetWithTTL("drop:b", make([]byte, 100), time.Hour)
+	if n, err := cache.Shrink(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 eviction, got %d, %v", n, err)
+	}
+	if !cache.Exists("keep:a") || cache.Exists("drop:b") {
+		t.Error("Expected the scorer to keep keep:a over drop:b")
+	}
+}
+
+func TestShrinkCompositeLimits(t *testing.T) {
+	// The entry limit applies even when the byte limit is far off
+	for _, opts := range [][]Option{nil, {WithIndex(2)}} {
+		cache, err := NewWithStore(NewMemoryStore(), time.Minute, append(opts, WithMaxSize(1<<30), WithMaxEntries(4))...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		for i := 0; i < 6; i++ {
+			_ = cache.SetWithTTL("k"+strconv.Itoa(i), []byte("x"), time.Duration(i+1)*time.Minute)
+		}
+		if n, err := cache.Shrink(); err != nil || n != 2 {
+			t.Errorf("Expected 2 evictions, got %d, %v", n, err)
+		}
+		if _, entries, _ := cache.DiskUsage(); entries != 4 {
+			t.Errorf("Expected 4 entries left, got %d", entries)
+		}
+	}
+
+	// Entries and the directories holding them count against the file limit
+	tempDir, err := os.MkdirTemp("", "pie_cache_eviction")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	cache, err := NewFileCache(tempDir, time.Minute, WithPathScheme(1, 1), WithMaxFiles(10))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		_ = cache.SetWithTTL("k"+strconv.Itoa(i), []byte("x"), time.Duration(i+1)*time.Minute)
+	}
+	n, err := cache.Shrink()
+	if err != nil || n == 0 {
+		t.Fatalf("Expected evictions, got %d, %v", n, err)
+	}
+	files := 0
+	_ = filepath.WalkDir(tempDir, func(p string, d fs.DirEntry, err error) error {
+		if p != tempDir && !strings.HasPrefix(p, filepath.Join(tempDir, metaPrefix)) {
+			files++
+		}
+		return nil
+	})
+	if files > 10 || files < 9 {
+		t.Errorf("Expected entries and directories to take 9 or 10 inodes, got %d", files)
+	}
+	if !cache.Exists("k19") {
+		t.Error("Expected the entry furthest from expiring kept")
+	}
+}
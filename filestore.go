@@ -0,0 +1,329 @@
+package pie_cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tempPrefix marks files being written by Create. Walk skips them.
+const tempPrefix = ".pie-tmp-"
+
+// FileStore is the default Store: every entry is a file below a base
+// directory, at the path given by its name
+type FileStore struct {
+	baseDir string
+}
+
+// NewFileStore creates a FileStore rooted at baseDir, creating the directory
+// if needed
+func NewFileStore(baseDir string) (*FileStore, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return &FileStore{baseDir: filepath.Clean(baseDir)}, nil
+}
+
+// Path returns the file path of name
+func (fs *FileStore) Path(name string) string {
+	return filepath.Join(fs.baseDir, filepath.FromSlash(name))
+}
+
+// name returns the store name of the file at filePath below the base
+// directory
+func (fs *FileStore) name(filePath string) string {
+	relPath, err := filepath.Rel(fs.baseDir, filePath)
+	if err != nil {
+		return filePath
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// Put implements Store
+func (fs *FileStore) Put(name string, data []byte) error {
+	filePath := fs.Path(name)
+	err := inDir(filePath, func() error {
+		return os.WriteFile(filePath, data, 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+	return nil
+}
+
+// inDir runs fn, which creates a file at filePath, creating its directory
+// first if fn finds it missing. A concurrent Remove may prune the directory
+// again before fn runs, so fn is retried once more if the directory has
+// gone.
+func inDir(filePath string, fn func() error) error {
+	if err := fn(); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil || !os.IsNotExist(err) || attempt > 0 {
+			return err
+		}
+	}
+}
+
+// Append implements AppendStore
+func (fs *FileStore) Append(name string, data []byte) error {
+	filePath := fs.Path(name)
+	var f *os.File
+	err := inDir(filePath, func() (err error) {
+		f, err = os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open cache file: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+	return nil
+}
+
+// Lease implements LeaseStore with a lock file created exclusively under
+// name. A lock file older than ttl is taken to be left by a holder that
+// died and is broken.
+func (fs *FileStore) Lease(name string, ttl time.Duration) (func(), bool, error) {
+	filePath := fs.Path(name)
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return nil, false, fmt.Errorf("failed to create lease token: %v", err)
+	}
+	token := hex.EncodeToString(buf[:])
+
+	for attempt := 0; attempt < 2; attempt++ {
+		var f *os.File
+		err := inDir(filePath, func() (err error) {
+			f, err = os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			return err
+		})
+		if err == nil {
+			_, err = f.WriteString(token)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(filePath)
+				return nil, false, fmt.Errorf("failed to write lease file: %v", err)
+			}
+			release := func() {
+				// Only remove the lock file if it was not broken and retaken
+				if data, err := os.ReadFile(filePath); err == nil && string(data) == token {
+					os.Remove(filePath)
+				}
+			}
+			return release, true, nil
+		}
+		if !os.IsExist(err) {
+			return nil, false, fmt.Errorf("failed to create lease file: %v", err)
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, false, fmt.Errorf("failed to stat lease file: %v", err)
+		}
+		if time.Since(info.ModTime()) < ttl {
+			return nil, false, nil
+		}
+		os.Remove(filePath)
+	}
+	return nil, false, nil
+}
+
+// Fetch implements Store
+func (fs *FileStore) Fetch(name string) ([]byte, error) {
+	data, err := os.ReadFile(fs.Path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read cache file: %v", err)
+	}
+	return data, nil
+}
+
+// Remove implements Store. Directories left empty are removed as well.
+func (fs *FileStore) Remove(name string) error {
+	filePath := fs.Path(name)
+	if err := os.Remove(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete cache file: %v", err)
+	}
+	fs.pruneParents(filePath)
+	return nil
+}
+
+// pruneParents removes the directories above filePath up to the base
+// directory for as long as they are empty
+func (fs *FileStore) pruneParents(filePath string) {
+	for dir := filepath.Dir(filePath); ; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(fs.baseDir, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+		// Fails once a directory still has entries
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// pruneDirs finds the empty directories below the base directory, deepest
+// first, and with remove set deletes them, so that parents left empty are
+// found too. It returns their store names.
+func (fs *FileStore) pruneDirs(remove bool) []string {
+	var dirs []string
+	_ = filepath.Walk(fs.baseDir, func(filePath string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && filePath != fs.baseDir {
+			dirs = append(dirs, filePath)
+		}
+		return nil
+	})
+
+	var empty []string
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+			continue
+		}
+		if remove && os.Remove(dir) != nil {
+			continue
+		}
+		empty = append(empty, fs.name(dir))
+	}
+	return empty
+}
+
+// Walk implements Store. Files that cannot be read are skipped.
+func (fs *FileStore) Walk(prefix string, fn func(name string, data []byte) error) error {
+	return fs.WalkAfter(prefix, "", fn)
+}
+
+// WalkAfter implements SeekStore. Directories holding only names up to
+// after are skipped without being listed.
+func (fs *FileStore) WalkAfter(prefix, after string, fn func(name string, data []byte) error) error {
+	// Start at the deepest directory fully covered by prefix
+	root := fs.baseDir
+	if dir := path.Dir(prefix + "x"); dir != "." {
+		root = fs.Path(dir)
+	}
+
+	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := fs.name(filePath)
+		if info.IsDir() {
+			// Names below the directory sort before name+"0", as '0'
+			// follows '/'
+			if filePath != root && name+"0" <= after {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if name <= after || !strings.HasPrefix(name, prefix) || strings.HasPrefix(info.Name(), tempPrefix) {
+			return nil
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil
+		}
+		return fn(name, data)
+	})
+}
+
+// fileEntry is an open entry file
+type fileEntry struct {
+	*os.File
+	size int64
+}
+
+// Size returns the size of the entry in bytes
+func (e *fileEntry) Size() int64 {
+	return e.size
+}
+
+// Open implements StreamStore
+func (fs *FileStore) Open(name string) (EntryReader, error) {
+	f, err := os.Open(fs.Path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open cache file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat cache file: %v", err)
+	}
+	return &fileEntry{File: f, size: info.Size()}, nil
+}
+
+// fileWriter writes an entry to a temporary file that replaces the entry
+// on Commit
+type fileWriter struct {
+	*os.File
+	path string
+}
+
+// Commit implements EntryWriter
+func (w *fileWriter) Commit() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.File.Name())
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+	if err := os.Rename(w.File.Name(), w.path); err != nil {
+		os.Remove(w.File.Name())
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+	return nil
+}
+
+// Abort implements EntryWriter
+func (w *fileWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.File.Name())
+}
+
+// Create implements StreamStore
+func (fs *FileStore) Create(name string) (EntryWriter, error) {
+	filePath := fs.Path(name)
+	var f *os.File
+	err := inDir(filePath, func() (err error) {
+		f, err = os.CreateTemp(filepath.Dir(filePath), tempPrefix+"*")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %v", err)
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("failed to create cache file: %v", err)
+	}
+	return &fileWriter{File: f, path: filePath}, nil
+}
@@ -0,0 +1,107 @@
+package pie_cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Entries come in two formats. The original one is a JSON CacheItem with
+// the payload base64-encoded inside. The binary format keeps the payload
+// raw so it can be streamed and read at an offset:
+//
+//	magic | payload | header | header length
+//
+// where header is the JSON CacheItem without data and the length is a
+// big-endian uint32. Putting the header last lets writers stream payloads
+// of unknown size and still sign them.
+
+// binaryMagic starts every entry in the binary format
+var binaryMagic = []byte("PIE\x01")
+
+// trailerLen is the size of the header length field
+const trailerLen = 4
+
+// errNotBinary is returned when an entry is not in the binary format
+var errNotBinary = errors.New("not a binary cache entry")
+
+// isBinary reports whether data is an entry in the binary format
+func isBinary(data []byte) bool {
+	return bytes.HasPrefix(data, binaryMagic)
+}
+
+// encodeBinary encodes item in the binary format
+func encodeBinary(item *CacheItem) ([]byte, error) {
+	trailer, err := binaryTrailer(item)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, len(binaryMagic)+len(item.Data)+len(trailer))
+	buf = append(buf, binaryMagic...)
+	buf = append(buf, item.Data...)
+	return append(buf, trailer...), nil
+}
+
+// binaryTrailer returns the header and header length that follow the
+// payload of item
+func binaryTrailer(item *CacheItem) ([]byte, error) {
+	header := *item
+	header.Data = nil
+	buf, err := json.Marshal(&header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cache item: %v", err)
+	}
+	return binary.BigEndian.AppendUint32(buf, uint32(len(buf))), nil
+}
+
+// decodeBinary parses an entry in the binary format
+func decodeBinary(data []byte) (*CacheItem, error) {
+	item, off, n, err := readBinaryHeader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	item.Data = data[off : off+n]
+	return item, nil
+}
+
+// readBinaryHeader reads the header of a binary entry of the given size
+// and returns it along with the offset and length of the payload
+func readBinaryHeader(r io.ReaderAt, size int64) (*CacheItem, int64, int64, error) {
+	magic := make([]byte, len(binaryMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, binaryMagic) {
+		return nil, 0, 0, errNotBinary
+	}
+
+	var trailer [trailerLen]byte
+	if size < int64(len(binaryMagic)+trailerLen) {
+		return nil, 0, 0, errors.New("failed to parse cache file: truncated entry")
+	}
+	if _, err := r.ReadAt(trailer[:], size-trailerLen); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read cache file: %v", err)
+	}
+	headerLen := int64(binary.BigEndian.Uint32(trailer[:]))
+	off := int64(len(binaryMagic))
+	n := size - trailerLen - headerLen - off
+	if n < 0 {
+		return nil, 0, 0, errors.New("failed to parse cache file: bad header length")
+	}
+
+	buf := headerPool.Get().(*[]byte)
+	defer headerPool.Put(buf)
+	if int64(cap(*buf)) < headerLen {
+		*buf = make([]byte, headerLen)
+	}
+	header := (*buf)[:headerLen]
+	if _, err := r.ReadAt(header, off+n); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read cache file: %v", err)
+	}
+	item := newItem()
+	if err := json.Unmarshal(header, item); err != nil {
+		releaseItem(item)
+		return nil, 0, 0, fmt.Errorf("failed to parse cache file: %v", err)
+	}
+	return item, off, n, nil
+}
@@ -1,3 +1,8 @@
 module github.com/ser163/pie_cache
 
 go 1.24.1
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	golang.org/x/sync v0.19.0
+)
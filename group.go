@@ -0,0 +1,189 @@
+package pie_cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// groupPrefix holds the epoch markers of invalidation groups
+const groupPrefix = metaPrefix + "groups/"
+
+// groupEpochRefresh is how long a group's epoch is served from memory
+// before its marker is read again, which bounds how late invalidations by
+// other processes are seen
+const groupEpochRefresh = time.Second
+
+// maxGroupEpochs is how many group epochs are kept in memory
+const maxGroupEpochs = 4096
+
+// InvalidationGroup ties entries together so they can be invalidated at
+// once. Every entry written through the group records the group's current
+// epoch; Invalidate bumps the epoch with a single store write, after which
+// all of them read as expired together. Use it for pages assembled from
+// several cached fragments that must never be served half-stale. Reads
+// keep the epoch in memory, so invalidations by other processes sharing
+// the store take up to a second to be seen.
+type InvalidationGroup struct {
+	fc     *FileCache
+	name   string
+	marker string
+}
+
+// Group returns the invalidation group called name
+func (fc *FileCache) Group(name string) *InvalidationGroup {
+	hash := sha256.Sum256([]byte(name))
+	return &InvalidationGroup{
+		fc:     fc,
+		name:   name,
+		marker: groupPrefix + hex.EncodeToString(hash[:]),
+	}
+}
+
+// Set adds or updates a cache item in the group with default TTL
+func (g *InvalidationGroup) Set(key string, data []byte) error {
+	return g.SetWithTTL(key, data, g.fc.ttl)
+}
+
+// SetWithTTL adds or updates a cache item in the group with specified TTL.
+// The item records the epoch reads compare it with, so it is only stale
+// once the group is invalidated again.
+func (g *InvalidationGroup) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	epoch, err := g.fc.cachedGroupEpoch(g.marker)
+	if err != nil {
+		return err
+	}
+	return g.fc.set(context.Background(), CacheItem{Key: key, Data: data, Group: g.name, Epoch: epoch}, ttl)
+}
+
+// Invalidate expires every entry written through the group so far
+func (g *InvalidationGroup) Invalidate() error {
+	// Group returns a new value per call, so the lock lives in the cache
+	g.fc.groups.invalidate.Lock()
+	defer g.fc.groups.invalidate.Unlock()
+
+	epoch, err := g.fc.groupEpoch(g.marker)
+	if err != nil {
+		epoch = 0
+	}
+	// A clock-based epoch stays unique even when processes race here
+	next := time.Now().UnixNano()
+	if next <= epoch {
+		next = epoch + 1
+	}
+	if err := g.fc.store.Put(g.marker, []byte(strconv.FormatInt(next, 10))); err != nil {
+		g.fc.groups.forget(g.marker)
+		return fmt.Errorf("failed to invalidate group %q: %v", g.name, err)
+	}
+	g.fc.groups.set(g.marker, next, g.fc.now())
+	return nil
+}
+
+// groupEpoch returns the current epoch stored in marker, 0 for a group that
+// was never invalidated
+func (fc *FileCache) groupEpoch(marker string) (int64, error) {
+	data, err := fc.store.Fetch(marker)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	epoch, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse group epoch: %v", err)
+	}
+	return epoch, nil
+}
+
+// groupStale reports whether item belongs to a group that was invalidated
+// after it was written. An unreadable marker counts as invalidated.
+func (fc *FileCache) groupStale(item *CacheItem) bool {
+	if item.Group == "" {
+		return false
+	}
+	epoch, err := fc.cachedGroupEpoch(fc.Group(item.Group).marker)
+	return err != nil || epoch != item.Epoch
+}
+
+// cachedGroupEpoch is groupEpoch, answered from memory if the marker was
+// read less than groupEpochRefresh ago
+func (fc *FileCache) cachedGroupEpoch(marker string) (int64, error) {
+	now := fc.now()
+	epoch, gen, ok := fc.groups.get(marker, now)
+	if ok {
+		return epoch, nil
+	}
+	epoch, err := fc.groupEpoch(marker)
+	if err != nil {
+		return 0, err
+	}
+	fc.groups.fill(marker, epoch, now, gen)
+	return epoch, nil
+}
+
+// groupEpochs keeps the epochs of group markers read recently
+type groupEpochs struct {
+	mu     sync.Mutex
+	gen    uint64                   // Bumped by every change, so fills racing one are dropped
+	epochs map[string]groupEpochRef // By marker
+
+	invalidate sync.Mutex // Serializes Invalidate's read and write of markers
+}
+
+// groupEpochRef is the epoch of a group marker and when it was read
+type groupEpochRef struct {
+	epoch int64
+	read  time.Time
+}
+
+// get returns the epoch of marker if it was read less than
+// groupEpochRefresh before now, and the generation to fill it with
+// otherwise
+func (g *groupEpochs) get(marker string, now time.Time) (int64, uint64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ref, ok := g.epochs[marker]
+	if ok && !now.Before(ref.read) && now.Sub(ref.read) < groupEpochRefresh {
+		return ref.epoch, 0, true
+	}
+	return 0, g.gen, false
+}
+
+// fill records the epoch of marker read at now, unless the epochs changed
+// since generation gen was handed out
+func (g *groupEpochs) fill(marker string, epoch int64, now time.Time, gen uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if gen == g.gen {
+		g.put(marker, epoch, now)
+	}
+}
+
+// set records epoch as the new epoch of marker
+func (g *groupEpochs) set(marker string, epoch int64, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gen++
+	g.put(marker, epoch, now)
+}
+
+// forget drops the epoch of marker, so the next read fetches it
+func (g *groupEpochs) forget(marker string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gen++
+	delete(g.epochs, marker)
+}
+
+// put stores the epoch of marker. The caller must hold g.mu.
+func (g *groupEpochs) put(marker string, epoch int64, now time.Time) {
+	if g.epochs == nil || len(g.epochs) >= maxGroupEpochs {
+		g.epochs = make(map[string]groupEpochRef)
+	}
+	g.epochs[marker] = groupEpochRef{epoch: epoch, read: now}
+}
@@ -0,0 +1,137 @@
+package pie_cache
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInvalidationGroup(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_group")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithHotCache(8), WithSigningKey([]byte("k")))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	page := cache.Group("page:home")
+	for _, key := range []string{"header", "body", "footer"} {
+		if err := page.Set(key, []byte(key)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		// Warm the hot cache so it must honour invalidation too
+		if _, err := cache.Get(key); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	_ = cache.Set("sidebar", []byte("sidebar"))
+
+	if err := page.Invalidate(); err != nil {
+		t.Fatalf("Invalidate failed: %v", err)
+	}
+	for _, key := range []string{"header", "body", "footer"} {
+		if _, err := cache.Get(key); err != ErrExpired {
+			t.Errorf("Expected %s to be expired, got %v", key, err)
+		}
+	}
+	if _, err := cache.Get("sidebar"); err != nil {
+		t.Errorf("Expected ungrouped entry to survive, got %v", err)
+	}
+
+	// Entries written after the invalidation belong to the new epoch
+	_ = page.Set("body", []byte("new"))
+	if v, err := cache.GetString("body"); err != nil || v != "new" {
+		t.Errorf("Expected new body, got %q, %v", v, err)
+	}
+
+	// The epoch marker is not an entry
+	keys, _ := cache.ListKeys()
+	if len(keys) != 2 {
+		t.Errorf("Expected 2 keys, got %v", keys)
+	}
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if err := page.Invalidate(); err != nil {
+		t.Fatalf("Invalidate failed: %v", err)
+	}
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 1 || keys[0] != "sidebar" {
+		t.Errorf("Expected only sidebar after purge, got %v", keys)
+	}
+}
+
+// markerCountStore counts fetches of group markers
+type markerCountStore struct {
+	*MemoryStore
+	fetches atomic.Int32
+}
+
+func (s *markerCountStore) Fetch(name string) ([]byte, error) {
+	if strings.HasPrefix(name, groupPrefix) {
+		s.fetches.Add(1)
+	}
+	return s.MemoryStore.Fetch(name)
+}
+
+func TestGroupEpochCache(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	store := &markerCountStore{MemoryStore: NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Hour, WithClock(clock), WithHotCache(8))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	other, err := NewWithStore(store, time.Hour, WithClock(clock))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	page := cache.Group("page:home")
+	_ = page.Set("body", []byte("body"))
+	_, _ = cache.Get("body")
+	store.fetches.Store(0)
+	for range 10 {
+		if _, err := cache.Get("body"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if n := store.fetches.Load(); n != 0 {
+		t.Errorf("Expected hot hits to skip the group marker, got %d fetches", n)
+	}
+
+	// Invalidating in this process is seen at once
+	if err := page.Invalidate(); err != nil {
+		t.Fatalf("Invalidate failed: %v", err)
+	}
+	if _, err := cache.Get("body"); err != ErrExpired {
+		t.Errorf("Expected body expired, got %v", err)
+	}
+
+	// Another process's invalidation is seen once the epoch is read again
+	_ = page.Set("body", []byte("new"))
+	_, _ = cache.Get("body")
+	if err := other.Group("page:home").Invalidate(); err != nil {
+		t.Fatalf("Invalidate failed: %v", err)
+	}
+	clock.Advance(groupEpochRefresh)
+	if _, err := cache.Get("body"); err != ErrExpired {
+		t.Errorf("Expected body expired after the refresh interval, got %v", err)
+	}
+
+	// Entries written while the epoch is served from memory are not stale
+	if err := other.Group("page:home").Invalidate(); err != nil {
+		t.Fatalf("Invalidate failed: %v", err)
+	}
+	_ = page.Set("body", []byte("fresh"))
+	if got, err := cache.Get("body"); err != nil || string(got) != "fresh" {
+		t.Errorf("Expected the fresh body, got %q, %v", got, err)
+	}
+}
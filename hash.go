@@ -0,0 +1,84 @@
+package pie_cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// HashFunc selects the hash whose hex digits name the directories entries
+// are spread over
+type HashFunc int
+
+const (
+	// HashSHA256 gives 64 hex digits. It is the default.
+	HashSHA256 HashFunc = iota
+	// HashFNV is 64-bit FNV-1a, giving 16 hex digits
+	HashFNV
+	// HashXXHash is 64-bit xxHash, giving 16 hex digits. It is the fastest
+	// choice for very large caches.
+	HashXXHash
+)
+
+var hashFuncNames = map[HashFunc]string{
+	HashSHA256: "sha256",
+	HashFNV:    "fnv",
+	HashXXHash: "xxhash",
+}
+
+// String returns the hash name
+func (h HashFunc) String() string {
+	if name, ok := hashFuncNames[h]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseHashFunc returns the HashFunc called name
+func ParseHashFunc(name string) (HashFunc, error) {
+	for h, n := range hashFuncNames {
+		if n == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash %q: use sha256, fnv or xxhash", name)
+}
+
+// WithHash selects the hash that spreads entries over directories. The
+// hash decides where existing entries are found, so changing it on an
+// existing cache needs a migration: open the cache with the new settings
+// and call Relocate, or run piecache migrate.
+func WithHash(h HashFunc) Option {
+	return func(fc *FileCache) {
+		fc.hash = h
+	}
+}
+
+// hexLen returns the number of hex digits of the hash
+func (h HashFunc) hexLen() int {
+	if h == HashSHA256 {
+		return sha256.Size * 2
+	}
+	return 16
+}
+
+// sum returns the hash of s in hex
+func (h HashFunc) sum(s string) string {
+	var buf [8]byte
+	switch h {
+	case HashFNV:
+		f := fnv.New64a()
+		f.Write([]byte(s))
+		binary.BigEndian.PutUint64(buf[:], f.Sum64())
+	case HashXXHash:
+		binary.BigEndian.PutUint64(buf[:], xxhash.Sum64String(s))
+	default:
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	return hex.EncodeToString(buf[:])
+}
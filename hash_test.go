@@ -0,0 +1,109 @@
+package pie_cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithHash(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_hash")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, h := range []HashFunc{HashSHA256, HashFNV, HashXXHash} {
+		parsed, err := ParseHashFunc(h.String())
+		if err != nil || parsed != h {
+			t.Errorf("ParseHashFunc(%q) = %v, %v", h.String(), parsed, err)
+		}
+		if sum := h.sum("key"); len(sum) != h.hexLen() {
+			t.Errorf("Expected %d hex digits from %v, got %q", h.hexLen(), h, sum)
+		}
+	}
+	if _, err := ParseHashFunc("md5"); err == nil {
+		t.Error("Expected error for unknown hash")
+	}
+
+	// 16 hex digits do not fit 3 levels of 8
+	if _, err := NewFileCache(tempDir, time.Minute, WithHash(HashFNV), WithPathScheme(3, 8)); err == nil {
+		t.Error("Expected error for a layout longer than the hash")
+	}
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithHash(HashXXHash), WithPathScheme(1, 2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	name, _ := cache.entryName("key")
+	if want := HashXXHash.sum("key")[:2] + "/key"; name != want {
+		t.Errorf("Expected name %q, got %q", want, name)
+	}
+	if err := cache.Set("key", []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if data, err := cache.Get("key"); err != nil || string(data) != "v" {
+		t.Errorf("Get = %q, %v", data, err)
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_relocate")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	old, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	keys := []string{"a", "b", "dir/c"}
+	for _, key := range keys {
+		_ = old.Set(key, []byte(key))
+	}
+
+	// As if written before layouts were recorded
+	if err := os.Remove(filepath.Join(tempDir, "_pie", "layout")); err != nil {
+		t.Fatalf("Failed to remove layout manifest: %v", err)
+	}
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithHash(HashFNV), WithPathScheme(1, 1), WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	if cache.Exists("a") {
+		t.Error("Expected entries in the old layout not to be found")
+	}
+
+	moved, err := cache.Relocate()
+	if err != nil {
+		t.Fatalf("Relocate failed: %v", err)
+	}
+	if moved != len(keys) {
+		t.Errorf("Expected %d entries moved, got %d", len(keys), moved)
+	}
+	for _, key := range keys {
+		if data, err := cache.Get(key); err != nil || string(data) != key {
+			t.Errorf("Get(%q) after Relocate = %q, %v", key, data, err)
+		}
+	}
+	if listed, _ := cache.ListKeys(); len(listed) != len(keys) {
+		t.Errorf("Expected the index to follow the move, got %v", listed)
+	}
+
+	if _, err := cache.CompactDirs(); err != nil {
+		t.Fatalf("CompactDirs failed: %v", err)
+	}
+	entries, _ := os.ReadDir(tempDir)
+	for _, e := range entries {
+		if e.Name() != "_pie" && len(e.Name()) != 1 {
+			t.Errorf("Unexpected directory %q left after migration", e.Name())
+		}
+	}
+	if n, _ := cache.Relocate(); n != 0 {
+		t.Errorf("Expected nothing left to move, got %d", n)
+	}
+}
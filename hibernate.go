@@ -0,0 +1,120 @@
+package pie_cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// minHibernateCheck bounds how often an idle cache checks whether to
+// hibernate
+const minHibernateCheck = 10 * time.Millisecond
+
+// idleWatch hibernates a cache that has not been used for a while
+type idleWatch struct {
+	after   time.Duration
+	lastUse atomic.Int64 // Unix nanoseconds of the last read or write
+	asleep  atomic.Bool  // Hibernated since the last use
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// WithHibernateAfter calls Hibernate once the cache has seen no reads or
+// writes for idle, e.g. for per-tenant caches that are mostly unused. Use
+// wakes the cache again; its memory tiers and index fill up on demand.
+func WithHibernateAfter(idle time.Duration) Option {
+	return func(fc *FileCache) {
+		if idle > 0 {
+			fc.idle = &idleWatch{after: idle}
+		}
+	}
+}
+
+// Hibernate prepares an idle cache to use as few resources as possible.
+// It writes queued writes and the access stats, folds the change logs of
+// the index into its snapshots and drops the index from memory, removes
+// empty directories and empties the hot cache. The cache stays usable and
+// reloads what it needs on the next access.
+func (fc *FileCache) Hibernate() error {
+	if err := fc.Flush(); err != nil {
+		return err
+	}
+	if fc.index != nil {
+		fc.index.compact()
+		if err := fc.index.flush(true); err != nil {
+			return err
+		}
+	}
+	if _, err := fc.CompactDirs(); err != nil {
+		return err
+	}
+	if fc.hot != nil {
+		fc.hot.clear()
+	}
+	return fc.SaveAccessStats()
+}
+
+// compact marks every shard with a change log for a snapshot rewrite on
+// the next flush
+func (idx *keyIndex) compact() {
+	for _, s := range idx.shards {
+		s.mu.Lock()
+		if !s.loaded {
+			if _, err := idx.store.Fetch(s.name + indexLogSuffix); err == nil {
+				s.load(idx.store)
+			}
+		}
+		if s.loaded && (s.logged > 0 || len(s.pending) > 0) {
+			s.rewrite, s.dirty = true, true
+		}
+		s.mu.Unlock()
+	}
+}
+
+// used records a read or write for WithHibernateAfter
+func (fc *FileCache) used() {
+	if w := fc.idle; w != nil {
+		w.lastUse.Store(time.Now().UnixNano())
+		w.asleep.Store(false)
+	}
+}
+
+// startIdleWatch launches the goroutine of WithHibernateAfter
+func (fc *FileCache) startIdleWatch() {
+	w := fc.idle
+	if w == nil {
+		return
+	}
+	w.lastUse.Store(time.Now().UnixNano())
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go fc.runIdleWatch()
+}
+
+func (fc *FileCache) runIdleWatch() {
+	w := fc.idle
+	defer close(w.done)
+
+	ticker := time.NewTicker(max(w.after/2, minHibernateCheck))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			idle := time.Since(time.Unix(0, w.lastUse.Load()))
+			if idle >= w.after && !w.asleep.Swap(true) {
+				if err := fc.Hibernate(); err != nil {
+					fc.logEvent(Event{Type: EventWriteFailed, Err: err})
+				}
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// stopIdleWatch stops the goroutine of WithHibernateAfter
+func (fc *FileCache) stopIdleWatch() {
+	if w := fc.idle; w != nil && w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+}
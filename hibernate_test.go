@@ -0,0 +1,80 @@
+package pie_cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// hotLen returns the number of entries in hc
+func hotLen(hc *hotCache) int {
+	n := 0
+	for i := range hc.shards {
+		s := &hc.shards[i]
+		s.mu.RLock()
+		n += len(s.entries)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+func TestHibernate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_hibernate")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithIndex(2), WithHotCache(8))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		_ = cache.Set(key, []byte(key))
+		_, _ = cache.Get(key)
+	}
+	_ = cache.Delete("c")
+	if err := cache.FlushIndex(); err != nil {
+		t.Fatalf("FlushIndex failed: %v", err)
+	}
+
+	if err := cache.Hibernate(); err != nil {
+		t.Fatalf("Hibernate failed: %v", err)
+	}
+	if n := hotLen(cache.hot); n != 0 {
+		t.Errorf("Expected an empty hot cache, got %d entries", n)
+	}
+	for _, s := range cache.index.shards {
+		if s.loaded {
+			t.Errorf("Expected index shard %s released", s.name)
+		}
+		if _, err := cache.store.Fetch(s.name + indexLogSuffix); err != ErrNotFound {
+			t.Errorf("Expected the log of %s compacted, got %v", s.name, err)
+		}
+	}
+	path, _ := cache.getFilePath("c")
+	if fileExists(filepath.Dir(path)) {
+		t.Error("Expected empty directories removed")
+	}
+	if v, err := cache.GetString("a"); err != nil || v != "a" {
+		t.Errorf("Expected the cache usable after Hibernate, got %q, %v", v, err)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 2 {
+		t.Errorf("Expected 2 keys after Hibernate, got %v", keys)
+	}
+
+	idle, err := NewFileCache(tempDir, time.Minute, WithIndex(2), WithHotCache(8), WithHibernateAfter(30*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer idle.Close()
+	_, _ = idle.Get("a")
+	if n := hotLen(idle.hot); n != 1 {
+		t.Fatalf("Expected 1 hot entry, got %d", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := hotLen(idle.hot); n != 0 {
+		t.Errorf("Expected the idle cache to hibernate, got %d hot entries", n)
+	}
+}
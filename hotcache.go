@@ -0,0 +1,148 @@
+package pie_cache
+
+import (
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const hotShards = 16
+
+// hotCache keeps the decoded payloads of recently read items in memory.
+// Reads share a per-shard read lock. A full shard evicts with the clock
+// algorithm: reads mark entries, and the hand drops the first unmarked
+// entry it reaches, clearing the marks it passes.
+type hotCache struct {
+	shards   [hotShards]hotShard
+	perShard int
+	verify   bool // Panic when a shared payload was modified by a caller
+}
+
+type hotShard struct {
+	mu      sync.RWMutex
+	entries map[string]*hotEntry
+	ring    []string      // Keys of entries in clock order
+	hand    int           // Position in ring of the next eviction candidate
+	gen     atomic.Uint64 // Bumped by every remove, so puts of older reads are dropped
+}
+
+type hotEntry struct {
+	item CacheItem   // Decoded item; Data may be shared with callers
+	slot int         // Position of the key in ring
+	used atomic.Bool // Read since the hand last passed
+	sum  uint32      // CRC32 of Data at insertion, checked when verify is set
+}
+
+func newHotCache(size int) *hotCache {
+	perShard := (size + hotShards - 1) / hotShards
+	if perShard < 1 {
+		perShard = 1
+	}
+	hc := &hotCache{perShard: perShard}
+	for i := range hc.shards {
+		hc.shards[i].entries = map[string]*hotEntry{}
+	}
+	return hc
+}
+
+func (hc *hotCache) shard(key string) *hotShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &hc.shards[h.Sum32()%hotShards]
+}
+
+// get returns a copy of the item for key if it is cached and not expired
+// at now. The returned item's Data is the shared in-memory buffer.
+func (hc *hotCache) get(key string, now time.Time) (CacheItem, bool) {
+	s := hc.shard(key)
+	s.mu.RLock()
+	e, ok := s.entries[key]
+	s.mu.RUnlock()
+	if !ok || now.After(e.item.ExpireAt) {
+		return CacheItem{}, false
+	}
+	e.used.Store(true)
+	if hc.verify && crc32.ChecksumIEEE(e.item.Data) != e.sum {
+		panic(fmt.Sprintf("pie_cache: cached value for key %q was modified after Get; "+
+			"values returned in ZeroCopy mode are read-only", key))
+	}
+	return e.item, true
+}
+
+// generation returns the write generation of the shard of key, to be
+// passed to put for an item read from the store afterwards
+func (hc *hotCache) generation(key string) uint64 {
+	return hc.shard(key).gen.Load()
+}
+
+// put stores item under key, evicting an entry when the shard is full.
+// Nothing is stored if a key of the shard was removed since gen was taken,
+// as item may then predate a write.
+func (hc *hotCache) put(key string, item CacheItem, gen uint64) {
+	s := hc.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen.Load() != gen {
+		return
+	}
+
+	e := &hotEntry{item: item}
+	if hc.verify {
+		e.sum = crc32.ChecksumIEEE(item.Data)
+	}
+	if old, ok := s.entries[key]; ok {
+		e.slot = old.slot
+	} else if len(s.ring) < hc.perShard {
+		e.slot = len(s.ring)
+		s.ring = append(s.ring, key)
+	} else {
+		for s.entries[s.ring[s.hand]].used.Swap(false) {
+			s.hand = (s.hand + 1) % len(s.ring)
+		}
+		delete(s.entries, s.ring[s.hand])
+		e.slot = s.hand
+		s.ring[s.hand] = key
+		s.hand = (s.hand + 1) % len(s.ring)
+	}
+	s.entries[key] = e
+}
+
+// remove drops key from the hot cache
+func (hc *hotCache) remove(key string) {
+	s := hc.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen.Add(1)
+
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	delete(s.entries, key)
+	last := len(s.ring) - 1
+	if e.slot != last {
+		moved := s.ring[last]
+		s.ring[e.slot] = moved
+		s.entries[moved].slot = e.slot
+	}
+	s.ring = s.ring[:last]
+	if s.hand >= len(s.ring) {
+		s.hand = 0
+	}
+}
+
+// clear drops every entry from the hot cache
+func (hc *hotCache) clear() {
+	for i := range hc.shards {
+		s := &hc.shards[i]
+		s.mu.Lock()
+		s.gen.Add(1)
+		s.entries = map[string]*hotEntry{}
+		s.ring = nil
+		s.hand = 0
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,170 @@
+package pie_cache
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHotCache(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_hot")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithHotCache(4))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	if err := cache.Set("hot", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := cache.Get("hot"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	// Remove the file behind the cache's back: the hot copy must still serve
+	filePath, _ := cache.getFilePath("hot")
+	if err := os.Remove(filePath); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	got, err := cache.Get("hot")
+	if err != nil || string(got) != "value" {
+		t.Fatalf("Expected hot hit, got %q, %v", got, err)
+	}
+
+	// Returned slices are copies
+	got[0] = 'X'
+	if again, _ := cache.Get("hot"); string(again) != "value" {
+		t.Errorf("Hot entry was mutated through returned slice: %q", again)
+	}
+
+	// Set invalidates the hot entry
+	if err := cache.Set("hot", []byte("new")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, _ := cache.Get("hot"); string(got) != "new" {
+		t.Errorf("Expected %q after Set, got %q", "new", got)
+	}
+
+	// Delete invalidates the hot entry
+	if err := cache.Delete("hot"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := cache.Get("hot"); err == nil {
+		t.Error("Expected miss after Delete")
+	}
+}
+
+func TestHotCacheBounds(t *testing.T) {
+	hc := newHotCache(hotShards)
+	now := time.Now()
+
+	hc.put("a", CacheItem{Key: "a", Data: []byte("1"), ExpireAt: now.Add(time.Minute)}, 0)
+	if _, ok := hc.get("a", now); !ok {
+		t.Error("Expected entry to be present")
+	}
+	if _, ok := hc.get("a", now.Add(2*time.Minute)); ok {
+		t.Error("Expected expired entry to be ignored")
+	}
+
+	// One slot per shard: a second key in the same shard evicts the first
+	s := hc.shard("a")
+	for i := 0; i < 1000; i++ {
+		k := string(rune('b' + i))
+		if hc.shard(k) == s {
+			hc.put(k, CacheItem{Key: k, Data: []byte("2"), ExpireAt: now.Add(time.Minute)}, 0)
+			break
+		}
+	}
+	if _, ok := hc.get("a", now); ok {
+		t.Error("Expected oldest entry to be evicted")
+	}
+}
+
+func TestHotCacheClock(t *testing.T) {
+	hc := newHotCache(2 * hotShards)
+	now := time.Now()
+
+	// Three keys sharing a shard of two slots
+	var keys []string
+	s := hc.shard("a")
+	for i := 0; len(keys) < 3; i++ {
+		if k := strconv.Itoa(i); hc.shard(k) == s {
+			keys = append(keys, k)
+		}
+	}
+	put := func(k string) {
+		hc.put(k, CacheItem{Key: k, ExpireAt: now.Add(time.Minute)}, hc.generation(k))
+	}
+
+	// A read spares an entry from the next eviction
+	put(keys[0])
+	put(keys[1])
+	_, _ = hc.get(keys[0], now)
+	put(keys[2])
+	if _, ok := hc.get(keys[0], now); !ok {
+		t.Error("Expected the entry read since the last eviction kept")
+	}
+	if _, ok := hc.get(keys[1], now); ok {
+		t.Error("Expected the unread entry evicted")
+	}
+
+	// Removal frees a slot without evicting
+	hc.remove(keys[0])
+	put(keys[1])
+	if _, ok := hc.get(keys[2], now); !ok {
+		t.Error("Expected the entry kept while the shard has room")
+	}
+	if n := hotLen(hc); n != 2 {
+		t.Errorf("Expected 2 entries, got %d", n)
+	}
+}
+
+func TestHotCacheConcurrentSet(t *testing.T) {
+	store := &hookStore{MemoryStore: NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Minute, WithHotCache(16))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("k", []byte("old"))
+
+	// A Set landing between the read and the hot cache fill must not be
+	// hidden by the value read before it
+	store.onFetch = func() { _ = cache.Set("k", []byte("new")) }
+	_, _ = cache.Get("k")
+	if got, err := cache.Get("k"); err != nil || string(got) != "new" {
+		t.Errorf("Expected the new value, got %q, %v", got, err)
+	}
+
+	// Readers racing a writer must see its last value once it is done
+	const writes = 200
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					_, _ = cache.Get("race")
+				}
+			}
+		}()
+	}
+	for i := 1; i <= writes; i++ {
+		_ = cache.Set("race", []byte(strconv.Itoa(i)))
+	}
+	close(done)
+	wg.Wait()
+	if got, err := cache.Get("race"); err != nil || string(got) != strconv.Itoa(writes) {
+		t.Errorf("Expected %d, got %q, %v", writes, got, err)
+	}
+}
@@ -0,0 +1,331 @@
+// Package httpcache provides net/http middleware that stores complete
+// responses in a pie_cache.FileCache and replays them for later requests.
+//
+// Responses to GET and HEAD requests are cached by method, host and URL,
+// plus the request headers named in the response's Vary header. Freshness
+// comes from Cache-Control max-age/s-maxage; responses marked no-store,
+// no-cache or private, responses setting cookies and requests sending
+// no-store are never cached. As a shared cache, the middleware only stores
+// responses to requests with Authorization when the response allows it
+// with public, s-maxage or must-revalidate (RFC 9111 section 3.5).
+//
+// Transport does the same on the client side as an http.RoundTripper.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// HeaderCache reports whether a response was served from the cache
+const HeaderCache = "X-Cache"
+
+// defaultMaxBodySize limits the responses that are cached unless configured
+const defaultMaxBodySize = 10 << 20
+
+// cacheableStatus lists the status codes that may be cached
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// Option configures the middleware
+type Option func(*middleware)
+
+// WithDefaultTTL caches responses without an explicit max-age for ttl.
+// By default such responses are not cached.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(m *middleware) {
+		m.defaultTTL = ttl
+	}
+}
+
+// WithMaxBodySize skips caching responses larger than n bytes
+func WithMaxBodySize(n int) Option {
+	return func(m *middleware) {
+		if n > 0 {
+			m.maxBodySize = n
+		}
+	}
+}
+
+type middleware struct {
+	cache       *pie_cache.FileCache
+	defaultTTL  time.Duration
+	maxBodySize int
+}
+
+// cachedResponse is what the middleware stores for a request. An entry
+// with Vary set and no status only records which request headers select
+// the variant.
+type cachedResponse struct {
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	Vary   []string    `json:"vary,omitempty"`
+
+	FreshUntil time.Time `json:"freshUntil,omitempty"` // End of freshness, for Transport
+}
+
+// Middleware returns a function wrapping handlers with a response cache
+// backed by cache
+func Middleware(cache *pie_cache.FileCache, opts ...Option) func(http.Handler) http.Handler {
+	m := &middleware{cache: cache, maxBodySize: defaultMaxBodySize}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.serve(next, w, r)
+		})
+	}
+}
+
+func (m *middleware) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+	reqCC := parseCacheControl(r.Header.Get("Cache-Control"))
+	if _, ok := reqCC["no-store"]; ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	base := baseKey(r)
+	if _, ok := reqCC["no-cache"]; !ok && m.replay(w, r, base) {
+		return
+	}
+
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK, limit: m.maxBodySize}
+	w.Header().Set(HeaderCache, "MISS")
+	next.ServeHTTP(rec, r)
+	m.store(r, base, rec)
+}
+
+// replay writes the cached response for r, reporting whether there was one
+func (m *middleware) replay(w http.ResponseWriter, r *http.Request, base string) bool {
+	resp, created, ok := lookup(m.cache, base, r)
+	if !ok {
+		return false
+	}
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(created)/time.Second)))
+	w.Header().Set(HeaderCache, "HIT")
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		w.Write(resp.Body)
+	}
+	return true
+}
+
+// lookup returns the response stored for r under base, following the Vary
+// index if there is one, and when it was stored
+func lookup(cache *pie_cache.FileCache, base string, r *http.Request) (*cachedResponse, time.Time, bool) {
+	resp, created, ok := load(cache, base)
+	if ok && resp.Status == 0 && len(resp.Vary) > 0 {
+		resp, created, ok = load(cache, variantKey(base, resp.Vary, r))
+	}
+	if !ok || resp.Status == 0 {
+		return nil, time.Time{}, false
+	}
+	return resp, created, true
+}
+
+// load fetches and decodes the entry under key
+func load(cache *pie_cache.FileCache, key string) (*cachedResponse, time.Time, bool) {
+	data, meta, err := cache.GetWithMeta(key)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	var resp cachedResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, time.Time{}, false
+	}
+	return &resp, meta.Created, true
+}
+
+// store saves the recorded response if it may be cached
+func (m *middleware) store(r *http.Request, base string, rec *recorder) {
+	if rec.overflow || !cacheableStatus[rec.status] {
+		return
+	}
+	header := rec.Header()
+	if header.Get("Set-Cookie") != "" {
+		return
+	}
+
+	respCC := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := respCC["no-store"]; ok {
+		return
+	}
+	if _, ok := respCC["private"]; ok {
+		return
+	}
+	// Stored responses are replayed without revalidation
+	if _, ok := respCC["no-cache"]; ok {
+		return
+	}
+	if r.Header.Get("Authorization") != "" && !sharedWithAuthorization(respCC) {
+		return
+	}
+	ttl := m.defaultTTL
+	if age, ok := maxAge(respCC); ok {
+		ttl = age
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	stored := header.Clone()
+	stored.Del(HeaderCache)
+	save(m.cache, base, r, &cachedResponse{Status: rec.status, Header: stored, Body: rec.body.Bytes()}, ttl)
+}
+
+// sharedWithAuthorization reports whether a response to a request with
+// Authorization may be stored by a shared cache
+func sharedWithAuthorization(cc map[string]string) bool {
+	for _, name := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := cc[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// save stores resp for r under base for ttl, writing a Vary index first
+// when the response varies by request headers. Responses with Vary: * are
+// not stored.
+func save(cache *pie_cache.FileCache, base string, r *http.Request, resp *cachedResponse, ttl time.Duration) {
+	var vary []string
+	for _, v := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	for _, name := range vary {
+		if name == "*" {
+			return
+		}
+	}
+
+	key := base
+	if len(vary) > 0 {
+		index, _ := json.Marshal(cachedResponse{Vary: vary})
+		if err := cache.SetWithTTL(base, index, ttl); err != nil {
+			return
+		}
+		key = variantKey(base, vary, r)
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	_ = cache.SetWithTTL(key, data, ttl)
+}
+
+// baseKey identifies the resource r asks for. URLs are hashed so that
+// arbitrary paths make safe cache keys.
+func baseKey(r *http.Request) string {
+	return hashKey(r.Method + " " + r.Host + r.URL.RequestURI())
+}
+
+// variantKey extends base with the values of the vary headers in r
+func variantKey(base string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return hashKey(b.String())
+}
+
+// hashKey turns s into a cache key in the http namespace
+func hashKey(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "http:" + hex.EncodeToString(sum[:])
+}
+
+// parseCacheControl splits a Cache-Control header into its directives
+func parseCacheControl(value string) map[string]string {
+	cc := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return cc
+}
+
+// maxAge returns the freshness lifetime set by s-maxage or max-age
+func maxAge(cc map[string]string) (time.Duration, bool) {
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[name]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, true
+			}
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// recorder passes a response through to the client while keeping a copy
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	limit       int
+	overflow    bool
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	if !rec.overflow {
+		if rec.body.Len()+len(p) > rec.limit {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(p)
+		}
+	}
+	return rec.ResponseWriter.Write(p)
+}
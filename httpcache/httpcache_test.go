@@ -0,0 +1,133 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+func TestMiddleware(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_httpcache")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := pie_cache.NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	calls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "page %d", calls)
+	})
+	mux.HandleFunc("/lang", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "lang %s", r.Header.Get("Accept-Language"))
+	})
+	mux.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		fmt.Fprint(w, "secret")
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "account of %s", r.Header.Get("Authorization"))
+	})
+	mux.HandleFunc("/logo", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		fmt.Fprint(w, "logo")
+	})
+	mux.HandleFunc("/revalidate", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "no-cache, max-age=60")
+		fmt.Fprintf(w, "revalidate %d", calls)
+	})
+	h := Middleware(cache)(mux)
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first, second := get("/page"), get("/page")
+	if first.Header().Get(HeaderCache) != "MISS" || second.Header().Get(HeaderCache) != "HIT" {
+		t.Errorf("Expected MISS then HIT, got %q then %q", first.Header().Get(HeaderCache), second.Header().Get(HeaderCache))
+	}
+	if second.Body.String() != "page 1" || second.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected replayed page 1 with headers, got %q %v", second.Body.String(), second.Header())
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 handler call, got %d", calls)
+	}
+
+	// no-cache revalidates, no-store bypasses the cache entirely
+	if rec := get("/page", "Cache-Control", "no-cache"); rec.Body.String() != "page 2" {
+		t.Errorf("Expected fresh page 2 with no-cache, got %q", rec.Body.String())
+	}
+	if rec := get("/page"); rec.Body.String() != "page 2" {
+		t.Errorf("Expected no-cache response to be stored, got %q", rec.Body.String())
+	}
+
+	calls = 0
+	get("/lang", "Accept-Language", "en")
+	get("/lang", "Accept-Language", "de")
+	en := get("/lang", "Accept-Language", "en")
+	de := get("/lang", "Accept-Language", "de")
+	if calls != 2 || en.Body.String() != "lang en" || de.Body.String() != "lang de" {
+		t.Errorf("Expected one call per variant, got %d calls, %q, %q", calls, en.Body.String(), de.Body.String())
+	}
+
+	calls = 0
+	get("/private")
+	get("/private")
+	if calls != 2 {
+		t.Errorf("Expected private responses not to be cached, got %d calls", calls)
+	}
+
+	// Responses to authorized requests are not shared unless marked public
+	calls = 0
+	get("/account", "Authorization", "Bearer alice")
+	if rec := get("/account", "Authorization", "Bearer bob"); rec.Body.String() != "account of Bearer bob" || calls != 2 {
+		t.Errorf("Expected no shared replay of an authorized response, got %q after %d calls", rec.Body.String(), calls)
+	}
+	calls = 0
+	get("/logo", "Authorization", "Bearer alice")
+	get("/logo", "Authorization", "Bearer bob")
+	if calls != 1 {
+		t.Errorf("Expected a public response to an authorized request to be cached, got %d calls", calls)
+	}
+
+	// A response marked no-cache would need revalidation before reuse
+	calls = 0
+	get("/revalidate")
+	if rec := get("/revalidate"); rec.Body.String() != "revalidate 2" || calls != 2 {
+		t.Errorf("Expected a no-cache response not to be replayed, got %q", rec.Body.String())
+	}
+
+	req := httptest.NewRequest("POST", "/page", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get(HeaderCache) != "" {
+		t.Errorf("Expected POST to bypass the cache")
+	}
+}
@@ -0,0 +1,199 @@
+package httpcache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// staleRetention is how long responses with validators are kept after they
+// go stale, so they can be revalidated with a conditional request
+const staleRetention = 24 * time.Hour
+
+// Transport is an http.RoundTripper that caches GET responses on disk as a
+// private client cache. Fresh responses are served without a request;
+// stale ones carrying an ETag or Last-Modified are revalidated with a
+// conditional request and refreshed on 304 Not Modified.
+type Transport struct {
+	cache *pie_cache.FileCache
+	next  http.RoundTripper
+}
+
+// NewTransport returns a Transport storing responses in cache and sending
+// requests through next, or http.DefaultTransport if next is nil
+func NewTransport(cache *pie_cache.FileCache, next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{cache: cache, next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+	reqCC := parseCacheControl(req.Header.Get("Cache-Control"))
+	if _, ok := reqCC["no-store"]; ok {
+		return t.next.RoundTrip(req)
+	}
+
+	base := hashKey("client " + req.URL.String())
+	cached, created, ok := lookup(t.cache, base, req)
+	if !ok {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return t.store(req, base, resp)
+	}
+
+	if _, noCache := reqCC["no-cache"]; !noCache && time.Now().Before(cached.FreshUntil) {
+		return cached.response(req, created, "HIT"), nil
+	}
+
+	etag, lastModified := cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return t.store(req, base, resp)
+	}
+
+	cond := req.Clone(req.Context())
+	if etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		cond.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := t.next.RoundTrip(cond)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		return t.store(req, base, resp)
+	}
+
+	// Not modified: refresh the stored headers and freshness
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	for name, values := range resp.Header {
+		cached.Header[name] = values
+	}
+	if ttl, ok := cached.refresh(time.Now()); ok {
+		save(t.cache, base, req, cached, ttl)
+	}
+	return cached.response(req, time.Now(), "REVALIDATED"), nil
+}
+
+// store caches resp if it may be stored and returns it with a readable body
+func (t *Transport) store(req *http.Request, base string, resp *http.Response) (*http.Response, error) {
+	if !cacheableStatus[resp.StatusCode] {
+		return resp, nil
+	}
+	cc := parseCacheControl(resp.Header.Get("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return resp, nil
+	}
+
+	cached := &cachedResponse{Status: resp.StatusCode, Header: resp.Header.Clone()}
+	ttl, ok := cached.refresh(time.Now())
+	if !ok {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, defaultMaxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if len(body) > defaultMaxBodySize {
+		// Too large to cache; hand back what was read followed by the rest
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	cached.Body = body
+	save(t.cache, base, req, cached, ttl)
+	return resp, nil
+}
+
+// refresh recomputes FreshUntil from the stored headers as of now. It
+// returns how long to keep the entry, and false if it is not worth storing.
+func (c *cachedResponse) refresh(now time.Time) (time.Duration, bool) {
+	lifetime := freshnessLifetime(c.Header, now)
+	if age, err := strconv.Atoi(c.Header.Get("Age")); err == nil {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	c.FreshUntil = now.Add(lifetime)
+
+	ttl := lifetime
+	if c.Header.Get("ETag") != "" || c.Header.Get("Last-Modified") != "" {
+		ttl += staleRetention
+	}
+	return ttl, ttl > 0
+}
+
+// freshnessLifetime returns how long a response stays fresh in a private
+// cache, from Cache-Control max-age or Expires
+func freshnessLifetime(header http.Header, now time.Time) time.Duration {
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if v, ok := cc["max-age"]; ok {
+		secs, err := strconv.Atoi(v)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		date := now
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		return expires.Sub(date)
+	}
+	return 0
+}
+
+// response builds an http.Response for req from the stored response
+func (c *cachedResponse) response(req *http.Request, created time.Time, state string) *http.Response {
+	header := c.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(time.Since(created)/time.Second)))
+	header.Set(HeaderCache, state)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.Status, http.StatusText(c.Status)),
+		StatusCode:    c.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// readCloser combines a reader with the closer of the underlying body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
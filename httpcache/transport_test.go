@@ -0,0 +1,87 @@
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+func TestTransport(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_transport")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := pie_cache.NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	var calls, notModified atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fresh", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "fresh %d", n)
+	})
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "tagged")
+	})
+	mux.HandleFunc("/nostore", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintf(w, "nostore %d", n)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(cache, nil)}
+	get := func(path string) (string, string) {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.Header.Get(HeaderCache)
+	}
+
+	get("/fresh")
+	if body, state := get("/fresh"); body != "fresh 1" || state != "HIT" {
+		t.Errorf("Expected cached fresh 1, got %q (%s)", body, state)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 origin call, got %d", calls.Load())
+	}
+
+	calls.Store(0)
+	get("/etag")
+	if body, state := get("/etag"); body != "tagged" || state != "REVALIDATED" {
+		t.Errorf("Expected revalidated body, got %q (%s)", body, state)
+	}
+	if calls.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("Expected one full and one conditional request, got %d calls, %d not modified", calls.Load(), notModified.Load())
+	}
+
+	calls.Store(0)
+	get("/nostore")
+	if body, _ := get("/nostore"); body != "nostore 2" || calls.Load() != 2 {
+		t.Errorf("Expected no-store responses to be fetched each time, got %q", body)
+	}
+}
@@ -0,0 +1,219 @@
+// Package httpclient provides RemoteCache, a client for caches served by
+// the httpserver package. It mirrors the FileCache API, so an application
+// can move between a local cache directory and a shared cache node without
+// changing call sites. PeerLoader lets a fleet of nodes ask each other
+// for missing keys before going to the origin.
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ser163/pie_cache"
+	"github.com/ser163/pie_cache/httpserver"
+)
+
+// RemoteCache talks to a cache node over HTTP
+type RemoteCache struct {
+	baseURL string
+	client  *http.Client
+	apiKey  string
+}
+
+var _ pie_cache.Cache = (*RemoteCache)(nil)
+
+// Option configures a RemoteCache
+type Option func(*RemoteCache)
+
+// WithHTTPClient sends requests through client, e.g. one configured with a
+// tlsconfig.Client TLS configuration
+func WithHTTPClient(client *http.Client) Option {
+	return func(rc *RemoteCache) {
+		rc.client = client
+	}
+}
+
+// WithAPIKey authenticates every request with key
+func WithAPIKey(key string) Option {
+	return func(rc *RemoteCache) {
+		rc.apiKey = key
+	}
+}
+
+// New creates a client for the cache node at baseURL, e.g.
+// "https://cache.internal:8080"
+func New(baseURL string, opts ...Option) *RemoteCache {
+	rc := &RemoteCache{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	return rc
+}
+
+// Set adds or updates a cache item with the node's default TTL
+func (rc *RemoteCache) Set(key string, data []byte) error {
+	return rc.SetWithTTL(key, data, 0)
+}
+
+// SetWithTTL adds or updates a cache item with the specified TTL. A zero
+// ttl uses the node's default.
+func (rc *RemoteCache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	u := rc.keyURL(key)
+	if ttl > 0 {
+		u += "?ttl=" + url.QueryEscape(ttl.String())
+	}
+	resp, err := rc.do(http.MethodPut, u, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get retrieves a cache item
+func (rc *RemoteCache) Get(key string) ([]byte, error) {
+	data, _, err := rc.GetWithMeta(key)
+	return data, err
+}
+
+// GetString retrieves a cache item as string
+func (rc *RemoteCache) GetString(key string) (string, error) {
+	data, err := rc.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetWithMeta retrieves a cache item together with the metadata the node
+// reports in its response headers. When the node sends a payload checksum
+// the data is checked against it, failing with pie_cache.ErrCorrupted if
+// it was damaged on the way.
+func (rc *RemoteCache) GetWithMeta(key string) ([]byte, pie_cache.ItemMeta, error) {
+	resp, err := rc.do(http.MethodGet, rc.keyURL(key), nil)
+	if err != nil {
+		return nil, pie_cache.ItemMeta{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, pie_cache.ItemMeta{}, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	meta := pie_cache.ItemMeta{Key: key, Size: len(data)}
+	if secs, err := strconv.ParseInt(resp.Header.Get(httpserver.HeaderTTLRemaining), 10, 64); err == nil {
+		meta.ExpireAt = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	if created, err := time.Parse(time.RFC3339, resp.Header.Get(httpserver.HeaderCreated)); err == nil {
+		meta.Created = created
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		meta.Checksum = strings.Trim(etag, `"`)
+		if pie_cache.Checksum(data) != meta.Checksum {
+			return nil, pie_cache.ItemMeta{}, pie_cache.ErrCorrupted
+		}
+	}
+	return data, meta, nil
+}
+
+// GetWithChecksum retrieves a cache item together with its payload
+// checksum, which is empty if the node does not store checksums
+func (rc *RemoteCache) GetWithChecksum(key string) ([]byte, string, error) {
+	data, meta, err := rc.GetWithMeta(key)
+	return data, meta.Checksum, err
+}
+
+// Exists checks if a cache item exists and is not expired
+func (rc *RemoteCache) Exists(key string) bool {
+	resp, err := rc.do(http.MethodHead, rc.keyURL(key), nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+// Delete removes a cache item
+func (rc *RemoteCache) Delete(key string) error {
+	resp, err := rc.do(http.MethodDelete, rc.keyURL(key), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PurgeExpired asks the node to remove all expired cache items
+func (rc *RemoteCache) PurgeExpired() error {
+	resp, err := rc.do(http.MethodPost, rc.baseURL+"/purge", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Stats returns the node's operation counters
+func (rc *RemoteCache) Stats() (pie_cache.CacheStats, error) {
+	var stats pie_cache.CacheStats
+	resp, err := rc.do(http.MethodGet, rc.baseURL+"/stats", nil)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return stats, fmt.Errorf("failed to parse stats: %v", err)
+	}
+	return stats, nil
+}
+
+// ConcurrentSafe implements pie_cache.ConcurrencyReporter
+func (rc *RemoteCache) ConcurrentSafe() bool { return true }
+
+// keyURL returns the URL of key on the node
+func (rc *RemoteCache) keyURL(key string) string {
+	return rc.baseURL + "/cache/" + url.PathEscape(key)
+}
+
+// do sends a request and maps error statuses to the cache's errors. The
+// caller must close the body of a successful response.
+func (rc *RemoteCache) do(method, u string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if rc.apiKey != "" {
+		req.Header.Set(httpserver.HeaderAPIKey, rc.apiKey)
+	}
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach cache node: %v", err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, pie_cache.ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, pie_cache.ErrAccessDenied
+	default:
+		return nil, fmt.Errorf("cache node returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
@@ -0,0 +1,95 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+	"github.com/ser163/pie_cache/httpserver"
+)
+
+func TestRemoteCache(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_remote")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	local, err := pie_cache.NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	auth := pie_cache.APIKeys(map[string]string{"secret": "app"})
+	srv := httptest.NewServer(httpserver.NewHandler(local, httpserver.WithAuthorizer(auth)))
+	defer srv.Close()
+
+	rc := New(srv.URL, WithAPIKey("secret"))
+
+	key := "page:/docs/intro?lang=en"
+	if err := rc.SetWithTTL(key, []byte("hello"), 30*time.Second); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	// Written through the node, readable locally under the same key
+	if v, err := local.GetString(key); err != nil || v != "hello" {
+		t.Errorf("Expected local hello, got %q, %v", v, err)
+	}
+
+	data, meta, err := rc.GetWithMeta(key)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("Expected hello, got %q, %v", data, err)
+	}
+	if ttl := meta.TTLRemaining(time.Now()); ttl <= 0 || ttl > 30*time.Second {
+		t.Errorf("Expected TTL within 30s, got %v", ttl)
+	}
+	if !rc.Exists(key) {
+		t.Error("Exists returned false for existing key")
+	}
+
+	if err := rc.Delete(key); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if _, err := rc.Get(key); err != pie_cache.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := rc.Delete(key); err != pie_cache.ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+	if err := rc.PurgeExpired(); err != nil {
+		t.Errorf("PurgeExpired failed: %v", err)
+	}
+	if stats, err := rc.Stats(); err != nil || stats.Sets != 1 || stats.Deletes != 1 {
+		t.Errorf("Unexpected stats %+v, %v", stats, err)
+	}
+
+	if err := New(srv.URL).Set("k", []byte("x")); err != pie_cache.ErrAccessDenied {
+		t.Errorf("Expected ErrAccessDenied without API key, got %v", err)
+	}
+}
+
+func TestRemoteCacheChecksum(t *testing.T) {
+	local, err := pie_cache.NewWithStore(pie_cache.NewMemoryStore(), time.Minute, pie_cache.WithChecksum(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = local.Set("k", []byte("payload"))
+	srv := httptest.NewServer(httpserver.NewHandler(local))
+	defer srv.Close()
+
+	data, sum, err := New(srv.URL).GetWithChecksum("k")
+	if err != nil || string(data) != "payload" || sum != pie_cache.Checksum(data) {
+		t.Errorf("GetWithChecksum returned %q, %q, %v", data, sum, err)
+	}
+
+	// A payload damaged between node and client
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"`+sum+`"`)
+		w.Write([]byte("paylaod"))
+	}))
+	defer bad.Close()
+	if _, err := New(bad.URL).Get("k"); err != pie_cache.ErrCorrupted {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+}
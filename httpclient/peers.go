@@ -0,0 +1,51 @@
+package httpclient
+
+import (
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// PeerLoader returns a loader for pie_cache.WithLoader, RegisterLoader or
+// GetOrLoad that asks peers for a missing key before calling origin,
+// groupcache-style, so a fleet of nodes shares what any of them cached.
+// All peers are asked at once; the first to hold the key wins and its
+// remaining TTL is kept. Peers that miss or cannot be reached count as
+// misses. Peers answer from their own cache without running loaders, so
+// nodes that are each other's peers do not ask each other in circles.
+func PeerLoader(peers []*RemoteCache, origin pie_cache.LoaderFunc) pie_cache.LoaderFunc {
+	return func(key string) ([]byte, time.Duration, error) {
+		if data, ttl, ok := askPeers(peers, key); ok {
+			return data, ttl, nil
+		}
+		return origin(key)
+	}
+}
+
+// peerAnswer is the reply of a peer to askPeers
+type peerAnswer struct {
+	data []byte
+	ttl  time.Duration
+	ok   bool
+}
+
+// askPeers asks every peer for key and returns the first value found
+func askPeers(peers []*RemoteCache, key string) ([]byte, time.Duration, bool) {
+	// Buffered so that peers answering after the winner do not block
+	answers := make(chan peerAnswer, len(peers))
+	for _, peer := range peers {
+		go func() {
+			data, meta, err := peer.GetWithMeta(key)
+			// Under a second left is reported as 0, which a loader would
+			// take as the default TTL
+			ttl := meta.TTLRemaining(time.Now())
+			answers <- peerAnswer{data: data, ttl: ttl, ok: err == nil && ttl >= time.Second}
+		}()
+	}
+	for range peers {
+		if a := <-answers; a.ok {
+			return a.data, a.ttl, true
+		}
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+	"github.com/ser163/pie_cache/httpserver"
+)
+
+func TestPeerLoader(t *testing.T) {
+	var peers []*RemoteCache
+	var nodes []*pie_cache.FileCache
+	for range 2 {
+		node, err := pie_cache.NewWithStore(pie_cache.NewMemoryStore(), time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		srv := httptest.NewServer(httpserver.NewHandler(node))
+		defer srv.Close()
+		nodes = append(nodes, node)
+		peers = append(peers, New(srv.URL))
+	}
+	// A peer that is down counts as a miss
+	peers = append(peers, New("http://127.0.0.1:1"))
+
+	var origin atomic.Int32
+	load := func(key string) ([]byte, time.Duration, error) {
+		origin.Add(1)
+		return []byte("origin"), 0, nil
+	}
+	local, err := pie_cache.NewWithStore(pie_cache.NewMemoryStore(), time.Minute,
+		pie_cache.WithLoader(PeerLoader(peers, load)))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	_ = nodes[1].SetWithTTL("shared", []byte("peer"), 30*time.Second)
+	if v, err := local.GetString("shared"); err != nil || v != "peer" {
+		t.Errorf("Expected the peer's value, got %q, %v", v, err)
+	}
+	if meta, _ := local.Inspect("shared"); meta.TTLRemaining(time.Now()) > 30*time.Second {
+		t.Errorf("Expected the peer's TTL kept, got %v", meta.ExpireAt)
+	}
+
+	if v, err := local.GetString("fresh"); err != nil || v != "origin" {
+		t.Errorf("Expected the origin's value, got %q, %v", v, err)
+	}
+	if n := origin.Load(); n != 1 {
+		t.Errorf("Expected 1 origin load, got %d", n)
+	}
+}
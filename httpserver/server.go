@@ -0,0 +1,292 @@
+// Package httpserver exposes a pie_cache.FileCache over HTTP, so processes
+// that are not written in Go can share the cache and operators can inspect
+// it with curl.
+//
+// Routes:
+//
+//	GET    /cache/{key}  value as the response body, with the payload checksum
+//	                     as ETag when the cache stores checksums
+//	PUT    /cache/{key}  store the request body (optional ?ttl=30s)
+//	DELETE /cache/{key}  remove the entry
+//	GET    /stats        operation counters and recent hit ratios as JSON
+//	POST   /purge        remove expired entries
+//
+// WithReadOnly serves only the GET routes.
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// Response headers describing a returned entry
+const (
+	HeaderTTLRemaining = "X-Cache-TTL-Remaining" // Whole seconds until the entry expires
+	HeaderCreated      = "X-Cache-Created"       // Creation time in RFC 3339 format
+	HeaderAPIKey       = "X-API-Key"             // Credential passed to the Authorizer
+	HeaderRequestID    = "X-Request-ID"          // Trace ID attached to cache events and access requests
+)
+
+// defaultMaxBodySize limits PUT bodies unless configured
+const defaultMaxBodySize = 32 << 20
+
+// Option configures a handler
+type Option func(*handler)
+
+// WithAuthorizer checks every request with auth before it reaches the cache
+func WithAuthorizer(auth pie_cache.Authorizer) Option {
+	return func(h *handler) {
+		h.auth = auth
+	}
+}
+
+// WithMaxBodySize limits the size of stored values to n bytes
+func WithMaxBodySize(n int64) Option {
+	return func(h *handler) {
+		if n > 0 {
+			h.maxBodySize = n
+		}
+	}
+}
+
+// WithReadOnly serves only the routes reading the cache and answers the
+// others with 405 Method Not Allowed. Pair it with a cache opened with
+// pie_cache.WithReadOnly to serve another service's cache directory
+// without changing it.
+func WithReadOnly() Option {
+	return func(h *handler) {
+		h.readOnly = true
+	}
+}
+
+type handler struct {
+	cache       *pie_cache.FileCache
+	auth        pie_cache.Authorizer
+	maxBodySize int64
+	readOnly    bool
+	mux         *http.ServeMux
+}
+
+// NewHandler returns an http.Handler serving cache
+func NewHandler(cache *pie_cache.FileCache, opts ...Option) http.Handler {
+	h := &handler{
+		cache:       cache,
+		maxBodySize: defaultMaxBodySize,
+		mux:         http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	put, del, purge := h.put, h.delete, h.purge
+	if h.readOnly {
+		put, del, purge = readOnly, readOnly, readOnly
+	}
+	h.mux.HandleFunc("GET /cache/{key...}", h.get)
+	h.mux.HandleFunc("PUT /cache/{key...}", put)
+	h.mux.HandleFunc("DELETE /cache/{key...}", del)
+	h.mux.HandleFunc("GET /stats", h.stats)
+	h.mux.HandleFunc("POST /purge", purge)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorize runs the configured Authorizer and writes the rejection if it
+// fails. It reports whether the request may proceed.
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request, op pie_cache.Operation, key string) bool {
+	if h.auth == nil {
+		return true
+	}
+
+	req := &pie_cache.AccessRequest{
+		Op:         op,
+		Key:        key,
+		Namespace:  pie_cache.NamespaceOf(key),
+		APIKey:     apiKey(r),
+		RemoteAddr: r.RemoteAddr,
+		TraceID:    r.Header.Get(HeaderRequestID),
+	}
+	if r.TLS != nil {
+		req.PeerCertificates = r.TLS.PeerCertificates
+	}
+	if err := h.auth.Authorize(req); err != nil {
+		status := http.StatusForbidden
+		if req.APIKey == "" && req.PeerCertificates == nil {
+			status = http.StatusUnauthorized
+		}
+		http.Error(w, err.Error(), status)
+		return false
+	}
+	return true
+}
+
+// apiKey returns the credential from the X-API-Key header or a bearer token
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ""
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+	if !h.authorize(w, r, pie_cache.OpRead, key) {
+		return
+	}
+
+	data, meta, err := h.cache.GetWithMetaContext(traceContext(r), key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set(HeaderTTLRemaining, strconv.FormatInt(int64(meta.TTLRemaining(time.Now())/time.Second), 10))
+	w.Header().Set(HeaderCreated, meta.Created.UTC().Format(time.RFC3339))
+	if meta.Checksum != "" {
+		etag := `"` + meta.Checksum + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+func (h *handler) put(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+	if !h.authorize(w, r, pie_cache.OpWrite, key) {
+		return
+	}
+
+	var ttl time.Duration
+	if s := r.URL.Query().Get("ttl"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", s), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if ttl > 0 {
+		err = h.cache.SetWithTTLContext(traceContext(r), key, data, ttl)
+	} else {
+		err = h.cache.SetContext(traceContext(r), key, data)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+	if !h.authorize(w, r, pie_cache.OpDelete, key) {
+		return
+	}
+
+	if err := h.cache.Delete(key); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r, pie_cache.OpAdmin, "") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.cache.Stats())
+}
+
+func (h *handler) purge(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r, pie_cache.OpAdmin, "") {
+		return
+	}
+
+	if err := h.cache.PurgeExpired(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readOnly rejects requests that would change a read-only cache
+func readOnly(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, pie_cache.ErrReadOnly.Error(), http.StatusMethodNotAllowed)
+}
+
+// writeError maps cache errors to HTTP status codes
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pie_cache.ErrNotFound), errors.Is(err, pie_cache.ErrExpired):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, pie_cache.ErrAccessDenied), errors.Is(err, pie_cache.ErrReadOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, pie_cache.ErrInvalidKey):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, pie_cache.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, pie_cache.ErrNoSpace):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	case errors.Is(err, pie_cache.ErrCollision):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// traceContext returns the context of r carrying the client's request ID
+// as trace ID, if it sent one
+func traceContext(r *http.Request) context.Context {
+	if id := r.Header.Get(HeaderRequestID); id != "" {
+		return pie_cache.WithTraceID(r.Context(), id)
+	}
+	return r.Context()
+}
@@ -0,0 +1,238 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+func TestHandler(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_http")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := pie_cache.NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	srv := httptest.NewServer(NewHandler(cache))
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return resp
+	}
+
+	if resp := do("PUT", "/cache/user:1", "hello"); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 from PUT, got %d", resp.StatusCode)
+	}
+	if resp := do("PUT", "/cache/short?ttl=bogus", "x"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid ttl, got %d", resp.StatusCode)
+	}
+
+	resp := do("GET", "/cache/user:1", "")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("Expected 200 hello, got %d %q", resp.StatusCode, body)
+	}
+	if ttl, _ := strconv.Atoi(resp.Header.Get(HeaderTTLRemaining)); ttl <= 0 || ttl > 60 {
+		t.Errorf("Expected TTL header in (0, 60], got %q", resp.Header.Get(HeaderTTLRemaining))
+	}
+	if _, err := time.Parse(time.RFC3339, resp.Header.Get(HeaderCreated)); err != nil {
+		t.Errorf("Expected RFC 3339 created header, got %q", resp.Header.Get(HeaderCreated))
+	}
+
+	if resp := do("DELETE", "/cache/user:1", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 from DELETE, got %d", resp.StatusCode)
+	}
+	if resp := do("GET", "/cache/user:1", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after DELETE, got %d", resp.StatusCode)
+	}
+	if resp := do("POST", "/purge", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 from purge, got %d", resp.StatusCode)
+	}
+
+	resp = do("GET", "/stats", "")
+	var stats pie_cache.CacheStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	resp.Body.Close()
+	if stats.Sets != 1 || stats.Hits != 1 || stats.Deletes != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestHandlerAuthorizer(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_http_auth")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := pie_cache.NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	auth := pie_cache.Chain(
+		pie_cache.APIKeys(map[string]string{"secret": "web"}),
+		pie_cache.NamespaceACL{"web": {"page": {pie_cache.OpRead, pie_cache.OpWrite}}},
+	)
+	srv := httptest.NewServer(NewHandler(cache, WithAuthorizer(auth)))
+	defer srv.Close()
+
+	tests := []struct {
+		method, path, key string
+		want              int
+	}{
+		{"PUT", "/cache/page:home", "", http.StatusUnauthorized},
+		{"PUT", "/cache/page:home", "secret", http.StatusNoContent},
+		{"PUT", "/cache/user:1", "secret", http.StatusForbidden},
+		{"GET", "/cache/page:home", "secret", http.StatusOK},
+		{"DELETE", "/cache/page:home", "secret", http.StatusForbidden},
+		{"POST", "/purge", "secret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader("x"))
+		if tt.key != "" {
+			req.Header.Set(HeaderAPIKey, tt.key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", tt.method, tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s with key %q: expected %d, got %d", tt.method, tt.path, tt.key, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	var traces []string
+	cache, err := pie_cache.NewWithStore(pie_cache.NewMemoryStore(), time.Minute,
+		pie_cache.WithLogger(pie_cache.LoggerFunc(func(e pie_cache.Event) {
+			traces = append(traces, e.TraceID)
+		})))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	var audited string
+	auth := pie_cache.AuthorizerFunc(func(r *pie_cache.AccessRequest) error {
+		audited = r.TraceID
+		return nil
+	})
+	srv := httptest.NewServer(NewHandler(cache, WithAuthorizer(auth)))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/cache/k", strings.NewReader("v"))
+	req.Header.Set(HeaderRequestID, "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if audited != "abc" {
+		t.Errorf("Expected authorizer to see request ID, got %q", audited)
+	}
+	if len(traces) != 1 || traces[0] != "abc" {
+		t.Errorf("Expected write event with request ID, got %v", traces)
+	}
+}
+
+func TestHandlerETag(t *testing.T) {
+	cache, err := pie_cache.NewWithStore(pie_cache.NewMemoryStore(), time.Minute, pie_cache.WithChecksum(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("k", []byte("payload"))
+	srv := httptest.NewServer(NewHandler(cache))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/cache/k")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag != `"`+pie_cache.Checksum([]byte("payload"))+`"` {
+		t.Errorf("Expected checksum ETag, got %q", etag)
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/cache/k", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching ETag, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerTooLarge(t *testing.T) {
+	cache, err := pie_cache.NewWithStore(pie_cache.NewMemoryStore(), time.Minute, pie_cache.WithMaxValueSize(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	srv := httptest.NewServer(NewHandler(cache))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/cache/k", strings.NewReader("123"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a value over the cache limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadOnlyHandler(t *testing.T) {
+	cache, err := pie_cache.NewMemoryCache(time.Minute, pie_cache.WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	srv := httptest.NewServer(NewHandler(cache, WithReadOnly()))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/cache/missing", http.StatusNotFound},
+		{http.MethodGet, "/stats", http.StatusOK},
+		{http.MethodPut, "/cache/key", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/cache/key", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/purge", http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader("v"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", tc.method, tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, resp.StatusCode)
+		}
+	}
+}
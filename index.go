@@ -0,0 +1,451 @@
+package pie_cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexPrefix holds the shards of the key index
+const indexPrefix = metaPrefix + "index/"
+
+// indexMetaName records the shard count the index was written with
+const indexMetaName = indexPrefix + "meta"
+
+// indexLogSuffix names the change log kept next to each shard snapshot
+const indexLogSuffix = ".log"
+
+// minIndexCompaction is the least number of logged changes that makes a
+// shard worth compacting
+const minIndexCompaction = 256
+
+// WithIndex keeps an index of keys, expiration times and sizes so ListKeys
+// and PurgeExpired do not have to read every entry. The index is split by
+// key hash into shards, each with its own lock, that are loaded only when
+// touched. Changes are appended to a log per shard by FlushIndex, the
+// janitor and Close, and folded into the shard's snapshot once the log
+// outgrows it, so keeping the index current costs little even for
+// millions of keys. An existing cache is indexed on open. PurgeExpired in
+// index mode only sees indexed entries, so corrupt files are left to
+// GetWithMeta and RebuildIndex.
+func WithIndex(shards int) Option {
+	return func(fc *FileCache) {
+		if shards > 0 {
+			fc.indexShards = shards
+		}
+	}
+}
+
+// indexEntry is what the index knows about an entry
+type indexEntry struct {
+	Name     string    `json:"n"`
+	ExpireAt time.Time `json:"e"`
+	Size     int       `json:"s"`
+	Bytes    int       `json:"b,omitempty"` // Encoded size in the store
+}
+
+// indexRecord is a line of a shard's change log
+type indexRecord struct {
+	Key     string `json:"k"`
+	Deleted bool   `json:"d,omitempty"`
+	indexEntry
+}
+
+// keyIndex is the sharded key index of a cache
+type keyIndex struct {
+	store  Store
+	shards []*indexShard
+
+	usageMu    sync.Mutex
+	usage      map[string]NamespaceUsage // Footprint by namespace
+	usageDirty bool
+}
+
+// indexShard holds the entries of the keys hashing to it
+type indexShard struct {
+	mu      sync.Mutex
+	name    string
+	loaded  bool
+	dirty   bool
+	compact bool                  // Entries are held in packed instead
+	entries map[string]indexEntry // Entries by key
+	packed  map[uint64]string     // Packed entries by key fingerprint, with WithCompactIndex
+	pending []indexRecord         // Changes not yet in the log
+	logged  int                   // Records in the log
+	rewrite bool                  // Write a snapshot on the next flush
+}
+
+// openIndex opens the index of fc, building it if it is missing or was
+// written with a different shard count
+func (fc *FileCache) openIndex() error {
+	idx := &keyIndex{store: fc.store, shards: make([]*indexShard, fc.indexShards)}
+	for i := range idx.shards {
+		idx.shards[i] = &indexShard{name: indexPrefix + strconv.Itoa(i), compact: fc.compactIndex}
+	}
+	fc.index = idx
+
+	data, err := fc.store.Fetch(indexMetaName)
+	if err == nil && string(data) == idx.meta() {
+		return idx.loadUsage()
+	}
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to read index: %v", err)
+	}
+	return fc.RebuildIndex()
+}
+
+// RebuildIndex recreates the key index from the stored entries
+func (fc *FileCache) RebuildIndex() error {
+	idx := fc.index
+	if idx == nil {
+		return nil
+	}
+
+	for _, s := range idx.shards {
+		s.mu.Lock()
+		s.reset()
+		s.loaded, s.dirty = true, true
+		s.pending, s.rewrite = nil, true
+		s.mu.Unlock()
+	}
+	idx.usageMu.Lock()
+	idx.usage, idx.usageDirty = make(map[string]NamespaceUsage), true
+	idx.usageMu.Unlock()
+
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		if item, err := decodeItem(data); err == nil {
+			idx.put(item.Key, indexEntry{Name: name, ExpireAt: fc.retainUntil(item), Size: len(item.Data), Bytes: len(data)})
+			releaseItem(item)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := idx.flush(true); err != nil {
+		return err
+	}
+	return fc.store.Put(indexMetaName, []byte(idx.meta()))
+}
+
+// RebuildIndexPrefix repairs the index for part of the cache without
+// reading every entry. Entries stored under names starting with prefix are
+// re-read and indexed, and index records pointing there that have no entry
+// are dropped; with the default layout prefix is a hash directory such as
+// "3f/" or "3f/a2/". Indexed keys starting with prefix are checked against
+// their entries as well, which covers key prefixes without rereading the
+// whole store, but cannot find entries the index never knew about; without
+// hashed directories (WithPathScheme(0, 0)) key and name prefixes are the
+// same and both are covered.
+func (fc *FileCache) RebuildIndexPrefix(prefix string) error {
+	idx := fc.index
+	if idx == nil {
+		return nil
+	}
+
+	found := make(map[string]indexEntry)
+	err := fc.store.Walk(prefix, func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		if item, err := decodeItem(data); err == nil {
+			found[item.Key] = indexEntry{Name: name, ExpireAt: fc.retainUntil(item), Size: len(item.Data), Bytes: len(data)}
+			releaseItem(item)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	var recheck []purgeCandidate
+	idx.each(func(key string, e indexEntry) {
+		if _, ok := found[key]; ok {
+			return
+		}
+		if strings.HasPrefix(e.Name, prefix) {
+			stale = append(stale, key)
+		} else if strings.HasPrefix(key, prefix) {
+			recheck = append(recheck, purgeCandidate{name: e.Name, key: key})
+		}
+	})
+	for _, key := range stale {
+		idx.remove(key)
+	}
+	for _, c := range recheck {
+		data, err := fc.store.Fetch(c.name)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		item, decodeErr := decodeItem(data)
+		if err != nil || decodeErr != nil || item.Key != c.key {
+			idx.remove(c.key)
+			continue
+		}
+		idx.put(c.key, indexEntry{Name: c.name, ExpireAt: fc.retainUntil(item), Size: len(item.Data), Bytes: len(data)})
+	}
+	for key, e := range found {
+		idx.put(key, e)
+	}
+	return idx.flush(false)
+}
+
+// FlushIndex writes changed index shards to the store
+func (fc *FileCache) FlushIndex() error {
+	if fc.index == nil {
+		return nil
+	}
+	return fc.index.flush(false)
+}
+
+// shard returns the shard responsible for key
+func (idx *keyIndex) shard(key string) *indexShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return idx.shards[h.Sum32()%uint32(len(idx.shards))]
+}
+
+// load reads the shard from the store if it is not in memory yet, replaying
+// its log over the snapshot. The caller must hold s.mu.
+func (s *indexShard) load(store Store) {
+	if s.loaded {
+		return
+	}
+	s.reset()
+	if data, err := store.Fetch(s.name); err == nil {
+		s.decodeSnapshot(data)
+	}
+	s.logged = 0
+	if data, err := store.Fetch(s.name + indexLogSuffix); err == nil {
+		// A write cut short leaves a partial last line, which is dropped;
+		// appending after it would corrupt the next record, so compact
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			s.rewrite, s.dirty = true, true
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			var r indexRecord
+			if len(line) == 0 || json.Unmarshal(line, &r) != nil {
+				continue
+			}
+			s.apply(r)
+			s.logged++
+		}
+	}
+	s.loaded = true
+}
+
+// apply makes the change r to the entries. The caller must hold s.mu.
+func (s *indexShard) apply(r indexRecord) {
+	switch {
+	case s.compact && r.Deleted:
+		delete(s.packed, fingerprint(r.Key))
+	case s.compact:
+		s.packed[fingerprint(r.Key)] = packEntry(r.indexEntry)
+	case r.Deleted:
+		delete(s.entries, r.Key)
+	default:
+		s.entries[r.Key] = r.indexEntry
+	}
+}
+
+// lookup returns the entry of key. The caller must hold s.mu.
+func (s *indexShard) lookup(key string) (indexEntry, bool) {
+	if s.compact {
+		p, ok := s.packed[fingerprint(key)]
+		if !ok {
+			return indexEntry{}, false
+		}
+		return unpackEntry(p), true
+	}
+	e, ok := s.entries[key]
+	return e, ok
+}
+
+// size returns the number of entries. The caller must hold s.mu.
+func (s *indexShard) size() int {
+	if s.compact {
+		return len(s.packed)
+	}
+	return len(s.entries)
+}
+
+// reset empties the shard. The caller must hold s.mu.
+func (s *indexShard) reset() {
+	if s.compact {
+		s.packed = make(map[uint64]string)
+	} else {
+		s.entries = make(map[string]indexEntry)
+	}
+}
+
+// release drops the entries from memory. The caller must hold s.mu.
+func (s *indexShard) release() {
+	s.entries, s.packed, s.loaded = nil, nil, false
+}
+
+// change applies r and queues it for the log
+func (idx *keyIndex) change(r indexRecord) {
+	s := idx.shard(r.Key)
+	s.mu.Lock()
+	s.load(idx.store)
+	if old, ok := s.lookup(r.Key); ok || !r.Deleted {
+		var delta NamespaceUsage
+		if ok {
+			delta.Bytes, delta.Entries = -old.bytes(), -1
+		}
+		if !r.Deleted {
+			delta.Bytes += r.bytes()
+			delta.Entries++
+		}
+		idx.account(NamespaceOf(r.Key), delta)
+		s.apply(r)
+		if !s.rewrite {
+			s.pending = append(s.pending, r)
+		}
+		s.dirty = true
+	}
+	s.mu.Unlock()
+}
+
+// get returns the indexed entry of key
+func (idx *keyIndex) get(key string) (indexEntry, bool) {
+	s := idx.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load(idx.store)
+	return s.lookup(key)
+}
+
+func (idx *keyIndex) put(key string, e indexEntry) {
+	idx.change(indexRecord{Key: key, indexEntry: e})
+}
+
+func (idx *keyIndex) remove(key string) {
+	idx.change(indexRecord{Key: key, Deleted: true})
+}
+
+// each calls fn for every indexed key, one shard at a time, with keys in
+// sorted order within a shard. Shards not touched before are released
+// again afterwards to keep memory bounded.
+func (idx *keyIndex) each(fn func(key string, e indexEntry)) {
+	idx.scan(nil, fn)
+}
+
+// scan calls fn like each, but only for the entries match accepts, or
+// all entries if match is nil. A compact index reads the keys of those
+// entries from the store.
+func (idx *keyIndex) scan(match func(e indexEntry) bool, fn func(key string, e indexEntry)) {
+	for _, s := range idx.shards {
+		s.mu.Lock()
+		wasLoaded := s.loaded
+		s.load(idx.store)
+		var keys []string
+		var entries []indexEntry
+		var records []packedRecord
+		if s.compact {
+			records = s.packedRecords(match)
+		} else {
+			keys = make([]string, 0, len(s.entries))
+			for key, e := range s.entries {
+				if match == nil || match(e) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			entries = make([]indexEntry, len(keys))
+			for i, key := range keys {
+				entries[i] = s.entries[key]
+			}
+		}
+		if !wasLoaded && !s.dirty {
+			s.release()
+		}
+		s.mu.Unlock()
+
+		if records != nil {
+			keys, entries = idx.resolveKeys(s, records)
+		}
+		for i, key := range keys {
+			fn(key, entries[i])
+		}
+	}
+}
+
+// flush writes the changes of dirty shards to the store. With release set,
+// shards are dropped from memory after writing.
+func (idx *keyIndex) flush(release bool) error {
+	for _, s := range idx.shards {
+		s.mu.Lock()
+		if s.dirty {
+			if err := s.write(idx.store); err != nil {
+				s.mu.Unlock()
+				return fmt.Errorf("failed to write index shard: %v", err)
+			}
+			s.dirty = false
+		}
+		if release {
+			s.release()
+			s.logged = 0
+		}
+		s.mu.Unlock()
+	}
+	return idx.saveUsage()
+}
+
+// write appends the pending changes to the log, or replaces snapshot and
+// log by a new snapshot once the log holds more records than the shard has
+// entries. The caller must hold s.mu.
+func (s *indexShard) write(store Store) error {
+	if s.rewrite || s.logged+len(s.pending) > max(s.size(), minIndexCompaction) {
+		data, err := s.encodeSnapshot()
+		if err != nil {
+			return err
+		}
+		if err := store.Put(s.name, data); err != nil {
+			return err
+		}
+		if err := store.Remove(s.name + indexLogSuffix); err != nil && err != ErrNotFound {
+			return err
+		}
+		s.pending, s.logged, s.rewrite = nil, 0, false
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, r := range s.pending {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := appendTo(store, s.name+indexLogSuffix, buf.Bytes()); err != nil {
+		return err
+	}
+	s.logged += len(s.pending)
+	s.pending = nil
+	return nil
+}
+
+// expired returns the indexed entries that expired before now
+func (idx *keyIndex) expired(now time.Time) []purgeCandidate {
+	var candidates []purgeCandidate
+	expired := func(e indexEntry) bool {
+		return now.After(e.ExpireAt)
+	}
+	idx.scan(expired, func(key string, e indexEntry) {
+		candidates = append(candidates, purgeCandidate{name: e.Name, key: key})
+	})
+	return candidates
+}
@@ -0,0 +1,183 @@
+package pie_cache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestIndex(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_index")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	plain, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		_ = plain.Set(fmt.Sprintf("key%d", i), []byte("v"))
+	}
+
+	// Opening an unindexed cache builds the index
+	cache, err := NewFileCache(tempDir, time.Minute, WithIndex(4))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 10 {
+		t.Errorf("Expected 10 indexed keys, got %d", len(keys))
+	}
+	_ = cache.Delete("key0")
+	_ = cache.SetWithTTL("short", []byte("v"), time.Millisecond)
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopening loads shards lazily instead of rebuilding
+	_ = plain.Set("unindexed", []byte("v"))
+	cache, err = NewFileCache(tempDir, time.Minute, WithIndex(4))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for i, s := range cache.index.shards {
+		if s.loaded {
+			t.Errorf("Expected shard %d not to be loaded on open", i)
+		}
+	}
+	keys, _ := cache.ListKeys()
+	sort.Strings(keys)
+	if len(keys) != 10 || keys[0] != "key1" || keys[9] != "short" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if cache.Exists("short") {
+		t.Error("Expired item not purged")
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 9 {
+		t.Errorf("Expected 9 keys after purge, got %d", len(keys))
+	}
+
+	if err := cache.RebuildIndex(); err != nil {
+		t.Fatalf("RebuildIndex failed: %v", err)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 10 {
+		t.Errorf("Expected rebuilt index to include unindexed key, got %d", len(keys))
+	}
+	_ = cache.Close()
+
+	// A different shard count rebuilds
+	cache, err = NewFileCache(tempDir, time.Minute, WithIndex(16))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	if keys, _ := cache.ListKeys(); len(keys) != 10 {
+		t.Errorf("Expected 10 keys after resharding, got %d", len(keys))
+	}
+}
+
+func TestIndexLog(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithIndex(1))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	logName := indexPrefix + "0" + indexLogSuffix
+
+	_ = cache.Set("a", []byte("v"))
+	_ = cache.Set("b", []byte("v"))
+	_ = cache.Delete("a")
+	if err := cache.FlushIndex(); err != nil {
+		t.Fatalf("FlushIndex failed: %v", err)
+	}
+	data, err := store.Fetch(logName)
+	if err != nil {
+		t.Fatalf("Expected changes in the index log: %v", err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 3 {
+		t.Errorf("Expected 3 logged changes, got %d", n)
+	}
+
+	// A torn last record is ignored and forces a snapshot
+	_ = store.Append(logName, []byte(`{"k":"c","n":`))
+	reopened, err := NewWithStore(store, time.Minute, WithIndex(1))
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	if keys, _ := reopened.ListKeys(); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("Expected keys [b] from the log, got %v", keys)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := store.Fetch(logName); err != ErrNotFound {
+		t.Errorf("Expected the log to be compacted, got %v", err)
+	}
+
+	// A log outgrowing the snapshot is compacted
+	cache, _ = NewWithStore(store, time.Minute, WithIndex(1))
+	for i := 0; i <= minIndexCompaction; i++ {
+		_ = cache.Set("b", []byte("v"))
+		_ = cache.FlushIndex()
+	}
+	if data, err := store.Fetch(logName); err == nil && bytes.Count(data, []byte("\n")) > minIndexCompaction {
+		t.Errorf("Expected the log to be compacted, has %d records", bytes.Count(data, []byte("\n")))
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 1 {
+		t.Errorf("Expected 1 key after compaction, got %v", keys)
+	}
+}
+
+func TestRebuildIndexPrefix(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_index_prefix")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithIndex(4))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	plain, _ := NewFileCache(tempDir, time.Minute)
+
+	_ = cache.Set("user:1", []byte("v"))
+	_ = cache.Set("user:2", []byte("v"))
+	// Changes the index does not see
+	_ = plain.Delete("user:1")
+	_ = plain.Set("orphan", []byte("v"))
+
+	// A hash directory picks up the unindexed entry stored there
+	name, _ := cache.entryName("orphan")
+	if err := cache.RebuildIndexPrefix(name[:3]); err != nil {
+		t.Fatalf("RebuildIndexPrefix failed: %v", err)
+	}
+	keys, _ := cache.ListKeys()
+	sort.Strings(keys)
+	if len(keys) != 3 || keys[0] != "orphan" {
+		t.Errorf("Expected orphan to be indexed, got %v", keys)
+	}
+
+	// A key prefix drops the deleted entry
+	if err := cache.RebuildIndexPrefix("user:"); err != nil {
+		t.Fatalf("RebuildIndexPrefix failed: %v", err)
+	}
+	keys, _ = cache.ListKeys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "orphan" || keys[1] != "user:2" {
+		t.Errorf("Expected [orphan user:2], got %v", keys)
+	}
+	if _, entries, _ := cache.DiskUsage(); entries != 2 {
+		t.Errorf("Expected usage to follow the repair, got %d entries", entries)
+	}
+}
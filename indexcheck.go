@@ -0,0 +1,116 @@
+package pie_cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// IndexReport lists where the key index and the stored entries disagree
+type IndexReport struct {
+	Scanned    int      `json:"scanned"`    // Entries examined
+	Missing    []string `json:"missing"`    // Indexed keys whose entry is gone
+	Unindexed  []string `json:"unindexed"`  // Keys of entries the index does not know
+	Mismatched []string `json:"mismatched"` // Keys whose index record disagrees with their entry
+	Reconciled int      `json:"reconciled"` // Index records fixed, with reconcile set
+}
+
+// OK reports whether VerifyIndex found the index in line with the entries
+func (r IndexReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unindexed) == 0 && len(r.Mismatched) == 0
+}
+
+// WithIndexCheck makes opening a cache with WithIndex compare the loaded
+// index, snapshot and change log, with the entries in the store, so that
+// entries changed behind the cache's back or a directory restored without
+// its index are noticed. Every divergence is logged as EventIndexMismatch;
+// with reconcile set the index is then brought in line with the entries.
+// The check reads every entry, so it costs as much as RebuildIndex.
+func WithIndexCheck(reconcile bool) Option {
+	return func(fc *FileCache) {
+		fc.indexCheck, fc.indexReconcile = true, reconcile
+	}
+}
+
+// checkIndexOnOpen runs the check requested by WithIndexCheck
+func (fc *FileCache) checkIndexOnOpen() error {
+	if !fc.indexCheck || fc.index == nil {
+		return nil
+	}
+	if _, err := fc.VerifyIndex(fc.indexReconcile); err != nil {
+		return fmt.Errorf("failed to check index: %v", err)
+	}
+	return nil
+}
+
+// VerifyIndex compares the key index with the stored entries and logs
+// every divergence as EventIndexMismatch. With reconcile set, records of
+// missing entries are dropped and those of unindexed or changed entries
+// rewritten from the entries. Entries stored where their key does not
+// belong are left to Verify. It does nothing without WithIndex.
+func (fc *FileCache) VerifyIndex(reconcile bool) (IndexReport, error) {
+	var report IndexReport
+	idx := fc.index
+	if idx == nil {
+		return report, nil
+	}
+
+	seen := make(map[string]bool)
+	fixes := make(map[string]indexEntry)
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		report.Scanned++
+		item, err := decodeItem(data)
+		if err != nil {
+			return nil
+		}
+		defer releaseItem(item)
+		if want, err := fc.entryName(item.Key); err != nil || want != name {
+			return nil
+		}
+
+		seen[item.Key] = true
+		want := indexEntry{Name: name, ExpireAt: fc.retainUntil(item), Size: len(item.Data), Bytes: len(data)}
+		e, ok := idx.get(item.Key)
+		switch {
+		case !ok:
+			report.Unindexed = append(report.Unindexed, item.Key)
+			fc.logEvent(Event{Type: EventIndexMismatch, Key: item.Key, Path: name, Err: errors.New("entry not indexed")})
+		case e.Name != want.Name || !e.ExpireAt.Equal(want.ExpireAt) || e.Size != want.Size || e.Bytes != want.Bytes:
+			report.Mismatched = append(report.Mismatched, item.Key)
+			fc.logEvent(Event{Type: EventIndexMismatch, Key: item.Key, Path: name,
+				Err: fmt.Errorf("index record %+v does not match entry", e)})
+		default:
+			return nil
+		}
+		fixes[item.Key] = want
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	idx.each(func(key string, e indexEntry) {
+		if !seen[key] {
+			report.Missing = append(report.Missing, key)
+			fc.logEvent(Event{Type: EventIndexMismatch, Key: key, Path: e.Name, Err: errors.New("indexed entry missing")})
+		}
+	})
+	sort.Strings(report.Missing)
+	sort.Strings(report.Unindexed)
+	sort.Strings(report.Mismatched)
+
+	if !reconcile || report.OK() {
+		return report, nil
+	}
+	for _, key := range report.Missing {
+		idx.remove(key)
+	}
+	for key, e := range fixes {
+		idx.put(key, e)
+	}
+	report.Reconciled = len(report.Missing) + len(fixes)
+	return report, idx.flush(false)
+}
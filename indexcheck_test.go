@@ -0,0 +1,66 @@
+package pie_cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVerifyIndex(t *testing.T) {
+	store := NewMemoryStore()
+	indexed, err := NewWithStore(store, time.Minute, WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		_ = indexed.Set(key, []byte(key))
+	}
+	indexed.Close()
+
+	// Change the entries behind the index
+	plain, err := NewWithStore(store, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = plain.Delete("a")
+	_ = plain.SetWithTTL("b", []byte("changed"), time.Hour)
+	_ = plain.Set("d", []byte("d"))
+
+	var mu sync.Mutex
+	var events []Event
+	logger := LoggerFunc(func(e Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+	cache, err := NewWithStore(store, time.Minute, WithIndex(2), WithIndexCheck(false), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	mu.Lock()
+	if len(events) != 3 {
+		t.Errorf("Expected 3 divergences logged on open, got %v", events)
+	}
+	for _, e := range events {
+		if e.Type != EventIndexMismatch {
+			t.Errorf("Expected EventIndexMismatch, got %v", e.Type)
+		}
+	}
+	mu.Unlock()
+
+	report, err := cache.VerifyIndex(true)
+	if err != nil {
+		t.Fatalf("VerifyIndex failed: %v", err)
+	}
+	if report.Scanned != 3 || len(report.Missing) != 1 || report.Missing[0] != "a" ||
+		len(report.Unindexed) != 1 || report.Unindexed[0] != "d" ||
+		len(report.Mismatched) != 1 || report.Mismatched[0] != "b" || report.Reconciled != 3 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report, err := cache.VerifyIndex(false); err != nil || !report.OK() {
+		t.Errorf("Expected a reconciled index, got %+v, %v", report, err)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 3 {
+		t.Errorf("Expected 3 keys listed, got %v", keys)
+	}
+}
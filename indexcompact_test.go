@@ -0,0 +1,112 @@
+package pie_cache
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompactIndex(t *testing.T) {
+	e := indexEntry{Name: "ab/cd/key", ExpireAt: time.Now(), Size: 300, Bytes: 420}
+	if got := unpackEntry(packEntry(e)); got.Name != e.Name || !got.ExpireAt.Equal(e.ExpireAt) || got.Size != e.Size || got.Bytes != e.Bytes {
+		t.Errorf("Expected %+v after packing, got %+v", e, got)
+	}
+
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithIndex(2), WithCompactIndex())
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		_ = cache.Set("user:"+strconv.Itoa(i), []byte("v"))
+	}
+	_ = cache.SetWithTTL("short", []byte("v"), time.Millisecond)
+	for _, s := range cache.index.shards {
+		if s.entries != nil {
+			t.Errorf("Expected shard %s to hold no full keys", s.name)
+		}
+	}
+	if keys, _ := cache.KeysWithPrefix("user:"); len(keys) != 10 {
+		t.Errorf("Expected 10 keys with prefix, got %v", keys)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Entries removed behind the index are dropped when their keys are read
+	_ = store.Remove(mustEntryName(t, cache, "user:9"))
+
+	cache, err = NewWithStore(store, time.Minute, WithIndex(2), WithCompactIndex())
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 9 {
+		t.Errorf("Expected 9 keys after reopening, got %v", keys)
+	}
+
+	// Switching to a full index rebuilds it
+	full, err := NewWithStore(store, time.Minute, WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	if keys, _ := full.ListKeys(); len(keys) != 9 {
+		t.Errorf("Expected 9 keys in the rebuilt index, got %v", keys)
+	}
+}
+
+// mustEntryName returns the store name of key in cache
+func mustEntryName(t *testing.T, cache *FileCache, key string) string {
+	t.Helper()
+	name, err := cache.entryName(key)
+	if err != nil {
+		t.Fatalf("entryName(%q) failed: %v", key, err)
+	}
+	return name
+}
+
+func BenchmarkIndexMemory(b *testing.B) {
+	cache, err := NewMemoryCache(time.Minute)
+	if err != nil {
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	const keys = 10000
+	// Keys safe as file names are part of their entry name, others are
+	// stored under their hash
+	for _, layout := range []struct{ name, prefix string }{{"safe", "user:"}, {"hashed", "user/"}} {
+		records := make([]indexRecord, keys)
+		for i := range records {
+			key := layout.prefix + strconv.Itoa(100000+i)
+			name, _ := cache.entryName(key)
+			records[i] = indexRecord{Key: key, indexEntry: indexEntry{Name: name, ExpireAt: time.Now(), Size: 300, Bytes: 420}}
+		}
+		for _, compact := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/compact=%v", layout.name, compact), func(b *testing.B) {
+				var perKey float64
+				for b.Loop() {
+					s := &indexShard{compact: compact}
+					s.reset()
+					var before, after runtime.MemStats
+					runtime.GC()
+					runtime.ReadMemStats(&before)
+					for _, r := range records {
+						// Records are decoded into fresh strings when loaded
+						r.Key, r.Name = strings.Clone(r.Key), strings.Clone(r.Name)
+						s.apply(r)
+					}
+					runtime.GC()
+					runtime.ReadMemStats(&after)
+					perKey = float64(after.HeapAlloc-before.HeapAlloc) / keys
+					runtime.KeepAlive(s)
+				}
+				b.ReportMetric(perKey, "B/key")
+			})
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package pie_cache
+
+import "time"
+
+// Cache is the set of operations shared by the caches in this module, for
+// code that should not depend on where entries are kept. FileCache,
+// ShardedCache and ShadowCache implement it, as does
+// httpclient.RemoteCache; NewMemoryCache returns one kept in memory, e.g.
+// for tests.
+type Cache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, data []byte) error
+	SetWithTTL(key string, data []byte, ttl time.Duration) error
+	Delete(key string) error
+	Exists(key string) bool
+	PurgeExpired() error
+}
+
+var (
+	_ Cache = (*FileCache)(nil)
+	_ Cache = (*ShardedCache)(nil)
+)
+
+// NewMemoryCache creates a cache keeping its entries in memory, for unit
+// tests and small caches. It is a FileCache on a MemoryStore, so TTLs,
+// errors and stats behave as with a cache directory, without any disk IO.
+func NewMemoryCache(ttl time.Duration, opts ...Option) (*FileCache, error) {
+	return NewWithStore(NewMemoryStore(), ttl, opts...)
+}
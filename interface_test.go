@@ -0,0 +1,96 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// countHits is application code depending only on Cache
+func countHits(c Cache, key string) (int, error) {
+	data, err := c.Get(key)
+	if err == ErrNotFound {
+		data = nil
+	} else if err != nil {
+		return 0, err
+	}
+	n := len(data) + 1
+	return n, c.Set(key, make([]byte, n))
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache, err := NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	var c Cache = cache
+	for want := 1; want <= 3; want++ {
+		if n, err := countHits(c, "page"); err != nil || n != want {
+			t.Errorf("Expected count %d, got %d, %v", want, n, err)
+		}
+	}
+	if err := c.SetWithTTL("short", []byte("x"), time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := c.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if c.Exists("short") {
+		t.Error("Expected the expired entry purged")
+	}
+	if err := c.Delete("page"); err != nil || c.Exists("page") {
+		t.Errorf("Expected the entry deleted, got %v", err)
+	}
+}
+
+func TestMemoryCacheParity(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memory_parity")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer file.Close()
+	memory, err := NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer memory.Close()
+
+	type result struct {
+		data  string
+		err   error
+		stats CacheStats
+	}
+	run := func(c *FileCache) []result {
+		var results []result
+		record := func(data []byte, err error) {
+			stats := c.Stats()
+			stats.BytesRead, stats.BytesWritten = 0, 0
+			results = append(results, result{string(data), err, stats})
+		}
+		_ = c.Set("a", []byte("1"))
+		_ = c.SetWithTTL("short", []byte("2"), time.Millisecond)
+		record(c.Get("a"))
+		record(c.Get("missing"))
+		time.Sleep(5 * time.Millisecond)
+		record(c.Get("short"))
+		record(nil, c.Delete("a"))
+		record(nil, c.Delete("a"))
+		record(c.Get(""))
+		return results
+	}
+	want, got := run(file), run(memory)
+	for i := range want {
+		if want[i] != got[i] {
+			t.Errorf("Step %d: FileCache gave %+v, memory cache %+v", i, want[i], got[i])
+		}
+	}
+}
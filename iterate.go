@@ -0,0 +1,198 @@
+package pie_cache
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// errStopWalk ends a store walk early without reporting an error
+var errStopWalk = errors.New("stop walk")
+
+// Iterate calls fn with the key and metadata of every entry, expired ones
+// included, without collecting them first. An error returned by fn stops
+// the iteration and is returned.
+func (fc *FileCache) Iterate(fn func(key string, meta ItemMeta) error) error {
+	return fc.walkItems(func(name string, item *CacheItem) error {
+		return fn(item.Key, item.meta())
+	})
+}
+
+// Keys returns up to limit keys following cursor, and the cursor for the
+// next page, which is empty once all keys were returned. Pass an empty
+// cursor to start. Keys added or removed while paging may or may not be
+// returned, but no key that exists throughout is skipped or repeated.
+// Pages come from the index when there is one; otherwise entries before
+// the cursor are only skipped unread on a SeekStore.
+func (fc *FileCache) Keys(cursor string, limit int) ([]string, string, error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid limit %d: must be positive", limit)
+	}
+	after, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid cursor: %v", err)
+	}
+	if fc.index != nil {
+		return fc.indexKeys(string(after), limit)
+	}
+
+	var keys []string
+	var last string
+	more := false
+	err = walkAfter(fc.store, "", string(after), func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		if len(keys) == limit {
+			more = true
+			return errStopWalk
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			return nil
+		}
+		keys = append(keys, item.Key)
+		releaseItem(item)
+		last = name
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return nil, "", err
+	}
+
+	if !more {
+		return keys, "", nil
+	}
+	return keys, base64.RawURLEncoding.EncodeToString([]byte(last)), nil
+}
+
+// indexKeys is Keys for the page after the entry name after, read from
+// the index. Only the keys returned are looked up, which a compact index
+// reads from the store.
+func (fc *FileCache) indexKeys(after string, limit int) ([]string, string, error) {
+	var names []string
+	fc.index.scan(func(e indexEntry) bool {
+		if e.Name > after {
+			names = append(names, e.Name)
+		}
+		return false
+	}, func(string, indexEntry) {})
+	sort.Strings(names)
+	more := len(names) > limit
+	if more {
+		names = names[:limit]
+	}
+
+	page := make(map[string]string, len(names))
+	for _, name := range names {
+		page[name] = ""
+	}
+	fc.index.scan(func(e indexEntry) bool {
+		_, ok := page[e.Name]
+		return ok
+	}, func(key string, e indexEntry) {
+		page[e.Name] = key
+	})
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		if key := page[name]; key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	if !more {
+		return keys, "", nil
+	}
+	return keys, base64.RawURLEncoding.EncodeToString([]byte(names[len(names)-1])), nil
+}
+
+// eachKey calls fn for every key, from the index when there is one
+func (fc *FileCache) eachKey(fn func(key string)) error {
+	if fc.index != nil {
+		fc.index.each(func(key string, e indexEntry) {
+			fn(key)
+		})
+		return nil
+	}
+	return fc.walkItems(func(name string, item *CacheItem) error {
+		fn(item.Key)
+		return nil
+	})
+}
+
+// KeysWithPrefix returns the keys starting with prefix. Entry names are
+// derived from key hashes, so this scans every key; with WithIndex the
+// scan reads the index instead of the entries.
+func (fc *FileCache) KeysWithPrefix(prefix string) ([]string, error) {
+	var keys []string
+	err := fc.eachKey(func(key string) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	})
+	return keys, err
+}
+
+// KeysMatching returns the keys matching pattern, in which * matches any
+// run of characters, ? matches one byte and \ escapes the next one.
+// Like KeysWithPrefix it scans every key.
+func (fc *FileCache) KeysMatching(pattern string) ([]string, error) {
+	var keys []string
+	err := fc.eachKey(func(key string) {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	})
+	return keys, err
+}
+
+// DeleteByPrefix removes every entry whose key starts with prefix, e.g.
+// "user:123:", and returns how many were removed
+func (fc *FileCache) DeleteByPrefix(prefix string) (int, error) {
+	keys, err := fc.KeysWithPrefix(prefix)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, key := range keys {
+		if err := fc.Delete(key); err != nil {
+			if err == ErrNotFound {
+				continue
+			}
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// globMatch reports whether s matches pattern
+func globMatch(pattern, s string) bool {
+	// Backtracking to the most recent * keeps this linear in practice
+	p, i := 0, 0
+	star, match := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, i
+			p++
+		case p < len(pattern) && pattern[p] == '\\' && p+1 < len(pattern) && pattern[p+1] == s[i]:
+			p += 2
+			i++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] != '\\' && pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			match++
+			p, i = star+1, match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,173 @@
+package pie_cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIterate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_iterate")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		_ = cache.Set(fmt.Sprintf("key%02d", i), []byte("value"))
+	}
+	_ = cache.Group("g").Invalidate() // Bookkeeping entries are not keys
+
+	sizes := 0
+	if err := cache.Iterate(func(key string, meta ItemMeta) error {
+		if meta.Key != key {
+			t.Errorf("Expected meta for %s, got %s", key, meta.Key)
+		}
+		sizes += meta.Size
+		return nil
+	}); err != nil {
+		t.Fatalf("Iterate failed: %v", err)
+	}
+	if sizes != 25*5 {
+		t.Errorf("Expected total size %d, got %d", 25*5, sizes)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := cache.Iterate(func(string, ItemMeta) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Errorf("Expected Iterate to stop with fn's error, got %v after %d calls", err, calls)
+	}
+
+	seen := map[string]bool{}
+	cursor, pages := "", 0
+	for {
+		keys, next, err := cache.Keys(cursor, 10)
+		if err != nil {
+			t.Fatalf("Keys failed: %v", err)
+		}
+		pages++
+		for _, k := range keys {
+			if seen[k] {
+				t.Errorf("Key %s returned twice", k)
+			}
+			seen[k] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 25 || pages != 3 {
+		t.Errorf("Expected 25 keys in 3 pages, got %d in %d", len(seen), pages)
+	}
+
+	if _, _, err := cache.Keys("", 0); err == nil {
+		t.Error("Expected error for zero limit")
+	}
+	if _, _, err := cache.Keys("!!", 10); err == nil {
+		t.Error("Expected error for malformed cursor")
+	}
+}
+
+// seekCountingStore counts the entries its walks hand out
+type seekCountingStore struct {
+	*MemoryStore
+	reads atomic.Int32
+}
+
+func (s *seekCountingStore) Walk(prefix string, fn func(name string, data []byte) error) error {
+	return s.WalkAfter(prefix, "", fn)
+}
+
+func (s *seekCountingStore) WalkAfter(prefix, after string, fn func(name string, data []byte) error) error {
+	return s.MemoryStore.WalkAfter(prefix, after, func(name string, data []byte) error {
+		s.reads.Add(1)
+		return fn(name, data)
+	})
+}
+
+func TestKeysPaging(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithIndex(4)}, {WithIndex(4), WithCompactIndex()}} {
+		store := &seekCountingStore{MemoryStore: NewMemoryStore()}
+		cache, err := NewWithStore(store, time.Minute, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			_ = cache.Set(fmt.Sprintf("key%03d", i), []byte("value"))
+		}
+		store.reads.Store(0)
+
+		seen := map[string]bool{}
+		cursor, pages := "", 0
+		for {
+			keys, next, err := cache.Keys(cursor, 10)
+			if err != nil {
+				t.Fatalf("Keys failed: %v", err)
+			}
+			pages++
+			for _, k := range keys {
+				if seen[k] {
+					t.Errorf("Key %s returned twice", k)
+				}
+				seen[k] = true
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if len(seen) != 100 || pages != 10 {
+			t.Errorf("Expected 100 keys in 10 pages, got %d in %d", len(seen), pages)
+		}
+		// Every page starts reading at its cursor
+		if n := store.reads.Load(); n > 2*100 {
+			t.Errorf("Expected each entry read about once, got %d reads", n)
+		}
+		cache.Close()
+	}
+}
+
+func TestKeyMatching(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithIndex(4)}} {
+		cache, err := NewWithStore(NewMemoryStore(), time.Minute, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		for _, key := range []string{"user:123:profile", "user:123:cart", "user:1234:profile", "page:home", "a*b"} {
+			_ = cache.Set(key, []byte("x"))
+		}
+
+		if keys, _ := cache.KeysWithPrefix("user:123:"); len(keys) != 2 {
+			t.Errorf("Expected 2 keys with prefix, got %v", keys)
+		}
+		tests := map[string]int{
+			"user:*:profile": 2,
+			"user:12?:*":     2,
+			"*":              5,
+			"page:home":      1,
+			`a\*b`:           1,
+			"page:*x":        0,
+		}
+		for pattern, want := range tests {
+			if keys, _ := cache.KeysMatching(pattern); len(keys) != want {
+				t.Errorf("KeysMatching(%q): expected %d keys, got %v", pattern, want, keys)
+			}
+		}
+
+		n, err := cache.DeleteByPrefix("user:123:")
+		if err != nil || n != 2 {
+			t.Errorf("Expected 2 deletions, got %d, %v", n, err)
+		}
+		if !cache.Exists("user:1234:profile") || cache.Exists("user:123:cart") {
+			t.Error("DeleteByPrefix removed the wrong keys")
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package pie_cache
+
+import "time"
+
+// WithJanitor runs PurgeExpired every interval in a background goroutine
+// until Close is called
+func WithJanitor(interval time.Duration) Option {
+	return func(fc *FileCache) {
+		if interval > 0 {
+			fc.janitorInterval = interval
+		}
+	}
+}
+
+// WithDeferredExpiry hands expired entries found by reads to the janitor
+// instead of deleting them inline, so a read never pays for a write. At most
+// budget deletions are queued; entries beyond that stay on disk until the
+// next purge. Call Close to finish pending deletions.
+func WithDeferredExpiry(budget int) Option {
+	return func(fc *FileCache) {
+		if budget > 0 {
+			fc.expiryQueue = make(chan string, budget)
+		}
+	}
+}
+
+// JanitorPacing lets the janitor adapt to churn. After a run that removed
+// more than Backlog entries it halves its interval and doubles its removal
+// workers; after a run that removed nothing it does the opposite. The
+// interval stays within [MinInterval, MaxInterval] and the workers within
+// [1, MaxWorkers].
+type JanitorPacing struct {
+	MinInterval time.Duration // Shortest pause between runs under churn
+	MaxInterval time.Duration // Longest pause between runs when idle
+	MaxWorkers  int           // Most concurrent removals per run
+	Backlog     int           // Expired entries per run that count as churn
+}
+
+// WithJanitorPacing runs the janitor with an adaptive interval and worker
+// count instead of the fixed interval of WithJanitor, which if given is
+// used as the starting interval
+func WithJanitorPacing(p JanitorPacing) Option {
+	return func(fc *FileCache) {
+		if p.MinInterval <= 0 {
+			p.MinInterval = time.Second
+		}
+		if p.MaxInterval < p.MinInterval {
+			p.MaxInterval = p.MinInterval
+		}
+		if p.MaxWorkers < 1 {
+			p.MaxWorkers = 1
+		}
+		if p.Backlog < 1 {
+			p.Backlog = 1000
+		}
+		fc.pacing = &p
+	}
+}
+
+// janitorPace is the current interval and worker count of the janitor
+type janitorPace struct {
+	interval time.Duration
+	workers  int
+}
+
+// next returns the pace after a run that removed n entries
+func (p *JanitorPacing) next(cur janitorPace, n int) janitorPace {
+	switch {
+	case n > p.Backlog:
+		cur.interval /= 2
+		cur.workers *= 2
+	case n == 0:
+		cur.interval *= 2
+		cur.workers /= 2
+	}
+	cur.interval = min(max(cur.interval, p.MinInterval), p.MaxInterval)
+	cur.workers = min(max(cur.workers, 1), p.MaxWorkers)
+	return cur
+}
+
+// startJanitor launches the background goroutine if any option needs it
+func (fc *FileCache) startJanitor() {
+	if fc.janitorInterval <= 0 && fc.expiryQueue == nil && fc.pacing == nil {
+		return
+	}
+	fc.janitorStop = make(chan struct{})
+	fc.janitorDone = make(chan struct{})
+	go fc.runJanitor()
+}
+
+func (fc *FileCache) runJanitor() {
+	defer close(fc.janitorDone)
+
+	pace := janitorPace{interval: fc.janitorInterval, workers: 1}
+	if fc.pacing != nil {
+		if pace.interval <= 0 {
+			pace.interval = fc.pacing.MinInterval
+		}
+		pace = fc.pacing.next(pace, -1)
+	}
+	fc.setPace(pace)
+
+	var tick <-chan time.Time
+	var timer *time.Timer
+	if pace.interval > 0 {
+		timer = time.NewTimer(pace.interval)
+		defer timer.Stop()
+		tick = timer.C
+	}
+
+	for {
+		select {
+		case name := <-fc.expiryQueue:
+			fc.removeIfExpired(name)
+		case <-tick:
+			n, _ := fc.purge(pace.workers, nil)
+			if deleted, err := fc.DeleteDue(); err == nil {
+				n += deleted
+			}
+			if evicted, err := fc.Shrink(); err == nil {
+				n += evicted
+			}
+			_ = fc.FlushIndex()
+			_ = fc.SaveAccessStats()
+			if fc.pacing != nil {
+				pace = fc.pacing.next(pace, n)
+				fc.setPace(pace)
+			}
+			// Timing the pause from the end of a run keeps slow runs from
+			// piling up
+			timer.Reset(pace.interval)
+		case <-fc.janitorStop:
+			// Drain what reads already queued
+			for {
+				select {
+				case name := <-fc.expiryQueue:
+					fc.removeIfExpired(name)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// setPace publishes the janitor's current pace for inspection
+func (fc *FileCache) setPace(p janitorPace) {
+	fc.pace.Store(&p)
+}
+
+// queueExpired schedules the deletion of an expired entry, dropping it when
+// the budget is exhausted
+func (fc *FileCache) queueExpired(name string) {
+	select {
+	case fc.expiryQueue <- name:
+	default:
+	}
+}
+
+// removeIfExpired deletes name unless it was rewritten since it was queued
+func (fc *FileCache) removeIfExpired(name string) {
+	data, err := fc.store.Fetch(name)
+	if err != nil {
+		return
+	}
+	item, err := decodeItem(data)
+	if err != nil {
+		return
+	}
+	defer releaseItem(item)
+	if !fc.isExpired(item, fc.now()) || !fc.owned(name, item) {
+		return
+	}
+	if err := fc.removeEntry(name, item.Key); err == nil {
+		fc.logEvent(Event{Type: EventExpired, Key: item.Key, Path: name})
+	}
+}
+
+// Close stops WithHibernateAfter, waits for refresh-ahead reloads, writes
+// queued async writes, stops the janitor after finishing queued deletions
+// and writes the key index and access stats. It is safe to call more than
+// once and on caches without a janitor.
+func (fc *FileCache) Close() error {
+	var err error
+	fc.closeOnce.Do(func() {
+		fc.stopIdleWatch()
+		if fc.refresh != nil {
+			fc.refresh.wg.Wait()
+		}
+		if fc.async != nil {
+			err = fc.async.close()
+		}
+		if fc.janitorStop != nil {
+			close(fc.janitorStop)
+			<-fc.janitorDone
+		}
+		if flushErr := fc.FlushIndex(); err == nil {
+			err = flushErr
+		}
+		if saveErr := fc.SaveAccessStats(); err == nil {
+			err = saveErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJanitor(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_janitor")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Deferred expiry: the read reports the expiry, Close performs the delete
+	cache, err := NewFileCache(tempDir, time.Minute, WithDeferredExpiry(4))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.SetWithTTL("old", []byte("x"), time.Millisecond)
+	_ = cache.SetWithTTL("renewed", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := cache.Get("old"); err != ErrExpired {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if _, err := cache.Get("renewed"); err != ErrExpired {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	// Rewritten after being queued, so the janitor must keep it
+	_ = cache.Set("renewed", []byte("y"))
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+	if path, _ := cache.getFilePath("old"); fileExists(path) {
+		t.Errorf("Expected queued expired entry to be deleted on Close")
+	}
+	if v, err := cache.GetString("renewed"); err != nil || v != "y" {
+		t.Errorf("Expected renewed entry to survive, got %q, %v", v, err)
+	}
+
+	// Periodic purge
+	cache, err = NewFileCache(tempDir, time.Minute, WithJanitor(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	_ = cache.SetWithTTL("short", []byte("x"), time.Millisecond)
+	path, _ := cache.getFilePath("short")
+	deadline := time.Now().Add(time.Second)
+	for fileExists(path) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if fileExists(path) {
+		t.Errorf("Expected janitor to purge expired entry")
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestJanitorPacing(t *testing.T) {
+	p := JanitorPacing{MinInterval: 10 * time.Millisecond, MaxInterval: 80 * time.Millisecond, MaxWorkers: 4, Backlog: 2}
+	pace := janitorPace{interval: 40 * time.Millisecond, workers: 1}
+	steps := []struct {
+		removed  int
+		interval time.Duration
+		workers  int
+	}{
+		{5, 20 * time.Millisecond, 2},
+		{5, 10 * time.Millisecond, 4},
+		{5, 10 * time.Millisecond, 4},
+		{1, 10 * time.Millisecond, 4},
+		{0, 20 * time.Millisecond, 2},
+		{0, 40 * time.Millisecond, 1},
+		{0, 80 * time.Millisecond, 1},
+		{0, 80 * time.Millisecond, 1},
+	}
+	for i, step := range steps {
+		pace = p.next(pace, step.removed)
+		if pace.interval != step.interval || pace.workers != step.workers {
+			t.Errorf("Step %d: expected %v/%d, got %v/%d", i, step.interval, step.workers, pace.interval, pace.workers)
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "pie_cache_pacing")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithJanitorPacing(JanitorPacing{
+		MinInterval: 5 * time.Millisecond, MaxInterval: 20 * time.Millisecond, MaxWorkers: 4, Backlog: 3,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	for i := 0; i < 20; i++ {
+		_ = cache.SetWithTTL(string(rune('a'+i)), []byte("x"), time.Millisecond)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if keys, _ := cache.ListKeys(); len(keys) == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 0 {
+		t.Errorf("Expected paced janitor to purge all entries, %d left", len(keys))
+	}
+	// Idle runs back off towards the maximum interval
+	time.Sleep(60 * time.Millisecond)
+	if pace := cache.pace.Load(); pace == nil || pace.interval != 20*time.Millisecond || pace.workers != 1 {
+		t.Errorf("Expected idle pace 20ms/1, got %+v", pace)
+	}
+}
@@ -0,0 +1,26 @@
+package pie_cache
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// WithTTLJitter spreads the TTL of every write randomly by up to fraction
+// of it in either direction, so entries written together do not all
+// expire in the same second and send their reloads to the origin at once.
+// 0.1 turns a TTL of an hour into one between 54 and 66 minutes.
+func WithTTLJitter(fraction float64) Option {
+	return func(fc *FileCache) {
+		if fraction > 0 && fraction < 1 {
+			fc.ttlJitter = fraction
+		}
+	}
+}
+
+// jitter returns ttl moved randomly by up to the configured fraction
+func (fc *FileCache) jitter(ttl time.Duration) time.Duration {
+	if fc.ttlJitter == 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration((rand.Float64()*2-1)*fc.ttlJitter*float64(ttl))
+}
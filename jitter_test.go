@@ -0,0 +1,32 @@
+package pie_cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLJitter(t *testing.T) {
+	cache, err := NewWithStore(NewMemoryStore(), time.Hour, WithTTLJitter(0.1))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	lifetimes := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%d", i)
+		_ = cache.Set(key, []byte("v"))
+		meta, err := cache.Inspect(key)
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		d := meta.ExpireAt.Sub(meta.Created)
+		if d < 54*time.Minute || d > 66*time.Minute {
+			t.Errorf("Expected a TTL within 10%% of an hour, got %v", d)
+		}
+		lifetimes[d] = true
+	}
+	if len(lifetimes) < 2 {
+		t.Error("Expected TTLs to be spread")
+	}
+}
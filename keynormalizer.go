@@ -0,0 +1,33 @@
+package pie_cache
+
+import "strings"
+
+// KeyNormalizer maps a key to the key its entry's directory is derived
+// from. Keys it maps to the same value are stored side by side in one
+// directory, under their own file names, so they never share an entry.
+// The default is the identity.
+type KeyNormalizer func(key string) string
+
+// WithKeyNormalizer places entries by n(key) instead of by key. It only
+// decides placement, so changing it on an existing cache leaves entries
+// where they are not found until Relocate moves them.
+func WithKeyNormalizer(n KeyNormalizer) Option {
+	return func(fc *FileCache) {
+		fc.keyNormalizer = n
+	}
+}
+
+// StripSuffixes returns a KeyNormalizer removing the first of suffixes
+// that key ends with, e.g. StripSuffixes("_info.json", "_toc.json") keeps
+// "book_info.json" and "book_toc.json" in the directory of "book"
+func StripSuffixes(suffixes ...string) KeyNormalizer {
+	suffixes = append([]string(nil), suffixes...)
+	return func(key string) string {
+		for _, suffix := range suffixes {
+			if s, ok := strings.CutSuffix(key, suffix); ok {
+				return s
+			}
+		}
+		return key
+	}
+}
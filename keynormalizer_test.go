@@ -0,0 +1,54 @@
+package pie_cache
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestKeyNormalizer(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_keynorm")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Without a normalizer suffixes are part of the key like anything else
+	plain, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	a, _ := plain.entryName("book")
+	b, _ := plain.entryName("book_info.json")
+	if path.Dir(a) == path.Dir(b) {
+		t.Errorf("Expected keys placed independently by default, both in %s", path.Dir(a))
+	}
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithKeyNormalizer(StripSuffixes("_info.json", "_toc.json")))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	book, _ := cache.entryName("book")
+	for _, key := range []string{"book_info.json", "book_toc.json"} {
+		name, _ := cache.entryName(key)
+		if path.Dir(name) != path.Dir(book) {
+			t.Errorf("Expected %s in the directory of book, got %s", key, name)
+		}
+		if name == book {
+			t.Errorf("Expected %s in its own file", key)
+		}
+	}
+	if name, _ := cache.entryName("book_info.json.bak"); path.Dir(name) == path.Dir(book) {
+		t.Error("Expected only suffixes to be stripped")
+	}
+
+	_ = cache.Set("book", []byte("b"))
+	_ = cache.Set("book_info.json", []byte("i"))
+	if data, err := cache.Get("book"); err != nil || string(data) != "b" {
+		t.Errorf("Expected keys sharing a directory to keep their values, got %q, %v", data, err)
+	}
+	if data, err := cache.Get("book_info.json"); err != nil || string(data) != "i" {
+		t.Errorf("Expected keys sharing a directory to keep their values, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,128 @@
+package pie_cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// layoutName is the manifest recording the layout a cache was created with
+const layoutName = metaPrefix + "layout"
+
+// ErrLayoutMismatch is returned when opening a cache with a hash or path
+// scheme different from the one its entries were written with
+var ErrLayoutMismatch = errors.New("cache layout mismatch")
+
+// Layout describes how keys map to store names
+type Layout struct {
+	Hash      HashFunc
+	Levels    int
+	PrefixLen int
+}
+
+// String returns the layout as "sha256 3x2"
+func (l Layout) String() string {
+	return fmt.Sprintf("%v %dx%d", l.Hash, l.Levels, l.PrefixLen)
+}
+
+// layoutManifest is the stored form of a Layout
+type layoutManifest struct {
+	Hash      string `json:"hash"`
+	Levels    int    `json:"levels"`
+	PrefixLen int    `json:"prefixLen"`
+}
+
+// LayoutPolicy decides what opening a cache does when the layout given by
+// its options differs from the one recorded in the store
+type LayoutPolicy int
+
+const (
+	// LayoutRefuse fails with ErrLayoutMismatch. It is the default.
+	LayoutRefuse LayoutPolicy = iota
+	// LayoutAdopt ignores WithHash and WithPathScheme and uses the
+	// recorded layout
+	LayoutAdopt
+	// LayoutMigrate moves the existing entries to the new layout with
+	// Relocate before the cache is used
+	LayoutMigrate
+)
+
+// WithLayoutPolicy sets what happens when the cache was created with a
+// different hash or path scheme. Without it, opening such a cache fails
+// rather than silently missing every existing key.
+func WithLayoutPolicy(p LayoutPolicy) Option {
+	return func(fc *FileCache) {
+		fc.layoutPolicy = p
+	}
+}
+
+// layout returns the layout of fc
+func (fc *FileCache) layout() Layout {
+	return Layout{Hash: fc.hash, Levels: fc.dirLevels, PrefixLen: fc.prefixLen}
+}
+
+// ReadLayout returns the layout recorded in store. It returns ErrNotFound
+// for stores not opened since layouts were recorded.
+func ReadLayout(store Store) (Layout, error) {
+	data, err := store.Fetch(layoutName)
+	if err != nil {
+		return Layout{}, err
+	}
+	var m layoutManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Layout{}, fmt.Errorf("failed to parse layout manifest: %v", err)
+	}
+	hash, err := ParseHashFunc(m.Hash)
+	if err != nil {
+		return Layout{}, fmt.Errorf("failed to parse layout manifest: %v", err)
+	}
+	return Layout{Hash: hash, Levels: m.Levels, PrefixLen: m.PrefixLen}, nil
+}
+
+// writeLayout records the layout of fc in its store
+func (fc *FileCache) writeLayout() error {
+	l := fc.layout()
+	data, err := json.Marshal(layoutManifest{Hash: l.Hash.String(), Levels: l.Levels, PrefixLen: l.PrefixLen})
+	if err != nil {
+		return err
+	}
+	if err := fc.store.Put(layoutName, data); err != nil {
+		return fmt.Errorf("failed to write layout manifest: %v", err)
+	}
+	return nil
+}
+
+// checkLayout compares the layout of fc with the recorded one and applies
+// the layout policy. A store without a manifest is taken to be in the
+// layout of fc, which is then recorded.
+func (fc *FileCache) checkLayout() error {
+	stored, err := ReadLayout(fc.store)
+	if err == ErrNotFound {
+		if fc.readOnly {
+			return nil
+		}
+		return fc.writeLayout()
+	}
+	if err != nil {
+		return err
+	}
+	if stored == fc.layout() {
+		return nil
+	}
+
+	switch fc.layoutPolicy {
+	case LayoutAdopt:
+		fc.hash, fc.dirLevels, fc.prefixLen = stored.Hash, stored.Levels, stored.PrefixLen
+		return validateLayout(fc.dirLevels, fc.prefixLen, fc.hash.hexLen())
+	case LayoutMigrate:
+		if _, err := fc.Relocate(); err != nil {
+			return err
+		}
+		if _, err := fc.CompactDirs(); err != nil {
+			return err
+		}
+		return fc.writeLayout()
+	default:
+		return ErrLayoutMismatch
+	}
+}
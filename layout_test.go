@@ -0,0 +1,55 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLayoutPolicy(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_layout_policy")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("key", []byte("v"))
+	store, _ := NewFileStore(tempDir)
+	if l, err := ReadLayout(store); err != nil || l != (Layout{HashSHA256, 3, 2}) {
+		t.Errorf("Expected sha256 3x2 recorded, got %v, %v", l, err)
+	}
+
+	if _, err := NewFileCache(tempDir, time.Minute, WithPathScheme(1, 2)); err != ErrLayoutMismatch {
+		t.Errorf("Expected ErrLayoutMismatch, got %v", err)
+	}
+	if _, err := NewFileCache(tempDir, time.Minute, WithHash(HashFNV)); err != ErrLayoutMismatch {
+		t.Errorf("Expected ErrLayoutMismatch for another hash, got %v", err)
+	}
+
+	adopted, err := NewFileCache(tempDir, time.Minute, WithPathScheme(1, 2), WithLayoutPolicy(LayoutAdopt))
+	if err != nil {
+		t.Fatalf("Failed to adopt layout: %v", err)
+	}
+	if data, err := adopted.Get("key"); err != nil || string(data) != "v" {
+		t.Errorf("Expected key in adopted layout, got %q, %v", data, err)
+	}
+
+	migrated, err := NewFileCache(tempDir, time.Minute, WithHash(HashXXHash), WithPathScheme(1, 2),
+		WithLayoutPolicy(LayoutMigrate))
+	if err != nil {
+		t.Fatalf("Failed to migrate layout: %v", err)
+	}
+	if data, err := migrated.Get("key"); err != nil || string(data) != "v" {
+		t.Errorf("Expected key after migration, got %q, %v", data, err)
+	}
+	if l, _ := ReadLayout(store); l != (Layout{HashXXHash, 1, 2}) {
+		t.Errorf("Expected xxhash 1x2 recorded, got %v", l)
+	}
+	if _, err := NewFileCache(tempDir, time.Minute); err != ErrLayoutMismatch {
+		t.Errorf("Expected the old layout to be refused now, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package pie_cache
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrTooLarge is returned when a value exceeds the limit set with
+// WithMaxValueSize. Nothing is stored.
+var ErrTooLarge = errors.New("cache value too large")
+
+// WithMaxValueSize rejects values larger than bytes with ErrTooLarge
+// instead of writing them, so a runaway producer cannot fill the disk.
+// Streamed values are cut off once they pass the limit. Values GetOrLoad
+// and loaders produce are still returned when too large, just not cached.
+func WithMaxValueSize(bytes int64) Option {
+	return func(fc *FileCache) {
+		if bytes > 0 {
+			fc.maxValueSize = bytes
+		}
+	}
+}
+
+// WithMaxKeyLength lowers the length of the longest key accepted from
+// MaxKeyLength to n bytes. Longer keys get ErrInvalidKey.
+func WithMaxKeyLength(n int) Option {
+	return func(fc *FileCache) {
+		if n > 0 && n < MaxKeyLength {
+			fc.maxKeyLength = n
+		}
+	}
+}
+
+// keyTooLong reports whether key exceeds the key length limit
+func (fc *FileCache) keyTooLong(key string) bool {
+	if fc.maxKeyLength > 0 {
+		return len(key) > fc.maxKeyLength
+	}
+	return len(key) > MaxKeyLength
+}
+
+// checkSize returns ErrTooLarge if a value of size bytes exceeds the limit
+func (fc *FileCache) checkSize(size int64) error {
+	if fc.maxValueSize > 0 && size > fc.maxValueSize {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// limitReader returns r reading at most one byte more than the value size
+// limit, so that reading past the limit can be told from reaching it
+func (fc *FileCache) limitReader(r io.Reader) io.Reader {
+	if fc.maxValueSize > 0 {
+		return io.LimitReader(r, fc.maxValueSize+1)
+	}
+	return r
+}
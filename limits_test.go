@@ -0,0 +1,74 @@
+package pie_cache
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxValueSize(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_limits")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, store := range []Store{NewMemoryStore(), nil} {
+		var cache *FileCache
+		if store == nil {
+			cache, err = NewFileCache(tempDir, time.Minute, WithMaxValueSize(4))
+		} else {
+			cache, err = NewWithStore(store, time.Minute, WithMaxValueSize(4))
+		}
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+
+		if err := cache.Set("fits", []byte("1234")); err != nil {
+			t.Errorf("Expected a value at the limit to be stored, got %v", err)
+		}
+		if err := cache.Set("big", []byte("12345")); err != ErrTooLarge {
+			t.Errorf("Expected ErrTooLarge, got %v", err)
+		}
+		if err := cache.SetFromReader("streamed", strings.NewReader("12345"), time.Minute); err != ErrTooLarge {
+			t.Errorf("Expected ErrTooLarge for a streamed value, got %v", err)
+		}
+		if err := cache.SetFromReader("small", strings.NewReader("1234"), time.Minute); err != nil {
+			t.Errorf("Expected a streamed value at the limit to be stored, got %v", err)
+		}
+		for _, key := range []string{"big", "streamed"} {
+			if cache.Exists(key) {
+				t.Errorf("Expected %s not to be stored", key)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) == 0 {
+		t.Error("Expected the file cache to hold the values that fit")
+	}
+
+	// Loaded values that are too large are returned, just not cached
+	cache, _ := NewWithStore(NewMemoryStore(), time.Minute, WithMaxValueSize(4))
+	v, err := cache.GetOrLoad("loaded", func(string) ([]byte, time.Duration, error) {
+		return []byte("12345"), 0, nil
+	})
+	if err != nil || string(v) != "12345" {
+		t.Errorf("Expected the loaded value, got %q, %v", v, err)
+	}
+	if cache.Exists("loaded") {
+		t.Error("Expected the oversized loaded value not to be cached")
+	}
+}
+
+func TestMaxKeyLength(t *testing.T) {
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithMaxKeyLength(8))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := cache.Set("12345678", []byte("v")); err != nil {
+		t.Errorf("Expected a key at the limit to be accepted, got %v", err)
+	}
+	if err := cache.Set("123456789", []byte("v")); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+}
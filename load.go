@@ -0,0 +1,171 @@
+package pie_cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// leasePrefix holds the leases of keys being loaded by GetOrLoad
+const leasePrefix = metaPrefix + "leases/"
+
+// LoaderFunc produces the value of a missing key for GetOrLoad, along with
+// how long to cache it. A ttl of 0 uses the cache's default TTL.
+type LoaderFunc func(key string) (data []byte, ttl time.Duration, err error)
+
+// LoadPolicy controls how GetOrLoad coordinates loads across processes
+// sharing a store. It only has an effect on stores implementing LeaseStore.
+type LoadPolicy struct {
+	Lease      time.Duration // How long a loader may take before others load too
+	Poll       time.Duration // How often waiting callers check for the value
+	ServeStale bool          // Return the expired value instead of waiting
+}
+
+// defaultLoadPolicy is used unless WithLoadPolicy is given
+var defaultLoadPolicy = LoadPolicy{Lease: 30 * time.Second, Poll: 50 * time.Millisecond}
+
+// WithLoadPolicy sets how GetOrLoad coordinates loads across processes
+func WithLoadPolicy(p LoadPolicy) Option {
+	return func(fc *FileCache) {
+		if p.Lease <= 0 {
+			p.Lease = defaultLoadPolicy.Lease
+		}
+		if p.Poll <= 0 {
+			p.Poll = defaultLoadPolicy.Poll
+		}
+		fc.loadPolicy = p
+	}
+}
+
+// WithLoader makes Get load missing or expired keys with load, as with
+// GetOrLoad, for keys whose namespace has no loader of its own
+func WithLoader(load LoaderFunc) Option {
+	return func(fc *FileCache) {
+		fc.loader = load
+	}
+}
+
+// RegisterLoader makes Get load missing or expired keys of namespace (see
+// NamespaceOf) with load, as with GetOrLoad. A nil load removes the
+// namespace's loader again. It is safe to call while the cache is in use.
+func (fc *FileCache) RegisterLoader(namespace string, load LoaderFunc) {
+	fc.loadersMu.Lock()
+	defer fc.loadersMu.Unlock()
+	if load == nil {
+		delete(fc.loaders, namespace)
+		return
+	}
+	if fc.loaders == nil {
+		fc.loaders = make(map[string]LoaderFunc)
+	}
+	fc.loaders[namespace] = load
+}
+
+// loaderFor returns the loader Get uses for key, or nil if it has none
+func (fc *FileCache) loaderFor(key string) LoaderFunc {
+	fc.loadersMu.RLock()
+	load, ok := fc.loaders[NamespaceOf(key)]
+	fc.loadersMu.RUnlock()
+	if ok {
+		return load
+	}
+	return fc.loader
+}
+
+// GetOrLoad returns the value of key, calling load to produce and store it
+// when it is missing or expired. Concurrent calls for the same key share a
+// single load. On a LeaseStore the same holds across processes: the one
+// holding the key's lease loads, while the others wait for its result or,
+// with LoadPolicy.ServeStale, return the expired value meanwhile.
+func (fc *FileCache) GetOrLoad(key string, load LoaderFunc) ([]byte, error) {
+	item, err := fc.readItem(context.Background(), key, fc.loadPolicy.ServeStale)
+	fc.recordRead(key, err)
+	if err == nil {
+		return item.Data, nil
+	}
+	if err != ErrNotFound && err != ErrExpired {
+		return nil, err
+	}
+
+	if fc.stampedes != nil {
+		fc.stampedes.join(key)
+	}
+	v, err, _ := fc.loads.Do(key, func() (any, error) {
+		data, err := fc.load(key, load, item)
+		if fc.stampedes != nil {
+			if s, ok := fc.stampedes.finish(key, time.Now()); ok {
+				fc.reportStampede(s)
+			}
+		}
+		return data, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyBytes(v.([]byte)), nil
+}
+
+// load produces the value of key for GetOrLoad, taking the key's lease if
+// the store offers leases. stale is the expired entry, if kept.
+func (fc *FileCache) load(key string, load LoaderFunc, stale *CacheItem) ([]byte, error) {
+	ls, ok := fc.store.(LeaseStore)
+	if !ok {
+		return fc.loadAndStore(key, load)
+	}
+
+	lease := leaseName(key)
+	for {
+		release, ok, err := ls.Lease(lease, fc.loadPolicy.Lease)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			defer release()
+			// Another process may have stored the value since our miss
+			if item, err := fc.getItem(context.Background(), key); err == nil {
+				return item.Data, nil
+			}
+			return fc.loadAndStore(key, load)
+		}
+
+		if stale != nil {
+			return stale.Data, nil
+		}
+		time.Sleep(fc.loadPolicy.Poll)
+		if item, err := fc.getItem(context.Background(), key); err == nil {
+			return item.Data, nil
+		}
+	}
+}
+
+// loadAndStore calls load and caches what it returns
+func (fc *FileCache) loadAndStore(key string, load LoaderFunc) ([]byte, error) {
+	if fc.stampedes != nil {
+		if s, ok := fc.stampedes.loaded(key, time.Now()); ok {
+			fc.reportStampede(s)
+		}
+	}
+	data, ttl, err := load(key)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = fc.ttl
+	}
+	if err := fc.SetWithTTL(key, data, ttl); err != nil {
+		fc.logEvent(Event{Type: EventWriteFailed, Key: key, Err: err})
+	}
+	return data, nil
+}
+
+// leaseName returns the store name of the lease on loading key
+func leaseName(key string) string {
+	return leasePrefix + leaseHash(key)
+}
+
+// leaseHash returns the part of a lease name identifying key
+func leaseHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,130 @@
+package pie_cache
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_load")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Two caches on one directory stand in for two processes
+	policy := WithLoadPolicy(LoadPolicy{Lease: time.Second, Poll: time.Millisecond})
+	first, err := NewFileCache(tempDir, time.Minute, policy)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	second, err := NewFileCache(tempDir, time.Minute, policy)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	var calls atomic.Int32
+	unblock := make(chan struct{})
+	load := func(key string) ([]byte, time.Duration, error) {
+		calls.Add(1)
+		<-unblock
+		return []byte("value of " + key), 0, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for i := range results {
+		cache := first
+		if i%2 == 1 {
+			cache = second
+		}
+		wg.Add(1)
+		go func(i int, cache *FileCache) {
+			defer wg.Done()
+			data, err := cache.GetOrLoad("report", load)
+			if err != nil {
+				t.Errorf("GetOrLoad failed: %v", err)
+			}
+			results[i] = string(data)
+		}(i, cache)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(unblock)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected one load, got %d", n)
+	}
+	for i, r := range results {
+		if r != "value of report" {
+			t.Errorf("Caller %d got %q", i, r)
+		}
+	}
+	if data, err := second.Get("report"); err != nil || string(data) != "value of report" {
+		t.Errorf("Expected loaded value to be cached, got %q, %v", data, err)
+	}
+}
+
+func TestGetOrLoadServeStale(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithLoadPolicy(LoadPolicy{ServeStale: true}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	load := func(string) ([]byte, time.Duration, error) { return []byte("new"), 0, nil }
+	_ = cache.SetWithTTL("k", []byte("old"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	// Another process is loading the key
+	release, ok, _ := store.Lease(leaseName("k"), time.Minute)
+	if !ok {
+		t.Fatal("Expected to get a free lease")
+	}
+	if data, err := cache.GetOrLoad("k", load); err != nil || string(data) != "old" {
+		t.Errorf("Expected stale value while another loads, got %q, %v", data, err)
+	}
+
+	release()
+	if data, err := cache.GetOrLoad("k", load); err != nil || string(data) != "new" {
+		t.Errorf("Expected released lease to load, got %q, %v", data, err)
+	}
+}
+
+func TestRegisterLoader(t *testing.T) {
+	var calls atomic.Int32
+	loader := func(prefix string) LoaderFunc {
+		return func(key string) ([]byte, time.Duration, error) {
+			calls.Add(1)
+			return []byte(prefix + key), 0, nil
+		}
+	}
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithLoader(loader("default:")))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	cache.RegisterLoader("user", loader("user-db:"))
+
+	if v, err := cache.GetString("user:1"); err != nil || v != "user-db:user:1" {
+		t.Errorf("Expected namespace loader, got %q, %v", v, err)
+	}
+	if v, err := cache.GetString("page"); err != nil || v != "default:page" {
+		t.Errorf("Expected default loader, got %q, %v", v, err)
+	}
+	// Loaded values are cached
+	if v, _ := cache.GetString("user:1"); v != "user-db:user:1" || calls.Load() != 2 {
+		t.Errorf("Expected cached value without another load, got %q after %d loads", v, calls.Load())
+	}
+
+	cache.RegisterLoader("user", nil)
+	if v, _ := cache.GetString("user:2"); v != "default:user:2" {
+		t.Errorf("Expected default loader after unregistering, got %q", v)
+	}
+
+	plain, _ := NewWithStore(NewMemoryStore(), time.Minute)
+	if _, err := plain.Get("user:1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound without loaders, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package pie_cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// EventType identifies what a logged Event describes
+type EventType int
+
+const (
+	// EventWrite is logged after an entry was written
+	EventWrite EventType = iota
+	// EventWriteFailed is logged when writing an entry failed
+	EventWriteFailed
+	// EventExpired is logged when a read found and removed an expired entry
+	EventExpired
+	// EventEvict is logged when maintenance removed an entry
+	EventEvict
+	// EventCorrupt is logged when an unreadable or unparsable file was found
+	EventCorrupt
+	// EventPurge is logged when a PurgeExpired run finished
+	EventPurge
+	// EventRepair is logged when read repair fixed or removed an entry
+	EventRepair
+	// EventIndexMismatch is logged when VerifyIndex found the index and an
+	// entry disagreeing
+	EventIndexMismatch
+	// EventSecondaryFailed is logged when mirroring a write or delete to
+	// the WithSecondary cache failed
+	EventSecondaryFailed
+	// EventForeign is logged when maintenance left a file alone because it
+	// does not hold an entry at the path its key maps to
+	EventForeign
+	// EventCollision is logged when a read found the entry of another key
+	// where its key maps to
+	EventCollision
+	// EventQuotaWarning is logged when a write took usage past the
+	// threshold of a WithSoftQuota quota
+	EventQuotaWarning
+)
+
+var eventTypeNames = map[EventType]string{
+	EventWrite:           "write",
+	EventWriteFailed:     "write_failed",
+	EventExpired:         "expired",
+	EventEvict:           "evict",
+	EventCorrupt:         "corrupt",
+	EventPurge:           "purge",
+	EventRepair:          "repair",
+	EventIndexMismatch:   "index_mismatch",
+	EventSecondaryFailed: "secondary_failed",
+	EventForeign:         "foreign",
+	EventCollision:       "collision",
+	EventQuotaWarning:    "quota_warning",
+}
+
+// String returns the event type name
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Event describes something the cache did
+type Event struct {
+	Type    EventType // What happened
+	Time    time.Time // When it happened
+	Key     string    // Cache key, if known
+	Path    string    // Store name of the entry involved, if any
+	Size    int       // Bytes written, for write events
+	Count   int       // Entries affected, for purge events
+	Removed bool      // Whether the file was deleted, for corrupt events
+	Err     error     // Failure cause, if any
+	TraceID string    // Trace ID of the call that caused the event, if given
+}
+
+// Logger receives cache events. Implementations must be safe for concurrent
+// use and should return quickly; they are called inline.
+type Logger interface {
+	Log(e Event)
+}
+
+// LoggerFunc adapts an ordinary function to the Logger interface
+type LoggerFunc func(e Event)
+
+// Log calls f(e)
+func (f LoggerFunc) Log(e Event) {
+	f(e)
+}
+
+// WithLogger sends cache events to l
+func WithLogger(l Logger) Option {
+	return func(fc *FileCache) {
+		fc.logger = l
+	}
+}
+
+// NewSlogLogger returns a Logger that writes events to l. Failures and
+// corrupt files are logged at warn level, everything else at debug level.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return LoggerFunc(func(e Event) {
+		level := slog.LevelDebug
+		if e.Err != nil || e.Type == EventCorrupt {
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{slog.String("event", e.Type.String())}
+		if e.Key != "" {
+			attrs = append(attrs, slog.String("key", e.Key))
+		}
+		if e.Path != "" {
+			attrs = append(attrs, slog.String("path", e.Path))
+		}
+		if e.Size != 0 {
+			attrs = append(attrs, slog.Int("size", e.Size))
+		}
+		if e.Type == EventPurge {
+			attrs = append(attrs, slog.Int("count", e.Count))
+		}
+		if e.Type == EventCorrupt || e.Type == EventRepair {
+			attrs = append(attrs, slog.Bool("removed", e.Removed))
+		}
+		if e.Err != nil {
+			attrs = append(attrs, slog.String("error", e.Err.Error()))
+		}
+		if e.TraceID != "" {
+			attrs = append(attrs, slog.String("trace_id", e.TraceID))
+		}
+		l.LogAttrs(context.Background(), level, "pie_cache "+e.Type.String(), attrs...)
+	})
+}
+
+// logEvent forwards e to the configured logger, if any
+func (fc *FileCache) logEvent(e Event) {
+	if fc.logger == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if fc.logKey != nil {
+		fc.logKey.redact(&e)
+	}
+	fc.logger.Log(e)
+}
+
+// logEventContext is logEvent tagging e with the trace ID of ctx
+func (fc *FileCache) logEventContext(ctx context.Context, e Event) {
+	e.TraceID = TraceIDFrom(ctx)
+	fc.logEvent(e)
+}
@@ -0,0 +1,82 @@
+package pie_cache
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_logger")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var mu sync.Mutex
+	var events []Event
+	cache, err := NewFileCache(tempDir, time.Minute, WithLogger(LoggerFunc(func(e Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	_ = cache.Set("a", []byte("abc"))
+	_ = cache.SetWithTTL("gone.json", []byte("x"), time.Millisecond)
+
+	// Plant a corrupt entry where PurgeExpired will find it
+	corrupt, _ := cache.getFilePath("broken.json")
+	_ = os.MkdirAll(filepath.Dir(corrupt), 0755)
+	_ = os.WriteFile(corrupt, []byte("{not json"), 0644)
+
+	time.Sleep(5 * time.Millisecond)
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+
+	// Maintenance only deletes files it can tell are its own entries
+	if _, err := os.Stat(corrupt); err != nil {
+		t.Errorf("Expected the corrupt file kept, got %v", err)
+	}
+
+	counts := map[EventType]int{}
+	for _, e := range events {
+		counts[e.Type]++
+		if e.Time.IsZero() {
+			t.Errorf("Event %v has no time", e.Type)
+		}
+		if e.Type == EventPurge && e.Count != 1 {
+			t.Errorf("Expected purge count 1, got %d", e.Count)
+		}
+		if e.Type == EventWrite && e.Key == "a" && e.Size != 3 {
+			t.Errorf("Expected write size 3, got %d", e.Size)
+		}
+	}
+	want := map[EventType]int{EventWrite: 2, EventEvict: 1, EventCorrupt: 1, EventPurge: 1}
+	for typ, n := range want {
+		if counts[typ] != n {
+			t.Errorf("Expected %d %v events, got %d", n, typ, counts[typ])
+		}
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	l.Log(Event{Type: EventCorrupt, Path: "/x/y", Removed: true})
+
+	out := buf.String()
+	for _, want := range []string{"level=WARN", "event=corrupt", "path=/x/y", "removed=true"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in %q", want, out)
+		}
+	}
+}
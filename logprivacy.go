@@ -0,0 +1,78 @@
+package pie_cache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// keyRedactor rewrites a key for logging
+type keyRedactor func(key string) string
+
+// WithHashedKeys logs a keyed hash of every key instead of the key, e.g.
+// "#9f86d081884c7d65", for caches holding user identifiers. Events for
+// one key still carry the same hash, so they can be correlated. The hash
+// is an HMAC under salt; with an empty salt a random one is chosen, and
+// hashes then differ between processes.
+func WithHashedKeys(salt []byte) Option {
+	return func(fc *FileCache) {
+		if len(salt) == 0 {
+			salt = make([]byte, 32)
+			_, _ = rand.Read(salt)
+		}
+		fc.logKey = func(key string) string {
+			mac := hmac.New(sha256.New, salt)
+			mac.Write([]byte(key))
+			return "#" + hex.EncodeToString(mac.Sum(nil)[:8])
+		}
+	}
+}
+
+// WithTruncatedKeys logs at most the first n bytes of every key, followed
+// by "…", instead of the key, e.g. to keep the namespace of "user:1234"
+// with n = 5. Short keys are cut to half their length, so no key is ever
+// logged whole.
+func WithTruncatedKeys(n int) Option {
+	return func(fc *FileCache) {
+		fc.logKey = func(key string) string {
+			keep := min(n, len(key)/2)
+			for keep > 0 && !utf8.RuneStart(key[keep]) {
+				keep--
+			}
+			return key[:keep] + "…"
+		}
+	}
+}
+
+// redact rewrites the key of e, and the entry name and error message
+// where they contain it, before e is logged. Hashed entry names and the
+// cache's bookkeeping names carry no key and are logged as is.
+func (r keyRedactor) redact(e *Event) {
+	var raw []string
+	if e.Key != "" {
+		raw = append(raw, e.Key)
+		e.Key = r(e.Key)
+	}
+	if e.Path != "" && !isMetaName(e.Path) {
+		dir, base := path.Split(e.Path)
+		if !strings.HasPrefix(base, hashedNamePrefix) {
+			raw = append(raw, base)
+			e.Path = dir + r(base)
+		}
+	}
+	if e.Err == nil || len(raw) == 0 {
+		return
+	}
+	msg := e.Err.Error()
+	for _, s := range raw {
+		msg = strings.ReplaceAll(msg, s, r(s))
+	}
+	if msg != e.Err.Error() {
+		e.Err = errors.New(msg)
+	}
+}
@@ -0,0 +1,62 @@
+package pie_cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashedKeys(t *testing.T) {
+	var events []Event
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithHashedKeys([]byte("salt")), WithLogger(LoggerFunc(func(e Event) {
+		events = append(events, e)
+	})))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	_ = cache.Set("user:alice", []byte("profile"))
+	_ = cache.Set("user:alice", []byte("profile v2"))
+	name, _ := cache.entryName("user:alice")
+	_ = store.Put(name, []byte("{not json"))
+	_, _ = cache.Get("user:alice")
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	for _, e := range events {
+		s := e.Key + " " + e.Path
+		if e.Err != nil {
+			s += " " + e.Err.Error()
+		}
+		if strings.Contains(s, "alice") {
+			t.Errorf("Expected no raw key in %v event, got %q", e.Type, s)
+		}
+		if e.Key != events[0].Key || !strings.HasPrefix(e.Key, "#") {
+			t.Errorf("Expected the same hash for every event, got %q and %q", e.Key, events[0].Key)
+		}
+	}
+	if events[2].Type != EventCorrupt || !strings.HasSuffix(events[2].Path, events[0].Key) {
+		t.Errorf("Expected a corrupt event with the hashed name, got %v at %q", events[2].Type, events[2].Path)
+	}
+}
+
+func TestTruncatedKeys(t *testing.T) {
+	var keys []string
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithTruncatedKeys(5), WithLogger(LoggerFunc(func(e Event) {
+		keys = append(keys, e.Key)
+	})))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	_ = cache.Set("user:alice", []byte("profile"))
+	_ = cache.Set("ab", []byte("x"))
+	_ = cache.Set("ééé", []byte("x"))
+
+	want := []string{"user:…", "a…", "é…"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected keys %q, got %q", want, keys)
+	}
+}
@@ -0,0 +1,485 @@
+// Package memcached serves a pie_cache.FileCache over the memcached text
+// protocol, so applications with an existing memcached client can use a
+// disk-persistent cache without code changes.
+//
+// Supported commands are get, gets, set, add, replace, delete, touch, incr,
+// decr, version and quit. There is no cas command: gets always reports a
+// cas value of 0. Item flags are kept in a 4-byte prefix of the stored
+// value, so entries written here read back with that prefix through
+// FileCache.Get.
+//
+// The protocol carries no credentials. WithAuthorizer checks every command
+// against the client's address and, when Serve is given a TLS listener,
+// its verified certificates.
+package memcached
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// defaultMaxItemSize matches memcached's default item size limit
+const defaultMaxItemSize = 1 << 20
+
+// maxRelativeExptime is the largest exptime memcached treats as seconds
+// from now; larger values are Unix timestamps
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+// maxKeyLen is the longest key the protocol allows
+const maxKeyLen = 250
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithAuthorizer checks every command with auth before it reaches the
+// cache
+func WithAuthorizer(auth pie_cache.Authorizer) Option {
+	return func(s *Server) {
+		s.auth = auth
+	}
+}
+
+// WithMaxItemSize rejects values larger than n bytes
+func WithMaxItemSize(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxItemSize = n
+		}
+	}
+}
+
+// Server answers memcached text protocol requests from a FileCache
+type Server struct {
+	cache       *pie_cache.FileCache
+	auth        pie_cache.Authorizer
+	maxItemSize int
+
+	// arith serializes mutating commands, so the read-modify-write cycles
+	// of incr/decr, touch, add and replace see no writes in between
+	arith sync.Mutex
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer creates a Server backed by cache
+func NewServer(cache *pie_cache.FileCache, opts ...Option) *Server {
+	s := &Server{
+		cache:       cache,
+		maxItemSize: defaultMaxItemSize,
+		listeners:   make(map[net.Listener]struct{}),
+		conns:       make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until it fails or the server is closed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return net.ErrClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops all listeners, closes open connections and waits for their
+// handlers to return
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn handles requests on conn until the client quits or fails
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+			w.Flush()
+			continue
+		}
+
+		cmd, args := fields[0], fields[1:]
+		switch cmd {
+		case "get", "gets":
+			s.get(conn, w, args, cmd == "gets")
+		case "set", "add", "replace":
+			if err := s.store(conn, r, w, cmd, args); err != nil {
+				return
+			}
+		case "delete":
+			s.delete(conn, w, args)
+		case "touch":
+			s.touch(conn, w, args)
+		case "incr", "decr":
+			s.arithmetic(conn, w, args, cmd == "incr")
+		case "version":
+			w.WriteString("VERSION pie_cache\r\n")
+		case "quit":
+			w.Flush()
+			return
+		default:
+			w.WriteString("ERROR\r\n")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// authorize runs the configured Authorizer for op on key and writes the
+// rejection if it fails. It reports whether the command may proceed.
+func (s *Server) authorize(conn net.Conn, w *bufio.Writer, op pie_cache.Operation, key string) bool {
+	if s.auth == nil {
+		return true
+	}
+
+	req := &pie_cache.AccessRequest{
+		Op:         op,
+		Key:        key,
+		Namespace:  pie_cache.NamespaceOf(key),
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		req.PeerCertificates = tc.ConnectionState().PeerCertificates
+	}
+	if err := s.auth.Authorize(req); err != nil {
+		w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+		return false
+	}
+	return true
+}
+
+func (s *Server) get(conn net.Conn, w *bufio.Writer, keys []string, withCAS bool) {
+	if len(keys) == 0 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	for _, key := range keys {
+		if !validKey(key) {
+			w.WriteString("CLIENT_ERROR bad key\r\n")
+			return
+		}
+		if !s.authorize(conn, w, pie_cache.OpRead, key) {
+			return
+		}
+	}
+	for _, key := range keys {
+		flags, data, _, err := s.load(key)
+		if err != nil {
+			continue
+		}
+		if withCAS {
+			fmt.Fprintf(w, "VALUE %s %d %d 0\r\n", key, flags, len(data))
+		} else {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, flags, len(data))
+		}
+		w.Write(data)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// store handles set, add and replace. It returns an error only when the
+// connection can no longer be used.
+func (s *Server) store(conn net.Conn, r *bufio.Reader, w *bufio.Writer, cmd string, args []string) error {
+	noreply := len(args) == 5 && args[4] == "noreply"
+	if len(args) != 4 && !noreply {
+		w.WriteString("ERROR\r\n")
+		return nil
+	}
+	key := args[0]
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	size, err3 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+	if size > s.maxItemSize {
+		// Skip the payload so the connection stays in sync
+		if _, err := io.CopyN(io.Discard, r, int64(size)+2); err != nil {
+			return err
+		}
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if string(data[size:]) != "\r\n" {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return nil
+	}
+	if !validKey(key) {
+		w.WriteString("CLIENT_ERROR bad key\r\n")
+		return nil
+	}
+	if !s.authorize(conn, w, pie_cache.OpWrite, key) {
+		return nil
+	}
+	data = data[:size]
+
+	reply := "STORED\r\n"
+	s.arith.Lock()
+	defer s.arith.Unlock()
+	exists := s.cache.Exists(key)
+	switch {
+	case cmd == "add" && exists, cmd == "replace" && !exists:
+		reply = "NOT_STORED\r\n"
+	default:
+		if err := s.save(key, uint32(flags), data, exptime); err != nil {
+			reply = "SERVER_ERROR " + err.Error() + "\r\n"
+		}
+	}
+	if !noreply {
+		w.WriteString(reply)
+	}
+	return nil
+}
+
+func (s *Server) delete(conn net.Conn, w *bufio.Writer, args []string) {
+	noreply := len(args) == 2 && args[1] == "noreply"
+	if len(args) != 1 && !noreply {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	if !s.authorize(conn, w, pie_cache.OpDelete, args[0]) {
+		return
+	}
+
+	reply := "DELETED\r\n"
+	s.arith.Lock()
+	err := s.cache.Delete(args[0])
+	s.arith.Unlock()
+	if err != nil {
+		reply = "NOT_FOUND\r\n"
+	}
+	if !noreply {
+		w.WriteString(reply)
+	}
+}
+
+func (s *Server) touch(conn net.Conn, w *bufio.Writer, args []string) {
+	noreply := len(args) == 3 && args[2] == "noreply"
+	if len(args) != 2 && !noreply {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+	if !s.authorize(conn, w, pie_cache.OpWrite, args[0]) {
+		return
+	}
+
+	reply := "TOUCHED\r\n"
+	s.arith.Lock()
+	flags, data, _, err := s.load(args[0])
+	if err == nil {
+		err = s.save(args[0], flags, data, exptime)
+	}
+	s.arith.Unlock()
+	if err != nil {
+		reply = "NOT_FOUND\r\n"
+	}
+	if !noreply {
+		w.WriteString(reply)
+	}
+}
+
+func (s *Server) arithmetic(conn net.Conn, w *bufio.Writer, args []string, incr bool) {
+	noreply := len(args) == 3 && args[2] == "noreply"
+	if len(args) != 2 && !noreply {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return
+	}
+	if !s.authorize(conn, w, pie_cache.OpWrite, args[0]) {
+		return
+	}
+
+	s.arith.Lock()
+	defer s.arith.Unlock()
+
+	flags, data, meta, err := s.load(args[0])
+	if err != nil {
+		if !noreply {
+			w.WriteString("NOT_FOUND\r\n")
+		}
+		return
+	}
+	value, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+		return
+	}
+	switch {
+	case incr:
+		value += delta // Wraps at 64 bits like memcached
+	case delta > value:
+		value = 0
+	default:
+		value -= delta
+	}
+
+	ttl := meta.TTLRemaining(time.Now())
+	if ttl <= 0 {
+		if !noreply {
+			w.WriteString("NOT_FOUND\r\n")
+		}
+		return
+	}
+	result := strconv.FormatUint(value, 10)
+	if err := s.cache.SetWithTTL(args[0], encode(flags, []byte(result)), ttl); err != nil {
+		w.WriteString("SERVER_ERROR " + err.Error() + "\r\n")
+		return
+	}
+	if !noreply {
+		w.WriteString(result + "\r\n")
+	}
+}
+
+// load reads key and splits the stored value into flags and data
+func (s *Server) load(key string) (uint32, []byte, pie_cache.ItemMeta, error) {
+	value, meta, err := s.cache.GetWithMeta(key)
+	if err != nil {
+		return 0, nil, meta, err
+	}
+	if len(value) < 4 {
+		return 0, nil, meta, errors.New("value without flags")
+	}
+	return binary.BigEndian.Uint32(value), value[4:], meta, nil
+}
+
+// save stores data with flags under key, interpreting exptime like
+// memcached: 0 uses the cache's default TTL, values up to 30 days are
+// relative, larger ones are Unix timestamps, and anything in the past
+// removes the item
+func (s *Server) save(key string, flags uint32, data []byte, exptime int64) error {
+	value := encode(flags, data)
+	var ttl time.Duration
+	switch {
+	case exptime == 0:
+		return s.cache.Set(key, value)
+	case exptime <= maxRelativeExptime:
+		ttl = time.Duration(exptime) * time.Second
+	default:
+		ttl = time.Until(time.Unix(exptime, 0))
+	}
+
+	if ttl <= 0 {
+		if err := s.cache.Delete(key); err != nil && !errors.Is(err, pie_cache.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	return s.cache.SetWithTTL(key, value, ttl)
+}
+
+// encode prefixes data with its flags
+func encode(flags uint32, data []byte) []byte {
+	value := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(value, flags)
+	copy(value[4:], data)
+	return value
+}
+
+// validKey reports whether key is acceptable to the protocol
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,279 @@
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+func TestServer(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_memcached")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := pie_cache.NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := NewServer(cache, WithMaxItemSize(16))
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// send writes a request and reads the given number of response lines
+	send := func(req string, lines int) string {
+		fmt.Fprint(conn, req)
+		var out []string
+		for i := 0; i < lines; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read response to %q: %v", req, err)
+			}
+			out = append(out, strings.TrimRight(line, "\r\n"))
+		}
+		return strings.Join(out, "|")
+	}
+
+	tests := []struct {
+		req   string
+		lines int
+		want  string
+	}{
+		{"set greeting 42 0 5\r\nhello\r\n", 1, "STORED"},
+		{"get greeting missing\r\n", 3, "VALUE greeting 42 5|hello|END"},
+		{"add greeting 0 0 1\r\nx\r\n", 1, "NOT_STORED"},
+		{"replace missing 0 0 1\r\nx\r\n", 1, "NOT_STORED"},
+		{"set big 0 0 17\r\n01234567890123456\r\n", 1, "SERVER_ERROR object too large for cache"},
+		{"set counter 0 0 2\r\n10\r\n", 1, "STORED"},
+		{"incr counter 5\r\n", 1, "15"},
+		{"decr counter 20\r\n", 1, "0"},
+		{"incr greeting 1\r\n", 1, "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		{"incr missing 1\r\n", 1, "NOT_FOUND"},
+		{"touch greeting 100\r\n", 1, "TOUCHED"},
+		{"touch missing 100\r\n", 1, "NOT_FOUND"},
+		{"delete greeting\r\n", 1, "DELETED"},
+		{"delete greeting\r\n", 1, "NOT_FOUND"},
+		{"set quiet 0 0 1 noreply\r\nq\r\nget quiet\r\n", 3, "VALUE quiet 0 1|q|END"},
+		{"set gone 0 -1 1\r\nx\r\nget gone\r\n", 2, "STORED|END"},
+		{"bogus\r\n", 1, "ERROR"},
+		{"version\r\n", 1, "VERSION pie_cache"},
+	}
+	for _, tt := range tests {
+		if got := send(tt.req, tt.lines); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.req, tt.want, got)
+		}
+	}
+
+	// Values keep their remaining TTL through incr
+	_, meta, err := cache.GetWithMeta("counter")
+	if err != nil || meta.TTLRemaining(time.Now()) > time.Minute {
+		t.Errorf("Unexpected counter meta %+v, %v", meta, err)
+	}
+}
+
+func TestServerConcurrentAdd(t *testing.T) {
+	cache, err := pie_cache.NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := NewServer(cache)
+	go srv.Serve(l)
+	defer srv.Close()
+
+	// Of several clients adding the same key only one may succeed
+	var wg sync.WaitGroup
+	var stored atomic.Int32
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Errorf("Failed to dial: %v", err)
+				return
+			}
+			defer conn.Close()
+			fmt.Fprintf(conn, "add lock 0 0 1\r\n%d\r\n", i)
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				t.Errorf("Failed to read response: %v", err)
+				return
+			}
+			if line == "STORED\r\n" {
+				stored.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := stored.Load(); n != 1 {
+		t.Errorf("Expected one add stored, got %d", n)
+	}
+}
+
+// pauseStore calls onFetch once after the next Fetch
+type pauseStore struct {
+	*pie_cache.MemoryStore
+	mu      sync.Mutex
+	onFetch func()
+}
+
+func (s *pauseStore) Fetch(name string) ([]byte, error) {
+	data, err := s.MemoryStore.Fetch(name)
+	s.mu.Lock()
+	hook := s.onFetch
+	s.onFetch = nil
+	s.mu.Unlock()
+	if hook != nil {
+		hook()
+	}
+	return data, err
+}
+
+func TestServerWritesDuringIncr(t *testing.T) {
+	store := &pauseStore{MemoryStore: pie_cache.NewMemoryStore()}
+	cache, err := pie_cache.NewWithStore(store, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := NewServer(cache)
+	go srv.Serve(l)
+	defer srv.Close()
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		return conn, bufio.NewReader(conn)
+	}
+	conn, r := dial()
+	defer conn.Close()
+	other, otherR := dial()
+	defer other.Close()
+
+	// A write sent while an incr is between its read and its write must
+	// not be overwritten by the incr
+	for _, tt := range []struct {
+		req  string
+		want string
+	}{
+		{"set counter 0 0 3\r\n100\r\n", "VALUE counter 0 3\r\n"},
+		{"delete counter\r\n", "END\r\n"},
+	} {
+		fmt.Fprint(conn, "set counter 0 0 2\r\n10\r\n")
+		if line, _ := r.ReadString('\n'); line != "STORED\r\n" {
+			t.Fatalf("Expected STORED, got %q", line)
+		}
+		store.mu.Lock()
+		store.onFetch = func() {
+			fmt.Fprint(other, tt.req)
+			time.Sleep(50 * time.Millisecond)
+		}
+		store.mu.Unlock()
+		fmt.Fprint(conn, "incr counter 1\r\n")
+		if line, _ := r.ReadString('\n'); line != "11\r\n" {
+			t.Errorf("Expected 11, got %q", line)
+		}
+		_, _ = otherR.ReadString('\n')
+
+		fmt.Fprint(conn, "get counter\r\n")
+		line, _ := r.ReadString('\n')
+		if line != tt.want {
+			t.Errorf("%q: expected %q after the incr, got %q", tt.req, tt.want, line)
+		}
+		for line != "" && line != "END\r\n" {
+			line, _ = r.ReadString('\n')
+		}
+	}
+}
+
+func TestServerAuthorizer(t *testing.T) {
+	cache, err := pie_cache.NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("secret:k", encode(0, []byte("s")))
+	var ops []pie_cache.Operation
+	var mu sync.Mutex
+	auth := pie_cache.AuthorizerFunc(func(r *pie_cache.AccessRequest) error {
+		mu.Lock()
+		ops = append(ops, r.Op)
+		mu.Unlock()
+		if r.RemoteAddr == "" {
+			t.Error("Expected the client address in the request")
+		}
+		if r.Namespace == "secret" {
+			return pie_cache.ErrAccessDenied
+		}
+		return nil
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := NewServer(cache, WithAuthorizer(auth))
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	denied := "CLIENT_ERROR " + pie_cache.ErrAccessDenied.Error() + "\r\n"
+	for _, tt := range []struct {
+		req  string
+		want string
+	}{
+		{"set open:k 0 0 1\r\nx\r\n", "STORED\r\n"},
+		{"get open:k secret:k\r\n", denied},
+		{"set secret:k 0 0 1\r\nx\r\n", denied},
+		{"incr secret:k 1\r\n", denied},
+		{"touch secret:k 10\r\n", denied},
+		{"delete secret:k\r\n", denied},
+		{"delete open:k\r\n", "DELETED\r\n"},
+	} {
+		fmt.Fprint(conn, tt.req)
+		if line, _ := r.ReadString('\n'); line != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.req, tt.want, line)
+		}
+	}
+	if !cache.Exists("secret:k") {
+		t.Error("Expected the denied commands to leave the entry alone")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ops) != 8 || ops[0] != pie_cache.OpWrite || ops[1] != pie_cache.OpRead || ops[7] != pie_cache.OpDelete {
+		t.Errorf("Unexpected authorized operations %v", ops)
+	}
+}
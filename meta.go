@@ -0,0 +1,92 @@
+package pie_cache
+
+import (
+	"context"
+	"time"
+)
+
+// ItemMeta describes a cache entry without its payload
+type ItemMeta struct {
+	Key      string    `json:"key"`                // Cache key
+	Size     int       `json:"size"`               // Payload size in bytes
+	Created  time.Time `json:"created"`            // Creation time
+	ExpireAt time.Time `json:"expireAt"`           // Expiration time
+	Deadline time.Time `json:"deadline,omitzero"`  // Hard expiry from SetWithMaxLifetime, if any
+	Cost     float64   `json:"cost,omitempty"`     // Recompute cost from SetWithCost, if any
+	Tags     []string  `json:"tags,omitempty"`     // Labels from WithTagsOpt, if any
+	Priority Priority  `json:"priority,omitempty"` // Eviction priority from WithPriority
+
+	Checksum   string      `json:"checksum,omitempty"`   // CRC-32C of the payload, with WithChecksum
+	Provenance *Provenance `json:"provenance,omitempty"` // Writer, with WithProvenance
+}
+
+// TTLRemaining returns how long the entry stays fresh after now, or 0 if it
+// has already expired
+func (m ItemMeta) TTLRemaining(now time.Time) time.Duration {
+	if d := m.ExpireAt.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// meta returns the metadata of item
+func (item *CacheItem) meta() ItemMeta {
+	return ItemMeta{
+		Key:      item.Key,
+		Size:     len(item.Data),
+		Created:  item.Created,
+		ExpireAt: item.ExpireAt,
+		Deadline: item.Deadline,
+		Cost:     item.Cost,
+		Tags:     item.Tags,
+		Priority: item.Priority,
+
+		Checksum:   item.Checksum,
+		Provenance: item.Provenance,
+	}
+}
+
+// GetWithMeta retrieves a cache item together with its metadata, so callers
+// serving the value remotely can report freshness without a second lookup
+func (fc *FileCache) GetWithMeta(key string) ([]byte, ItemMeta, error) {
+	return fc.GetWithMetaContext(context.Background(), key)
+}
+
+// GetWithMetaContext is GetWithMeta tagging the events it logs with the
+// trace ID of ctx
+func (fc *FileCache) GetWithMetaContext(ctx context.Context, key string) ([]byte, ItemMeta, error) {
+	item, err := fc.getItem(ctx, key)
+	fc.recordRead(key, err)
+	if err != nil {
+		return nil, ItemMeta{}, err
+	}
+	data, meta := item.Data, item.meta()
+	releaseItem(item)
+	return data, meta, nil
+}
+
+// Inspect returns the metadata of the entry stored under key without
+// counting a read, extending its TTL or removing it when expired. It is
+// meant for debugging; expired entries are reported as they are.
+func (fc *FileCache) Inspect(key string) (ItemMeta, error) {
+	name, err := fc.entryName(key)
+	if err != nil {
+		return ItemMeta{}, err
+	}
+	data, err := fc.store.Fetch(name)
+	if err != nil {
+		return ItemMeta{}, err
+	}
+	item, err := decodeItem(data)
+	if err != nil {
+		return ItemMeta{}, err
+	}
+	defer releaseItem(item)
+	if err := fc.checkKey(context.Background(), key, name, item); err != nil {
+		return ItemMeta{}, err
+	}
+	if err := fc.verify(item); err != nil {
+		return ItemMeta{}, err
+	}
+	return item.meta(), nil
+}
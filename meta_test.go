@@ -0,0 +1,55 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetWithMeta(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_meta")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, opts := range [][]Option{nil, {WithHotCache(4)}} {
+		cache, err := NewFileCache(tempDir, time.Minute, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+
+		before := time.Now()
+		if err := cache.Set("k", []byte("hello")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+
+		// Read twice so the second lookup is served by the hot cache if enabled
+		for i := 0; i < 2; i++ {
+			data, meta, err := cache.GetWithMeta("k")
+			if err != nil {
+				t.Fatalf("GetWithMeta failed: %v", err)
+			}
+			if string(data) != "hello" || meta.Key != "k" || meta.Size != 5 {
+				t.Errorf("Unexpected result %q %+v", data, meta)
+			}
+			if meta.Created.Before(before.Add(-time.Second)) {
+				t.Errorf("Unexpected created time %v", meta.Created)
+			}
+			if r := meta.TTLRemaining(time.Now()); r <= 50*time.Second || r > time.Minute {
+				t.Errorf("Unexpected remaining TTL %v", r)
+			}
+		}
+	}
+
+	cache, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if _, _, err := cache.GetWithMeta("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if r := (ItemMeta{ExpireAt: time.Now().Add(-time.Second)}).TTLRemaining(time.Now()); r != 0 {
+		t.Errorf("Expected 0 remaining for expired entry, got %v", r)
+	}
+}
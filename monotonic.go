@@ -0,0 +1,35 @@
+package pie_cache
+
+import "time"
+
+// monotonicClock measures time by how long the process has been running,
+// bounded by the wall clock
+type monotonicClock struct {
+	wall  time.Time // Wall clock time at start, without monotonic reading
+	start time.Time // Start, with monotonic reading
+}
+
+// WithMonotonicExpiry bounds expiry by the time the process has been
+// running as well as by the wall clock. In VMs and sandboxes that get
+// suspended, the wall clock jumps forward on resume while the monotonic
+// clock does not, so without this option a resumed process finds its
+// whole cache expired. With it, expiry is checked against the wall clock
+// at open plus the process uptime, or the wall clock if that is earlier.
+// Writes are still stamped by the wall clock, so other processes and later
+// runs see them expire on time. It is meant for the wall clock and should
+// not be combined with WithClock.
+func WithMonotonicExpiry() Option {
+	return func(fc *FileCache) {
+		now := time.Now()
+		fc.monotonic = &monotonicClock{wall: now.Round(0), start: now}
+	}
+}
+
+// bound returns now, or the wall clock at start plus the uptime if that is
+// earlier
+func (c *monotonicClock) bound(now time.Time) time.Time {
+	if up := c.wall.Add(time.Since(c.start)); up.Before(now.Round(0)) {
+		return up
+	}
+	return now
+}
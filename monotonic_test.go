@@ -0,0 +1,57 @@
+package pie_cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonotonicExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithMonotonicExpiry(), WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	// The wall clock jumped an hour ahead of the uptime, as after a suspend
+	clock := cache.monotonic
+	clock.wall = clock.wall.Add(-time.Hour)
+
+	// An entry written before the suspend, due half an hour ago by the wall clock
+	before, _ := NewWithStore(store, time.Minute, WithClock(NewFakeClock(time.Now().Add(-40*time.Minute))))
+	if err := before.SetWithTTL("key", []byte("value"), 10*time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if data, err := cache.Get("key"); err != nil || string(data) != "value" {
+		t.Errorf("Expected the entry to survive the jump, got %q, %v", data, err)
+	}
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if !cache.Exists("key") {
+		t.Error("PurgeExpired removed an entry that is not due by uptime")
+	}
+
+	// A cache going by the wall clock alone sees it expired
+	plain, err := NewWithStore(store, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer plain.Close()
+	if _, err := plain.Get("key"); err != ErrExpired && err != ErrNotFound {
+		t.Errorf("Expected the entry expired by the wall clock, got %v", err)
+	}
+
+	// New writes are stamped by the wall clock, so others see them live
+	if err := cache.SetWithTTL("fresh", []byte("value"), 10*time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if meta, err := plain.Inspect("fresh"); err != nil || time.Since(meta.Created) > time.Minute {
+		t.Errorf("Expected a wall clock stamp visible to other caches, got %v, %v", meta.Created, err)
+	}
+
+	// Wall clock behind the uptime is used as is
+	clock.wall = clock.wall.Add(2 * time.Hour)
+	if now := cache.expiryNow(); now.After(time.Now()) {
+		t.Errorf("Expected the earlier of both clocks, got %v", now)
+	}
+}
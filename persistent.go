@@ -0,0 +1,98 @@
+package pie_cache
+
+import (
+	"math"
+	"strings"
+)
+
+// forever is the TTL of PersistentStore entries
+const forever = math.MaxInt64
+
+// PersistentStore is a durable key-value store without expiry, for
+// applications that need a little durable state next to their cache
+// without pulling in a second library. It keeps its entries in the same
+// format and layout as FileCache, with the same guarantees for concurrent
+// use by goroutines and processes, but they stay until deleted.
+type PersistentStore struct {
+	fc *FileCache
+}
+
+// NewPersistentStore opens a PersistentStore in dir, creating it if
+// needed. Options configure it as they would a FileCache, e.g.
+// WithChecksum, WithSigningKey or WithTransformPolicy. Options that would
+// expire or evict entries, such as WithMaxAge or WithMaxSize, are
+// ignored, and so is WithAsyncWrites, so Put is durable once it returns.
+func NewPersistentStore(dir string, opts ...Option) (*PersistentStore, error) {
+	fc, err := NewFileCache(dir, forever, append(opts, persistent())...)
+	if err != nil {
+		return nil, err
+	}
+	return &PersistentStore{fc: fc}, nil
+}
+
+// NewPersistentStoreWithStore is NewPersistentStore on top of an arbitrary
+// Store
+func NewPersistentStoreWithStore(store Store, opts ...Option) (*PersistentStore, error) {
+	fc, err := NewWithStore(store, forever, append(opts, persistent())...)
+	if err != nil {
+		return nil, err
+	}
+	return &PersistentStore{fc: fc}, nil
+}
+
+// persistent overrides the options that would make entries go away on
+// their own or Put return before the value is stored
+func persistent() Option {
+	return func(fc *FileCache) {
+		fc.maxAge = 0
+		fc.ttlJitter = 0
+		fc.adaptive = nil
+		fc.maxSize, fc.maxEntries, fc.maxFiles = 0, 0, 0
+		fc.asyncQueue = 0
+	}
+}
+
+// Put stores value under key, replacing any previous value
+func (ps *PersistentStore) Put(key string, value []byte) error {
+	return ps.fc.SetWithTTL(key, value, forever)
+}
+
+// Get returns the value stored under key, or ErrNotFound
+func (ps *PersistentStore) Get(key string) ([]byte, error) {
+	return ps.fc.Get(key)
+}
+
+// Delete removes key, returning ErrNotFound if it is not stored
+func (ps *PersistentStore) Delete(key string) error {
+	return ps.fc.Delete(key)
+}
+
+// Iterate calls fn with every key starting with prefix and its value, in
+// no particular order. value is only valid during the call. Entries that
+// fail their signature or checksum are logged as EventCorrupt and skipped.
+// An error returned by fn stops the iteration and is returned.
+func (ps *PersistentStore) Iterate(prefix string, fn func(key string, value []byte) error) error {
+	fc := ps.fc
+	return fc.walkItems(func(name string, item *CacheItem) error {
+		if !strings.HasPrefix(item.Key, prefix) || !fc.owned(name, item) {
+			return nil
+		}
+		err := fc.verify(item)
+		if err == nil {
+			err = fc.decodeItemData(item)
+		}
+		if err == nil {
+			err = fc.verifyChecksum(item)
+		}
+		if err != nil {
+			fc.logEvent(Event{Type: EventCorrupt, Key: item.Key, Path: name, Err: err})
+			return nil
+		}
+		return fn(item.Key, item.Data)
+	})
+}
+
+// Close releases the resources of the store
+func (ps *PersistentStore) Close() error {
+	return ps.fc.Close()
+}
@@ -0,0 +1,60 @@
+package pie_cache
+
+import (
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPersistentStore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_persistent")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts := []Option{WithClock(clock), WithChecksum(true), WithMaxAge(time.Hour), WithMaxEntries(1)}
+	ps, err := NewPersistentStore(tempDir, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	_ = ps.Put("user:1", []byte("ann"))
+	_ = ps.Put("user:2", []byte("bob"))
+	_ = ps.Put("config", []byte("{}"))
+	if err := ps.Delete("config"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := ps.Get("config"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after Delete, got %v", err)
+	}
+	ps.Close()
+
+	// Values outlive restarts, any TTL and the expiry options
+	clock.Advance(100 * 365 * 24 * time.Hour)
+	ps, err = NewPersistentStore(tempDir, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer ps.Close()
+	if _, err := ps.fc.Shrink(); err != nil {
+		t.Fatalf("Shrink failed: %v", err)
+	}
+	if err := ps.fc.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if v, err := ps.Get("user:1"); err != nil || string(v) != "ann" {
+		t.Errorf("Expected ann, got %q, %v", v, err)
+	}
+
+	var keys []string
+	err = ps.Iterate("user:", func(key string, value []byte) error {
+		keys = append(keys, key+"="+string(value))
+		return nil
+	})
+	sort.Strings(keys)
+	if err != nil || len(keys) != 2 || keys[0] != "user:1=ann" || keys[1] != "user:2=bob" {
+		t.Errorf("Unexpected iteration %v, %v", keys, err)
+	}
+}
@@ -0,0 +1,75 @@
+package pie_cache
+
+import "fmt"
+
+// pinAttempts is how often Pin and Unpin retry when the entry is replaced
+// while they rewrite it
+const pinAttempts = 3
+
+// Pin gives the live entry of key PriorityPinned, exempting it from TTL
+// expiry, PurgeExpired and the size limits until Unpin, e.g. for
+// bootstrap data the application cannot cheaply recompute. The WithMaxAge
+// cap and SetWithMaxLifetime deadlines still apply. Writing the key again
+// replaces the entry and drops the pin. Pin returns ErrNotFound if there
+// is no live entry.
+func (fc *FileCache) Pin(key string) error {
+	return fc.setPriority(key, PriorityPinned)
+}
+
+// Unpin gives the pinned entry of key PriorityNormal, so it expires and is
+// evicted as usual again. An entry whose TTL ran out while pinned expires
+// at once. Unpin returns ErrNotFound if there is no entry.
+func (fc *FileCache) Unpin(key string) error {
+	return fc.setPriority(key, PriorityNormal)
+}
+
+// setPriority rewrites the entry of key with priority p
+func (fc *FileCache) setPriority(key string, p Priority) error {
+	// A queued write has to reach the store before it can be rewritten
+	if err := fc.Flush(); err != nil {
+		return err
+	}
+	name, err := fc.entryName(key)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < pinAttempts; i++ {
+		err := fc.rewritePriority(key, name, p)
+		if err != errEntryChanged {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to change priority of %q: entry keeps changing", key)
+}
+
+// rewritePriority does one attempt of setPriority. It returns
+// errEntryChanged if the entry was replaced while it was rewritten.
+func (fc *FileCache) rewritePriority(key, name string, p Priority) error {
+	data, err := fc.store.Fetch(name)
+	if err != nil {
+		return err
+	}
+	item, err := decodeItem(data)
+	if err != nil {
+		// Reads report and remove corrupt entries
+		return ErrNotFound
+	}
+	defer releaseItem(item)
+	if err := fc.verify(item); err != nil || item.Key != key || fc.isExpired(item, fc.now()) {
+		return ErrNotFound
+	}
+	pinned := item.Priority >= PriorityPinned
+	if pinned == (p >= PriorityPinned) {
+		return nil
+	}
+
+	// The payload is rewritten as stored, so transformed data stays encoded
+	item.Priority = p
+	if err := fc.rewriteItem(name, data, item); err != nil {
+		return err
+	}
+	if fc.hot != nil {
+		fc.hot.remove(key)
+	}
+	return nil
+}
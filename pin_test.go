@@ -0,0 +1,109 @@
+package pie_cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache, err := NewMemoryCache(time.Minute, WithClock(clock), WithIndex(2), WithSigningKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	if err := cache.Pin("boot:missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound pinning a missing key, got %v", err)
+	}
+	_ = cache.Set("boot:config", []byte("settings"))
+	_ = cache.Set("boot:other", []byte("x"))
+	if err := cache.Pin("boot:config"); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	if n, err := cache.PurgeExpiredFunc(nil); err != nil || n != 1 {
+		t.Fatalf("Expected only the unpinned entry purged, got %d, %v", n, err)
+	}
+	data, meta, err := cache.GetWithMeta("boot:config")
+	if err != nil || string(data) != "settings" || meta.Priority != PriorityPinned {
+		t.Fatalf("Expected the pinned entry past its TTL, got %q, %v, %v", data, meta.Priority, err)
+	}
+
+	if err := cache.Unpin("boot:config"); err != nil {
+		t.Fatalf("Failed to unpin: %v", err)
+	}
+	if _, err := cache.Get("boot:config"); err != ErrExpired && err != ErrNotFound {
+		t.Errorf("Expected the entry to expire once unpinned, got %v", err)
+	}
+}
+
+func TestPinnedEviction(t *testing.T) {
+	probe, _ := NewMemoryCache(time.Minute)
+	_ = probe.Set("boot:a", make([]byte, 100))
+	_ = probe.Pin("boot:a")
+	entry, _, _ := probe.DiskUsage()
+
+	cache, err := NewMemoryCache(time.Minute, WithMaxSize(entry+entry/2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.SetWithTTL("boot:a", make([]byte, 100), time.Second)
+	_ = cache.SetWithTTL("page:b", make([]byte, 100), time.Hour)
+	_ = cache.Pin("boot:a")
+
+	if n, err := cache.Shrink(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 eviction, got %d, %v", n, err)
+	}
+	if !cache.Exists("boot:a") || cache.Exists("page:b") {
+		t.Error("Expected the pinned entry to be kept")
+	}
+}
+
+func TestPinMaxAge(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache, err := NewMemoryCache(time.Minute, WithClock(clock), WithMaxAge(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("boot:config", []byte("settings"))
+	_ = cache.SetWithMaxLifetime("boot:token", []byte("t"), time.Minute, 10*time.Minute)
+	_ = cache.Pin("boot:config")
+	_ = cache.Pin("boot:token")
+
+	// Pins outlast the TTL but not the deadline or the WithMaxAge cap
+	clock.Advance(30 * time.Minute)
+	if !cache.Exists("boot:config") || cache.Exists("boot:token") {
+		t.Error("Expected the pinned entry kept and the one past its deadline expired")
+	}
+	clock.Advance(time.Hour)
+	if cache.Exists("boot:config") {
+		t.Error("Expected the pinned entry to expire at the WithMaxAge cap")
+	}
+}
+
+func TestPinConcurrentSet(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("k", []byte("old"))
+	name, _ := cache.entryName("k")
+	data, _ := store.Fetch(name)
+	item, _ := decodeItem(data)
+
+	// A Set landing while the pin is written must not be overwritten
+	_ = cache.Set("k", []byte("new"))
+	item.Priority = PriorityPinned
+	if err := cache.rewriteItem(name, data, item); err != errEntryChanged {
+		t.Errorf("Expected errEntryChanged, got %v", err)
+	}
+	if err := cache.Pin("k"); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+	if got, meta, err := cache.GetWithMeta("k"); err != nil || string(got) != "new" || meta.Priority != PriorityPinned {
+		t.Errorf("Expected the new value pinned, got %q, %v, %v", got, meta.Priority, err)
+	}
+}
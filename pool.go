@@ -0,0 +1,71 @@
+package pie_cache
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// maxPooledBuffer is the largest encode buffer kept for reuse, so one
+// large write does not pin its memory
+const maxPooledBuffer = 1 << 20
+
+// itemPool recycles the CacheItem structs reads decode entries into
+var itemPool = sync.Pool{New: func() any { return new(CacheItem) }}
+
+// headerPool recycles the buffers binary entry headers are read into
+var headerPool = sync.Pool{New: func() any {
+	buf := make([]byte, 0, 512)
+	return &buf
+}}
+
+// bufferPool recycles the buffers entries are encoded into
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool unless it grew too large
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// newItem returns an empty CacheItem from the pool
+func newItem() *CacheItem {
+	return itemPool.Get().(*CacheItem)
+}
+
+// releaseItem clears item, so the pool does not keep its payload alive,
+// and returns it to the pool. The caller must not use item afterwards.
+func releaseItem(item *CacheItem) {
+	if item == nil {
+		return
+	}
+	*item = CacheItem{}
+	itemPool.Put(item)
+}
+
+// GetItem retrieves the entry of key with its payload and metadata.
+// Services doing many reads can hand the item back with ReleaseItem once
+// they are done with it, so that later reads reuse it instead of
+// allocating.
+func (fc *FileCache) GetItem(key string) (*CacheItem, error) {
+	item, err := fc.getItem(context.Background(), key)
+	fc.recordRead(key, err)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ReleaseItem returns an item obtained from GetItem for reuse. Neither the
+// item nor its Data may be used afterwards.
+func ReleaseItem(item *CacheItem) {
+	releaseItem(item)
+}
@@ -0,0 +1,71 @@
+package pie_cache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetItem(t *testing.T) {
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("a", []byte("1"))
+
+	item, err := cache.GetItem("a")
+	if err != nil {
+		t.Fatalf("GetItem failed: %v", err)
+	}
+	if item.Key != "a" || string(item.Data) != "1" || item.ExpireAt.IsZero() {
+		t.Errorf("Unexpected item %+v", item)
+	}
+	ReleaseItem(item)
+	if item.Key != "" || item.Data != nil {
+		t.Errorf("Expected released item to be cleared, got %+v", item)
+	}
+	if _, err := cache.GetItem("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPooledReads(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		cache, err := NewWithStore(NewMemoryStore(), time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			key, value := fmt.Sprintf("k%d", i), fmt.Sprint(i)
+			if binary {
+				_ = cache.SetFromReader(key, strings.NewReader(value), time.Minute)
+			} else {
+				_ = cache.Set(key, []byte(value))
+			}
+		}
+
+		// Values returned while other reads recycle items stay intact
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 200; n++ {
+					i := n % 10
+					key := fmt.Sprintf("k%d", i)
+					data, meta, err := cache.GetWithMeta(key)
+					if err != nil || string(data) != fmt.Sprint(i) || meta.Key != key {
+						t.Errorf("GetWithMeta(%q) = %q, %+v, %v", key, data, meta, err)
+						return
+					}
+					if item, err := cache.GetItem(key); err == nil {
+						ReleaseItem(item)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
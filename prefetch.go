@@ -0,0 +1,150 @@
+package pie_cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// accessStatsName is where read counts are persisted
+const accessStatsName = metaPrefix + "stats/access"
+
+// minTrackedKeys is the least number of keys the access tracker keeps
+const minTrackedKeys = 1024
+
+// KeyCount is the number of successful reads of a key
+type KeyCount struct {
+	Key  string `json:"key"`
+	Hits uint64 `json:"hits"`
+}
+
+// WithPrefetch counts reads per key, persists the counts on Close and
+// janitor runs, and when the cache is opened loads the n most read
+// entries into the hot cache before returning, so a restarted process
+// does not start cold. It needs WithHotCache to have somewhere to load
+// entries into; without it only the counts are kept.
+func WithPrefetch(n int) Option {
+	return func(fc *FileCache) {
+		if n > 0 {
+			fc.prefetch = n
+			fc.access = &accessTracker{counts: make(map[string]uint64), limit: max(minTrackedKeys, 10*n)}
+		}
+	}
+}
+
+// accessTracker counts reads of the most read keys. When it tracks more
+// than limit keys it halves all counts and forgets the coldest, so old
+// popularity fades.
+type accessTracker struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+	limit  int
+}
+
+func (a *accessTracker) record(key string) {
+	a.mu.Lock()
+	a.counts[key]++
+	if len(a.counts) > a.limit {
+		a.decay()
+	}
+	a.mu.Unlock()
+}
+
+// decay halves every count and drops keys left at zero, then the coldest
+// keys until at most limit/2 remain. The caller must hold a.mu.
+func (a *accessTracker) decay() {
+	for key, n := range a.counts {
+		if n /= 2; n == 0 {
+			delete(a.counts, key)
+		} else {
+			a.counts[key] = n
+		}
+	}
+	if len(a.counts) > a.limit/2 {
+		for _, kc := range a.top(len(a.counts))[a.limit/2:] {
+			delete(a.counts, kc.Key)
+		}
+	}
+}
+
+// top returns the n most read keys, most read first. The caller must hold
+// a.mu.
+func (a *accessTracker) top(n int) []KeyCount {
+	all := make([]KeyCount, 0, len(a.counts))
+	for key, hits := range a.counts {
+		all = append(all, KeyCount{Key: key, Hits: hits})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Hits != all[j].Hits {
+			return all[i].Hits > all[j].Hits
+		}
+		return all[i].Key < all[j].Key
+	})
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// TopKeys returns the n most read keys since the counts were started,
+// most read first. It is empty unless WithPrefetch is used.
+func (fc *FileCache) TopKeys(n int) []KeyCount {
+	if fc.access == nil {
+		return nil
+	}
+	fc.access.mu.Lock()
+	defer fc.access.mu.Unlock()
+	return fc.access.top(n)
+}
+
+// recordRead counts the outcome of a read of key
+func (fc *FileCache) recordRead(key string, err error) {
+	fc.stats.recordGet(err)
+	if err == nil && fc.access != nil {
+		fc.access.record(key)
+	}
+}
+
+// SaveAccessStats persists the read counts used by WithPrefetch
+func (fc *FileCache) SaveAccessStats() error {
+	if fc.access == nil {
+		return nil
+	}
+	fc.access.mu.Lock()
+	data, err := json.Marshal(fc.access.top(len(fc.access.counts)))
+	fc.access.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal access stats: %v", err)
+	}
+	return fc.store.Put(accessStatsName, data)
+}
+
+// loadAccessStats restores persisted read counts and warms the hot cache
+// with the most read entries
+func (fc *FileCache) loadAccessStats() {
+	data, err := fc.store.Fetch(accessStatsName)
+	if err != nil {
+		return
+	}
+	var counts []KeyCount
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return
+	}
+
+	fc.access.mu.Lock()
+	for _, kc := range counts {
+		fc.access.counts[kc.Key] = kc.Hits
+	}
+	hottest := fc.access.top(fc.prefetch)
+	fc.access.mu.Unlock()
+
+	if fc.hot == nil {
+		return
+	}
+	for _, kc := range hottest {
+		// getItem puts what it reads into the hot cache
+		_, _ = fc.getItem(context.Background(), kc.Key)
+	}
+}
@@ -0,0 +1,78 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_prefetch")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithPrefetch(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		_ = cache.Set(key, []byte(key))
+	}
+	reads := map[string]int{"a": 1, "b": 5, "c": 3}
+	for key, n := range reads {
+		for i := 0; i < n; i++ {
+			if _, err := cache.Get(key); err != nil {
+				t.Fatalf("Get %s failed: %v", key, err)
+			}
+		}
+	}
+	_, _ = cache.Get("missing")
+
+	top := cache.TopKeys(2)
+	if len(top) != 2 || top[0] != (KeyCount{"b", 5}) || top[1] != (KeyCount{"c", 3}) {
+		t.Errorf("Unexpected top keys: %v", top)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopened, the two most read entries are already in memory
+	cache, err = NewFileCache(tempDir, time.Minute, WithPrefetch(2), WithHotCache(10))
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	defer cache.Close()
+	now := time.Now()
+	for key, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		if _, ok := cache.hot.get(key, now); ok != want {
+			t.Errorf("Expected %s prefetched=%v, got %v", key, want, ok)
+		}
+	}
+	if top := cache.TopKeys(1); len(top) != 1 || top[0].Hits != 5 {
+		t.Errorf("Expected restored counts, got %v", top)
+	}
+	if stats := cache.Stats(); stats.Hits != 0 {
+		t.Errorf("Expected prefetch not to count as hits, got %d", stats.Hits)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 3 {
+		t.Errorf("Expected stats entry to be hidden, got %v", keys)
+	}
+}
+
+func TestAccessTrackerDecay(t *testing.T) {
+	a := &accessTracker{counts: make(map[string]uint64), limit: 4}
+	for i := 0; i < 10; i++ {
+		a.record("hot")
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		a.record(key)
+	}
+	if len(a.counts) > a.limit {
+		t.Errorf("Expected at most %d keys, got %d", a.limit, len(a.counts))
+	}
+	if a.counts["hot"] != 5 {
+		t.Errorf("Expected hot count halved to 5, got %d", a.counts["hot"])
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/ser163/pie_cache/protocache
+
+go 1.24.1
+
+require (
+	github.com/ser163/pie_cache v0.0.0
+	google.golang.org/protobuf v1.36.12
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	golang.org/x/sync v0.19.0 // indirect
+)
+
+replace github.com/ser163/pie_cache => ../
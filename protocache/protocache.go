@@ -0,0 +1,139 @@
+// Package protocache stores protobuf messages in a pie_cache.FileCache.
+//
+// Messages are stored in the wire format of google.protobuf.Any, so every
+// entry records the type it was written with and reads can refuse an entry
+// of a different type instead of misinterpreting its fields.
+package protocache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ser163/pie_cache"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrTypeMismatch is returned by Get when the cached message is of another
+// type than the one asked for
+var ErrTypeMismatch = errors.New("cached message type mismatch")
+
+// typeURLPrefix is the prefix of type URLs, as used by google.protobuf.Any
+const typeURLPrefix = "type.googleapis.com/"
+
+// Field numbers of google.protobuf.Any
+const (
+	typeURLField protowire.Number = 1
+	valueField   protowire.Number = 2
+)
+
+// Option configures Get
+type Option func(*options)
+
+type options struct {
+	skipTypeCheck bool
+}
+
+// WithoutTypeCheck decodes the cached message into the one given to Get
+// whatever type it was written as, for readers of compatible types such as
+// a message that was renamed
+func WithoutTypeCheck() Option {
+	return func(o *options) {
+		o.skipTypeCheck = true
+	}
+}
+
+// Set stores m under key with the cache's default TTL
+func Set(cache *pie_cache.FileCache, key string, m proto.Message) error {
+	data, err := marshal(m)
+	if err != nil {
+		return err
+	}
+	return cache.Set(key, data)
+}
+
+// SetWithTTL stores m under key with the specified TTL
+func SetWithTTL(cache *pie_cache.FileCache, key string, m proto.Message, ttl time.Duration) error {
+	data, err := marshal(m)
+	if err != nil {
+		return err
+	}
+	return cache.SetWithTTL(key, data, ttl)
+}
+
+// Get reads the message stored under key into m. It fails with
+// ErrTypeMismatch if the entry holds a message of another type, and with
+// the cache's errors such as pie_cache.ErrNotFound otherwise.
+func Get(cache *pie_cache.FileCache, key string, m proto.Message, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := cache.Get(key)
+	if err != nil {
+		return err
+	}
+	typeURL, value, err := unmarshalAny(data)
+	if err != nil {
+		return err
+	}
+	if !o.skipTypeCheck && typeURL != typeURLOf(m) {
+		return ErrTypeMismatch
+	}
+	if err := proto.Unmarshal(value, m); err != nil {
+		return fmt.Errorf("failed to unmarshal cached message: %v", err)
+	}
+	return nil
+}
+
+// typeURLOf returns the type URL of m
+func typeURLOf(m proto.Message) string {
+	return typeURLPrefix + string(m.ProtoReflect().Descriptor().FullName())
+}
+
+// marshal encodes m as an Any in a single buffer, without marshaling the
+// message and then copying it into the envelope
+func marshal(m proto.Message) ([]byte, error) {
+	typeURL := typeURLOf(m)
+	size := proto.Size(m)
+
+	// Two one-byte tags and two length prefixes
+	b := make([]byte, 0, 2+protowire.SizeVarint(uint64(len(typeURL)))+len(typeURL)+protowire.SizeVarint(uint64(size))+size)
+	b = protowire.AppendTag(b, typeURLField, protowire.BytesType)
+	b = protowire.AppendString(b, typeURL)
+	b = protowire.AppendTag(b, valueField, protowire.BytesType)
+	b = protowire.AppendVarint(b, uint64(size))
+	b, err := proto.MarshalOptions{UseCachedSize: true}.MarshalAppend(b, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %v", err)
+	}
+	return b, nil
+}
+
+// unmarshalAny splits an encoded Any into its type URL and value
+func unmarshalAny(b []byte) (typeURL string, value []byte, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", nil, fmt.Errorf("failed to parse cached message: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch {
+		case num == typeURLField && typ == protowire.BytesType:
+			var s string
+			s, n = protowire.ConsumeString(b)
+			typeURL = s
+		case num == valueField && typ == protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return "", nil, fmt.Errorf("failed to parse cached message: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return typeURL, value, nil
+}
@@ -0,0 +1,57 @@
+package protocache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoCache(t *testing.T) {
+	cache, err := pie_cache.NewWithStore(pie_cache.NewMemoryStore(), time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	if err := Set(cache, "greeting", wrapperspb.String("hello")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	var got wrapperspb.StringValue
+	if err := Get(cache, "greeting", &got); err != nil || got.GetValue() != "hello" {
+		t.Errorf("Get returned %q, %v", got.GetValue(), err)
+	}
+
+	// The entry is a valid google.protobuf.Any
+	data, _ := cache.Get("greeting")
+	var envelope anypb.Any
+	if err := proto.Unmarshal(data, &envelope); err != nil {
+		t.Fatalf("Entry is not an Any: %v", err)
+	}
+	if !envelope.MessageIs(&got) {
+		t.Errorf("Unexpected type URL %q", envelope.GetTypeUrl())
+	}
+
+	var wrong durationpb.Duration
+	if err := Get(cache, "greeting", &wrong); err != ErrTypeMismatch {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+	var bytesValue wrapperspb.BytesValue
+	if err := Get(cache, "greeting", &bytesValue, WithoutTypeCheck()); err != nil || string(bytesValue.GetValue()) != "hello" {
+		t.Errorf("Expected unchecked read of a compatible type, got %q, %v", bytesValue.GetValue(), err)
+	}
+
+	if err := SetWithTTL(cache, "short", durationpb.New(time.Second), time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := Get(cache, "short", &wrong); err != pie_cache.ErrExpired {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if err := Get(cache, "missing", &wrong); err != pie_cache.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package pie_cache
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Provenance records who wrote a cache entry
+type Provenance struct {
+	Caller string `json:"caller"` // Function that wrote the entry, as package.Function
+	File   string `json:"file"`   // Source location of the call, as file:line
+	Host   string `json:"host"`   // Hostname of the writing process
+	PID    int    `json:"pid"`    // Process ID of the writing process
+}
+
+// WithProvenance records the calling function, hostname and PID in every
+// written entry, so the writer of surprising data on a shared cache can be
+// traced with Inspect. It costs a stack walk per write.
+func WithProvenance(enabled bool) Option {
+	return func(fc *FileCache) {
+		fc.provenance = enabled
+		if enabled {
+			fc.hostname, _ = os.Hostname()
+		}
+	}
+}
+
+// pkgPrefix identifies functions of this package in stack frames
+var pkgPrefix = reflect.TypeOf(FileCache{}).PkgPath() + "."
+
+// callerProvenance describes the first caller outside this package
+func (fc *FileCache) callerProvenance() *Provenance {
+	prov := &Provenance{Host: fc.hostname, PID: os.Getpid()}
+
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		internal := strings.HasPrefix(frame.Function, pkgPrefix) && !strings.HasSuffix(frame.File, "_test.go")
+		if !internal {
+			prov.Caller = frame.Function
+			prov.File = fmt.Sprintf("%s:%d", frame.File, frame.Line)
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	return prov
+}
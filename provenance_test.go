@@ -0,0 +1,56 @@
+package pie_cache
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProvenance(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_provenance")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithProvenance(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := cache.Set("k", []byte("v")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	meta, err := cache.Inspect("k")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	prov := meta.Provenance
+	if prov == nil {
+		t.Fatal("Expected provenance to be recorded")
+	}
+	if !strings.HasSuffix(prov.Caller, ".TestProvenance") || !strings.Contains(prov.File, "provenance_test.go:") {
+		t.Errorf("Expected caller TestProvenance, got %s at %s", prov.Caller, prov.File)
+	}
+	if prov.PID != os.Getpid() {
+		t.Errorf("Expected PID %d, got %d", os.Getpid(), prov.PID)
+	}
+	if host, _ := os.Hostname(); prov.Host != host {
+		t.Errorf("Expected host %q, got %q", host, prov.Host)
+	}
+
+	// Inspect reports expired entries without removing them
+	plain, _ := NewFileCache(tempDir, time.Minute)
+	_ = plain.SetWithTTL("old", []byte("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if meta, err := plain.Inspect("old"); err != nil || meta.Provenance != nil || meta.TTLRemaining(time.Now()) != 0 {
+		t.Errorf("Unexpected Inspect result %+v, %v", meta, err)
+	}
+	if _, err := plain.Inspect("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if s := plain.Stats(); s.Hits+s.Misses != 0 {
+		t.Errorf("Expected Inspect not to count reads, got %+v", s)
+	}
+}
@@ -0,0 +1,38 @@
+package pie_cache
+
+import (
+	"fmt"
+	"io"
+)
+
+// WithPurgeListener calls fn with the key of every entry removed by
+// PurgeExpired or the janitor, so systems derived from the cache, such as
+// a CDN or a search index, can follow expirations. Calls are serialized
+// and made as entries are removed, so fn should return quickly.
+func WithPurgeListener(fn func(key string)) Option {
+	return func(fc *FileCache) {
+		fc.purgeListener = fn
+	}
+}
+
+// PurgeExpiredFunc is PurgeExpired calling fn with the key of every entry
+// it removes. It returns how many entries were removed, including corrupt
+// ones whose key could not be read and were not passed to fn.
+func (fc *FileCache) PurgeExpiredFunc(fn func(key string)) (int, error) {
+	return fc.purge(1, fn)
+}
+
+// PurgeExpiredTo is PurgeExpired writing the key of every entry it removes
+// to w, one per line, as they are removed
+func (fc *FileCache) PurgeExpiredTo(w io.Writer) (int, error) {
+	var writeErr error
+	n, err := fc.purge(1, func(key string) {
+		if writeErr == nil {
+			_, writeErr = fmt.Fprintln(w, key)
+		}
+	})
+	if err == nil && writeErr != nil {
+		err = fmt.Errorf("failed to write purged keys: %v", writeErr)
+	}
+	return n, err
+}
@@ -0,0 +1,58 @@
+package pie_cache
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPurgeNotification(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_purge")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var mu sync.Mutex
+	var heard []string
+	cache, err := NewFileCache(tempDir, time.Minute, WithPurgeListener(func(key string) {
+		mu.Lock()
+		heard = append(heard, key)
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.SetWithTTL("a", []byte("x"), time.Millisecond)
+	_ = cache.SetWithTTL("b", []byte("x"), time.Millisecond)
+	_ = cache.Set("fresh", []byte("x"))
+	time.Sleep(5 * time.Millisecond)
+
+	var out bytes.Buffer
+	n, err := cache.PurgeExpiredTo(&out)
+	if err != nil {
+		t.Fatalf("PurgeExpiredTo failed: %v", err)
+	}
+	listed := strings.Fields(out.String())
+	sort.Strings(listed)
+	if n != 2 || len(listed) != 2 || listed[0] != "a" || listed[1] != "b" {
+		t.Errorf("Expected a and b purged, got %d %v", n, listed)
+	}
+	if len(heard) != 2 {
+		t.Errorf("Expected listener to hear 2 keys, got %v", heard)
+	}
+
+	_ = cache.SetWithTTL("c", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	var got []string
+	if n, err := cache.PurgeExpiredFunc(func(key string) { got = append(got, key) }); err != nil || n != 1 {
+		t.Errorf("PurgeExpiredFunc returned %d, %v", n, err)
+	}
+	if len(got) != 1 || got[0] != "c" || len(heard) != 3 {
+		t.Errorf("Unexpected notifications %v, %v", got, heard)
+	}
+}
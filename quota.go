@@ -0,0 +1,93 @@
+package pie_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// defaultQuotaThreshold is the share of a quota SoftQuota warns at when
+// Threshold is not set
+const defaultQuotaThreshold = 0.8
+
+// SoftQuota sets the quotas WithSoftQuota warns about
+type SoftQuota struct {
+	Bytes      int64            // Quota of the whole cache in bytes, 0 for none
+	Namespaces map[string]int64 // Quotas of namespaces in bytes, see NamespaceOf
+	Threshold  float64          // Share of a quota past which writes are reported, 0.8 if 0
+}
+
+// WithSoftQuota logs an EventQuotaWarning when a write takes the bytes the
+// entries of the cache, or of the namespace written to, past q.Threshold
+// of their quota, so applications can alert before hard limits start
+// rejecting writes. Writes are never refused. A warning is logged once
+// when usage crosses the threshold and again only after it fell below.
+// Usage is kept by the index, so it needs WithIndex.
+func WithSoftQuota(q SoftQuota) Option {
+	return func(fc *FileCache) {
+		if q.Threshold <= 0 {
+			q.Threshold = defaultQuotaThreshold
+		}
+		fc.quota = &quotaState{SoftQuota: q, warned: make(map[string]bool)}
+	}
+}
+
+// errQuotaNeedsIndex is returned by the constructors for WithSoftQuota
+// without WithIndex
+var errQuotaNeedsIndex = errors.New("invalid options: WithSoftQuota needs WithIndex")
+
+// quotaState tracks which quotas are past their threshold
+type quotaState struct {
+	SoftQuota
+	mu     sync.Mutex
+	total  bool            // The whole cache is past the threshold
+	warned map[string]bool // Namespaces past the threshold
+}
+
+// checkQuota logs a warning for every quota the write of key took past its
+// threshold
+func (fc *FileCache) checkQuota(ctx context.Context, key string) {
+	q := fc.quota
+	if q == nil || fc.index == nil {
+		return
+	}
+	usage, err := fc.DiskUsageByNamespace()
+	if err != nil {
+		return
+	}
+	ns := NamespaceOf(key)
+
+	q.mu.Lock()
+	var warnings []error
+	if q.Bytes > 0 {
+		var total int64
+		for _, u := range usage {
+			total += u.Bytes
+		}
+		if crossed(&q.total, total, q.Bytes, q.Threshold) {
+			warnings = append(warnings, fmt.Errorf("cache uses %d of its %d byte quota", total, q.Bytes))
+		}
+	}
+	if quota := q.Namespaces[ns]; quota > 0 {
+		over := q.warned[ns]
+		if crossed(&over, usage[ns].Bytes, quota, q.Threshold) {
+			warnings = append(warnings, fmt.Errorf("namespace %q uses %d of its %d byte quota", ns, usage[ns].Bytes, quota))
+		}
+		q.warned[ns] = over
+	}
+	q.mu.Unlock()
+
+	for _, err := range warnings {
+		fc.logEventContext(ctx, Event{Type: EventQuotaWarning, Key: key, Err: err})
+	}
+}
+
+// crossed updates over for used bytes of quota and reports whether they
+// just went past threshold
+func crossed(over *bool, used, quota int64, threshold float64) bool {
+	past := float64(used) >= threshold*float64(quota)
+	was := *over
+	*over = past
+	return past && !was
+}
@@ -0,0 +1,68 @@
+package pie_cache
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSoftQuota(t *testing.T) {
+	if _, err := NewMemoryCache(time.Minute, WithSoftQuota(SoftQuota{Bytes: 1})); err == nil {
+		t.Error("Expected WithSoftQuota without WithIndex to fail")
+	}
+
+	var mu sync.Mutex
+	var warnings []Event
+	logger := LoggerFunc(func(e Event) {
+		if e.Type == EventQuotaWarning {
+			mu.Lock()
+			warnings = append(warnings, e)
+			mu.Unlock()
+		}
+	})
+	probe, _ := NewMemoryCache(time.Minute, WithIndex(1))
+	_ = probe.Set("img:0", make([]byte, 1000))
+	entry, _, _ := probe.DiskUsage()
+
+	cache, err := NewMemoryCache(time.Minute, WithIndex(2), WithLogger(logger), WithSoftQuota(SoftQuota{
+		Bytes:      9 * entry,
+		Namespaces: map[string]int64{"img": 3 * entry},
+		Threshold:  0.5,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	_ = cache.Set("img:0", make([]byte, 1000))
+	if len(warnings) != 0 {
+		t.Fatalf("Expected no warning below the threshold, got %v", warnings)
+	}
+	// The second image takes the namespace past half its quota
+	_ = cache.Set("img:1", make([]byte, 1000))
+	if len(warnings) != 1 || warnings[0].Key != "img:1" || !strings.Contains(warnings[0].Err.Error(), `namespace "img"`) {
+		t.Fatalf("Expected a namespace warning for img:1, got %v", warnings)
+	}
+	// Writes past the threshold do not repeat it
+	_ = cache.Set("img:2", make([]byte, 1000))
+	for i := 0; i < 3; i++ {
+		_ = cache.Set("doc:"+string(rune('a'+i)), make([]byte, 1000))
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[1].Err.Error(), "cache uses") {
+		t.Fatalf("Expected a single cache warning once half the total was passed, got %v", warnings)
+	}
+
+	// Falling below the threshold rearms the warnings
+	_ = cache.Delete("img:1")
+	_ = cache.Delete("img:2")
+	_ = cache.Set("img:0", make([]byte, 10))
+	if len(warnings) != 2 {
+		t.Fatalf("Expected no warning while usage drops, got %v", warnings)
+	}
+	_ = cache.Set("img:3", make([]byte, 1000))
+	_ = cache.Set("img:4", make([]byte, 1000))
+	if len(warnings) != 4 || warnings[2].Key != "img:4" || warnings[3].Key != "img:4" {
+		t.Errorf("Expected both warnings again for img:4, got %v", warnings)
+	}
+}
@@ -0,0 +1,38 @@
+package pie_cache
+
+// ReadMode controls who owns the byte slices returned by Get
+type ReadMode int
+
+const (
+	// CopyOnRead returns a private slice on every Get; callers may modify it
+	// freely. This is the default.
+	CopyOnRead ReadMode = iota
+	// ZeroCopy returns slices that may be shared with in-memory tiers such
+	// as the hot cache. Callers must treat them as read-only: modifying one
+	// corrupts the value seen by every later reader.
+	ZeroCopy
+)
+
+// WithReadMode selects the ownership semantics of values returned by Get
+func WithReadMode(mode ReadMode) Option {
+	return func(fc *FileCache) {
+		fc.readMode = mode
+	}
+}
+
+// WithMutationCheck enables a debug mode that checksums shared payloads
+// when they are cached in memory and panics on the next read if a caller
+// modified them. Intended for tests and staging; it costs a CRC32 per read.
+func WithMutationCheck(enabled bool) Option {
+	return func(fc *FileCache) {
+		fc.mutationCheck = enabled
+	}
+}
+
+// share returns data as it may be handed out under the configured read mode
+func (fc *FileCache) share(data []byte) []byte {
+	if fc.readMode == ZeroCopy {
+		return data
+	}
+	return copyBytes(data)
+}
@@ -0,0 +1,62 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadMode(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_readmode")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	copyCache, err := NewFileCache(tempDir, time.Minute, WithHotCache(8))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = copyCache.Set("k", []byte("value"))
+	first, _ := copyCache.Get("k")
+	second, _ := copyCache.Get("k")
+	first[0] = 'X'
+	second[0] = 'Y'
+	if got, _ := copyCache.Get("k"); string(got) != "value" {
+		t.Errorf("CopyOnRead leaked a shared buffer: %q", got)
+	}
+
+	zeroCache, err := NewFileCache(tempDir, time.Minute, WithHotCache(8), WithReadMode(ZeroCopy))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	a, _ := zeroCache.Get("k")
+	b, _ := zeroCache.Get("k")
+	if &a[0] != &b[0] {
+		t.Error("ZeroCopy should return the shared hot buffer")
+	}
+}
+
+func TestMutationCheck(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_mutation")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute,
+		WithHotCache(8), WithReadMode(ZeroCopy), WithMutationCheck(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("k", []byte("value"))
+	got, _ := cache.Get("k")
+	got[0] = 'X'
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic after mutating a shared value")
+		}
+	}()
+	_, _ = cache.Get("k")
+}
@@ -0,0 +1,46 @@
+package pie_cache
+
+import "errors"
+
+// ErrReadOnly is returned by writes to a cache opened with WithReadOnly
+var ErrReadOnly = errors.New("cache is read-only")
+
+// WithReadOnly opens the cache for reading only, e.g. to inspect the cache
+// directory of another service in place. Writes, deletes and purges fail
+// with ErrReadOnly, and reads leave expired entries where they are. A
+// missing layout manifest is not recorded; combine with LayoutAdopt to
+// read a directory written with another layout. Options that need to
+// write on open, such as WithIndex on a directory without a current
+// index, make opening fail with ErrReadOnly.
+func WithReadOnly() Option {
+	return func(fc *FileCache) {
+		fc.readOnly = true
+		fc.purgeOnLoad = false
+	}
+}
+
+// readOnlyStore rejects every change to a Store. It offers none of the
+// optional store interfaces.
+type readOnlyStore struct {
+	store Store
+}
+
+// Put implements Store
+func (rs readOnlyStore) Put(name string, data []byte) error {
+	return ErrReadOnly
+}
+
+// Fetch implements Store
+func (rs readOnlyStore) Fetch(name string) ([]byte, error) {
+	return rs.store.Fetch(name)
+}
+
+// Remove implements Store
+func (rs readOnlyStore) Remove(name string) error {
+	return ErrReadOnly
+}
+
+// Walk implements Store
+func (rs readOnlyStore) Walk(prefix string, fn func(name string, data []byte) error) error {
+	return rs.store.Walk(prefix, fn)
+}
@@ -0,0 +1,59 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadOnly(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "readonly_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	owner, err := NewFileCache(tempDir, time.Minute, WithPathScheme(1, 2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = owner.Set("key", []byte("value"))
+	_ = owner.SetWithTTL("gone", []byte("x"), time.Millisecond)
+	owner.Close()
+	time.Sleep(5 * time.Millisecond)
+
+	cache, err := NewFileCache(tempDir, time.Minute, WithReadOnly(), WithLayoutPolicy(LayoutAdopt))
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	defer cache.Close()
+
+	if data, err := cache.Get("key"); err != nil || string(data) != "value" {
+		t.Errorf("Get returned %q, %v", data, err)
+	}
+	if _, err := cache.Get("gone"); err != ErrExpired {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if err := cache.Set("key", []byte("new")); err != ErrReadOnly {
+		t.Errorf("Expected Set to fail with ErrReadOnly, got %v", err)
+	}
+	if err := cache.Delete("key"); err != ErrReadOnly {
+		t.Errorf("Expected Delete to fail with ErrReadOnly, got %v", err)
+	}
+	if err := cache.PurgeExpired(); err != ErrReadOnly {
+		t.Errorf("Expected PurgeExpired to fail with ErrReadOnly, got %v", err)
+	}
+
+	// Nothing changed underneath
+	check, err := NewFileCache(tempDir, time.Minute, WithPathScheme(1, 2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer check.Close()
+	if data, err := check.Get("key"); err != nil || string(data) != "value" {
+		t.Errorf("Expected the value unchanged, got %q, %v", data, err)
+	}
+	if meta, err := check.Inspect("gone"); err != nil || meta.Key != "gone" {
+		t.Errorf("Expected the expired entry left in place, got %v", err)
+	}
+}
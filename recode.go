@@ -0,0 +1,195 @@
+package pie_cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RecodeOptions controls a Recode run
+type RecodeOptions struct {
+	Binary   bool               // Rewrite entries in the JSON format in the binary format
+	From     []Transform        // Transforms entries were encoded with that the policy no longer has
+	Rate     int                // Most entries rewritten per second, 0 for no limit
+	Progress func(RecodeResult) // Called with the totals so far after every entry, if set
+	DryRun   bool               // Report what would be rewritten without writing anything
+}
+
+// RecodeResult summarises a Recode run
+type RecodeResult struct {
+	Scanned int // Entries examined
+	Recoded int // Entries rewritten
+	Skipped int // Entries already encoded as configured, or changed during the run
+	Expired int // Entries left to the purge because they expired
+	Failed  int // Entries that could not be read or written
+}
+
+// Recode rewrites the stored entries whose encoding differs from what the
+// cache writes now, so a live cache can adopt a new WithTransformPolicy,
+// WithChecksum or the binary format without being emptied: open it with
+// the new options and call Recode. Payloads are decoded with the
+// transforms of the policy or opts.From, and re-encoded with the
+// transform the policy gives their key; creation and expiry times are
+// kept. Entries that fail their signature or checksum are counted as
+// failed and left alone, as are entries written again while Recode runs.
+// Recode stops early when ctx is done.
+func (fc *FileCache) Recode(ctx context.Context, opts RecodeOptions) (RecodeResult, error) {
+	var res RecodeResult
+	if fc.readOnly {
+		return res, ErrReadOnly
+	}
+	from := make(map[string]Transform)
+	for _, tr := range opts.From {
+		from[tr.Name()] = tr
+	}
+
+	var names []string
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if !isMetaName(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	var tick *time.Ticker
+	if opts.Rate > 0 {
+		tick = time.NewTicker(time.Second / time.Duration(opts.Rate))
+		defer tick.Stop()
+	}
+	now := fc.now()
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		res.Scanned++
+		rewrite, err := fc.recodeEntry(name, from, opts, now)
+		switch {
+		case err != nil:
+			res.Failed++
+			fc.logEvent(Event{Type: EventWriteFailed, Path: name, Err: err})
+		case rewrite == recodeExpired:
+			res.Expired++
+		case rewrite == recodeDone:
+			res.Recoded++
+		default:
+			res.Skipped++
+		}
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+		if tick != nil && rewrite == recodeDone {
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return res, ctx.Err()
+			}
+		}
+	}
+	return res, nil
+}
+
+// recodeOutcome is what Recode did with an entry
+type recodeOutcome int
+
+const (
+	recodeSkipped recodeOutcome = iota
+	recodeExpired
+	recodeDone
+)
+
+// recodeEntry rewrites the entry stored under name if its encoding differs
+// from the configured one
+func (fc *FileCache) recodeEntry(name string, from map[string]Transform, opts RecodeOptions, now time.Time) (recodeOutcome, error) {
+	data, err := fc.store.Fetch(name)
+	if err == ErrNotFound {
+		return recodeSkipped, nil
+	}
+	if err != nil {
+		return recodeSkipped, err
+	}
+	item, err := decodeItem(data)
+	if err != nil {
+		return recodeSkipped, err
+	}
+	if !fc.owned(name, item) {
+		return recodeSkipped, nil
+	}
+	if fc.isExpired(item, now) {
+		return recodeExpired, nil
+	}
+
+	binary := isBinary(data) || opts.Binary
+	var encoding string
+	if fc.transforms != nil {
+		if tr := fc.transforms.forKey(item.Key); tr != nil {
+			encoding = tr.Name()
+		}
+	}
+	if item.Encoding == encoding && binary == isBinary(data) && (!fc.checksum || item.Checksum != "") {
+		return recodeSkipped, nil
+	}
+
+	if err := fc.verify(item); err != nil {
+		return recodeSkipped, err
+	}
+	if item.Encoding != "" {
+		tr := from[item.Encoding]
+		if fc.transforms != nil && fc.transforms.byName[item.Encoding] != nil {
+			tr = fc.transforms.byName[item.Encoding]
+		}
+		if tr == nil {
+			return recodeSkipped, fmt.Errorf("failed to decode payload: unknown encoding %q", item.Encoding)
+		}
+		raw, err := tr.Decode(item.Data)
+		if err != nil {
+			return recodeSkipped, fmt.Errorf("failed to decode payload with %s: %v", tr.Name(), err)
+		}
+		item.Data, item.Encoding = raw, ""
+	}
+	if item.Checksum != "" && Checksum(item.Data) != item.Checksum {
+		return recodeSkipped, ErrCorrupted
+	}
+	if opts.DryRun {
+		return recodeDone, nil
+	}
+
+	size := len(item.Data)
+	if fc.checksum && item.Checksum == "" {
+		item.Checksum = Checksum(item.Data)
+	}
+	if err := fc.encodeItem(item); err != nil {
+		return recodeSkipped, err
+	}
+	item.Signature = ""
+	fc.sign(item)
+	encoded, err := encodeBinary(item)
+	if !binary {
+		encoded, err = json.Marshal(item)
+	}
+	if err != nil {
+		return recodeSkipped, err
+	}
+
+	// Leave entries alone that were written since they were read
+	err = fc.compareAndWrite(name, data, item.Key, func() error {
+		if err := fc.store.Put(name, encoded); err != nil {
+			return err
+		}
+		fc.stored(name, item, size, len(encoded))
+		return nil
+	})
+	if err == errEntryChanged || err == ErrNotFound {
+		return recodeSkipped, nil
+	}
+	if err != nil {
+		return recodeSkipped, err
+	}
+	if fc.hot != nil {
+		fc.hot.remove(item.Key)
+	}
+	return recodeDone, nil
+}
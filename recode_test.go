@@ -0,0 +1,126 @@
+package pie_cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecode(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_recode")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	page := []byte(strings.Repeat("<p>hello</p>", 100))
+	old, err := NewFileCache(tempDir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = old.Set("html:index", page)
+	_ = old.SetFromReader("img:logo", bytes.NewReader([]byte("png")), time.Hour)
+	before, _ := old.Inspect("html:index")
+	old.Close()
+
+	entry := func(cache *FileCache, key string) (*CacheItem, bool) {
+		path, _ := cache.getFilePath(key)
+		data, _ := os.ReadFile(path)
+		item, err := decodeItem(data)
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", key, err)
+		}
+		return item, isBinary(data)
+	}
+
+	// Adopt compression, checksums and the binary format
+	cache, err := NewFileCache(tempDir, time.Hour, WithTransformPolicy(TransformPolicy{"html:*": Gzip()}), WithChecksum(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if res, err := cache.Recode(context.Background(), RecodeOptions{Binary: true, DryRun: true}); err != nil || res.Recoded != 2 {
+		t.Errorf("Expected a dry run to report 2 entries, got %+v, %v", res, err)
+	}
+	if _, binary := entry(cache, "html:index"); binary {
+		t.Error("Expected a dry run to write nothing")
+	}
+	progress := 0
+	res, err := cache.Recode(context.Background(), RecodeOptions{Binary: true, Rate: 1000, Progress: func(RecodeResult) { progress++ }})
+	if err != nil || res.Scanned != 2 || res.Recoded != 2 || progress != 2 {
+		t.Errorf("Expected 2 entries recoded with progress, got %+v, %v, %d calls", res, err, progress)
+	}
+	item, binary := entry(cache, "html:index")
+	if !binary || item.Encoding != "gzip" || item.Checksum == "" || bytes.Contains(item.Data, []byte("hello")) {
+		t.Errorf("Expected a compressed binary entry with a checksum, got %q, binary %v", item.Encoding, binary)
+	}
+	if after, _ := cache.Inspect("html:index"); !after.Created.Equal(before.Created) || !after.ExpireAt.Equal(before.ExpireAt) {
+		t.Errorf("Expected times kept, got %+v, was %+v", after, before)
+	}
+	if data, err := cache.Get("html:index"); err != nil || !bytes.Equal(data, page) {
+		t.Errorf("Expected the page after recoding, got %d bytes, %v", len(data), err)
+	}
+	if res, _ := cache.Recode(context.Background(), RecodeOptions{Binary: true}); res.Recoded != 0 || res.Skipped != 2 {
+		t.Errorf("Expected nothing left to recode, got %+v", res)
+	}
+	cache.Close()
+
+	// Dropping a transform needs it to decode what it encoded
+	plain, err := NewFileCache(tempDir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer plain.Close()
+	if res, _ := plain.Recode(context.Background(), RecodeOptions{}); res.Failed != 1 {
+		t.Errorf("Expected the gzip entry to fail without From, got %+v", res)
+	}
+	if res, err := plain.Recode(context.Background(), RecodeOptions{From: []Transform{Gzip()}}); err != nil || res.Recoded != 1 {
+		t.Errorf("Expected the gzip entry decoded, got %+v, %v", res, err)
+	}
+	if item, _ := entry(plain, "html:index"); item.Encoding != "" {
+		t.Errorf("Expected the payload stored plain, got %q", item.Encoding)
+	}
+	if data, err := plain.Get("html:index"); err != nil || !bytes.Equal(data, page) {
+		t.Errorf("Expected the page after recoding, got %d bytes, %v", len(data), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := plain.Recode(ctx, RecodeOptions{}); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRecodeConcurrentSet(t *testing.T) {
+	store := &hookStore{MemoryStore: NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("k", []byte("old"))
+
+	// A Set landing between the check and the rewrite must not be undone
+	var wg sync.WaitGroup
+	store.onFetch = func() {
+		store.mu.Lock()
+		store.onFetch = func() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = cache.Set("k", []byte("new"))
+			}()
+			time.Sleep(20 * time.Millisecond)
+		}
+		store.mu.Unlock()
+	}
+	if _, err := cache.Recode(context.Background(), RecodeOptions{Binary: true}); err != nil {
+		t.Fatalf("Recode failed: %v", err)
+	}
+	wg.Wait()
+	if got, err := cache.Get("k"); err != nil || string(got) != "new" {
+		t.Errorf("Expected the new value kept, got %q, %v", got, err)
+	}
+}
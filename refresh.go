@@ -0,0 +1,114 @@
+package pie_cache
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// refreshAhead reloads entries read late in their lifetime
+type refreshAhead struct {
+	fraction float64
+	load     LoaderFunc
+	inFlight sync.Map // Keys being refreshed or waiting for it
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	limit   int          // Most reloads running at once, 0 for no limit
+	running int          // Reloads running
+	waiting refreshQueue // Due keys beyond the limit, most expensive first
+}
+
+// WithRefreshAhead reloads an entry in the background with load when a
+// read finds it in the last fraction of its TTL, so keys that keep being
+// read never expire for their readers. The read itself returns the current
+// value. fraction must be between 0 and 1; 0.2 refreshes entries read in
+// the last fifth of their lifetime.
+func WithRefreshAhead(fraction float64, load LoaderFunc) Option {
+	return func(fc *FileCache) {
+		if fraction > 0 && fraction < 1 && load != nil {
+			fc.refresh = &refreshAhead{fraction: fraction, load: load, limit: fc.refreshLimit}
+		}
+	}
+}
+
+// WithRefreshLimit runs at most n refresh-ahead reloads at once. Entries
+// due while the limit is reached wait their turn, those with the highest
+// cost from SetWithCost first.
+func WithRefreshLimit(n int) Option {
+	return func(fc *FileCache) {
+		if n > 0 {
+			fc.refreshLimit = n
+			if fc.refresh != nil {
+				fc.refresh.limit = n
+			}
+		}
+	}
+}
+
+// refreshTask is a key waiting for a reload
+type refreshTask struct {
+	key  string
+	cost float64
+}
+
+// refreshQueue is a heap of refresh tasks ordered by descending cost
+type refreshQueue []refreshTask
+
+func (q refreshQueue) Len() int           { return len(q) }
+func (q refreshQueue) Less(i, j int) bool { return q[i].cost > q[j].cost }
+func (q refreshQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *refreshQueue) Push(x any)        { *q = append(*q, x.(refreshTask)) }
+func (q *refreshQueue) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
+
+// refreshIfDue starts a reload of key if item, just read, is due for one
+func (fc *FileCache) refreshIfDue(key string, item *CacheItem) {
+	r := fc.refresh
+	if r == nil {
+		return
+	}
+	lifetime := item.ExpireAt.Sub(item.Created)
+	if lifetime <= 0 || item.ExpireAt.Sub(fc.now()) > time.Duration(float64(lifetime)*r.fraction) {
+		return
+	}
+	if _, busy := r.inFlight.LoadOrStore(key, true); busy {
+		return
+	}
+
+	r.mu.Lock()
+	if r.limit > 0 && r.running >= r.limit {
+		heap.Push(&r.waiting, refreshTask{key: key, cost: item.Cost})
+		r.mu.Unlock()
+		return
+	}
+	r.running++
+	r.wg.Add(1)
+	r.mu.Unlock()
+	go fc.runRefresh(key)
+}
+
+// runRefresh reloads key, then the waiting keys until none are left
+func (fc *FileCache) runRefresh(key string) {
+	r := fc.refresh
+	defer r.wg.Done()
+	for {
+		if _, err := fc.loadAndStore(key, r.load); err != nil {
+			fc.logEvent(Event{Type: EventWriteFailed, Key: key, Err: err})
+		}
+		r.inFlight.Delete(key)
+
+		r.mu.Lock()
+		if r.waiting.Len() == 0 {
+			r.running--
+			r.mu.Unlock()
+			return
+		}
+		key = heap.Pop(&r.waiting).(refreshTask).key
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,78 @@
+package pie_cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	var loads atomic.Int32
+	load := func(key string) ([]byte, time.Duration, error) {
+		loads.Add(1)
+		return []byte("fresh"), 0, nil
+	}
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithRefreshAhead(0.5, load))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Early in its lifetime an entry is left alone
+	_ = cache.Set("early", []byte("old"))
+	_, _ = cache.Get("early")
+
+	// Late in its lifetime a read returns the value and reloads it
+	_ = cache.SetWithTTL("late", []byte("old"), 40*time.Millisecond)
+	time.Sleep(25 * time.Millisecond)
+	if v, err := cache.GetString("late"); err != nil || v != "old" {
+		t.Errorf("Expected the current value, got %q, %v", v, err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("Expected 1 reload, got %d", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if v, err := cache.GetString("late"); err != nil || v != "fresh" {
+		t.Errorf("Expected the reloaded value past the old expiry, got %q, %v", v, err)
+	}
+}
+
+func TestRefreshLimit(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	load := func(key string) ([]byte, time.Duration, error) {
+		if key == "first" {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, key)
+		mu.Unlock()
+		return []byte("fresh"), 0, nil
+	}
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithRefreshAhead(0.9, load), WithRefreshLimit(1))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.SetWithCost("first", []byte("old"), time.Second, 1)
+	_ = cache.SetWithCost("cheap", []byte("old"), time.Second, 1)
+	_ = cache.SetWithCost("costly", []byte("old"), time.Second, 100)
+	time.Sleep(150 * time.Millisecond)
+
+	// The first reload holds the only slot while the others come due
+	for _, key := range []string{"first", "cheap", "costly"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Fatalf("Get(%q) failed: %v", key, err)
+		}
+	}
+	close(release)
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(order) != 3 || order[1] != "costly" || order[2] != "cheap" {
+		t.Errorf("Expected the costly entry refreshed before the cheap one, got %v", order)
+	}
+}
@@ -0,0 +1,87 @@
+package pie_cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxClockSkew is how far in the future a creation time may lie before
+// read repair takes it to be wrong
+const maxClockSkew = time.Minute
+
+// WithReadRepair makes reads fix entries whose metadata has drifted. An
+// entry holding another key is moved to where that key belongs, or
+// removed; a creation time that is missing, in the future or after the
+// expiration time is reset; and index records disagreeing with the entry
+// are rewritten. Repairs are counted in Stats and logged as EventRepair.
+// Without it, an entry holding another key is still treated as a miss.
+func WithReadRepair() Option {
+	return func(fc *FileCache) {
+		fc.readRepair = true
+	}
+}
+
+// checkDrift compares the entry read from name for key, encoded as data,
+// with what it should hold. It returns ErrNotFound if the entry is not
+// usable for key, ErrCollision if it belongs to another key mapping to the
+// same entry, and whether item was fixed and needs to be written back.
+func (fc *FileCache) checkDrift(ctx context.Context, key, name string, item *CacheItem, data []byte) (bool, error) {
+	if item.Key != key {
+		if err := fc.checkKey(ctx, key, name, item); err == ErrCollision {
+			// Repairing would destroy the other key's entry
+			return false, err
+		}
+		if fc.readRepair {
+			err := fmt.Errorf("entry holds key %q", item.Key)
+			removed := true
+			if want, wantErr := fc.entryName(item.Key); wantErr == nil && want != name {
+				if fc.relocate(name, want, item, data) == nil {
+					removed = false
+				}
+			}
+			if removed {
+				removed = fc.store.Remove(name) == nil
+			}
+			fc.repaired(ctx, Event{Type: EventRepair, Key: key, Path: name, Removed: removed, Err: err})
+		}
+		return false, ErrNotFound
+	}
+
+	if !fc.readRepair {
+		return false, nil
+	}
+	now := fc.now()
+	if item.Created.IsZero() || item.Created.After(now.Add(maxClockSkew)) || item.Created.After(item.ExpireAt) {
+		err := fmt.Errorf("bad creation time %v", item.Created)
+		item.Created = now
+		if item.ExpireAt.Before(now) {
+			item.Created = item.ExpireAt
+		}
+		fc.repaired(ctx, Event{Type: EventRepair, Key: key, Path: name, Err: err})
+		return true, nil
+	}
+	return false, nil
+}
+
+// checkIndex rewrites the index record of key if it disagrees with the
+// entry read from name, whose encoded size is encoded
+func (fc *FileCache) checkIndex(ctx context.Context, key, name string, item *CacheItem, encoded int) {
+	if !fc.readRepair || fc.index == nil {
+		return
+	}
+	want := indexEntry{Name: name, ExpireAt: item.ExpireAt, Size: len(item.Data), Bytes: encoded}
+	e, ok := fc.index.get(key)
+	if ok && e.Name == want.Name && e.ExpireAt.Equal(want.ExpireAt) && e.Size == want.Size && e.Bytes == want.Bytes {
+		return
+	}
+	fc.index.put(key, want)
+	fc.repaired(ctx, Event{Type: EventRepair, Key: key, Path: name,
+		Err: fmt.Errorf("index record %+v does not match entry", e)})
+}
+
+// repaired counts and logs a repair
+func (fc *FileCache) repaired(ctx context.Context, e Event) {
+	fc.stats.repairs.Add(1)
+	fc.logEventContext(ctx, e)
+}
@@ -0,0 +1,75 @@
+package pie_cache
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReadRepair(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithReadRepair(), WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	// An entry stored under the name of another key is moved to its own
+	_ = cache.Set("a", []byte("1"))
+	aName, _ := cache.entryName("a")
+	bName, _ := cache.entryName("b")
+	data, _ := store.Fetch(aName)
+	_ = store.Put(bName, data)
+	_ = store.Remove(aName)
+	if _, err := cache.Get("b"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an entry holding another key, got %v", err)
+	}
+	if v, err := cache.GetString("a"); err != nil || v != "1" {
+		t.Errorf("Expected a to be moved back, got %q, %v", v, err)
+	}
+	if _, err := store.Fetch(bName); err != ErrNotFound {
+		t.Errorf("Expected the misplaced entry to be gone, got %v", err)
+	}
+
+	// A creation time in the future is reset
+	var item CacheItem
+	data, _ = store.Fetch(aName)
+	_ = json.Unmarshal(data, &item)
+	item.Created = time.Now().Add(time.Hour)
+	data, _ = json.Marshal(&item)
+	_ = store.Put(aName, data)
+	if _, err := cache.Get("a"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, _ = store.Fetch(aName)
+	_ = json.Unmarshal(data, &item)
+	if item.Created.After(time.Now()) {
+		t.Errorf("Expected creation time to be repaired, got %v", item.Created)
+	}
+
+	// A stale index record is rewritten
+	cache.index.put("a", indexEntry{Name: aName, ExpireAt: item.ExpireAt, Size: 99, Bytes: 1})
+	_, _ = cache.Get("a")
+	if e, _ := cache.index.get("a"); e.Size != 1 || e.Bytes != len(data) {
+		t.Errorf("Expected index record to be repaired, got %+v", e)
+	}
+
+	if n := cache.Stats().Repairs; n != 3 {
+		t.Errorf("Expected 3 repairs, got %d", n)
+	}
+	// A healthy entry needs none
+	_, _ = cache.Get("a")
+	if n := cache.Stats().Repairs; n != 3 {
+		t.Errorf("Expected no repair of a healthy entry, got %d", n)
+	}
+
+	// Without read repair, an entry holding another key is only a miss
+	plain, _ := NewWithStore(store, time.Minute)
+	_ = store.Put(bName, data)
+	if _, err := plain.Get("b"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound without read repair, got %v", err)
+	}
+	if _, err := store.Fetch(bName); err != nil {
+		t.Errorf("Expected the entry to be left alone, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package pie_cache
+
+import (
+	"context"
+	"time"
+)
+
+// WithMaxAge caps how long any entry is kept, whatever its TTL: entries
+// created more than maxAge ago count as expired, so reads miss them and
+// the janitor and PurgeExpired remove them. It is meant for retention
+// policies that forbid keeping cached user data indefinitely. New entries
+// get their expiration time capped when written; on a cache with an index
+// that already holds entries, call RebuildIndex once after enabling it so
+// that index-based purges see the cap for the older entries as well.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(fc *FileCache) {
+		if maxAge > 0 {
+			fc.maxAge = maxAge
+		}
+	}
+}
+
+// SetWithMaxLifetime stores data under key with the specified TTL and a
+// hard limit of maxLifetime from now, e.g. for sessions that must end
+// however active they are. Extensions such as WithAdaptiveTTL and
+// TouchPrefix never move the expiry past that limit.
+func (fc *FileCache) SetWithMaxLifetime(key string, data []byte, ttl, maxLifetime time.Duration) error {
+	return fc.set(context.Background(), CacheItem{Key: key, Data: data, Deadline: fc.now().Add(maxLifetime)}, ttl)
+}
+
+// retainUntil returns when item expires, taking the WithMaxAge cap and the
+// deadline of the item into account. The TTL of pinned items does not run
+// out, but the cap and deadline still apply.
+func (fc *FileCache) retainUntil(item *CacheItem) time.Time {
+	until := item.ExpireAt
+	if item.Priority >= PriorityPinned {
+		until = item.Created.Add(forever)
+	}
+	if fc.maxAge > 0 {
+		if limit := item.Created.Add(fc.maxAge); limit.Before(until) {
+			until = limit
+		}
+	}
+	if !item.Deadline.IsZero() && item.Deadline.Before(until) {
+		until = item.Deadline
+	}
+	return until
+}
+
+// isExpired reports whether item is expired at now, because its TTL or the
+// WithMaxAge cap passed or its group was invalidated
+func (fc *FileCache) isExpired(item *CacheItem, now time.Time) bool {
+	return fc.expiryTime(now).After(fc.retainUntil(item)) || fc.groupStale(item)
+}
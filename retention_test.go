@@ -0,0 +1,79 @@
+package pie_cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxAge(t *testing.T) {
+	store := NewMemoryStore()
+	plain, err := NewWithStore(store, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = plain.Set("old", []byte("v"))
+	time.Sleep(20 * time.Millisecond)
+
+	cache, err := NewWithStore(store, time.Hour, WithMaxAge(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	// Entries written before the cap count as expired once past it
+	if _, err := cache.Get("old"); err != ErrExpired {
+		t.Errorf("Expected ErrExpired for an entry past the max age, got %v", err)
+	}
+
+	// New entries have their expiration time capped
+	_ = cache.Set("new", []byte("v"))
+	meta, err := cache.Inspect("new")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if d := meta.ExpireAt.Sub(meta.Created); d != 10*time.Millisecond {
+		t.Errorf("Expected lifetime capped at 10ms, got %v", d)
+	}
+
+	_ = plain.Set("old", []byte("v"))
+	time.Sleep(20 * time.Millisecond)
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if keys, _ := plain.ListKeys(); len(keys) != 0 {
+		t.Errorf("Expected all entries past the max age purged, got %v", keys)
+	}
+}
+
+func TestMaxLifetime(t *testing.T) {
+	cache, err := NewWithStore(NewMemoryStore(), time.Hour, WithSigningKey([]byte("secret")),
+		WithAdaptiveTTL(AdaptiveTTLPolicy{HotHits: 1, Extension: time.Hour}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if err := cache.SetWithMaxLifetime("session:1", []byte("v"), 10*time.Millisecond, 50*time.Millisecond); err != nil {
+		t.Fatalf("SetWithMaxLifetime failed: %v", err)
+	}
+
+	// Reads and touches extend the entry, but only up to its deadline
+	if _, err := cache.Get("session:1"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if _, err := cache.TouchPrefix("session:", time.Hour); err != nil {
+		t.Fatalf("TouchPrefix failed: %v", err)
+	}
+	meta, err := cache.Inspect("session:1")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if meta.ExpireAt.After(meta.Deadline) || meta.Deadline.Sub(meta.Created) > 51*time.Millisecond {
+		t.Errorf("Expected expiry capped at the deadline, got %v and %v", meta.ExpireAt, meta.Deadline)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := cache.Get("session:1"); err != nil {
+		t.Errorf("Expected the extended entry to be live, got %v", err)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, err := cache.Get("session:1"); err != ErrExpired {
+		t.Errorf("Expected ErrExpired past the deadline, got %v", err)
+	}
+}
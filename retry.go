@@ -0,0 +1,164 @@
+package pie_cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how writes made on behalf of a caller that is no
+// longer waiting, such as TieredCache write-back, are retried, and where
+// those that keep failing are kept
+type RetryPolicy struct {
+	Attempts      int           // Total tries per write, including the first
+	Backoff       time.Duration // Pause before the first retry, doubled after each
+	MaxBackoff    time.Duration // Upper bound for the pause, 0 for none
+	DeadLetterDir string        // Where exhausted writes are saved, empty to drop them
+}
+
+// WithWriteRetry retries background writes according to p
+func WithWriteRetry(p RetryPolicy) Option {
+	return func(fc *FileCache) {
+		if p.Attempts < 1 {
+			p.Attempts = 1
+		}
+		fc.retry = p
+	}
+}
+
+// DeadLetter is a write that failed after all retries, as saved in the
+// dead-letter directory
+type DeadLetter struct {
+	Key      string    `json:"key"`
+	Data     []byte    `json:"data"`
+	ExpireAt time.Time `json:"expireAt"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"` // Last failure
+	Time     time.Time `json:"time"`  // When the write was given up
+}
+
+// permanentWriteError reports whether a write that failed with err would
+// fail the same way on every retry
+func permanentWriteError(err error) bool {
+	switch err {
+	case ErrTooLarge, ErrInvalidKey, ErrReadOnly, ErrNoSpace, ErrCollision:
+		return true
+	}
+	return false
+}
+
+// setWithRetry writes key like SetWithTTL, retrying with backoff and
+// saving the write as a dead letter if every attempt fails. Writes that
+// can never succeed fail at once, and once ctx is done the write is saved
+// without waiting for the remaining attempts.
+func (fc *FileCache) setWithRetry(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	attempts := max(fc.retry.Attempts, 1)
+	backoff := fc.retry.Backoff
+	expireAt := fc.now().Add(ttl)
+
+	var err error
+	tries := 0
+	for tries < attempts {
+		if tries > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			backoff *= 2
+			if fc.retry.MaxBackoff > 0 && backoff > fc.retry.MaxBackoff {
+				backoff = fc.retry.MaxBackoff
+			}
+			// Keep the original deadline rather than restarting the TTL
+			if ttl = expireAt.Sub(fc.now()); ttl <= 0 {
+				return nil
+			}
+		}
+		tries++
+		if err = fc.set(ctx, CacheItem{Key: key, Data: data}, ttl); err == nil {
+			return nil
+		}
+		if permanentWriteError(err) {
+			return err
+		}
+	}
+
+	if fc.retry.DeadLetterDir == "" {
+		return err
+	}
+	dl := DeadLetter{Key: key, Data: data, ExpireAt: expireAt, Attempts: tries, Error: err.Error(), Time: time.Now()}
+	if dlErr := writeDeadLetter(fc.retry.DeadLetterDir, &dl); dlErr != nil {
+		return fmt.Errorf("%v (dead letter not saved: %v)", err, dlErr)
+	}
+	return fmt.Errorf("%v (saved as dead letter)", err)
+}
+
+// writeDeadLetter saves dl as a JSON file in dir
+func writeDeadLetter(dir string, dl *DeadLetter) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create dead-letter directory: %v", err)
+	}
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %v", err)
+	}
+	hash := sha256.Sum256([]byte(dl.Key))
+	name := fmt.Sprintf("%d-%s.json", dl.Time.UnixNano(), hex.EncodeToString(hash[:8]))
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		return fmt.Errorf("failed to write dead letter: %v", err)
+	}
+	return nil
+}
+
+// ReplayDeadLetters writes the dead letters saved by the retry policy
+// back into the cache, removing each file once its entry was written or
+// has expired. It returns how many entries were restored.
+func (fc *FileCache) ReplayDeadLetters() (int, error) {
+	dir := fc.retry.DeadLetterDir
+	if dir == "" {
+		return 0, nil
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read dead-letter directory: %v", err)
+	}
+
+	restored := 0
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return restored, fmt.Errorf("failed to read dead letter: %v", err)
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(data, &dl); err != nil {
+			return restored, fmt.Errorf("failed to parse dead letter %s: %v", f.Name(), err)
+		}
+		if ttl := dl.ExpireAt.Sub(fc.now()); ttl > 0 {
+			if err := fc.SetWithTTL(dl.Key, dl.Data, ttl); err != nil {
+				return restored, err
+			}
+			restored++
+		}
+		if err := os.Remove(path); err != nil {
+			return restored, fmt.Errorf("failed to remove dead letter: %v", err)
+		}
+	}
+	return restored, nil
+}
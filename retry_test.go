@@ -0,0 +1,131 @@
+package pie_cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyStore fails the next failures Put calls
+type flakyStore struct {
+	*MemoryStore
+	mu       sync.Mutex
+	failures int
+	puts     int
+}
+
+func (s *flakyStore) Put(name string, data []byte) error {
+	s.mu.Lock()
+	s.puts++
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.mu.Unlock()
+	if fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Put(name, data)
+}
+
+func TestWriteRetry(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_retry")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Minute, WithWriteRetry(RetryPolicy{
+		Attempts: 3, Backoff: time.Millisecond, DeadLetterDir: tempDir,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	tc := NewTieredCache(cache, 1, WriteBack)
+	store.puts = 0
+
+	// Two failures are absorbed by the retries
+	store.failures = 2
+	_ = tc.Set("a", []byte("1"))
+	if err := tc.Set("b", []byte("2")); err != nil {
+		t.Fatalf("Expected retried write-back to succeed, got %v", err)
+	}
+	if v, err := cache.GetString("a"); err != nil || v != "1" || store.puts != 3 {
+		t.Errorf("Expected a persisted after 3 puts, got %q, %v, %d puts", v, err, store.puts)
+	}
+
+	// Exhausted retries end up in the dead-letter directory
+	store.failures = 3
+	if err := tc.Set("c", []byte("3")); err == nil {
+		t.Fatal("Expected write-back of b to fail")
+	}
+	files, _ := os.ReadDir(tempDir)
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(files))
+	}
+	if _, err := cache.Get("b"); err != ErrNotFound {
+		t.Errorf("Expected b not to be stored yet, got %v", err)
+	}
+
+	n, err := cache.ReplayDeadLetters()
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 replayed dead letter, got %d, %v", n, err)
+	}
+	if v, err := cache.GetString("b"); err != nil || v != "2" {
+		t.Errorf("Expected replayed b, got %q, %v", v, err)
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+		t.Errorf("Expected dead letters to be removed after replay, %d left", len(files))
+	}
+}
+
+func TestWriteRetryGivesUp(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_retry")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	cache, err := NewWithStore(store, time.Minute, WithMaxValueSize(4), WithWriteRetry(RetryPolicy{
+		Attempts: 3, Backoff: time.Hour, DeadLetterDir: tempDir,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Writes that can never succeed are neither retried nor saved
+	if err := cache.setWithRetry(context.Background(), "big", []byte("too large"), time.Minute); err != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if err := cache.setWithRetry(context.Background(), "", []byte("x"), time.Minute); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+		t.Errorf("Expected no dead letters for permanent failures, got %d", len(files))
+	}
+
+	// A done context ends the backoff and saves the write
+	store.failures = 3
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := cache.setWithRetry(ctx, "k", []byte("v"), time.Minute); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected the backoff to end with the context, took %v", d)
+	}
+	files, _ := os.ReadDir(tempDir)
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(files))
+	}
+	store.failures = 0
+	if n, err := cache.ReplayDeadLetters(); err != nil || n != 1 {
+		t.Errorf("Expected 1 replayed dead letter, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package s3store implements a pie_cache.Store on top of S3-compatible
+// object storage, so caches in ephemeral containers can share a bucket
+// instead of a local disk.
+package s3store
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// Config describes where and how to reach the bucket
+type Config struct {
+	Endpoint        string       // Service URL, e.g. "https://s3.eu-west-1.amazonaws.com" or "http://minio:9000"
+	Region          string       // Signing region, "us-east-1" if empty
+	Bucket          string       // Bucket name
+	Prefix          string       // Prefix prepended to every object key, e.g. "cache/"
+	AccessKeyID     string       // Access key; requests are unsigned if empty
+	SecretAccessKey string       // Secret for AccessKeyID
+	SessionToken    string       // Optional temporary session token
+	VirtualHost     bool         // Address the bucket as a subdomain instead of a path element
+	HTTPClient      *http.Client // Client to use, http.DefaultClient if nil
+}
+
+// Store is a pie_cache.Store backed by an S3 bucket
+type Store struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	virtual  bool
+	creds    credentials
+	signed   bool
+	client   *http.Client
+	now      func() time.Time
+}
+
+var _ pie_cache.Store = (*Store)(nil)
+
+// New creates a Store for cfg
+func New(cfg Config) (*Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3store: bucket is required")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3store: invalid endpoint %q", cfg.Endpoint)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Store{
+		endpoint: endpoint,
+		bucket:   cfg.Bucket,
+		prefix:   cfg.Prefix,
+		virtual:  cfg.VirtualHost,
+		creds: credentials{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			sessionToken:    cfg.SessionToken,
+			region:          region,
+		},
+		signed: cfg.AccessKeyID != "",
+		client: client,
+		now:    time.Now,
+	}, nil
+}
+
+// Put implements pie_cache.Store
+func (s *Store) Put(name string, data []byte) error {
+	resp, err := s.do(http.MethodPut, s.prefix+name, nil, data)
+	if err != nil {
+		return fmt.Errorf("failed to write cache object: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to write cache object: %v", responseError(resp))
+	}
+	return nil
+}
+
+// Fetch implements pie_cache.Store
+func (s *Store) Fetch(name string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, s.prefix+name, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache object: %v", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache object: %v", err)
+		}
+		return data, nil
+	case http.StatusNotFound:
+		return nil, pie_cache.ErrNotFound
+	default:
+		return nil, fmt.Errorf("failed to read cache object: %v", responseError(resp))
+	}
+}
+
+// Remove implements pie_cache.Store. S3 deletes succeed for missing
+// objects, so existence is checked first to report ErrNotFound.
+func (s *Store) Remove(name string) error {
+	resp, err := s.do(http.MethodHead, s.prefix+name, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete cache object: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return pie_cache.ErrNotFound
+	}
+
+	resp, err = s.do(http.MethodDelete, s.prefix+name, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete cache object: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete cache object: %v", responseError(resp))
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Walk implements pie_cache.Store using ListObjectsV2. Objects deleted
+// between listing and reading are skipped.
+func (s *Store) Walk(prefix string, fn func(name string, data []byte) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return fmt.Errorf("failed to list cache objects: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(resp)
+			resp.Body.Close()
+			return fmt.Errorf("failed to list cache objects: %v", err)
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse object listing: %v", err)
+		}
+
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(obj.Key, s.prefix)
+			data, err := s.Fetch(name)
+			if err == pie_cache.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(name, data); err != nil {
+				return err
+			}
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// do sends a signed request for the object key (or the bucket if key is empty)
+func (s *Store) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	bucketPath := "/" + s.bucket
+	if s.virtual {
+		u.Host = s.bucket + "." + u.Host
+		bucketPath = ""
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + bucketPath
+	if key != "" || u.Path == "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+
+	if s.signed {
+		payloadHash := emptyPayloadSHA
+		if body != nil {
+			payloadHash = hexSHA256(body)
+		}
+		s.creds.sign(req, payloadHash, s.now())
+	}
+
+	return s.client.Do(req)
+}
+
+// responseError describes a failed S3 response
+func responseError(resp *http.Response) error {
+	var s3err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+		return fmt.Errorf("%s: %s: %s", resp.Status, s3err.Code, s3err.Message)
+	}
+	return errors.New(resp.Status)
+}
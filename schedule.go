@@ -0,0 +1,112 @@
+package pie_cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// deletionPrefix holds the deletions scheduled by DeleteAt
+const deletionPrefix = metaPrefix + "deletions/"
+
+// scheduledDeletion is the stored form of a DeleteAt call
+type scheduledDeletion struct {
+	Key string    `json:"key"`
+	At  time.Time `json:"at"`
+}
+
+// DeleteAt schedules the removal of key at t, regardless of its TTL, e.g.
+// for content that must disappear when an embargo ends. The schedule is
+// kept in the store, so it survives restarts and is seen by every process
+// sharing the cache, and is carried out by the next janitor run or
+// DeleteDue call after t. A run that fails or is interrupted retries on the
+// next one, so the removal happens at least once. The schedule belongs to
+// the key rather than its current value: a value set again before t is
+// removed as well. Calling DeleteAt again replaces the schedule; a t that
+// has passed removes key at once.
+func (fc *FileCache) DeleteAt(key string, t time.Time) error {
+	if fc.readOnly {
+		return ErrReadOnly
+	}
+	if _, err := fc.entryName(key); err != nil {
+		return err
+	}
+	if !t.After(fc.now()) {
+		if err := fc.Delete(key); err != nil && err != ErrNotFound {
+			return err
+		}
+		return fc.CancelDeleteAt(key)
+	}
+
+	data, err := json.Marshal(scheduledDeletion{Key: key, At: t})
+	if err != nil {
+		return err
+	}
+	if err := fc.store.Put(deletionName(key), data); err != nil {
+		return fmt.Errorf("failed to schedule deletion of %q: %v", key, err)
+	}
+	return nil
+}
+
+// CancelDeleteAt drops the deletion of key scheduled by DeleteAt, if any
+func (fc *FileCache) CancelDeleteAt(key string) error {
+	if fc.readOnly {
+		return ErrReadOnly
+	}
+	if err := fc.store.Remove(deletionName(key)); err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to cancel deletion of %q: %v", key, err)
+	}
+	return nil
+}
+
+// DeleteDue carries out the deletions scheduled by DeleteAt whose time has
+// come and returns how many it carried out. The janitor calls it on every
+// run; caches without one can call it from their own scheduler.
+func (fc *FileCache) DeleteDue() (int, error) {
+	if fc.readOnly {
+		return 0, ErrReadOnly
+	}
+	now := fc.now()
+	due := make(map[string][]byte)
+	err := fc.store.Walk(deletionPrefix, func(name string, data []byte) error {
+		var d scheduledDeletion
+		if json.Unmarshal(data, &d) == nil && !d.At.After(now) {
+			due[name] = bytes.Clone(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list scheduled deletions: %v", err)
+	}
+
+	n := 0
+	var first error
+	for name, data := range due {
+		var d scheduledDeletion
+		_ = json.Unmarshal(data, &d)
+		if err := fc.Delete(d.Key); err != nil && err != ErrNotFound {
+			// The schedule stays for the next run to retry
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		// Keep a schedule another caller replaced in the meantime
+		if current, err := fc.store.Fetch(name); err == nil && bytes.Equal(current, data) {
+			if err := fc.store.Remove(name); err != nil && err != ErrNotFound && first == nil {
+				first = err
+			}
+		}
+		n++
+	}
+	return n, first
+}
+
+// deletionName returns the store name of the deletion scheduled for key
+func deletionName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return deletionPrefix + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,93 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeleteAt(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_schedule")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache, err := NewFileCache(tempDir, 24*time.Hour, WithClock(clock))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("article", []byte("embargoed"))
+	_ = cache.Set("draft", []byte("d"))
+	_ = cache.Set("now", []byte("n"))
+
+	embargo := clock.Now().Add(time.Hour)
+	if err := cache.DeleteAt("article", embargo); err != nil {
+		t.Fatalf("DeleteAt failed: %v", err)
+	}
+	if err := cache.DeleteAt("draft", embargo); err != nil {
+		t.Fatalf("DeleteAt failed: %v", err)
+	}
+	if err := cache.CancelDeleteAt("draft"); err != nil {
+		t.Fatalf("CancelDeleteAt failed: %v", err)
+	}
+	if err := cache.DeleteAt("now", clock.Now()); err != nil {
+		t.Fatalf("DeleteAt failed: %v", err)
+	}
+	if cache.Exists("now") {
+		t.Error("Expected a past deletion time to delete at once")
+	}
+	if n, err := cache.DeleteDue(); err != nil || n != 0 {
+		t.Errorf("Expected nothing due yet, got %d, %v", n, err)
+	}
+	if !cache.Exists("article") {
+		t.Error("Expected article kept until its deletion time")
+	}
+	cache.Close()
+
+	// The schedule survives reopening the cache
+	cache, err = NewFileCache(tempDir, 24*time.Hour, WithClock(clock))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	clock.Advance(time.Hour)
+	if n, err := cache.DeleteDue(); err != nil || n != 1 {
+		t.Errorf("Expected 1 due deletion, got %d, %v", n, err)
+	}
+	if cache.Exists("article") {
+		t.Error("Expected article deleted after its deletion time")
+	}
+	if !cache.Exists("draft") {
+		t.Error("Expected cancelled deletion not to run")
+	}
+	if n, _ := cache.DeleteDue(); n != 0 {
+		t.Errorf("Expected a carried out deletion to be dropped, got %d", n)
+	}
+	if keys, _ := cache.ListKeys(); len(keys) != 1 || keys[0] != "draft" {
+		t.Errorf("Expected schedules hidden from keys, got %v", keys)
+	}
+}
+
+func TestDeleteAtJanitor(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache, err := NewMemoryCache(24*time.Hour, WithClock(clock), WithJanitor(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	_ = cache.Set("promo", []byte("x"))
+	if err := cache.DeleteAt("promo", clock.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("DeleteAt failed: %v", err)
+	}
+	clock.Advance(time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for cache.Exists("promo") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if cache.Exists("promo") {
+		t.Error("Expected janitor to carry out the scheduled deletion")
+	}
+}
@@ -0,0 +1,47 @@
+package pie_cache
+
+import "time"
+
+// CacheInterface is what WithSecondary needs of the cache it mirrors writes
+// to. Every Cache implements it, as does TieredCache; a FileCache on an
+// s3store.Store mirrors to S3.
+type CacheInterface interface {
+	SetWithTTL(key string, data []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// WithSecondary mirrors every write and delete to secondary after it
+// succeeded here, for a replica that can take over from this cache. The
+// secondary gets the payload before transforms and the remaining TTL.
+// Failures to reach it do not fail the write here; they are logged as
+// EventSecondaryFailed. TouchPrefix is mirrored as a write; expiry,
+// eviction and purges are not mirrored.
+func WithSecondary(secondary CacheInterface) Option {
+	return func(fc *FileCache) {
+		fc.secondary = secondary
+	}
+}
+
+// mirrorSet writes data under key to the secondary cache until expireAt
+func (fc *FileCache) mirrorSet(key string, data []byte, expireAt time.Time) {
+	if fc.secondary == nil {
+		return
+	}
+	ttl := expireAt.Sub(fc.now())
+	if ttl <= 0 {
+		return
+	}
+	if err := fc.secondary.SetWithTTL(key, data, ttl); err != nil {
+		fc.logEvent(Event{Type: EventSecondaryFailed, Key: key, Size: len(data), Err: err})
+	}
+}
+
+// mirrorDelete removes key from the secondary cache
+func (fc *FileCache) mirrorDelete(key string) {
+	if fc.secondary == nil {
+		return
+	}
+	if err := fc.secondary.Delete(key); err != nil && err != ErrNotFound {
+		fc.logEvent(Event{Type: EventSecondaryFailed, Key: key, Err: err})
+	}
+}
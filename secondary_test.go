@@ -0,0 +1,80 @@
+package pie_cache
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSecondary(t *testing.T) {
+	replica, err := NewWithStore(NewMemoryStore(), time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer replica.Close()
+	for _, opts := range [][]Option{nil, {WithAsyncWrites(8, 1)}} {
+		cache, err := NewWithStore(NewMemoryStore(), time.Minute, append(opts, WithSecondary(replica))...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+
+		_ = cache.SetWithTTL("a", []byte("1"), time.Hour)
+		_ = cache.Append("log", []byte("x"))
+		_ = cache.Append("log", []byte("y"))
+		_ = cache.SetFromReader("stream", strings.NewReader("s"), time.Hour)
+		_ = cache.Set("gone", []byte("g"))
+		_ = cache.Set("taken", []byte("t"))
+		if err := cache.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		for key, want := range map[string]string{"a": "1", "log": "xy", "stream": "s", "gone": "g", "taken": "t"} {
+			if data, err := replica.Get(key); err != nil || string(data) != want {
+				t.Errorf("Expected %q mirrored as %q, got %q, %v", key, want, data, err)
+			}
+		}
+		if meta, _ := replica.Inspect("a"); meta.TTLRemaining(time.Now()) < 59*time.Minute {
+			t.Errorf("Expected the TTL to be mirrored, expires at %v", meta.ExpireAt)
+		}
+
+		_ = cache.Delete("gone")
+		_, _ = cache.Take("taken")
+		for _, key := range []string{"gone", "taken"} {
+			if _, err := replica.Get(key); err != ErrNotFound {
+				t.Errorf("Expected %q deleted from the secondary, got %v", key, err)
+			}
+		}
+		_ = cache.Close()
+	}
+}
+
+// failingCache is a CacheInterface whose writes fail
+type failingCache struct{}
+
+func (failingCache) SetWithTTL(string, []byte, time.Duration) error { return errors.New("unreachable") }
+func (failingCache) Delete(string) error                            { return errors.New("unreachable") }
+
+func TestSecondaryFailure(t *testing.T) {
+	var failures atomic.Int32
+	logger := LoggerFunc(func(e Event) {
+		if e.Type == EventSecondaryFailed {
+			failures.Add(1)
+		}
+	})
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithSecondary(failingCache{}), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	if err := cache.Set("key", []byte("v")); err != nil {
+		t.Errorf("Expected the write to succeed, got %v", err)
+	}
+	if err := cache.Delete("key"); err != nil {
+		t.Errorf("Expected the delete to succeed, got %v", err)
+	}
+	if n := failures.Load(); n != 2 {
+		t.Errorf("Expected 2 secondary failures logged, got %d", n)
+	}
+}
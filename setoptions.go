@@ -0,0 +1,89 @@
+package pie_cache
+
+import (
+	"context"
+	"time"
+)
+
+// SetOption configures a single SetWithOptions call
+type SetOption func(*setOptions)
+
+// setOptions is what the SetOptions of a call asked for
+type setOptions struct {
+	ttl        time.Duration
+	tags       []string
+	noCompress bool
+	priority   Priority
+}
+
+// WithTTLOpt stores the entry with ttl instead of the cache's default TTL
+func WithTTLOpt(ttl time.Duration) SetOption {
+	return func(o *setOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithTagsOpt labels the entry with tags. They are returned in ItemMeta
+// and listed by ExportMetadata, next to the invalidation group if any.
+func WithTagsOpt(tags ...string) SetOption {
+	return func(o *setOptions) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// WithNoCompress stores the payload uncompressed even if the transform
+// policy gzips the key, e.g. for data known to be compressed already.
+// Other transforms, including pipelines that also encrypt, still apply.
+func WithNoCompress() SetOption {
+	return func(o *setOptions) {
+		o.noCompress = true
+	}
+}
+
+// Priority ranks entries for size-based eviction
+type Priority int
+
+const (
+	// PriorityLow entries are evicted before any others, e.g. throwaway
+	// page fragments
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the priority of entries written without WithPriority
+	PriorityNormal
+	// PriorityHigh entries are evicted only once no lower priority is left
+	PriorityHigh
+	// PriorityPinned entries are never evicted to meet the size limits
+	// and their TTL does not run out, e.g. for critical configuration.
+	// The WithMaxAge cap and SetWithMaxLifetime deadlines still apply.
+	// Pin and Unpin set and clear it on stored entries.
+	PriorityPinned
+)
+
+// WithPriority sets the eviction priority of the entry. Once the cache
+// outgrows its size limits, live entries of a lower priority are evicted
+// before any of a higher one, whatever the eviction scorer says.
+func WithPriority(p Priority) SetOption {
+	return func(o *setOptions) {
+		o.priority = p
+	}
+}
+
+// SetWithOptions adds or updates a cache item configured by opts, e.g.
+// SetWithOptions(key, data, WithTTLOpt(time.Hour), WithPriority(PriorityHigh))
+func (fc *FileCache) SetWithOptions(key string, data []byte, opts ...SetOption) error {
+	o := setOptions{ttl: fc.ttl}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if fc.async != nil {
+		// Written directly, so a value still queued must not overwrite it
+		fc.async.cancel(key)
+	}
+
+	transform := true
+	if o.noCompress && fc.transforms != nil {
+		_, gzipped := fc.transforms.forKey(key).(gzipTransform)
+		transform = !gzipped
+	}
+	item := CacheItem{Key: key, Data: data, Tags: o.tags, Priority: o.priority}
+	return fc.setItem(context.Background(), item, o.ttl, transform)
+}
@@ -0,0 +1,102 @@
+package pie_cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetWithOptions(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute, WithSigningKey([]byte("secret")),
+		WithTransformPolicy(TransformPolicy{"page:*": Gzip()}))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	page := bytes.Repeat([]byte("<p>pie</p>"), 100)
+	if err := cache.SetWithOptions("page:home", page, WithTTLOpt(time.Hour), WithTagsOpt("html", "home")); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	data, meta, err := cache.GetWithMeta("page:home")
+	if err != nil || !bytes.Equal(data, page) {
+		t.Fatalf("Expected the page back, got %d bytes, %v", len(data), err)
+	}
+	if d := meta.ExpireAt.Sub(meta.Created); d != time.Hour {
+		t.Errorf("Expected a TTL of 1h, got %v", d)
+	}
+	if strings.Join(meta.Tags, ",") != "html,home" {
+		t.Errorf("Expected tags html,home, got %v", meta.Tags)
+	}
+
+	var buf bytes.Buffer
+	if err := cache.ExportMetadata(&buf); err != nil || !strings.Contains(buf.String(), `"tags":["html","home"]`) {
+		t.Errorf("Expected the tags in the metadata export, got %q, %v", buf.String(), err)
+	}
+
+	stored := func(key string) int {
+		name, _ := cache.entryName(key)
+		raw, _ := store.Fetch(name)
+		return len(raw)
+	}
+	compressed := stored("page:home")
+	if err := cache.SetWithOptions("page:home", page, WithNoCompress()); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	if n := stored("page:home"); n <= compressed {
+		t.Errorf("Expected the uncompressed entry to be larger than %d bytes, got %d", compressed, n)
+	}
+	if data, err := cache.Get("page:home"); err != nil || !bytes.Equal(data, page) {
+		t.Fatalf("Expected the uncompressed page back, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestSetWithPriority(t *testing.T) {
+	probe, _ := NewWithStore(NewMemoryStore(), time.Minute)
+	_ = probe.SetWithOptions("blob:a", make([]byte, 100), WithPriority(PriorityHigh))
+	entry, _, _ := probe.DiskUsage()
+
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithMaxSize(2*entry+entry/2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	// The default scorer alone would evict the entries closest to expiring
+	_ = cache.SetWithOptions("blob:config", make([]byte, 100), WithTTLOpt(time.Minute), WithPriority(PriorityPinned))
+	_ = cache.SetWithOptions("blob:report", make([]byte, 100), WithTTLOpt(2*time.Minute), WithPriority(PriorityHigh))
+	_ = cache.SetWithOptions("blob:page", make([]byte, 100), WithTTLOpt(time.Hour))
+	_ = cache.SetWithOptions("blob:fragment", make([]byte, 100), WithTTLOpt(2*time.Hour), WithPriority(PriorityLow))
+
+	if n, err := cache.Shrink(); err != nil || n != 2 {
+		t.Fatalf("Expected 2 evictions, got %d, %v", n, err)
+	}
+	for key, kept := range map[string]bool{"blob:config": true, "blob:report": true, "blob:page": false, "blob:fragment": false} {
+		if cache.Exists(key) != kept {
+			t.Errorf("Expected %s kept to be %v", key, kept)
+		}
+	}
+	if meta, err := cache.Inspect("blob:report"); err != nil || meta.Priority != PriorityHigh {
+		t.Errorf("Expected priority high, got %v, %v", meta.Priority, err)
+	}
+}
+
+func TestPinnedEntries(t *testing.T) {
+	probe, _ := NewWithStore(NewMemoryStore(), time.Minute)
+	_ = probe.SetWithOptions("cfg:a", make([]byte, 100), WithPriority(PriorityPinned))
+	entry, _, _ := probe.DiskUsage()
+
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithMaxSize(entry/2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.SetWithOptions("cfg:a", make([]byte, 100), WithPriority(PriorityPinned))
+	_ = cache.SetWithOptions("cfg:b", make([]byte, 100), WithPriority(PriorityPinned))
+
+	// Pinned entries stay even though the cache remains over its limit
+	if n, err := cache.Shrink(); err != nil || n != 0 {
+		t.Fatalf("Expected no evictions, got %d, %v", n, err)
+	}
+	if !cache.Exists("cfg:a") || !cache.Exists("cfg:b") {
+		t.Error("Expected pinned entries to be kept")
+	}
+}
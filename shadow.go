@@ -0,0 +1,249 @@
+package pie_cache
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// defaultShadowQueue is the number of mirrored operations ShadowCache
+// buffers when ShadowOptions.Queue is not set
+const defaultShadowQueue = 1024
+
+// ShadowOptions configures a ShadowCache
+type ShadowOptions struct {
+	Rate         float64          // Share of keys whose operations are mirrored, from 0 to 1
+	Queue        int              // Mirrored operations waiting for the shadow before more are dropped, 1024 if 0
+	OnDivergence func(Divergence) // Called for every divergence from the mirroring goroutine, if set
+}
+
+// Divergence is an operation the shadow answered differently than the
+// primary. Results are described as "N bytes HASH" for values, "miss" for
+// ErrNotFound and ErrExpired, "ok", "true" or "false", or the error.
+type Divergence struct {
+	Op      string // get, exists, set, delete or purge
+	Key     string // Empty for purge
+	Primary string // What the primary returned
+	Shadow  string // What the shadow returned
+}
+
+// ShadowStats counts what a ShadowCache mirrored
+type ShadowStats struct {
+	Mirrored    uint64        // Operations run on the shadow
+	Dropped     uint64        // Operations not mirrored because the queue was full
+	Divergences uint64        // Mirrored operations whose results differed
+	PrimaryTime time.Duration // Time the primary took for the mirrored operations
+	ShadowTime  time.Duration // Time the shadow took for them
+}
+
+// ShadowCache serves every call from a primary cache and repeats a share
+// of them on a shadow cache, e.g. one with a new layout, transform policy
+// or size limit, comparing results and latency. Risky changes to a cache
+// can so be tried on production traffic without affecting what callers
+// get. Keys are sampled by hash, so every operation on a sampled key is
+// mirrored and reads see the shadow's copy of earlier writes. Mirroring
+// runs in the order of the calls on a background goroutine and never
+// delays them; when it falls behind, operations are dropped. Writes that
+// race with a read of the same key can show as divergences.
+type ShadowCache struct {
+	primary Cache
+	shadow  Cache
+	opts    ShadowOptions
+
+	mu     sync.RWMutex // Guards closed against sends on queue
+	closed bool
+	queue  chan shadowOp
+	done   chan struct{}
+
+	mirrored    atomic.Uint64
+	dropped     atomic.Uint64
+	divergences atomic.Uint64
+	primaryTime atomic.Int64
+	shadowTime  atomic.Int64
+}
+
+var _ Cache = (*ShadowCache)(nil)
+
+// shadowOp is an operation waiting to be run on the shadow
+type shadowOp struct {
+	op      string
+	key     string
+	data    []byte        // Copy of the value for set
+	ttl     time.Duration // TTL for set, 0 for the shadow's default
+	result  string        // What the primary returned
+	elapsed time.Duration // Time the primary took
+}
+
+// NewShadowCache creates a ShadowCache serving from primary and mirroring
+// to shadow. Close it to stop mirroring; the caches are left open.
+func NewShadowCache(primary, shadow Cache, opts ShadowOptions) *ShadowCache {
+	if opts.Queue <= 0 {
+		opts.Queue = defaultShadowQueue
+	}
+	sc := &ShadowCache{
+		primary: primary,
+		shadow:  shadow,
+		opts:    opts,
+		queue:   make(chan shadowOp, opts.Queue),
+		done:    make(chan struct{}),
+	}
+	go sc.run()
+	return sc
+}
+
+// Get retrieves a cache item from the primary
+func (sc *ShadowCache) Get(key string) ([]byte, error) {
+	start := time.Now()
+	data, err := sc.primary.Get(key)
+	if sc.sampled(key) {
+		sc.mirror(shadowOp{op: "get", key: key, result: describeResult(data, err), elapsed: time.Since(start)})
+	}
+	return data, err
+}
+
+// Set adds or updates a cache item with the default TTL
+func (sc *ShadowCache) Set(key string, data []byte) error {
+	return sc.set(key, data, 0, sc.primary.Set)
+}
+
+// SetWithTTL adds or updates a cache item with the specified TTL
+func (sc *ShadowCache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return sc.set(key, data, ttl, func(key string, data []byte) error {
+		return sc.primary.SetWithTTL(key, data, ttl)
+	})
+}
+
+func (sc *ShadowCache) set(key string, data []byte, ttl time.Duration, fn func(string, []byte) error) error {
+	start := time.Now()
+	err := fn(key, data)
+	if sc.sampled(key) {
+		sc.mirror(shadowOp{op: "set", key: key, data: copyBytes(data), ttl: ttl, result: describeResult(nil, err), elapsed: time.Since(start)})
+	}
+	return err
+}
+
+// Delete removes a cache item
+func (sc *ShadowCache) Delete(key string) error {
+	start := time.Now()
+	err := sc.primary.Delete(key)
+	if sc.sampled(key) {
+		sc.mirror(shadowOp{op: "delete", key: key, result: describeResult(nil, err), elapsed: time.Since(start)})
+	}
+	return err
+}
+
+// Exists checks if a cache item exists in the primary
+func (sc *ShadowCache) Exists(key string) bool {
+	start := time.Now()
+	ok := sc.primary.Exists(key)
+	if sc.sampled(key) {
+		sc.mirror(shadowOp{op: "exists", key: key, result: strconv.FormatBool(ok), elapsed: time.Since(start)})
+	}
+	return ok
+}
+
+// PurgeExpired removes expired items from the primary, and from the
+// shadow unless nothing is mirrored
+func (sc *ShadowCache) PurgeExpired() error {
+	start := time.Now()
+	err := sc.primary.PurgeExpired()
+	if sc.opts.Rate > 0 {
+		sc.mirror(shadowOp{op: "purge", result: describeResult(nil, err), elapsed: time.Since(start)})
+	}
+	return err
+}
+
+// Stats returns what was mirrored so far
+func (sc *ShadowCache) Stats() ShadowStats {
+	return ShadowStats{
+		Mirrored:    sc.mirrored.Load(),
+		Dropped:     sc.dropped.Load(),
+		Divergences: sc.divergences.Load(),
+		PrimaryTime: time.Duration(sc.primaryTime.Load()),
+		ShadowTime:  time.Duration(sc.shadowTime.Load()),
+	}
+}
+
+// Close stops mirroring once the queued operations ran on the shadow
+func (sc *ShadowCache) Close() error {
+	sc.mu.Lock()
+	if !sc.closed {
+		sc.closed = true
+		close(sc.queue)
+	}
+	sc.mu.Unlock()
+	<-sc.done
+	return nil
+}
+
+// sampled reports whether the operations on key are mirrored
+func (sc *ShadowCache) sampled(key string) bool {
+	return float64(xxhash.Sum64String(key)%10000) < sc.opts.Rate*10000
+}
+
+// mirror queues op for the shadow, dropping it if the queue is full
+func (sc *ShadowCache) mirror(op shadowOp) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	if sc.closed {
+		return
+	}
+	select {
+	case sc.queue <- op:
+	default:
+		sc.dropped.Add(1)
+	}
+}
+
+// run repeats queued operations on the shadow and compares the results
+func (sc *ShadowCache) run() {
+	defer close(sc.done)
+	for op := range sc.queue {
+		start := time.Now()
+		var result string
+		switch op.op {
+		case "get":
+			result = describeResult(sc.shadow.Get(op.key))
+		case "exists":
+			result = strconv.FormatBool(sc.shadow.Exists(op.key))
+		case "set":
+			if op.ttl > 0 {
+				result = describeResult(nil, sc.shadow.SetWithTTL(op.key, op.data, op.ttl))
+			} else {
+				result = describeResult(nil, sc.shadow.Set(op.key, op.data))
+			}
+		case "delete":
+			result = describeResult(nil, sc.shadow.Delete(op.key))
+		case "purge":
+			result = describeResult(nil, sc.shadow.PurgeExpired())
+		}
+		sc.shadowTime.Add(int64(time.Since(start)))
+		sc.primaryTime.Add(int64(op.elapsed))
+		sc.mirrored.Add(1)
+
+		if result != op.result {
+			sc.divergences.Add(1)
+			if sc.opts.OnDivergence != nil {
+				sc.opts.OnDivergence(Divergence{Op: op.op, Key: op.key, Primary: op.result, Shadow: result})
+			}
+		}
+	}
+}
+
+// describeResult summarises the outcome of an operation for comparison
+func describeResult(data []byte, err error) string {
+	switch {
+	case err == ErrNotFound || err == ErrExpired:
+		return "miss"
+	case err != nil:
+		return err.Error()
+	case data != nil:
+		return fmt.Sprintf("%d bytes %016x", len(data), xxhash.Sum64(data))
+	default:
+		return "ok"
+	}
+}
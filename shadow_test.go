@@ -0,0 +1,76 @@
+package pie_cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShadowCache(t *testing.T) {
+	primary, _ := NewMemoryCache(time.Minute)
+	// The configuration under test rejects values over 4 bytes
+	shadow, _ := NewMemoryCache(time.Minute, WithMaxValueSize(4))
+
+	var mu sync.Mutex
+	var divergences []Divergence
+	sc := NewShadowCache(primary, shadow, ShadowOptions{Rate: 1, OnDivergence: func(d Divergence) {
+		mu.Lock()
+		divergences = append(divergences, d)
+		mu.Unlock()
+	}})
+
+	_ = sc.Set("small", []byte("abc"))
+	_ = sc.SetWithTTL("large", []byte("abcdefgh"), time.Minute)
+	if data, err := sc.Get("large"); err != nil || string(data) != "abcdefgh" {
+		t.Errorf("Expected the primary to serve, got %q, %v", data, err)
+	}
+	_, _ = sc.Get("small")
+	_ = sc.Exists("large")
+	_ = sc.Delete("small")
+	_ = sc.PurgeExpired()
+	sc.Close()
+
+	stats := sc.Stats()
+	if stats.Mirrored != 7 || stats.Dropped != 0 {
+		t.Errorf("Expected 7 mirrored operations, got %+v", stats)
+	}
+	// The failed set, and the get and exists of the value the shadow lacks
+	if stats.Divergences != 3 || len(divergences) != 3 {
+		t.Fatalf("Expected 3 divergences, got %d: %+v", stats.Divergences, divergences)
+	}
+	for i, op := range []string{"set", "get", "exists"} {
+		if d := divergences[i]; d.Op != op || d.Key != "large" {
+			t.Errorf("Expected a %s divergence for large, got %+v", op, d)
+		}
+	}
+	if divergences[1].Shadow != "miss" {
+		t.Errorf("Expected the shadow to miss, got %q", divergences[1].Shadow)
+	}
+	if stats.PrimaryTime <= 0 || stats.ShadowTime <= 0 {
+		t.Errorf("Expected latencies recorded, got %+v", stats)
+	}
+}
+
+func TestShadowCacheSampling(t *testing.T) {
+	primary, _ := NewMemoryCache(time.Minute)
+	shadow, _ := NewMemoryCache(time.Minute)
+	sc := NewShadowCache(primary, shadow, ShadowOptions{Rate: 0.25})
+
+	for i := 0; i < 1000; i++ {
+		key := "k" + strconv.Itoa(i)
+		_ = sc.Set(key, []byte("v"))
+		_, _ = sc.Get(key)
+	}
+	sc.Close()
+	_ = sc.Set("after-close", []byte("v"))
+
+	stats := sc.Stats()
+	if stats.Mirrored < 300 || stats.Mirrored > 700 {
+		t.Errorf("Expected about a quarter of the keys mirrored, got %d operations", stats.Mirrored)
+	}
+	// Sampled keys have their writes mirrored too, so their reads agree
+	if stats.Divergences != 0 {
+		t.Errorf("Expected no divergences between identical caches, got %d", stats.Divergences)
+	}
+}
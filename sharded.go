@@ -0,0 +1,297 @@
+package pie_cache
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// shardReplicas is the number of points each shard has on the hash ring
+const shardReplicas = 128
+
+// ShardedCache spreads keys over several directories, e.g. one per disk,
+// for caches that outgrow a single volume. Keys are placed by consistent
+// hashing, so adding or removing a directory moves only the keys of its
+// share of the ring. Each directory holds an ordinary FileCache. It is
+// safe for concurrent use.
+type ShardedCache struct {
+	ttl  time.Duration
+	opts []Option
+
+	mu     sync.RWMutex
+	shards map[string]*FileCache // Caches by directory
+	ring   []ringPoint           // Sorted by hash
+}
+
+// ringPoint is a point of a shard on the hash ring
+type ringPoint struct {
+	hash uint64
+	dir  string
+}
+
+// NewShardedCache creates a ShardedCache over dirs, opening a FileCache
+// with ttl and opts in each
+func NewShardedCache(dirs []string, ttl time.Duration, opts ...Option) (*ShardedCache, error) {
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("failed to create sharded cache: no directories")
+	}
+	sc := &ShardedCache{ttl: ttl, opts: opts, shards: make(map[string]*FileCache)}
+	for _, dir := range dirs {
+		if err := sc.AddShard(dir); err != nil {
+			_ = sc.Close()
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// Set adds or updates a cache item with default TTL
+func (sc *ShardedCache) Set(key string, data []byte) error {
+	return sc.SetWithTTL(key, data, sc.ttl)
+}
+
+// SetWithTTL adds or updates a cache item with specified TTL
+func (sc *ShardedCache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return sc.Shard(key).SetWithTTL(key, data, ttl)
+}
+
+// Get retrieves a cache item
+func (sc *ShardedCache) Get(key string) ([]byte, error) {
+	return sc.Shard(key).Get(key)
+}
+
+// GetString retrieves a cache item as string
+func (sc *ShardedCache) GetString(key string) (string, error) {
+	return sc.Shard(key).GetString(key)
+}
+
+// Exists checks if a cache item exists and is not expired
+func (sc *ShardedCache) Exists(key string) bool {
+	return sc.Shard(key).Exists(key)
+}
+
+// Delete removes a cache item
+func (sc *ShardedCache) Delete(key string) error {
+	return sc.Shard(key).Delete(key)
+}
+
+// Shard returns the cache holding key
+func (sc *ShardedCache) Shard(key string) *FileCache {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.shards[sc.owner(key)]
+}
+
+// ShardDir returns the directory holding key
+func (sc *ShardedCache) ShardDir(key string) string {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.owner(key)
+}
+
+// Dirs returns the directories of the shards, sorted
+func (sc *ShardedCache) Dirs() []string {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return slices.Sorted(maps.Keys(sc.shards))
+}
+
+// ShardStats returns the statistics of each shard by directory
+func (sc *ShardedCache) ShardStats() map[string]CacheStats {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	stats := make(map[string]CacheStats, len(sc.shards))
+	for dir, fc := range sc.shards {
+		stats[dir] = fc.Stats()
+	}
+	return stats
+}
+
+// ListKeys returns the keys of all shards
+func (sc *ShardedCache) ListKeys() ([]string, error) {
+	var keys []string
+	err := sc.each(func(fc *FileCache) error {
+		shardKeys, err := fc.ListKeys()
+		keys = append(keys, shardKeys...)
+		return err
+	})
+	return keys, err
+}
+
+// PurgeExpired removes all expired cache items from every shard
+func (sc *ShardedCache) PurgeExpired() error {
+	return sc.each((*FileCache).PurgeExpired)
+}
+
+// Flush writes the queued writes of every shard
+func (sc *ShardedCache) Flush() error {
+	return sc.each((*FileCache).Flush)
+}
+
+// Close closes every shard and returns the first error
+func (sc *ShardedCache) Close() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var first error
+	for _, fc := range sc.shards {
+		if err := fc.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// AddShard opens a cache in dir and gives it its share of the keys. The
+// entries of those keys stay where they are, out of reach of reads, until
+// Rebalance moves them.
+func (sc *ShardedCache) AddShard(dir string) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, ok := sc.shards[dir]; ok {
+		return fmt.Errorf("failed to add shard: %s is already a shard", dir)
+	}
+	fc, err := NewFileCache(dir, sc.ttl, sc.opts...)
+	if err != nil {
+		return err
+	}
+	sc.shards[dir] = fc
+	sc.addPoints(dir)
+	return nil
+}
+
+// RemoveShard moves the entries of the shard in dir to the shards now
+// owning their keys and closes it. The directory is left in place.
+func (sc *ShardedCache) RemoveShard(dir string) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	fc, ok := sc.shards[dir]
+	if !ok {
+		return fmt.Errorf("failed to remove shard: %s is not a shard", dir)
+	}
+	if len(sc.shards) == 1 {
+		return fmt.Errorf("failed to remove shard: %s is the last shard", dir)
+	}
+	delete(sc.shards, dir)
+	sc.ring = slices.DeleteFunc(sc.ring, func(p ringPoint) bool { return p.dir == dir })
+
+	if _, err := sc.move(fc); err != nil {
+		// Keep the shard and its entries reachable
+		sc.shards[dir] = fc
+		sc.addPoints(dir)
+		return err
+	}
+	return fc.Close()
+}
+
+// Rebalance moves entries stored on a shard other than the one owning
+// their key, e.g. after AddShard, and returns how many it moved. An entry
+// whose key was written to its new shard in the meantime is dropped in
+// favour of the newer value.
+func (sc *ShardedCache) Rebalance() (int, error) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	moved := 0
+	for _, dir := range slices.Sorted(maps.Keys(sc.shards)) {
+		n, err := sc.move(sc.shards[dir])
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// move moves the entries of src whose keys belong to other shards there
+// and returns how many it moved. The caller holds sc.mu.
+func (sc *ShardedCache) move(src *FileCache) (int, error) {
+	if err := src.Flush(); err != nil {
+		return 0, err
+	}
+	type misplaced struct {
+		name string
+		key  string
+		data []byte
+		dst  *FileCache
+	}
+	var entries []misplaced
+	err := src.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			// Reported by PurgeExpired
+			return nil
+		}
+		defer releaseItem(item)
+		if dst := sc.shards[sc.owner(item.Key)]; dst != src {
+			entries = append(entries, misplaced{name: name, key: item.Key, data: copyBytes(data), dst: dst})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, e := range entries {
+		if !e.dst.Exists(e.key) {
+			if _, err := e.dst.importEntry(e.name, e.data); err != nil {
+				return moved, err
+			}
+		}
+		if err := src.removeEntry(e.name, e.key); err != nil && err != ErrNotFound {
+			return moved, err
+		}
+		if src.hot != nil {
+			src.hot.remove(e.key)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// each calls fn on every shard and returns the first error
+func (sc *ShardedCache) each(fn func(fc *FileCache) error) error {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	var first error
+	for _, fc := range sc.shards {
+		if err := fn(fc); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// owner returns the directory of the shard owning key. The caller holds
+// sc.mu.
+func (sc *ShardedCache) owner(key string) string {
+	h := xxhash.Sum64String(key)
+	i := sort.Search(len(sc.ring), func(i int) bool { return sc.ring[i].hash >= h })
+	if i == len(sc.ring) {
+		i = 0
+	}
+	return sc.ring[i].dir
+}
+
+// addPoints puts the points of the shard in dir on the ring
+func (sc *ShardedCache) addPoints(dir string) {
+	for i := range shardReplicas {
+		sc.ring = append(sc.ring, ringPoint{hash: xxhash.Sum64String(dir + "#" + strconv.Itoa(i)), dir: dir})
+	}
+	// Ties are broken by directory so the placement does not depend on the
+	// order shards were added in
+	sort.Slice(sc.ring, func(i, j int) bool {
+		if sc.ring[i].hash != sc.ring[j].hash {
+			return sc.ring[i].hash < sc.ring[j].hash
+		}
+		return sc.ring[i].dir < sc.ring[j].dir
+	})
+}
@@ -0,0 +1,90 @@
+package pie_cache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShardedCache(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sharded_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	dir := func(name string) string { return filepath.Join(tempDir, name) }
+
+	cache, err := NewShardedCache([]string{dir("a"), dir("b")}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	const n = 200
+	for i := range n {
+		key := "key" + strconv.Itoa(i)
+		if err := cache.Set(key, []byte(key)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	stats := cache.ShardStats()
+	if len(stats) != 2 || stats[dir("a")].Sets == 0 || stats[dir("b")].Sets == 0 {
+		t.Errorf("Expected writes spread over both shards, got %+v", stats)
+	}
+	if stats[dir("a")].Sets+stats[dir("b")].Sets != n {
+		t.Errorf("Expected %d writes in total, got %+v", n, stats)
+	}
+
+	// Adding a shard moves only the keys it takes over
+	owners := make(map[string]string)
+	for i := range n {
+		key := "key" + strconv.Itoa(i)
+		owners[key] = cache.ShardDir(key)
+	}
+	if err := cache.AddShard(dir("c")); err != nil {
+		t.Fatalf("AddShard failed: %v", err)
+	}
+	taken := 0
+	for key, owner := range owners {
+		if now := cache.ShardDir(key); now != owner {
+			if now != dir("c") {
+				t.Errorf("Key %q moved from %s to %s", key, owner, now)
+			}
+			taken++
+		}
+	}
+	if taken == 0 || taken == n {
+		t.Errorf("Expected the new shard to take some keys, took %d", taken)
+	}
+
+	moved, err := cache.Rebalance()
+	if err != nil || moved != taken {
+		t.Errorf("Expected %d entries moved, got %d, %v", taken, moved, err)
+	}
+	for key := range owners {
+		if data, err := cache.Get(key); err != nil || string(data) != key {
+			t.Errorf("Get(%q) returned %q, %v after Rebalance", key, data, err)
+		}
+	}
+
+	if err := cache.RemoveShard(dir("a")); err != nil {
+		t.Fatalf("RemoveShard failed: %v", err)
+	}
+	if dirs := cache.Dirs(); len(dirs) != 2 || dirs[0] != dir("b") || dirs[1] != dir("c") {
+		t.Errorf("Unexpected shards %v", dirs)
+	}
+	keys, err := cache.ListKeys()
+	if err != nil || len(keys) != n {
+		t.Errorf("Expected %d keys after RemoveShard, got %d, %v", n, len(keys), err)
+	}
+	for key := range owners {
+		if data, err := cache.Get(key); err != nil || string(data) != key {
+			t.Errorf("Get(%q) returned %q, %v after RemoveShard", key, data, err)
+		}
+	}
+	if err := cache.RemoveShard(dir("a")); err == nil {
+		t.Error("Expected removing a missing shard to fail")
+	}
+}
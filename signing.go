@@ -0,0 +1,170 @@
+package pie_cache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// ErrInvalidSignature is returned by Get when signing is enabled and an
+// entry is unsigned or its signature does not match its contents
+var ErrInvalidSignature = errors.New("cache signature invalid")
+
+// WithSigningKey signs every written entry with HMAC-SHA256 under secret and
+// rejects entries on read whose signature is missing or wrong. Use it when
+// the cache directory is writable by processes that must not be able to
+// inject values into this consumer.
+func WithSigningKey(secret []byte) Option {
+	return func(fc *FileCache) {
+		fc.signingKey = copyBytes(secret)
+	}
+}
+
+// signature computes the HMAC of every persisted field of item
+func (fc *FileCache) signature(item *CacheItem) string {
+	d := newPayloadDigest()
+	d.Write(item.Data)
+	return fc.sealSignature(d, item)
+}
+
+// payloadDigest hashes a payload for its signature. The payload enters
+// the MAC as its length and digest, so no bytes can be moved between it
+// and the fields, and streamed payloads of unknown size can be signed.
+type payloadDigest struct {
+	hash.Hash
+	n int64
+}
+
+func newPayloadDigest() *payloadDigest {
+	return &payloadDigest{Hash: sha256.New()}
+}
+
+func (d *payloadDigest) Write(p []byte) (int, error) {
+	d.n += int64(len(p))
+	return d.Hash.Write(p)
+}
+
+// sealSignature returns the signature of item, whose payload went into d
+func (fc *FileCache) sealSignature(d *payloadDigest, item *CacheItem) string {
+	w := sigWriter{Hash: hmac.New(sha256.New, fc.signingKey)}
+	w.bytes('k', []byte(item.Key))
+	w.int('c', item.Created.UnixNano())
+	w.int('x', item.ExpireAt.UnixNano())
+	w.int('n', d.n)
+	w.bytes('d', d.Sum(nil))
+	// Optional fields are tagged, so leaving one out cannot be confused
+	// with another
+	if item.Group != "" {
+		w.bytes('g', []byte(item.Group))
+		w.int('e', item.Epoch)
+	}
+	if !item.Deadline.IsZero() {
+		w.int('l', item.Deadline.UnixNano())
+	}
+	if len(item.Tags) > 0 {
+		w.int('t', int64(len(item.Tags)))
+		for _, tag := range item.Tags {
+			w.bytes('T', []byte(tag))
+		}
+	}
+	if item.Priority != 0 {
+		w.int('p', int64(item.Priority))
+	}
+	if item.Encoding != "" {
+		w.bytes('E', []byte(item.Encoding))
+	}
+	if item.Checksum != "" {
+		w.bytes('s', []byte(item.Checksum))
+	}
+	if item.Cost != 0 {
+		w.int('C', int64(math.Float64bits(item.Cost)))
+	}
+	if len(item.Segments) > 0 {
+		w.int('S', int64(len(item.Segments)))
+		for _, n := range item.Segments {
+			w.int('N', int64(n))
+		}
+	}
+	if p := item.Provenance; p != nil {
+		w.bytes('v', []byte(p.Caller))
+		w.bytes('f', []byte(p.File))
+		w.bytes('h', []byte(p.Host))
+		w.int('i', int64(p.PID))
+	}
+	return hex.EncodeToString(w.Sum(nil))
+}
+
+// sigWriter writes fields into a MAC as tag, length and value
+type sigWriter struct {
+	hash.Hash
+}
+
+func (w sigWriter) bytes(tag byte, b []byte) {
+	var buf [9]byte
+	buf[0] = tag
+	binary.BigEndian.PutUint64(buf[1:], uint64(len(b)))
+	w.Write(buf[:])
+	w.Write(b)
+}
+
+func (w sigWriter) int(tag byte, v int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	w.bytes(tag, buf[:])
+}
+
+// sign stores the signature of item in it when signing is enabled
+func (fc *FileCache) sign(item *CacheItem) {
+	if fc.signingKey != nil {
+		item.Signature = fc.signature(item)
+	}
+}
+
+// verify checks the signature of item when signing is enabled
+func (fc *FileCache) verify(item *CacheItem) error {
+	if fc.signingKey == nil {
+		return nil
+	}
+	if item.Signature == "" || !hmac.Equal([]byte(item.Signature), []byte(fc.signature(item))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// verifyStream checks the signature and checksum of an item whose payload
+// is read from r, as verify and verifyChecksum do, in a single pass. The
+// checksum of an encoded payload is left to the reader decoding it.
+func (fc *FileCache) verifyStream(item *CacheItem, r io.Reader) error {
+	var digest *payloadDigest
+	var sum hash.Hash32
+	var dsts []io.Writer
+	if fc.signingKey != nil {
+		digest = newPayloadDigest()
+		dsts = append(dsts, digest)
+	}
+	if fc.checksum && item.Checksum != "" && item.Encoding == "" {
+		sum = crc32.New(checksumTable)
+		dsts = append(dsts, sum)
+	}
+	if len(dsts) == 0 {
+		return nil
+	}
+
+	if _, err := io.Copy(io.MultiWriter(dsts...), r); err != nil {
+		return fmt.Errorf("failed to read cache file: %v", err)
+	}
+	if digest != nil && (item.Signature == "" || !hmac.Equal([]byte(item.Signature), []byte(fc.sealSignature(digest, item)))) {
+		return ErrInvalidSignature
+	}
+	if sum != nil && formatChecksum(sum.Sum32()) != item.Checksum {
+		return ErrCorrupted
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package pie_cache
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSigning(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_signing")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	secret := []byte("shared secret")
+	signed, _ := NewFileCache(tempDir, time.Minute, WithSigningKey(secret))
+	forger, _ := NewFileCache(tempDir, time.Minute)
+	wrongKey, _ := NewFileCache(tempDir, time.Minute, WithSigningKey([]byte("other")))
+
+	if err := signed.Set("k", []byte("genuine")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := signed.GetString("k"); err != nil || got != "genuine" {
+		t.Fatalf("Expected signed entry to verify, got %q, %v", got, err)
+	}
+	if _, err := wrongKey.Get("k"); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature with wrong key, got %v", err)
+	}
+
+	// Tampering with the payload invalidates the signature
+	item := readItem(t, signed, "k")
+	item.Data = []byte("forged")
+	raw, _ := json.Marshal(item)
+	filePath, _ := signed.getFilePath("k")
+	_ = os.WriteFile(filePath, raw, 0644)
+	if _, err := signed.Get("k"); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature after tampering, got %v", err)
+	}
+
+	// Unsigned entries are rejected
+	_ = forger.Set("k", []byte("forged"))
+	if _, err := signed.Get("k"); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for unsigned entry, got %v", err)
+	}
+}
+
+func TestSignatureFieldShift(t *testing.T) {
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithSigningKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	now := time.Now()
+	item := CacheItem{Key: "k", Data: []byte("value"), Created: now, ExpireAt: now.Add(time.Minute), Group: "g", Epoch: 1}
+	cache.sign(&item)
+
+	// Moving the group into the payload must not keep the signature valid,
+	// or entries could escape group invalidation
+	forged := item
+	forged.Data = append([]byte("value"), 0, 0, 0, 0, 0, 0, 0, 1, 'g', 0, 0, 0, 0, 0, 0, 0, 1)
+	forged.Group, forged.Epoch = "", 0
+	if err := cache.verify(&forged); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for a shifted group, got %v", err)
+	}
+	if err := cache.verify(&item); err != nil {
+		t.Errorf("Expected the genuine item to verify, got %v", err)
+	}
+}
+
+func TestSignatureCoversFields(t *testing.T) {
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithSigningKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	now := time.Now()
+	genuine := func() CacheItem {
+		item := CacheItem{Key: "k", Data: []byte("value"), Created: now, ExpireAt: now.Add(time.Minute),
+			Group: "g", Epoch: 1, Encoding: "gzip", Checksum: "0000abcd", Deadline: now.Add(time.Hour),
+			Cost: 5, Segments: []int{2, 3}, Tags: []string{"a", "b"}, Priority: PriorityHigh,
+			Provenance: &Provenance{Caller: "main.main", File: "main.go:1", Host: "h", PID: 1}}
+		cache.sign(&item)
+		return item
+	}
+
+	forgeries := map[string]func(item *CacheItem){
+		"key":        func(item *CacheItem) { item.Key = "other" },
+		"data":       func(item *CacheItem) { item.Data = []byte("forged") },
+		"created":    func(item *CacheItem) { item.Created = now.Add(time.Second) },
+		"expiry":     func(item *CacheItem) { item.ExpireAt = now.Add(time.Hour) },
+		"group":      func(item *CacheItem) { item.Group = "" },
+		"epoch":      func(item *CacheItem) { item.Epoch = 2 },
+		"encoding":   func(item *CacheItem) { item.Encoding = "" },
+		"checksum":   func(item *CacheItem) { item.Checksum = "" },
+		"cost":       func(item *CacheItem) { item.Cost = 500 },
+		"segments":   func(item *CacheItem) { item.Segments = []int{1, 4} },
+		"tags":       func(item *CacheItem) { item.Tags = []string{"ab"} },
+		"provenance": func(item *CacheItem) { item.Provenance.Host = "other" },
+		// The deadline and the priority are both integers; swapping one for
+		// the other must not keep the signature valid
+		"deadline": func(item *CacheItem) {
+			item.Priority = Priority(item.Deadline.UnixNano())
+			item.Deadline = time.Time{}
+		},
+		"priority": func(item *CacheItem) { item.Priority = PriorityLow },
+	}
+	for name, forge := range forgeries {
+		item := genuine()
+		if err := cache.verify(&item); err != nil {
+			t.Fatalf("Expected the genuine item to verify, got %v", err)
+		}
+		forge(&item)
+		if err := cache.verify(&item); err != ErrInvalidSignature {
+			t.Errorf("Expected ErrInvalidSignature after forging the %s, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package pie_cache
+
+import "time"
+
+// SplitWrites selects the layer of a SplitStore that receives writes
+type SplitWrites int
+
+const (
+	// WriteLocal writes to the local layer only, like an edge cache in
+	// front of a shared origin
+	WriteLocal SplitWrites = iota
+	// WriteShared writes to the shared layer only, leaving the local one to
+	// be filled by other means, such as piecache sync
+	WriteShared
+)
+
+// SplitStore reads entries from a fast local store and falls back to a
+// slower shared one, while writes and removals go to one of them only. The
+// other layer is never modified. Bookkeeping such as the key index is kept
+// in the written layer; the layout manifest is read from either, so that a
+// local layer follows the layout of the shared one.
+type SplitStore struct {
+	local, shared Store
+	writes        SplitWrites
+}
+
+// NewSplitStore creates a SplitStore over local and shared
+func NewSplitStore(local, shared Store, writes SplitWrites) *SplitStore {
+	return &SplitStore{local: local, shared: shared, writes: writes}
+}
+
+// target returns the layer written to and the other one
+func (s *SplitStore) target() (Store, Store) {
+	if s.writes == WriteShared {
+		return s.shared, s.local
+	}
+	return s.local, s.shared
+}
+
+// Put implements Store
+func (s *SplitStore) Put(name string, data []byte) error {
+	target, _ := s.target()
+	return target.Put(name, data)
+}
+
+// Append implements AppendStore
+func (s *SplitStore) Append(name string, data []byte) error {
+	target, _ := s.target()
+	return appendTo(target, name, data)
+}
+
+// Lease implements LeaseStore on the written layer. If that layer has no
+// leases, every lease is granted.
+func (s *SplitStore) Lease(name string, ttl time.Duration) (func(), bool, error) {
+	target, _ := s.target()
+	if ls, ok := target.(LeaseStore); ok {
+		return ls.Lease(name, ttl)
+	}
+	return func() {}, true, nil
+}
+
+// Fetch implements Store, looking in the local layer first
+func (s *SplitStore) Fetch(name string) ([]byte, error) {
+	if isMetaName(name) && name != layoutName {
+		target, _ := s.target()
+		return target.Fetch(name)
+	}
+	data, err := s.local.Fetch(name)
+	if err != ErrNotFound {
+		return data, err
+	}
+	return s.shared.Fetch(name)
+}
+
+// Remove implements Store. Only the written layer is touched, so an entry
+// held by the other layer alone reports ErrNotFound.
+func (s *SplitStore) Remove(name string) error {
+	target, _ := s.target()
+	return target.Remove(name)
+}
+
+// splitEntry is an entry produced by one layer during a SplitStore walk
+type splitEntry struct {
+	name string
+	data []byte
+}
+
+// Walk implements Store. The walks of both layers are merged in lexical
+// order; an entry in both is reported once, with the local data.
+// Bookkeeping entries of the layer not written to are skipped.
+func (s *SplitStore) Walk(prefix string, fn func(name string, data []byte) error) error {
+	stop := make(chan struct{})
+	local, localErr := s.walkLayer(s.local, s.writes == WriteLocal, prefix, stop)
+	shared, sharedErr := s.walkLayer(s.shared, s.writes == WriteShared, prefix, stop)
+
+	var err error
+	l, lok := <-local
+	r, rok := <-shared
+	for err == nil && (lok || rok) {
+		switch {
+		case lok && (!rok || l.name <= r.name):
+			if rok && l.name == r.name {
+				r, rok = <-shared
+			}
+			err = fn(l.name, l.data)
+			l, lok = <-local
+		default:
+			err = fn(r.name, r.data)
+			r, rok = <-shared
+		}
+	}
+	close(stop)
+	// Let the walks see the stop and finish
+	for range local {
+	}
+	for range shared {
+	}
+
+	if err != nil {
+		return err
+	}
+	if err := <-localErr; err != nil {
+		return err
+	}
+	return <-sharedErr
+}
+
+// walkLayer walks layer in the background, sending its entries until stop
+// is closed. written tells whether the layer is the one written to.
+func (s *SplitStore) walkLayer(layer Store, written bool, prefix string, stop <-chan struct{}) (<-chan splitEntry, <-chan error) {
+	entries := make(chan splitEntry)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(entries)
+		err := layer.Walk(prefix, func(name string, data []byte) error {
+			if !written && isMetaName(name) {
+				return nil
+			}
+			select {
+			case entries <- splitEntry{name: name, data: data}:
+				return nil
+			case <-stop:
+				return errStopWalk
+			}
+		})
+		if err == errStopWalk {
+			err = nil
+		}
+		errc <- err
+	}()
+	return entries, errc
+}
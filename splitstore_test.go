@@ -0,0 +1,94 @@
+package pie_cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSplitStore(t *testing.T) {
+	local, shared := NewMemoryStore(), NewMemoryStore()
+	_ = local.Put("a", []byte("local"))
+	_ = local.Put("c", []byte("local"))
+	_ = shared.Put("a", []byte("shared"))
+	_ = shared.Put("b", []byte("shared"))
+	_ = shared.Put(indexMetaName, []byte("1"))
+
+	s := NewSplitStore(local, shared, WriteLocal)
+	if data, _ := s.Fetch("a"); string(data) != "local" {
+		t.Errorf("Expected the local entry to win, got %q", data)
+	}
+	if data, _ := s.Fetch("b"); string(data) != "shared" {
+		t.Errorf("Expected to fall back to the shared entry, got %q", data)
+	}
+	if _, err := s.Fetch(indexMetaName); err != ErrNotFound {
+		t.Errorf("Expected bookkeeping of the shared layer to be hidden, got %v", err)
+	}
+
+	var names, values []string
+	err := s.Walk("", func(name string, data []byte) error {
+		names = append(names, name)
+		values = append(values, string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" || values[0] != "local" {
+		t.Errorf("Expected merged walk a, b, c with local a, got %v %v", names, values)
+	}
+
+	// An error from fn stops both walks
+	stop := errors.New("stop")
+	calls := 0
+	if err := s.Walk("", func(string, []byte) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Errorf("Expected the walk to stop after 1 call, got %v after %d", err, calls)
+	}
+
+	_ = s.Put("d", []byte("new"))
+	if _, err := shared.Fetch("d"); err != ErrNotFound {
+		t.Errorf("Expected the shared layer to stay untouched, got %v", err)
+	}
+	if err := s.Remove("b"); err != ErrNotFound {
+		t.Errorf("Expected removing a shared-only entry to report ErrNotFound, got %v", err)
+	}
+
+	s = NewSplitStore(local, shared, WriteShared)
+	_ = s.Put("e", []byte("new"))
+	if _, err := local.Fetch("e"); err != ErrNotFound {
+		t.Errorf("Expected the local layer to stay untouched, got %v", err)
+	}
+}
+
+func TestSplitStoreCache(t *testing.T) {
+	local, shared := NewMemoryStore(), NewMemoryStore()
+	origin, err := NewWithStore(shared, time.Minute, WithPathScheme(1, 2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = origin.Set("page", []byte("origin"))
+
+	// The edge follows the layout recorded by the origin
+	edge, err := NewWithStore(NewSplitStore(local, shared, WriteLocal), time.Minute,
+		WithPathScheme(1, 2), WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to create edge cache: %v", err)
+	}
+	if v, err := edge.GetString("page"); err != nil || v != "origin" {
+		t.Errorf("Expected the origin value, got %q, %v", v, err)
+	}
+	_ = edge.Set("page", []byte("edge"))
+	if v, _ := edge.GetString("page"); v != "edge" {
+		t.Errorf("Expected the edge value, got %q", v)
+	}
+	if v, _ := origin.GetString("page"); v != "origin" {
+		t.Errorf("Expected the origin to be unchanged, got %q", v)
+	}
+	if keys, _ := edge.ListKeys(); len(keys) != 1 {
+		t.Errorf("Expected 1 key, got %v", keys)
+	}
+
+	if _, err := NewWithStore(NewSplitStore(NewMemoryStore(), shared, WriteLocal), time.Minute); err != ErrLayoutMismatch {
+		t.Errorf("Expected an edge with another layout to be refused, got %v", err)
+	}
+}
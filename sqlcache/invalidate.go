@@ -0,0 +1,87 @@
+package sqlcache
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ser163/pie_cache"
+)
+
+// Invalidator drops the cache entries derived from a table when the table
+// is written to. Map each table to the key prefixes and invalidation
+// groups holding data read from it, then call InvalidateTable from the
+// write hooks of an ORM or the code around sqlc queries. Table names are
+// matched case-insensitively. It is safe for concurrent use.
+type Invalidator struct {
+	cache *pie_cache.FileCache
+
+	mu       sync.RWMutex
+	prefixes map[string][]string // Key prefixes by table
+	groups   map[string][]string // Invalidation groups by table
+}
+
+// NewInvalidator creates an Invalidator for cache with no tables mapped
+func NewInvalidator(cache *pie_cache.FileCache) *Invalidator {
+	return &Invalidator{
+		cache:    cache,
+		prefixes: make(map[string][]string),
+		groups:   make(map[string][]string),
+	}
+}
+
+// MapPrefix makes InvalidateTable(table) delete the entries whose keys
+// start with prefix. Mapping a table to KeyPrefix drops every result
+// cached by CachedQuery.
+func (inv *Invalidator) MapPrefix(table, prefix string) *Invalidator {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	table = strings.ToLower(table)
+	inv.prefixes[table] = append(inv.prefixes[table], prefix)
+	return inv
+}
+
+// MapGroup makes InvalidateTable(table) invalidate the invalidation group
+// called group, see pie_cache.FileCache.Group
+func (inv *Invalidator) MapGroup(table, group string) *Invalidator {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	table = strings.ToLower(table)
+	inv.groups[table] = append(inv.groups[table], group)
+	return inv
+}
+
+// InvalidateTable drops the entries mapped to table. It goes through every
+// mapping even if one fails and returns the first error. Tables without
+// mappings are ignored.
+func (inv *Invalidator) InvalidateTable(table string) error {
+	inv.mu.RLock()
+	table = strings.ToLower(table)
+	prefixes := inv.prefixes[table]
+	groups := inv.groups[table]
+	inv.mu.RUnlock()
+
+	var first error
+	for _, prefix := range prefixes {
+		if _, err := inv.cache.DeleteByPrefix(prefix); err != nil && first == nil {
+			first = err
+		}
+	}
+	for _, group := range groups {
+		if err := inv.cache.Group(group).Invalidate(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// InvalidateTables calls InvalidateTable for each of tables, for writes
+// touching several
+func (inv *Invalidator) InvalidateTables(tables ...string) error {
+	var first error
+	for _, table := range tables {
+		if err := inv.InvalidateTable(table); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
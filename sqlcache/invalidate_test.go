@@ -0,0 +1,44 @@
+package sqlcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+func TestInvalidator(t *testing.T) {
+	cache, err := pie_cache.NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	_ = cache.Set("user:1", []byte("ann"))
+	_ = cache.Set("user:2", []byte("bob"))
+	_ = cache.Set("order:1", []byte("o"))
+	_ = cache.Group("dashboard").Set("summary", []byte("2 users"))
+
+	inv := NewInvalidator(cache).
+		MapPrefix("users", "user:").
+		MapGroup("users", "dashboard").
+		MapPrefix("orders", "order:")
+	if err := inv.InvalidateTable("Users"); err != nil {
+		t.Fatalf("InvalidateTable failed: %v", err)
+	}
+	for _, key := range []string{"user:1", "user:2", "summary"} {
+		if _, err := cache.Get(key); err == nil {
+			t.Errorf("Expected %q invalidated", key)
+		}
+	}
+	if !cache.Exists("order:1") {
+		t.Error("Expected entries of other tables kept")
+	}
+
+	if err := inv.InvalidateTables("orders", "unmapped"); err != nil {
+		t.Fatalf("InvalidateTables failed: %v", err)
+	}
+	if cache.Exists("order:1") {
+		t.Error("Expected order:1 invalidated")
+	}
+}
@@ -0,0 +1,176 @@
+// Package sqlcache caches the results of database/sql queries in a
+// pie_cache.FileCache, for the cache-aside pattern without hand-written
+// keys or encoding.
+//
+// Results are keyed by the query, with runs of whitespace outside string
+// literals collapsed, and its arguments, so the same query with the same
+// arguments is read from the cache until its entry expires. Rows are
+// stored as JSON arrays of the struct type they are scanned into.
+// Invalidator maps tables to the entries to drop when they are written.
+package sqlcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// KeyPrefix starts the keys of cached query results, so they can be
+// removed with DeleteByPrefix
+const KeyPrefix = "sql:"
+
+// Querier runs queries. *sql.DB, *sql.Tx and *sql.Conn implement it.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// CachedQuery returns the rows of query run with args on db, scanned into
+// values of T, from cache when they were stored there less than ttl ago.
+// T is a struct whose fields receive the columns named by their `db` tag
+// or, without one, matching their name case-insensitively; columns
+// without a field are skipped. For queries of a single column T may also
+// be a scalar type such as string or int64. Concurrent calls for the same
+// query share one run, see pie_cache.FileCache.GetOrLoad.
+func CachedQuery[T any](ctx context.Context, cache *pie_cache.FileCache, db Querier, ttl time.Duration, query string, args ...any) ([]T, error) {
+	key, err := Key(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	data, err := cache.GetOrLoad(key, func(string) ([]byte, time.Duration, error) {
+		rows, err := queryRows[T](ctx, db, query, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		data, err := json.Marshal(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to encode rows: %v", err)
+		}
+		return data, ttl, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []T
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode cached rows: %v", err)
+	}
+	return rows, nil
+}
+
+// Key returns the cache key CachedQuery uses for query and args, e.g. to
+// delete the entry after a write the result depends on
+func Key(query string, args ...any) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(normalize(query)))
+	for _, arg := range args {
+		if v, ok := arg.(sql.NamedArg); ok {
+			fmt.Fprintf(h, "\x00@%s", v.Name)
+			arg = v.Value
+		}
+		encoded, err := json.Marshal(arg)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode query argument: %v", err)
+		}
+		fmt.Fprintf(h, "\x00%T\x00%s", arg, encoded)
+	}
+	return KeyPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalize collapses runs of whitespace outside quoted literals and
+// identifiers into single spaces and trims trailing semicolons
+func normalize(query string) string {
+	var b strings.Builder
+	var quote rune
+	space := false
+	for _, r := range strings.TrimSpace(query) {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimRight(b.String(), "; ")
+}
+
+// queryRows runs query and scans its rows into values of T
+func queryRows[T any](ctx context.Context, db Querier, query string, args ...any) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []T{}
+	for rows.Next() {
+		var v T
+		dest, err := scanTargets(reflect.ValueOf(&v).Elem(), columns)
+		if err != nil {
+			return nil, err
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+// scanTargets returns the pointers rows.Scan stores columns into for v
+func scanTargets(v reflect.Value, columns []string) ([]any, error) {
+	if v.Kind() != reflect.Struct || v.Type().ConvertibleTo(reflect.TypeOf(time.Time{})) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("failed to scan %d columns into %s", len(columns), v.Type())
+		}
+		return []any{v.Addr().Interface()}, nil
+	}
+
+	fields := make(map[string]int)
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("db")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = i
+	}
+	dest := make([]any, len(columns))
+	for i, column := range columns {
+		if j, ok := fields[strings.ToLower(column)]; ok {
+			dest[i] = v.Field(j).Addr().Interface()
+		} else {
+			dest[i] = new(any)
+		}
+	}
+	return dest, nil
+}
@@ -0,0 +1,117 @@
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ser163/pie_cache"
+)
+
+// fakeDriver answers every query with the same users and counts queries
+type fakeDriver struct {
+	queries atomic.Int32
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d: d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return &fakeStmt{d: c.d}, nil }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type fakeStmt struct{ d *fakeDriver }
+
+func (s *fakeStmt) Close() error                               { return nil }
+func (s *fakeStmt) NumInput() int                              { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.queries.Add(1)
+	return &fakeRows{values: [][]driver.Value{{int64(1), "ann", "x"}, {int64(2), "bob", "y"}}}, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "user_name", "extra"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+type user struct {
+	ID   int64
+	Name string `db:"user_name"`
+}
+
+var fake = &fakeDriver{}
+
+func init() {
+	sql.Register("sqlcache_fake", fake)
+}
+
+func TestCachedQuery(t *testing.T) {
+	db, err := sql.Open("sqlcache_fake", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	cache, err := pie_cache.NewMemoryCache(time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	ctx := context.Background()
+	before := fake.queries.Load()
+	for _, query := range []string{"SELECT id, user_name FROM users WHERE age > ?", "SELECT id,  user_name\n\tFROM users WHERE age > ?;"} {
+		users, err := CachedQuery[user](ctx, cache, db, time.Minute, query, 30)
+		if err != nil {
+			t.Fatalf("CachedQuery failed: %v", err)
+		}
+		if len(users) != 2 || users[0] != (user{1, "ann"}) || users[1] != (user{2, "bob"}) {
+			t.Errorf("Unexpected rows %+v", users)
+		}
+	}
+	if n := fake.queries.Load() - before; n != 1 {
+		t.Errorf("Expected 1 query for equivalent SQL, got %d", n)
+	}
+
+	if _, err := CachedQuery[user](ctx, cache, db, time.Minute, "SELECT id, user_name FROM users WHERE age > ?", 40); err != nil {
+		t.Fatalf("CachedQuery failed: %v", err)
+	}
+	if n := fake.queries.Load() - before; n != 2 {
+		t.Errorf("Expected other arguments to run the query, got %d queries", n)
+	}
+
+	if _, err := CachedQuery[int64](ctx, cache, db, time.Minute, "SELECT id, user_name, extra FROM users"); err == nil {
+		t.Error("Expected scanning several columns into a scalar to fail")
+	}
+}
+
+func TestKey(t *testing.T) {
+	a, _ := Key("SELECT * FROM t WHERE name = 'a  b'", 1)
+	b, _ := Key("SELECT  *  FROM t WHERE name = 'a  b' ;", 1)
+	c, _ := Key("SELECT * FROM t WHERE name = 'a b'", 1)
+	d, _ := Key("SELECT * FROM t WHERE name = 'a  b'", "1")
+	if a != b {
+		t.Error("Expected whitespace outside literals to be ignored")
+	}
+	if a == c {
+		t.Error("Expected whitespace inside literals to matter")
+	}
+	if a == d {
+		t.Error("Expected argument types to matter")
+	}
+}
@@ -0,0 +1,135 @@
+package pie_cache
+
+import (
+	"sync"
+	"time"
+)
+
+// StampedeKind tells what kind of stampede was detected
+type StampedeKind int
+
+const (
+	// StampedeConcurrent is many callers waiting for one load of a key
+	StampedeConcurrent StampedeKind = iota
+	// StampedeRepeated is a key loaded again and again within a short
+	// window, typically because its TTL is too short for its read rate
+	StampedeRepeated
+)
+
+// String returns the kind name
+func (k StampedeKind) String() string {
+	if k == StampedeRepeated {
+		return "repeated"
+	}
+	return "concurrent"
+}
+
+// Stampede describes a key whose loads look like a cache stampede
+type Stampede struct {
+	Key   string
+	Kind  StampedeKind
+	Count int       // Callers of the load, or loads within the window
+	Time  time.Time // When it was detected
+}
+
+// StampedePolicy sets the thresholds of stampede detection
+type StampedePolicy struct {
+	Concurrent int           // Callers sharing one load that make a stampede, default 10
+	Repeated   int           // Loads of a key within Window that make a stampede, default 5
+	Window     time.Duration // Default 1 minute
+}
+
+// WithStampedeDetection watches GetOrLoad, loaders registered for Get and
+// refresh-ahead for stampedes: many callers waiting on one load of a key,
+// or a key loaded over and over. Each one found is counted in
+// CacheStats.Stampedes and passed to hook, if not nil, so operators can
+// add jitter or spread keys before it becomes an incident. hook is called
+// inline and should return quickly.
+func WithStampedeDetection(p StampedePolicy, hook func(Stampede)) Option {
+	return func(fc *FileCache) {
+		if p.Concurrent < 2 {
+			p.Concurrent = 10
+		}
+		if p.Repeated < 2 {
+			p.Repeated = 5
+		}
+		if p.Window <= 0 {
+			p.Window = time.Minute
+		}
+		fc.stampedes = &stampedeDetector{
+			policy:  p,
+			hook:    hook,
+			waiting: make(map[string]int),
+			loads:   make(map[string][]time.Time),
+		}
+	}
+}
+
+// stampedeDetector tracks loads per key
+type stampedeDetector struct {
+	policy StampedePolicy
+	hook   func(Stampede)
+
+	mu        sync.Mutex
+	waiting   map[string]int         // Callers waiting for the load of a key
+	loads     map[string][]time.Time // Recent load times of a key
+	lastSweep time.Time
+}
+
+// join counts a caller about to wait for the load of key
+func (d *stampedeDetector) join(key string) {
+	d.mu.Lock()
+	d.waiting[key]++
+	d.mu.Unlock()
+}
+
+// finish ends the load of key, returning the stampede it was part of, if
+// any
+func (d *stampedeDetector) finish(key string, now time.Time) (Stampede, bool) {
+	d.mu.Lock()
+	n := d.waiting[key]
+	delete(d.waiting, key)
+	d.mu.Unlock()
+	if n < d.policy.Concurrent {
+		return Stampede{}, false
+	}
+	return Stampede{Key: key, Kind: StampedeConcurrent, Count: n, Time: now}, true
+}
+
+// loaded records a load of key, returning a stampede if the key was loaded
+// too often within the window
+func (d *stampedeDetector) loaded(key string, now time.Time) (Stampede, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Forget keys not loaded recently, so one-off loads do not pile up
+	if now.Sub(d.lastSweep) > d.policy.Window {
+		for k, times := range d.loads {
+			if now.Sub(times[len(times)-1]) > d.policy.Window {
+				delete(d.loads, k)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	times := d.loads[key]
+	for len(times) > 0 && now.Sub(times[0]) > d.policy.Window {
+		times = times[1:]
+	}
+	times = append(times, now)
+	if len(times) < d.policy.Repeated {
+		d.loads[key] = times
+		return Stampede{}, false
+	}
+	// Report once per burst
+	delete(d.loads, key)
+	return Stampede{Key: key, Kind: StampedeRepeated, Count: len(times), Time: now}, true
+}
+
+// reportStampede counts s and passes it to the hook
+func (fc *FileCache) reportStampede(s Stampede) {
+	fc.stats.stampedes.Add(1)
+	if fc.stampedes.hook != nil {
+		fc.stampedes.hook(s)
+	}
+}
@@ -0,0 +1,82 @@
+package pie_cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStampedeDetection(t *testing.T) {
+	var mu sync.Mutex
+	var found []Stampede
+	hook := func(s Stampede) {
+		mu.Lock()
+		found = append(found, s)
+		mu.Unlock()
+	}
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute,
+		WithStampedeDetection(StampedePolicy{Concurrent: 3, Repeated: 3, Window: time.Minute}, hook))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	// Callers piling up behind one slow load
+	release := make(chan struct{})
+	slow := func(string) ([]byte, time.Duration, error) {
+		<-release
+		return []byte("v"), 0, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cache.GetOrLoad("hot", slow)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// A key that keeps expiring and being loaded again
+	quick := func(string) ([]byte, time.Duration, error) {
+		return []byte("v"), time.Nanosecond, nil
+	}
+	for i := 0; i < 3; i++ {
+		_, _ = cache.GetOrLoad("flappy", quick)
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(found) != 2 {
+		t.Fatalf("Expected 2 stampedes, got %+v", found)
+	}
+	if s := found[0]; s.Key != "hot" || s.Kind != StampedeConcurrent || s.Count != 5 {
+		t.Errorf("Unexpected concurrent stampede %+v", s)
+	}
+	if s := found[1]; s.Key != "flappy" || s.Kind != StampedeRepeated || s.Count != 3 {
+		t.Errorf("Unexpected repeated stampede %+v", s)
+	}
+	if n := cache.Stats().Stampedes; n != 2 {
+		t.Errorf("Expected 2 stampedes counted, got %d", n)
+	}
+}
+
+func TestStampedeDetectorSweep(t *testing.T) {
+	d := &stampedeDetector{
+		policy: StampedePolicy{Repeated: 2, Window: time.Second},
+		loads:  make(map[string][]time.Time),
+	}
+	now := time.Now()
+	d.loaded("old", now)
+	if _, ok := d.loaded("other", now.Add(2*time.Second)); ok {
+		t.Error("Expected no stampede for a single load")
+	}
+	if _, ok := d.loads["old"]; ok {
+		t.Error("Expected keys outside the window to be forgotten")
+	}
+	if _, ok := d.loaded("other", now.Add(2500*time.Millisecond)); !ok {
+		t.Error("Expected a stampede for two loads within the window")
+	}
+}
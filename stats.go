@@ -0,0 +1,177 @@
+package pie_cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats is a snapshot of the cache's operation counters
+type CacheStats struct {
+	Hits         int64 `json:"hits"`         // Get calls that returned data
+	Misses       int64 `json:"misses"`       // Get calls that returned no data, including expired entries
+	ExpiredHits  int64 `json:"expiredHits"`  // Get calls that found an expired entry
+	Sets         int64 `json:"sets"`         // Entries written
+	Deletes      int64 `json:"deletes"`      // Entries removed by Delete
+	Evictions    int64 `json:"evictions"`    // Entries removed by maintenance (PurgeExpired)
+	BytesWritten int64 `json:"bytesWritten"` // Bytes written to cache files
+	BytesRead    int64 `json:"bytesRead"`    // Bytes read from cache files
+	Repairs      int64 `json:"repairs"`      // Entries fixed or removed by read repair
+	Stampedes    int64 `json:"stampedes"`    // Stampedes found by WithStampedeDetection
+
+	// Hit ratios of recent Get calls, 0 when there were none. Unlike
+	// HitRatio they show changes soon after a deploy.
+	HitRatio1m float64 `json:"hitRatio1m"` // Over the last minute
+	HitRatio5m float64 `json:"hitRatio5m"` // Over the last 5 minutes
+	HitRatio1h float64 `json:"hitRatio1h"` // Over the last hour
+}
+
+// HitRatio returns hits / (hits + misses), or 0 when there were no reads
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// cacheStats holds the live counters behind CacheStats
+type cacheStats struct {
+	hits         atomic.Int64
+	misses       atomic.Int64
+	expiredHits  atomic.Int64
+	sets         atomic.Int64
+	deletes      atomic.Int64
+	evictions    atomic.Int64
+	bytesWritten atomic.Int64
+	bytesRead    atomic.Int64
+	repairs      atomic.Int64
+	stampedes    atomic.Int64
+	recent       hitWindows
+}
+
+// windowBucket is how much time a bucket of hitWindows covers
+const windowBucket = 10 * time.Second
+
+// hitWindows counts hits and misses in a ring of buckets covering the last
+// hour, from which the ratios of shorter windows are summed
+type hitWindows struct {
+	mu      sync.Mutex // Serializes bucket resets
+	buckets [int(time.Hour / windowBucket)]hitBucket
+}
+
+// hitBucket holds the reads of one windowBucket period
+type hitBucket struct {
+	period atomic.Int64 // Which period the counts belong to
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// record counts a read at now
+func (w *hitWindows) record(now time.Time, hit bool) {
+	period := now.UnixNano() / int64(windowBucket)
+	b := &w.buckets[period%int64(len(w.buckets))]
+	if b.period.Load() != period {
+		w.mu.Lock()
+		if b.period.Load() != period {
+			b.hits.Store(0)
+			b.misses.Store(0)
+			b.period.Store(period)
+		}
+		w.mu.Unlock()
+	}
+	if hit {
+		b.hits.Add(1)
+	} else {
+		b.misses.Add(1)
+	}
+}
+
+// ratio returns the hit ratio over span before now
+func (w *hitWindows) ratio(now time.Time, span time.Duration) float64 {
+	period := now.UnixNano() / int64(windowBucket)
+	var hits, total int64
+	for i := int64(0); i < int64(span/windowBucket); i++ {
+		b := &w.buckets[(period-i)%int64(len(w.buckets))]
+		if b.period.Load() != period-i {
+			continue
+		}
+		h := b.hits.Load()
+		hits += h
+		total += h + b.misses.Load()
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+func (w *hitWindows) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.buckets {
+		w.buckets[i].period.Store(0)
+		w.buckets[i].hits.Store(0)
+		w.buckets[i].misses.Store(0)
+	}
+}
+
+// recordGet counts the outcome of a Get call
+func (s *cacheStats) recordGet(err error) {
+	s.recent.record(time.Now(), err == nil)
+	switch {
+	case err == nil:
+		s.hits.Add(1)
+	case errors.Is(err, ErrExpired):
+		s.expiredHits.Add(1)
+		s.misses.Add(1)
+	default:
+		s.misses.Add(1)
+	}
+}
+
+func (s *cacheStats) snapshot() CacheStats {
+	now := time.Now()
+	return CacheStats{
+		Hits:         s.hits.Load(),
+		Misses:       s.misses.Load(),
+		ExpiredHits:  s.expiredHits.Load(),
+		Sets:         s.sets.Load(),
+		Deletes:      s.deletes.Load(),
+		Evictions:    s.evictions.Load(),
+		BytesWritten: s.bytesWritten.Load(),
+		BytesRead:    s.bytesRead.Load(),
+		Repairs:      s.repairs.Load(),
+		Stampedes:    s.stampedes.Load(),
+
+		HitRatio1m: s.recent.ratio(now, time.Minute),
+		HitRatio5m: s.recent.ratio(now, 5*time.Minute),
+		HitRatio1h: s.recent.ratio(now, time.Hour),
+	}
+}
+
+func (s *cacheStats) reset() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.expiredHits.Store(0)
+	s.sets.Store(0)
+	s.deletes.Store(0)
+	s.evictions.Store(0)
+	s.bytesWritten.Store(0)
+	s.bytesRead.Store(0)
+	s.repairs.Store(0)
+	s.stampedes.Store(0)
+	s.recent.reset()
+}
+
+// Stats returns a snapshot of the cache's counters since creation or the
+// last ResetStats call
+func (fc *FileCache) Stats() CacheStats {
+	return fc.stats.snapshot()
+}
+
+// ResetStats zeroes all counters
+func (fc *FileCache) ResetStats() {
+	fc.stats.reset()
+}
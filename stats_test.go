@@ -0,0 +1,82 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_stats")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	_ = cache.Set("a", []byte("12345"))
+	_ = cache.SetWithTTL("short", []byte("x"), time.Millisecond)
+	_, _ = cache.Get("a")
+	_, _ = cache.Get("missing")
+	time.Sleep(5 * time.Millisecond)
+	_, _ = cache.Get("short")
+	_ = cache.Delete("a")
+	_ = cache.SetWithTTL("old.json", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_ = cache.PurgeExpired()
+
+	s := cache.Stats()
+	if s.Hits != 1 || s.Misses != 2 || s.ExpiredHits != 1 {
+		t.Errorf("Unexpected read counters: %+v", s)
+	}
+	if s.Sets != 3 || s.Deletes != 1 || s.Evictions != 1 {
+		t.Errorf("Unexpected write counters: %+v", s)
+	}
+	if s.BytesWritten == 0 || s.BytesRead == 0 {
+		t.Errorf("Expected byte counters to be set: %+v", s)
+	}
+	if r := s.HitRatio(); r < 0.33 || r > 0.34 {
+		t.Errorf("Expected hit ratio 1/3, got %v", r)
+	}
+	if s.HitRatio1m != s.HitRatio() || s.HitRatio1h != s.HitRatio() {
+		t.Errorf("Expected recent hit ratios to match for a short run: %+v", s)
+	}
+
+	cache.ResetStats()
+	if s := cache.Stats(); s != (CacheStats{}) {
+		t.Errorf("Expected zero stats after reset, got %+v", s)
+	}
+}
+
+func TestHitWindows(t *testing.T) {
+	var w hitWindows
+	now := time.Now()
+
+	// An hour-old miss, a recent miss and two hits just now
+	w.record(now.Add(-50*time.Minute), false)
+	w.record(now.Add(-3*time.Minute), false)
+	w.record(now, true)
+	w.record(now, true)
+
+	if r := w.ratio(now, time.Minute); r != 1 {
+		t.Errorf("Expected 1m ratio 1, got %v", r)
+	}
+	if r := w.ratio(now, 5*time.Minute); r < 0.66 || r > 0.67 {
+		t.Errorf("Expected 5m ratio 2/3, got %v", r)
+	}
+	if r := w.ratio(now, time.Hour); r != 0.5 {
+		t.Errorf("Expected 1h ratio 1/2, got %v", r)
+	}
+	// Buckets older than the ring are reused, not summed
+	if r := w.ratio(now.Add(2*time.Hour), time.Hour); r != 0 {
+		t.Errorf("Expected no reads two hours later, got %v", r)
+	}
+	w.record(now.Add(time.Hour), false)
+	if r := w.ratio(now.Add(time.Hour), time.Minute); r != 0 {
+		t.Errorf("Expected the reused bucket to hold only the new miss, got %v", r)
+	}
+}
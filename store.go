@@ -0,0 +1,216 @@
+package pie_cache
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is the storage backend underneath a FileCache. It holds opaque
+// encoded entries under slash-separated names chosen by the cache; TTLs,
+// encoding and eviction are handled above it, so any Store gets the same
+// caching semantics. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put stores data under name, replacing any previous value. data is
+	// reused once Put returns, so it must be copied to be kept.
+	Put(name string, data []byte) error
+	// Fetch returns the data stored under name, or ErrNotFound
+	Fetch(name string) ([]byte, error)
+	// Remove deletes name, returning ErrNotFound if it does not exist
+	Remove(name string) error
+	// Walk calls fn for every entry whose name starts with prefix, in
+	// lexical order. An error returned by fn stops the walk and is returned.
+	Walk(prefix string, fn func(name string, data []byte) error) error
+}
+
+// StreamStore is a Store that can also move entries as streams, so large
+// payloads need not be held in memory. FileStore implements it.
+type StreamStore interface {
+	Store
+	// Open returns random access to the data stored under name, or
+	// ErrNotFound
+	Open(name string) (EntryReader, error)
+	// Create starts writing a new value for name
+	Create(name string) (EntryWriter, error)
+}
+
+// AppendStore is a Store that can add to an entry in place, so a growing
+// log need not be rewritten on every change. FileStore and MemoryStore
+// implement it.
+type AppendStore interface {
+	Store
+	// Append adds data to the end of name, creating it if needed
+	Append(name string, data []byte) error
+}
+
+// SeekStore is a Store that can start a walk after a given name without
+// reading the entries before it, so paging through a large store does not
+// read it from the start for every page. FileStore, MemoryStore and
+// boltstore.Store implement it.
+type SeekStore interface {
+	Store
+	// WalkAfter is Walk limited to the names after after
+	WalkAfter(prefix, after string, fn func(name string, data []byte) error) error
+}
+
+// LeaseStore is a Store that can grant a lease on a name to one holder at
+// a time, across all processes sharing the storage. A lease that is not
+// released expires after its ttl, so a crashed holder does not block
+// others forever. FileStore and MemoryStore implement it.
+type LeaseStore interface {
+	Store
+	// Lease takes the lease on name for ttl, reporting false if someone
+	// else holds it. release gives the lease up.
+	Lease(name string, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// walkAfter walks the entries of store named after after, skipping those
+// before it unread if store is a SeekStore
+func walkAfter(store Store, prefix, after string, fn func(name string, data []byte) error) error {
+	if ss, ok := store.(SeekStore); ok {
+		return ss.WalkAfter(prefix, after, fn)
+	}
+	return store.Walk(prefix, func(name string, data []byte) error {
+		if name <= after {
+			return nil
+		}
+		return fn(name, data)
+	})
+}
+
+// appendTo adds data to the end of name in store, rewriting the entry when
+// the store cannot append
+func appendTo(store Store, name string, data []byte) error {
+	if as, ok := store.(AppendStore); ok {
+		return as.Append(name, data)
+	}
+	old, err := store.Fetch(name)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	return store.Put(name, append(old, data...))
+}
+
+// EntryReader gives random access to a stored entry
+type EntryReader interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// EntryWriter streams a new entry into a StreamStore. Nothing is visible
+// under the name until Commit; Abort discards what was written.
+type EntryWriter interface {
+	io.Writer
+	Commit() error
+	Abort() error
+}
+
+// MemoryStore is a Store that keeps entries in a map. It is useful for tests
+// and for small caches that do not need persistence.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+	leases  map[string]*memoryLease
+}
+
+// memoryLease is a lease granted by a MemoryStore
+type memoryLease struct {
+	until time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string][]byte)}
+}
+
+// Put implements Store
+func (ms *MemoryStore) Put(name string, data []byte) error {
+	ms.mu.Lock()
+	ms.entries[name] = copyBytes(data)
+	ms.mu.Unlock()
+	return nil
+}
+
+// Append implements AppendStore
+func (ms *MemoryStore) Append(name string, data []byte) error {
+	ms.mu.Lock()
+	ms.entries[name] = append(copyBytes(ms.entries[name]), data...)
+	ms.mu.Unlock()
+	return nil
+}
+
+// Lease implements LeaseStore
+func (ms *MemoryStore) Lease(name string, ttl time.Duration) (func(), bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if l, ok := ms.leases[name]; ok && time.Now().Before(l.until) {
+		return nil, false, nil
+	}
+	if ms.leases == nil {
+		ms.leases = make(map[string]*memoryLease)
+	}
+	l := &memoryLease{until: time.Now().Add(ttl)}
+	ms.leases[name] = l
+	release := func() {
+		ms.mu.Lock()
+		if ms.leases[name] == l {
+			delete(ms.leases, name)
+		}
+		ms.mu.Unlock()
+	}
+	return release, true, nil
+}
+
+// Fetch implements Store
+func (ms *MemoryStore) Fetch(name string) ([]byte, error) {
+	ms.mu.RLock()
+	data, ok := ms.entries[name]
+	ms.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyBytes(data), nil
+}
+
+// Remove implements Store
+func (ms *MemoryStore) Remove(name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.entries[name]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.entries, name)
+	return nil
+}
+
+// Walk implements Store. It works on a snapshot, so fn may modify the store.
+func (ms *MemoryStore) Walk(prefix string, fn func(name string, data []byte) error) error {
+	return ms.WalkAfter(prefix, "", fn)
+}
+
+// WalkAfter implements SeekStore
+func (ms *MemoryStore) WalkAfter(prefix, after string, fn func(name string, data []byte) error) error {
+	ms.mu.RLock()
+	names := make([]string, 0, len(ms.entries))
+	for name := range ms.entries {
+		if strings.HasPrefix(name, prefix) && name > after {
+			names = append(names, name)
+		}
+	}
+	ms.mu.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := ms.Fetch(name)
+		if err != nil {
+			continue
+		}
+		if err := fn(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package pie_cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStore checks the behaviour every Store implementation must provide
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+
+	if _, err := s.Fetch("aa/missing"); err != ErrNotFound {
+		t.Errorf("Fetch of missing name: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Remove("aa/missing"); err != ErrNotFound {
+		t.Errorf("Remove of missing name: expected ErrNotFound, got %v", err)
+	}
+
+	for _, name := range []string{"bb/2", "aa/1", "aa/3", "cc/4"} {
+		if err := s.Put(name, []byte(name)); err != nil {
+			t.Fatalf("Put(%q) failed: %v", name, err)
+		}
+	}
+	if err := s.Put("aa/1", []byte("replaced")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if data, err := s.Fetch("aa/1"); err != nil || string(data) != "replaced" {
+		t.Errorf("Fetch returned %q, %v", data, err)
+	}
+
+	var names []string
+	err := s.Walk("aa/", func(name string, data []byte) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil || len(names) != 2 || names[0] != "aa/1" || names[1] != "aa/3" {
+		t.Errorf("Walk(aa/) returned %v, %v", names, err)
+	}
+
+	names = nil
+	_ = s.Walk("", func(name string, data []byte) error {
+		names = append(names, name)
+		return nil
+	})
+	if len(names) != 4 || names[0] != "aa/1" || names[3] != "cc/4" {
+		t.Errorf("Walk() returned %v", names)
+	}
+
+	if ss, ok := s.(SeekStore); ok {
+		for after, want := range map[string]string{"aa/1": "aa/3 bb/2 cc/4", "aa/3": "bb/2 cc/4", "bb": "bb/2 cc/4", "cc/4": ""} {
+			names = nil
+			_ = ss.WalkAfter("", after, func(name string, data []byte) error {
+				names = append(names, name)
+				return nil
+			})
+			if got := strings.Join(names, " "); got != want {
+				t.Errorf("WalkAfter(%q) returned %q, expected %q", after, got, want)
+			}
+		}
+	}
+
+	if err := s.Remove("bb/2"); err != nil {
+		t.Errorf("Remove failed: %v", err)
+	}
+	if _, err := s.Fetch("bb/2"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after Remove, got %v", err)
+	}
+
+	for _, part := range []string{"ab", "cd"} {
+		if err := appendTo(s, "dd/log", []byte(part)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if data, err := s.Fetch("dd/log"); err != nil || string(data) != "abcd" {
+		t.Errorf("Fetch after Append returned %q, %v", data, err)
+	}
+
+	if ls, ok := s.(LeaseStore); ok {
+		release, ok, err := ls.Lease("ee/lease", time.Minute)
+		if err != nil || !ok {
+			t.Fatalf("Lease failed: %v, %v", ok, err)
+		}
+		if _, ok, _ := ls.Lease("ee/lease", time.Minute); ok {
+			t.Error("Expected a held lease to be refused")
+		}
+		release()
+		if _, ok, _ := ls.Lease("ee/lease", time.Millisecond); !ok {
+			t.Error("Expected a released lease to be granted")
+		}
+		time.Sleep(5 * time.Millisecond)
+		if _, ok, _ := ls.Lease("ee/lease", time.Millisecond); !ok {
+			t.Error("Expected an expired lease to be granted")
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_store")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	s, err := NewFileStore(tempDir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	testStore(t, s)
+
+	// Removing the last entry of a directory removes the directory
+	_ = s.Put("ff/gg/hh/entry", []byte("v"))
+	_ = s.Put("ff/other", []byte("v"))
+	if err := s.Remove("ff/gg/hh/entry"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "ff", "gg")); !os.IsNotExist(err) {
+		t.Errorf("Expected empty directories to be pruned, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "ff")); err != nil {
+		t.Errorf("Expected non-empty directory to be kept, got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestCacheOnMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	cache, err := NewWithStore(store, time.Minute)
+	if err != nil {
+		t.Fatalf("NewWithStore failed: %v", err)
+	}
+
+	_ = cache.Set("user:1", []byte("a"))
+	_ = store.Put("notes.txt", []byte("not an entry"))
+	_ = cache.SetWithTTL("short", []byte("b"), time.Millisecond)
+	if got, err := cache.GetString("user:1"); err != nil || got != "a" {
+		t.Errorf("Get returned %q, %v", got, err)
+	}
+
+	name, _ := cache.entryName("short")
+	short, _ := store.Fetch(name)
+	_ = store.Put("copies/short", short)
+
+	time.Sleep(5 * time.Millisecond)
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	for _, kept := range []string{"notes.txt", "copies/short"} {
+		if _, err := store.Fetch(kept); err != nil {
+			t.Errorf("Expected %s, which is no entry, kept, got %v", kept, err)
+		}
+	}
+	keys, err := cache.ListKeys()
+	if err != nil || len(keys) != 1 || keys[0] != "user:1" {
+		t.Errorf("ListKeys returned %v, %v", keys, err)
+	}
+
+	if err := cache.Delete("user:1"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if err := cache.Delete("user:1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,402 @@
+package pie_cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// SetFromReader stores the contents of r under key with the specified TTL.
+// On a StreamStore such as FileStore the payload is streamed to disk
+// without being held in memory, encoded on the way if the key's transform
+// is a StreamTransform.
+func (fc *FileCache) SetFromReader(key string, r io.Reader, ttl time.Duration) error {
+	var tr Transform
+	if fc.transforms != nil {
+		tr = fc.transforms.forKey(key)
+	}
+	st, streamable := tr.(StreamTransform)
+	if fc.secondary != nil || tr != nil && !streamable {
+		// Other transforms and the secondary cache work on whole payloads
+		data, err := io.ReadAll(fc.limitReader(r))
+		if err != nil {
+			return fmt.Errorf("failed to read payload: %v", err)
+		}
+		return fc.SetWithTTL(key, data, ttl)
+	}
+
+	fc.used()
+	item := CacheItem{Key: key}
+	fc.stamp(&item, ttl)
+
+	name, err := fc.entryName(key)
+	if err != nil {
+		return err
+	}
+	if err := fc.checkSpace(); err != nil {
+		return fc.finishWrite(context.Background(), key, name, 0, err)
+	}
+
+	if !streamable {
+		size, err := fc.writeStream(name, &item, r)
+		return fc.finishWrite(context.Background(), key, name, int(size), err)
+	}
+
+	var size int64
+	encoded := fc.encodeStream(&item, st, r, &size)
+	defer encoded.Close()
+	_, err = fc.writeStream(name, &item, encoded)
+	return fc.finishWrite(context.Background(), key, name, int(size), err)
+}
+
+// encodeStream returns a reader of r encoded with st. The encoding runs in
+// a goroutine that applies the size limit and checksum to the raw payload,
+// so they mean the same as for Set; once the reader reaches EOF item holds
+// the checksum and size the payload size. Closing the reader stops the
+// goroutine.
+func (fc *FileCache) encodeStream(item *CacheItem, st StreamTransform, r io.Reader, size *int64) io.ReadCloser {
+	pr, pw := io.Pipe()
+	item.Encoding = st.Name()
+	go func() {
+		enc, err := st.NewEncoder(pw)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to encode payload with %s: %v", st.Name(), err))
+			return
+		}
+		var sum hash.Hash32
+		dst := io.Writer(enc)
+		if fc.checksum {
+			sum = crc32.New(checksumTable)
+			dst = io.MultiWriter(enc, sum)
+		}
+		n, err := io.Copy(dst, fc.limitReader(r))
+		if err == nil {
+			err = fc.checkSize(n)
+		}
+		if cerr := enc.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to encode payload with %s: %v", st.Name(), cerr)
+		}
+		if err == nil && sum != nil {
+			item.Checksum = formatChecksum(sum.Sum32())
+		}
+		*size = n
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// writeStream stores item in the binary format with its payload read from r
+// and returns the payload size. When item has an Encoding, r yields the
+// encoded payload and the size limit and checksum are left to the caller,
+// as they apply to the raw one.
+func (fc *FileCache) writeStream(name string, item *CacheItem, r io.Reader) (int64, error) {
+	raw := item.Encoding == ""
+	if raw {
+		r = fc.limitReader(r)
+	}
+	ss, ok := fc.store.(StreamStore)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err == ErrTooLarge {
+			return 0, err
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read payload: %v", err)
+		}
+		if err := fc.checkSize(int64(len(data))); raw && err != nil {
+			return 0, err
+		}
+		item.Data = data
+		if fc.checksum && raw {
+			item.Checksum = Checksum(data)
+		}
+		fc.sign(item)
+		encoded, err := encodeBinary(item)
+		if err != nil {
+			return 0, err
+		}
+		if err := fc.store.Put(name, encoded); err != nil {
+			return 0, err
+		}
+		fc.stored(name, item, len(data), len(encoded))
+		return int64(len(data)), nil
+	}
+
+	w, err := ss.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	var digest *payloadDigest
+	var sum hash.Hash32
+	dsts := []io.Writer{w}
+	if fc.signingKey != nil {
+		digest = newPayloadDigest()
+		dsts = append(dsts, digest)
+	}
+	if fc.checksum && raw {
+		sum = crc32.New(checksumTable)
+		dsts = append(dsts, sum)
+	}
+	dst := io.MultiWriter(dsts...)
+
+	if _, err := w.Write(binaryMagic); err != nil {
+		w.Abort()
+		return 0, fmt.Errorf("failed to write cache file: %v", err)
+	}
+	n, err := io.Copy(dst, r)
+	if err == ErrTooLarge {
+		w.Abort()
+		return 0, err
+	}
+	if err != nil {
+		w.Abort()
+		return 0, fmt.Errorf("failed to stream payload: %v", err)
+	}
+	if err := fc.checkSize(n); raw && err != nil {
+		w.Abort()
+		return 0, err
+	}
+	if sum != nil {
+		item.Checksum = formatChecksum(sum.Sum32())
+	}
+	if digest != nil {
+		item.Signature = fc.sealSignature(digest, item)
+	}
+	trailer, err := binaryTrailer(item)
+	if err != nil {
+		w.Abort()
+		return 0, err
+	}
+	if _, err := w.Write(trailer); err != nil {
+		w.Abort()
+		return 0, fmt.Errorf("failed to write cache file: %v", err)
+	}
+	if err := w.Commit(); err != nil {
+		return 0, err
+	}
+
+	fc.stored(name, item, int(n), len(binaryMagic)+int(n)+len(trailer))
+	return n, nil
+}
+
+// GetReadSeeker returns a reader over the payload stored under key that
+// supports seeking, for consumers that process large values in parts or
+// resume where they stopped. On a StreamStore the payload is read from
+// disk on demand; other stores, entries in the JSON format and transformed
+// payloads are loaded into memory. The caller must close the reader.
+func (fc *FileCache) GetReadSeeker(key string) (io.ReadSeekCloser, error) {
+	rs, err := fc.openPayload(key)
+	fc.recordRead(key, err)
+	return rs, err
+}
+
+// payloadReader reads a payload section and closes the underlying entry
+type payloadReader struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// openPayload is GetReadSeeker without statistics
+func (fc *FileCache) openPayload(key string) (io.ReadSeekCloser, error) {
+	ss, ok := fc.store.(StreamStore)
+	if !ok {
+		return fc.loadPayload(key)
+	}
+
+	name, err := fc.entryName(key)
+	if err != nil {
+		return nil, err
+	}
+	entry, item, section, err := fc.openEntry(ss, key, name)
+	if err == errNotBinary || err == nil && item.Encoding != "" {
+		if entry != nil {
+			entry.Close()
+		}
+		return fc.loadPayload(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := fc.verifyEntry(key, name, entry, item, section); err != nil {
+		return nil, err
+	}
+	return &payloadReader{SectionReader: section, Closer: entry}, nil
+}
+
+// GetReader returns a reader over the payload stored under key. Payloads
+// encoded with a StreamTransform such as Gzip are decoded as they are read
+// instead of in memory, and their checksum is verified when the reader
+// reaches the end, where a mismatch is reported as ErrCorrupted. Other
+// payloads are served as by GetReadSeeker. The caller must close the
+// reader.
+func (fc *FileCache) GetReader(key string) (io.ReadCloser, error) {
+	rc, err := fc.openReader(key)
+	fc.recordRead(key, err)
+	return rc, err
+}
+
+// GetInto copies the payload stored under key into buf and returns its
+// length, so callers reading many large values can reuse one buffer. If
+// buf is too small it returns the length needed and io.ErrShortBuffer;
+// grow buf and call again. On a StreamStore payloads in the binary format
+// are read straight into buf; others are loaded into memory first.
+func (fc *FileCache) GetInto(key string, buf []byte) (int, error) {
+	n, err := fc.getInto(key, buf)
+	if err != io.ErrShortBuffer {
+		// The read that follows a short buffer is the one that counts
+		fc.recordRead(key, err)
+	}
+	return n, err
+}
+
+// getInto is GetInto without statistics
+func (fc *FileCache) getInto(key string, buf []byte) (int, error) {
+	rs, err := fc.openPayload(key)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Close()
+	size := rs.(*payloadReader).Size()
+	if size > int64(len(buf)) {
+		return int(size), io.ErrShortBuffer
+	}
+	return io.ReadFull(rs, buf[:size])
+}
+
+// openReader is GetReader without statistics
+func (fc *FileCache) openReader(key string) (io.ReadCloser, error) {
+	ss, ok := fc.store.(StreamStore)
+	if !ok || fc.transforms == nil {
+		return fc.openPayload(key)
+	}
+
+	name, err := fc.entryName(key)
+	if err != nil {
+		return nil, err
+	}
+	entry, item, section, err := fc.openEntry(ss, key, name)
+	if err == errNotBinary {
+		return fc.loadPayload(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	st, _ := fc.transforms.byName[item.Encoding].(StreamTransform)
+	if item.Encoding != "" && st == nil {
+		entry.Close()
+		return fc.loadPayload(key)
+	}
+	if err := fc.verifyEntry(key, name, entry, item, section); err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return &payloadReader{SectionReader: section, Closer: entry}, nil
+	}
+
+	dec, err := st.NewDecoder(section)
+	if err != nil {
+		entry.Close()
+		fc.logEvent(Event{Type: EventCorrupt, Key: key, Path: name, Err: err})
+		return nil, fmt.Errorf("failed to decode payload with %s: %v", st.Name(), err)
+	}
+	r := &decodedReader{Reader: dec, dec: dec, entry: entry}
+	if fc.checksum && item.Checksum != "" {
+		r.Reader = &checksumReader{r: dec, sum: crc32.New(checksumTable), want: item.Checksum}
+	}
+	return r, nil
+}
+
+// openEntry opens the entry name of key on ss and reads its binary header,
+// returning the entry and a reader of its payload section. It returns
+// errNotBinary, with a nil entry, for entries in the JSON format.
+func (fc *FileCache) openEntry(ss StreamStore, key, name string) (EntryReader, *CacheItem, *io.SectionReader, error) {
+	entry, err := ss.Open(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	item, off, n, err := readBinaryHeader(entry, entry.Size())
+	if err != nil {
+		entry.Close()
+		if err != errNotBinary {
+			fc.logEvent(Event{Type: EventCorrupt, Key: key, Path: name, Err: err})
+		}
+		return nil, nil, nil, err
+	}
+	if err := fc.checkKey(context.Background(), key, name, item); err != nil {
+		entry.Close()
+		return nil, nil, nil, err
+	}
+	return entry, item, io.NewSectionReader(entry, off, n), nil
+}
+
+// verifyEntry checks the signature, checksum and expiry of an entry opened
+// by openEntry and rewinds section. It closes the entry if they fail. The
+// checksum of an encoded payload covers the decoded one, so it is left to
+// the reader.
+func (fc *FileCache) verifyEntry(key, name string, entry EntryReader, item *CacheItem, section *io.SectionReader) error {
+	if err := fc.verifyStream(item, section); err != nil {
+		entry.Close()
+		if err == ErrCorrupted {
+			fc.corrupt(context.Background(), key, name, err)
+		} else {
+			fc.logEvent(Event{Type: EventCorrupt, Key: key, Path: name, Err: err})
+		}
+		return err
+	}
+	if fc.isExpired(item, fc.now()) {
+		entry.Close()
+		fc.expire(context.Background(), key, name)
+		return ErrExpired
+	}
+
+	section.Seek(0, io.SeekStart)
+	fc.stats.bytesRead.Add(section.Size())
+	return nil
+}
+
+// decodedReader reads a payload through its decoder and closes both the
+// decoder and the underlying entry
+type decodedReader struct {
+	io.Reader
+	dec   io.Closer
+	entry io.Closer
+}
+
+func (r *decodedReader) Close() error {
+	err := r.dec.Close()
+	if cerr := r.entry.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checksumReader returns ErrCorrupted at the end of r if what it read does
+// not match the checksum want
+type checksumReader struct {
+	r    io.Reader
+	sum  hash.Hash32
+	want string
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.sum.Write(p[:n])
+	if err == io.EOF && formatChecksum(c.sum.Sum32()) != c.want {
+		return n, ErrCorrupted
+	}
+	return n, err
+}
+
+// loadPayload serves GetReadSeeker from an in-memory copy of the payload
+func (fc *FileCache) loadPayload(key string) (io.ReadSeekCloser, error) {
+	data, err := fc.get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	return &payloadReader{SectionReader: io.NewSectionReader(r, 0, r.Size()), Closer: io.NopCloser(nil)}, nil
+}
@@ -0,0 +1,232 @@
+package pie_cache
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadSeeker(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_stream")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	payload := bytes.Repeat([]byte("0123456789"), 10000)
+	memory, _ := NewWithStore(NewMemoryStore(), time.Minute)
+	signed, err := NewFileCache(tempDir, time.Minute, WithSigningKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	for _, cache := range []*FileCache{signed, memory} {
+		if err := cache.SetFromReader("media", bytes.NewReader(payload), time.Minute); err != nil {
+			t.Fatalf("SetFromReader failed: %v", err)
+		}
+
+		rs, err := cache.GetReadSeeker("media")
+		if err != nil {
+			t.Fatalf("GetReadSeeker failed: %v", err)
+		}
+		// Resume in the middle of the payload
+		if _, err := rs.Seek(50005, io.SeekStart); err != nil {
+			t.Fatalf("Seek failed: %v", err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(rs, buf); err != nil || string(buf) != "56789" {
+			t.Errorf("Expected 56789 after seek, got %q, %v", buf, err)
+		}
+		if end, _ := rs.Seek(0, io.SeekEnd); end != int64(len(payload)) {
+			t.Errorf("Expected size %d, got %d", len(payload), end)
+		}
+		rs.Close()
+
+		// The binary entry reads back through the regular API as well
+		if data, err := cache.Get("media"); err != nil || !bytes.Equal(data, payload) {
+			t.Errorf("Expected Get to return the streamed payload, got %d bytes, %v", len(data), err)
+		}
+		if keys, _ := cache.ListKeys(); len(keys) != 1 || keys[0] != "media" {
+			t.Errorf("Unexpected keys %v", keys)
+		}
+	}
+
+	// Entries in the JSON format can be read as streams too
+	_ = signed.Set("small", []byte("hello"))
+	if rs, err := signed.GetReadSeeker("small"); err != nil {
+		t.Errorf("GetReadSeeker on JSON entry failed: %v", err)
+	} else {
+		data, _ := io.ReadAll(rs)
+		rs.Close()
+		if string(data) != "hello" {
+			t.Errorf("Expected hello, got %q", data)
+		}
+	}
+
+	// Tampering with the payload on disk is detected
+	path, _ := signed.getFilePath("media")
+	raw, _ := os.ReadFile(path)
+	raw[10] ^= 0xff
+	_ = os.WriteFile(path, raw, 0644)
+	if _, err := signed.GetReadSeeker("media"); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	_ = signed.SetFromReader("short", strings.NewReader("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := signed.GetReadSeeker("short"); err != ErrExpired {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if _, err := signed.GetReadSeeker("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	entries, _ := os.ReadDir(tempDir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), tempPrefix) {
+			t.Errorf("Temporary file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestStreamTransform(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_stream_transform")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opts := []Option{
+		WithTransformPolicy(TransformPolicy{"html:*": Gzip()}),
+		WithChecksum(true),
+		WithSigningKey([]byte("secret")),
+		WithMaxValueSize(1 << 20),
+	}
+	file, err := NewFileCache(tempDir, time.Minute, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	memory, err := NewWithStore(NewMemoryStore(), time.Minute, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	page := []byte(strings.Repeat("<p>hello</p>", 10000))
+	for _, cache := range []*FileCache{file, memory} {
+		if err := cache.SetFromReader("html:index", bytes.NewReader(page), time.Minute); err != nil {
+			t.Fatalf("SetFromReader failed: %v", err)
+		}
+		rc, err := cache.GetReader("html:index")
+		if err != nil {
+			t.Fatalf("GetReader failed: %v", err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(data, page) {
+			t.Errorf("Expected GetReader to decode the page, got %d bytes, %v", len(data), err)
+		}
+		if data, err := cache.Get("html:index"); err != nil || !bytes.Equal(data, page) {
+			t.Errorf("Expected Get to decode the page, got %d bytes, %v", len(data), err)
+		}
+
+		// The size limit applies to the raw payload, not the compressed one
+		big := bytes.NewReader(bytes.Repeat([]byte("a"), 2<<20))
+		if err := cache.SetFromReader("html:big", big, time.Minute); err != ErrTooLarge {
+			t.Errorf("Expected ErrTooLarge, got %v", err)
+		}
+		if cache.Exists("html:big") {
+			t.Error("Expected oversized value not to be stored")
+		}
+	}
+
+	path, _ := file.getFilePath("html:index")
+	raw, _ := os.ReadFile(path)
+	if !bytes.HasPrefix(raw, binaryMagic) || len(raw) >= len(page) {
+		t.Fatalf("Expected a compressed binary entry, got %d bytes", len(raw))
+	}
+
+	// A wrong checksum surfaces when the decoded stream ends
+	item, off, n, err := readBinaryHeader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+	// Re-signed, as the signature covers the checksum too
+	item.Checksum = Checksum([]byte("other"))
+	item.Data = raw[off : off+n]
+	file.sign(item)
+	trailer, _ := binaryTrailer(item)
+	tampered := append(raw[:off+n:off+n], trailer...)
+	if err := os.WriteFile(path, tampered, 0644); err != nil {
+		t.Fatalf("Failed to write entry: %v", err)
+	}
+	rc, err := file.GetReader("html:index")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); err != ErrCorrupted {
+		t.Errorf("Expected ErrCorrupted at the end of the stream, got %v", err)
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_getinto")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file, err := NewFileCache(tempDir, time.Minute, WithChecksum(true))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	memory, _ := NewMemoryCache(time.Minute)
+
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	for _, cache := range []*FileCache{file, memory} {
+		_ = cache.SetFromReader("streamed", bytes.NewReader(payload), time.Minute)
+		_ = cache.Set("small", []byte("hello"))
+
+		buf := make([]byte, 16)
+		n, err := cache.GetInto("streamed", buf)
+		if err != io.ErrShortBuffer || n != len(payload) {
+			t.Fatalf("Expected io.ErrShortBuffer and the size needed, got %d, %v", n, err)
+		}
+		buf = make([]byte, n)
+		if n, err := cache.GetInto("streamed", buf); err != nil || !bytes.Equal(buf[:n], payload) {
+			t.Errorf("Expected the payload, got %d bytes, %v", n, err)
+		}
+		// A buffer larger than the payload is reused as it is
+		if n, err := cache.GetInto("small", buf); err != nil || string(buf[:n]) != "hello" {
+			t.Errorf("Expected hello, got %q, %v", buf[:n], err)
+		}
+		if _, err := cache.GetInto("missing", buf); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	}
+}
+
+func BenchmarkGetInto(b *testing.B) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_bench")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	cache, err := NewFileCache(tempDir, time.Hour)
+	if err != nil {
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	payload := make([]byte, 256<<10)
+	_ = cache.SetFromReader("large", bytes.NewReader(payload), time.Hour)
+	buf := make([]byte, len(payload))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	for b.Loop() {
+		if _, err := cache.GetInto("large", buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package pie_cache
+
+import "crypto/sha256"
+
+// SyncOptions controls a Sync run
+type SyncOptions struct {
+	DryRun bool // Report what would be copied without writing anything
+}
+
+// SyncResult summarises a Sync run
+type SyncResult struct {
+	Copied  int // Entries written to the destination
+	Skipped int // Entries already present and up to date
+	Expired int // Source entries skipped because they expired
+	Failed  int // Entries that could not be read or written
+}
+
+// Sync incrementally copies live entries from the cache directory src to
+// dst. An entry is copied when dst lacks it, holds an expired copy, or holds
+// different content created earlier than the source's. Creation and expiry
+// times are preserved, so a promoted standby serves the same freshness.
+func Sync(src, dst string, opts SyncOptions) (SyncResult, error) {
+	srcCache, err := NewFileCache(src, 0)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	dstCache, err := NewFileCache(dst, 0)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	return syncCaches(srcCache, dstCache, opts)
+}
+
+// SyncTo copies live entries of fc to other as Sync does between
+// directories, for warm standbys or replication managed in-process. Both
+// caches may use any Store. Call it in both directions to converge two
+// caches; entries deleted from one are not deleted from the other.
+func (fc *FileCache) SyncTo(other *FileCache, opts SyncOptions) (SyncResult, error) {
+	if err := fc.Flush(); err != nil {
+		return SyncResult{}, err
+	}
+	return syncCaches(fc, other, opts)
+}
+
+// syncCaches copies missing or newer entries from src to dst
+func syncCaches(src, dst *FileCache, opts SyncOptions) (SyncResult, error) {
+	var res SyncResult
+	now := src.now()
+
+	err := src.walkItems(func(name string, item *CacheItem) error {
+		if src.isExpired(item, now) {
+			res.Expired++
+			return nil
+		}
+
+		dstName, err := dst.entryName(item.Key)
+		if err != nil {
+			res.Failed++
+			return nil
+		}
+
+		if data, err := dst.store.Fetch(dstName); err == nil {
+			if existing, err := decodeItem(data); err == nil && !dst.isExpired(existing, dst.now()) {
+				same := sha256.Sum256(existing.Data) == sha256.Sum256(item.Data)
+				if same || !item.Created.After(existing.Created) {
+					res.Skipped++
+					return nil
+				}
+			}
+		}
+
+		if opts.DryRun {
+			res.Copied++
+			return nil
+		}
+		if err := dst.writeItem(dstName, item); err != nil {
+			res.Failed++
+			dst.logEvent(Event{Type: EventWriteFailed, Key: item.Key, Path: dstName, Err: err})
+			return nil
+		}
+		if dst.hot != nil {
+			dst.hot.remove(item.Key)
+		}
+		res.Copied++
+		return nil
+	})
+
+	return res, err
+}
+
+// walkItems calls fn for every stored entry that decodes to an item
+func (fc *FileCache) walkItems(fn func(name string, item *CacheItem) error) error {
+	return fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			return nil
+		}
+		return fn(name, item)
+	})
+}
@@ -0,0 +1,90 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "pie_cache_sync_src")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+	dstDir, err := os.MkdirTemp("", "pie_cache_sync_dst")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	src, _ := NewFileCache(srcDir, time.Minute)
+	dst, _ := NewFileCache(dstDir, time.Minute)
+
+	_ = dst.Set("stale", []byte("old"))
+	time.Sleep(2 * time.Millisecond)
+	_ = src.Set("missing", []byte("m"))
+	_ = src.Set("stale", []byte("new"))
+	_ = src.Set("same", []byte("s"))
+	_ = dst.Set("same", []byte("s"))
+	_ = src.SetWithTTL("expired", []byte("e"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	res, err := Sync(srcDir, dstDir, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if res.Copied != 2 || dst.Exists("missing") {
+		t.Errorf("Dry run should report 2 copies and write nothing: %+v", res)
+	}
+
+	res, err = Sync(srcDir, dstDir, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if res.Copied != 2 || res.Skipped != 1 || res.Expired != 1 {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+	if got, _ := dst.GetString("stale"); got != "new" {
+		t.Errorf("Expected newer entry to be copied, got %q", got)
+	}
+	if got, _ := dst.GetString("missing"); got != "m" {
+		t.Errorf("Expected missing entry to be copied, got %q", got)
+	}
+
+	// Creation time is preserved
+	if readItem(t, src, "missing").Created != readItem(t, dst, "missing").Created {
+		t.Error("Expected creation time to be preserved")
+	}
+
+	// A second run has nothing to do
+	res, _ = Sync(srcDir, dstDir, SyncOptions{})
+	if res.Copied != 0 {
+		t.Errorf("Expected incremental no-op, got %+v", res)
+	}
+}
+
+func TestSyncTo(t *testing.T) {
+	primary, _ := NewWithStore(NewMemoryStore(), time.Minute, WithAsyncWrites(8, 1))
+	standby, _ := NewWithStore(NewMemoryStore(), time.Minute, WithIndex(2))
+
+	_ = primary.SetWithTTL("a", []byte("a"), time.Minute)
+	_ = primary.SetWithTTL("old", []byte("o"), 2*time.Hour)
+	_ = standby.Set("b", []byte("b"))
+
+	res, err := primary.SyncTo(standby, SyncOptions{})
+	if err != nil || res.Copied != 2 {
+		t.Fatalf("Expected 2 entries copied, got %+v, %v", res, err)
+	}
+	if res, _ := standby.SyncTo(primary, SyncOptions{}); res.Copied != 1 || res.Skipped != 2 {
+		t.Errorf("Expected b copied back and the rest up to date, got %+v", res)
+	}
+	for _, key := range []string{"a", "old", "b"} {
+		if !primary.Exists(key) || !standby.Exists(key) {
+			t.Errorf("Expected %q in both caches", key)
+		}
+	}
+	if keys, _ := standby.ListKeys(); len(keys) != 3 {
+		t.Errorf("Expected the copies indexed, got %v", keys)
+	}
+}
@@ -0,0 +1,327 @@
+package pie_cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// WritePolicy selects when TieredCache writes reach the file cache
+type WritePolicy int
+
+const (
+	// WriteThrough writes every Set to the file cache before returning
+	WriteThrough WritePolicy = iota
+	// WriteBack keeps writes in memory and persists them when they are
+	// evicted from the LRU or on Flush. Unflushed writes are lost if the
+	// process dies. Persisting follows the file cache's WithWriteRetry
+	// policy.
+	WriteBack
+)
+
+// TieredCache keeps hot entries in a bounded in-memory LRU in front of a
+// FileCache. It is safe for concurrent use.
+type TieredCache struct {
+	file     *FileCache
+	capacity int
+	policy   WritePolicy
+
+	// writeLocks serialize, by key, the writes and deletes reaching the
+	// file cache with the in-memory state they come from
+	writeLocks [appendStripes]sync.Mutex
+
+	mu       sync.Mutex
+	lru      *list.List               // Front is most recently used
+	items    map[string]*list.Element // Values are *tieredEntry
+	evicting map[string]*tieredEntry  // Dirty entries evicted and not yet persisted
+}
+
+type tieredEntry struct {
+	key      string
+	data     []byte
+	expireAt time.Time
+	dirty    bool // Written with WriteBack and not yet persisted
+}
+
+// NewTieredCache creates a TieredCache holding up to capacity entries in
+// memory in front of file
+func NewTieredCache(file *FileCache, capacity int, policy WritePolicy) *TieredCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &TieredCache{
+		file:     file,
+		capacity: capacity,
+		policy:   policy,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+		evicting: make(map[string]*tieredEntry),
+	}
+}
+
+// Set adds or updates a cache item with the file cache's default TTL
+func (tc *TieredCache) Set(key string, data []byte) error {
+	return tc.SetWithTTL(key, data, tc.file.ttl)
+}
+
+// SetWithTTL adds or updates a cache item with specified TTL
+func (tc *TieredCache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	// Concurrent writers of key leave both tiers with the same value
+	mu := &tc.writeLocks[appendStripe(key)]
+	mu.Lock()
+	if tc.policy == WriteThrough {
+		if err := tc.file.SetWithTTL(key, data, ttl); err != nil {
+			mu.Unlock()
+			return err
+		}
+	}
+	evicted := tc.store(&tieredEntry{
+		key:      key,
+		data:     copyBytes(data),
+		expireAt: tc.file.now().Add(ttl),
+		dirty:    tc.policy == WriteBack,
+	})
+	mu.Unlock()
+	return tc.persist(evicted)
+}
+
+// Get retrieves a cache item from memory, falling back to the file cache
+func (tc *TieredCache) Get(key string) ([]byte, error) {
+	tc.mu.Lock()
+	if el, ok := tc.items[key]; ok {
+		e := el.Value.(*tieredEntry)
+		if tc.file.expiryNow().After(e.expireAt) {
+			tc.lru.Remove(el)
+			delete(tc.items, key)
+			tc.mu.Unlock()
+			// A dirty entry never reached disk, so there is nothing behind it
+			if e.dirty {
+				return nil, ErrExpired
+			}
+		} else {
+			tc.lru.MoveToFront(el)
+			data := copyBytes(e.data)
+			tc.mu.Unlock()
+			return data, nil
+		}
+	} else if e, ok := tc.evicting[key]; ok && !tc.file.expiryNow().After(e.expireAt) {
+		// The file cache has an older value until e is persisted
+		data := copyBytes(e.data)
+		tc.mu.Unlock()
+		return data, nil
+	} else {
+		tc.mu.Unlock()
+	}
+
+	data, meta, err := tc.file.GetWithMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	// A write that landed since the read above is newer than data
+	evicted := tc.storeIfAbsent(&tieredEntry{key: key, data: copyBytes(data), expireAt: meta.ExpireAt})
+	if err := tc.persist(evicted); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetString retrieves a cache item as string
+func (tc *TieredCache) GetString(key string) (string, error) {
+	data, err := tc.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Exists checks if a cache item exists and is not expired
+func (tc *TieredCache) Exists(key string) bool {
+	_, err := tc.Get(key)
+	return err == nil
+}
+
+// Delete removes a cache item from both tiers
+func (tc *TieredCache) Delete(key string) error {
+	mu := &tc.writeLocks[appendStripe(key)]
+	mu.Lock()
+	defer mu.Unlock()
+
+	tc.mu.Lock()
+	el, inMemory := tc.items[key]
+	_, dirty := tc.evicting[key]
+	if inMemory {
+		dirty = dirty || el.Value.(*tieredEntry).dirty
+		tc.lru.Remove(el)
+		delete(tc.items, key)
+	}
+	// An evicted write still on its way to disk is dropped
+	delete(tc.evicting, key)
+	tc.mu.Unlock()
+
+	err := tc.file.Delete(key)
+	if err == ErrNotFound && dirty {
+		return nil
+	}
+	return err
+}
+
+// Flush persists all dirty entries to the file cache
+func (tc *TieredCache) Flush() error {
+	tc.mu.Lock()
+	var dirty []*tieredEntry
+	for el := tc.lru.Front(); el != nil; el = el.Next() {
+		if e := el.Value.(*tieredEntry); e.dirty {
+			dirty = append(dirty, e)
+		}
+	}
+	tc.mu.Unlock()
+
+	// Entries stay dirty until they are persisted, so a failed flush can
+	// be retried
+	var firstErr error
+	for _, e := range dirty {
+		if err := tc.flushEntry(e); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// flushEntry persists e if it is still the dirty entry held in memory for
+// its key, so entries deleted or replaced since Flush collected them are
+// not written
+func (tc *TieredCache) flushEntry(e *tieredEntry) error {
+	mu := &tc.writeLocks[appendStripe(e.key)]
+	mu.Lock()
+	defer mu.Unlock()
+
+	tc.mu.Lock()
+	el, ok := tc.items[e.key]
+	current := ok && el.Value == e && e.dirty
+	tc.mu.Unlock()
+	if !current {
+		return nil
+	}
+	if err := tc.write(e); err != nil {
+		return err
+	}
+	tc.mu.Lock()
+	e.dirty = false
+	tc.mu.Unlock()
+	return nil
+}
+
+// Hibernate persists dirty entries, empties the in-memory LRU and
+// hibernates the file cache, see FileCache.Hibernate
+func (tc *TieredCache) Hibernate() error {
+	if err := tc.Flush(); err != nil {
+		return err
+	}
+	tc.mu.Lock()
+	for el := tc.lru.Front(); el != nil; {
+		next := el.Next()
+		// Entries dirtied since the flush stay
+		if e := el.Value.(*tieredEntry); !e.dirty {
+			tc.lru.Remove(el)
+			delete(tc.items, e.key)
+		}
+		el = next
+	}
+	tc.mu.Unlock()
+	return tc.file.Hibernate()
+}
+
+// Len returns the number of entries held in memory
+func (tc *TieredCache) Len() int {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.lru.Len()
+}
+
+// storeIfAbsent is store for values read from the file cache, which must
+// not replace an entry written to memory in the meantime
+func (tc *TieredCache) storeIfAbsent(e *tieredEntry) []*tieredEntry {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if _, ok := tc.items[e.key]; ok {
+		return nil
+	}
+	return tc.insert(e)
+}
+
+// store puts e at the front of the LRU and returns dirty entries that were
+// evicted to make room
+func (tc *TieredCache) store(e *tieredEntry) []*tieredEntry {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.insert(e)
+}
+
+// insert does the work of store with tc.mu held
+func (tc *TieredCache) insert(e *tieredEntry) []*tieredEntry {
+	if el, ok := tc.items[e.key]; ok {
+		// Never replace an unflushed write with a value read from disk
+		if old := el.Value.(*tieredEntry); !old.dirty || e.dirty {
+			el.Value = e
+		}
+		tc.lru.MoveToFront(el)
+	} else {
+		tc.items[e.key] = tc.lru.PushFront(e)
+	}
+	if e.dirty {
+		// A newer write supersedes an evicted one not yet persisted
+		delete(tc.evicting, e.key)
+	}
+
+	var evicted []*tieredEntry
+	for tc.lru.Len() > tc.capacity {
+		el := tc.lru.Back()
+		old := el.Value.(*tieredEntry)
+		tc.lru.Remove(el)
+		delete(tc.items, old.key)
+		if old.dirty {
+			tc.evicting[old.key] = old
+			evicted = append(evicted, old)
+		}
+	}
+	return evicted
+}
+
+// persist writes dirty entries evicted from memory to the file cache,
+// skipping those deleted or written again since
+func (tc *TieredCache) persist(entries []*tieredEntry) error {
+	var firstErr error
+	for _, e := range entries {
+		mu := &tc.writeLocks[appendStripe(e.key)]
+		mu.Lock()
+		tc.mu.Lock()
+		current := tc.evicting[e.key] == e
+		tc.mu.Unlock()
+		var err error
+		if current {
+			err = tc.write(e)
+			tc.mu.Lock()
+			if tc.evicting[e.key] == e {
+				delete(tc.evicting, e.key)
+			}
+			tc.mu.Unlock()
+		}
+		mu.Unlock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// write stores e in the file cache unless it expired, retrying failures
+// according to the file cache's retry policy. The caller must hold the
+// write lock of e.key.
+func (tc *TieredCache) write(e *tieredEntry) error {
+	ttl := e.expireAt.Sub(tc.file.now())
+	if ttl <= 0 {
+		return nil
+	}
+	return tc.file.setWithRetry(context.Background(), e.key, e.data, ttl)
+}
@@ -0,0 +1,192 @@
+package pie_cache
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTieredCacheWriteThrough(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_tiered")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fc, _ := NewFileCache(tempDir, time.Minute)
+	tc := NewTieredCache(fc, 2, WriteThrough)
+
+	if err := tc.Set("a", []byte("1")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !fc.Exists("a") {
+		t.Error("WriteThrough should persist immediately")
+	}
+
+	// Served from memory even when the file is gone
+	filePath, _ := fc.getFilePath("a")
+	_ = os.Remove(filePath)
+	if got, err := tc.GetString("a"); err != nil || got != "1" {
+		t.Errorf("Expected memory hit, got %q, %v", got, err)
+	}
+
+	// Misses fall back to the file cache and populate memory
+	_ = fc.Set("b", []byte("2"))
+	if got, _ := tc.GetString("b"); got != "2" {
+		t.Errorf("Expected file fallback, got %q", got)
+	}
+	_ = tc.Set("c", []byte("3"))
+	if tc.Len() != 2 {
+		t.Errorf("Expected LRU bounded at 2, got %d", tc.Len())
+	}
+
+	if err := tc.Delete("c"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if tc.Exists("c") || fc.Exists("c") {
+		t.Error("Delete should remove both tiers")
+	}
+}
+
+func TestTieredCacheWriteBack(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_tiered")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fc, _ := NewFileCache(tempDir, time.Minute)
+	tc := NewTieredCache(fc, 2, WriteBack)
+
+	_ = tc.Set("a", []byte("1"))
+	_ = tc.Set("b", []byte("2"))
+	if fc.Exists("a") || fc.Exists("b") {
+		t.Error("WriteBack should not persist before eviction or Flush")
+	}
+
+	// Evicting the least recently used dirty entry persists it
+	_ = tc.Set("c", []byte("3"))
+	if got, _ := fc.GetString("a"); got != "1" {
+		t.Errorf("Expected evicted entry to be persisted, got %q", got)
+	}
+
+	if err := tc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if !fc.Exists("b") || !fc.Exists("c") {
+		t.Error("Flush should persist dirty entries")
+	}
+
+	// Deleting a dirty-only entry succeeds
+	_ = tc.Set("d", []byte("4"))
+	if err := tc.Delete("d"); err != nil {
+		t.Errorf("Delete of unflushed entry failed: %v", err)
+	}
+}
+
+func TestTieredHibernate(t *testing.T) {
+	file, err := NewWithStore(NewMemoryStore(), time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	tc := NewTieredCache(file, 8, WriteBack)
+	_ = tc.Set("a", []byte("a"))
+	if err := tc.Hibernate(); err != nil {
+		t.Fatalf("Hibernate failed: %v", err)
+	}
+	if n := tc.Len(); n != 0 {
+		t.Errorf("Expected an empty LRU, got %d entries", n)
+	}
+	if v, err := file.GetString("a"); err != nil || v != "a" {
+		t.Errorf("Expected the dirty entry persisted, got %q, %v", v, err)
+	}
+}
+
+func TestTieredFlushFailure(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	fc, _ := NewWithStore(store, time.Minute)
+	tc := NewTieredCache(fc, 4, WriteBack)
+
+	_ = tc.Set("a", []byte("1"))
+	store.failures = 1
+	if err := tc.Flush(); err == nil {
+		t.Fatal("Expected the failed write to surface from Flush")
+	}
+	// The entry is still dirty, so the next flush writes it
+	if err := tc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got, _ := fc.GetString("a"); got != "1" {
+		t.Errorf("Expected the entry persisted by the second flush, got %q", got)
+	}
+}
+
+func TestTieredFillKeepsNewerWrite(t *testing.T) {
+	fc, _ := NewMemoryCache(time.Minute)
+	tc := NewTieredCache(fc, 4, WriteThrough)
+
+	_ = fc.Set("k", []byte("old"))
+	data, meta, _ := fc.GetWithMeta("k")
+	// A write-through Set lands between a Get's disk read and its fill
+	_ = tc.Set("k", []byte("new"))
+	tc.storeIfAbsent(&tieredEntry{key: "k", data: data, expireAt: meta.ExpireAt})
+
+	if got, _ := tc.GetString("k"); got != "new" {
+		t.Errorf("Expected the newer write to stay in memory, got %q", got)
+	}
+}
+
+func TestTieredDeleteDuringFlush(t *testing.T) {
+	fc, _ := NewMemoryCache(time.Minute)
+	tc := NewTieredCache(fc, 1, WriteBack)
+
+	// A Delete between Flush collecting an entry and writing it wins
+	_ = tc.Set("a", []byte("1"))
+	e := tc.items["a"].Value.(*tieredEntry)
+	_ = tc.Delete("a")
+	if err := tc.flushEntry(e); err != nil {
+		t.Fatalf("flushEntry failed: %v", err)
+	}
+	if fc.Exists("a") {
+		t.Error("Expected the deleted entry to stay off disk")
+	}
+
+	// So does one between an eviction and its write
+	_ = tc.Set("b", []byte("2"))
+	evicted := tc.store(&tieredEntry{key: "c", data: []byte("3"), expireAt: time.Now().Add(time.Minute), dirty: true})
+	if got, _ := tc.GetString("b"); got != "2" {
+		t.Errorf("Expected the evicted entry served until persisted, got %q", got)
+	}
+	_ = tc.Delete("b")
+	if err := tc.persist(evicted); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	if fc.Exists("b") {
+		t.Error("Expected the deleted evicted entry to stay off disk")
+	}
+}
+
+func TestTieredWriteThroughConcurrent(t *testing.T) {
+	fc, _ := NewMemoryCache(time.Minute)
+	tc := NewTieredCache(fc, 4, WriteThrough)
+
+	// Racing writers leave memory and disk with the same value
+	for i := 0; i < 50; i++ {
+		var wg sync.WaitGroup
+		for w := 0; w < 2; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = tc.Set("k", []byte(strconv.Itoa(w)))
+			}()
+		}
+		wg.Wait()
+		mem, _ := tc.GetString("k")
+		disk, _ := fc.GetString("k")
+		if mem != disk {
+			t.Fatalf("Memory has %q, disk %q", mem, disk)
+		}
+	}
+}
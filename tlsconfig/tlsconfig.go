@@ -0,0 +1,157 @@
+// Package tlsconfig builds TLS and mutual-TLS configurations for the remote
+// cache servers and clients, with certificates that are reloaded from disk
+// when they are rotated.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves a certificate loaded from a PEM cert/key pair and
+// reloads it when either file changes on disk
+type Reloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration // Minimum time between modification checks
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewReloader loads the key pair and returns a Reloader that checks the
+// files for changes at most once per interval
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the key pair from disk now
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+	modTime, _ := r.latestModTime()
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Certificate returns the current certificate, reloading it first if the
+// files changed. A failed reload keeps serving the previous certificate.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	check := time.Since(r.lastCheck) >= r.interval
+	if check {
+		r.lastCheck = time.Now()
+	}
+	cert, known := r.cert, r.modTime
+	r.mu.Unlock()
+
+	if check {
+		if modTime, err := r.latestModTime(); err == nil && modTime.After(known) {
+			if r.Reload() == nil {
+				r.mu.Lock()
+				cert = r.cert
+				r.mu.Unlock()
+			}
+		}
+	}
+	return cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Server returns a server TLS configuration serving the reloadable key
+// pair. If clientCAFile is set, clients must present a certificate signed
+// by one of its CAs (mutual TLS).
+func Server(certFile, keyFile, clientCAFile string) (*tls.Config, *Reloader, error) {
+	reloader, err := NewReloader(certFile, keyFile, 10*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientCAFile != "" {
+		pool, err := loadPool(clientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, reloader, nil
+}
+
+// Client returns a client TLS configuration trusting the CAs in caFile (the
+// system pool if empty) and, if certFile is set, presenting a reloadable
+// client certificate for mutual TLS
+func Client(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" {
+		reloader, err := NewReloader(certFile, keyFile, 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = reloader.GetClientCertificate
+	}
+	return cfg, nil
+}
+
+func loadPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in CA file")
+	}
+	return pool, nil
+}
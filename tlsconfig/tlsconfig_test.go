@@ -0,0 +1,146 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue writes a leaf certificate and key signed by ca to dir/name.pem and
+// dir/name.key
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, name+".key"), "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir)
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "client", 3)
+
+	serverCfg, _, err := Server(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatalf("Server failed: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.Listener = tls.NewListener(srv.Listener, serverCfg)
+	srv.Start()
+	defer srv.Close()
+	url := "https://" + srv.Listener.Addr().String()
+
+	clientCfg, err := Client(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"))
+	if err != nil {
+		t.Fatalf("Client failed: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("mTLS request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// Without a client certificate the handshake is rejected
+	anonCfg, _ := Client(filepath.Join(dir, "ca.pem"), "", "")
+	anon := &http.Client{Transport: &http.Transport{TLSClientConfig: anonCfg}}
+	if resp, err := anon.Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("Expected request without client certificate to fail")
+	}
+}
+
+func TestReloaderPicksUpRotation(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir)
+	ca.issue(t, dir, "server", 10)
+
+	r, err := NewReloader(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), 0)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	serial := func() int64 {
+		leaf, _ := x509.ParseCertificate(r.Certificate().Certificate[0])
+		return leaf.SerialNumber.Int64()
+	}
+	if serial() != 10 {
+		t.Fatalf("Expected serial 10, got %d", serial())
+	}
+
+	ca.issue(t, dir, "server", 11)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "server.pem"), future, future)
+	if serial() != 11 {
+		t.Errorf("Expected rotated certificate with serial 11, got %d", serial())
+	}
+
+	// A broken rotation keeps serving the last good certificate
+	os.WriteFile(filepath.Join(dir, "server.pem"), []byte("garbage"), 0600)
+	later := future.Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "server.pem"), later, later)
+	if cert := r.Certificate(); cert == nil {
+		t.Error("Expected previous certificate after failed reload")
+	}
+}
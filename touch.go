@@ -0,0 +1,74 @@
+package pie_cache
+
+import (
+	"time"
+)
+
+// TouchPrefix gives every live entry whose key starts with prefix a new
+// expiry ttl from now, e.g. when an upstream dataset is known to stay valid
+// for longer, and returns how many entries were extended. Keys come from
+// the index when there is one. Expired entries are left to expire, and
+// entries written meanwhile keep their own expiry; WithMaxAge still caps
+// the new expiry. WithSecondary mirrors the extended entries.
+func (fc *FileCache) TouchPrefix(prefix string, ttl time.Duration) (int, error) {
+	// Queued writes have to reach the store before they can be rewritten
+	if err := fc.Flush(); err != nil {
+		return 0, err
+	}
+	keys, err := fc.KeysWithPrefix(prefix)
+	if err != nil {
+		return 0, err
+	}
+	touched := 0
+	for _, key := range keys {
+		ok, err := fc.touch(key, fc.now().Add(ttl))
+		if err != nil {
+			return touched, err
+		}
+		if ok {
+			touched++
+		}
+	}
+	return touched, nil
+}
+
+// touch moves the expiry of the entry stored under key to expireAt and
+// reports whether the entry was live and unchanged until rewritten
+func (fc *FileCache) touch(key string, expireAt time.Time) (bool, error) {
+	name, err := fc.entryName(key)
+	if err != nil {
+		return false, err
+	}
+	data, err := fc.store.Fetch(name)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	item, err := decodeItem(data)
+	if err != nil {
+		// Reads report and remove corrupt entries
+		return false, nil
+	}
+	defer releaseItem(item)
+	if err := fc.verify(item); err != nil || item.Key != key || fc.isExpired(item, fc.now()) {
+		return false, nil
+	}
+
+	// The payload is rewritten as stored, so transformed data stays encoded
+	item.ExpireAt = expireAt
+	item.ExpireAt = fc.retainUntil(item)
+	if err := fc.rewriteItem(name, data, item); err == errEntryChanged || err == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if fc.hot != nil {
+		fc.hot.remove(key)
+	}
+	if fc.secondary != nil && fc.decodeItemData(item) == nil {
+		fc.mirrorSet(key, item.Data, item.ExpireAt)
+	}
+	return true, nil
+}
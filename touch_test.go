@@ -0,0 +1,77 @@
+package pie_cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTouchPrefix(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithIndex(2), WithHotCache(8)}} {
+		cache, err := NewWithStore(NewMemoryStore(), time.Minute, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create cache: %v", err)
+		}
+		_ = cache.SetWithTTL("dataset:a", []byte("a"), time.Minute)
+		_ = cache.SetWithTTL("dataset:b", []byte("b"), time.Minute)
+		_ = cache.SetWithTTL("dataset:gone", []byte("c"), time.Millisecond)
+		_ = cache.SetWithTTL("other", []byte("d"), time.Minute)
+		if _, err := cache.Get("dataset:a"); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		n, err := cache.TouchPrefix("dataset:", time.Hour)
+		if err != nil || n != 2 {
+			t.Errorf("Expected 2 entries extended, got %d, %v", n, err)
+		}
+		for _, key := range []string{"dataset:a", "dataset:b"} {
+			meta, err := cache.Inspect(key)
+			if err != nil {
+				t.Fatalf("Inspect(%q) failed: %v", key, err)
+			}
+			if meta.TTLRemaining(time.Now()) < 59*time.Minute {
+				t.Errorf("Expected %q to be extended, expires at %v", key, meta.ExpireAt)
+			}
+			if data, err := cache.Get(key); err != nil || string(data) != key[len(key)-1:] {
+				t.Errorf("Get(%q) returned %q, %v", key, data, err)
+			}
+		}
+		if meta, _ := cache.Inspect("other"); meta.TTLRemaining(time.Now()) > time.Minute {
+			t.Error("TouchPrefix extended a key outside the prefix")
+		}
+		if _, err := cache.Get("dataset:gone"); err != ErrExpired && err != ErrNotFound {
+			t.Errorf("Expected the expired entry to stay expired, got %v", err)
+		}
+	}
+}
+
+func TestTouchPrefixConcurrentSet(t *testing.T) {
+	store := &hookStore{MemoryStore: NewMemoryStore()}
+	secondary, _ := NewMemoryCache(time.Minute)
+	cache, err := NewWithStore(store, time.Minute, WithSecondary(secondary))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("p:k", []byte("old"))
+
+	// A Set landing between the read and the rewrite must not be undone
+	store.onFetch = func() { _ = cache.Set("p:k", []byte("new")) }
+	if n, err := cache.TouchPrefix("p:", time.Hour); err != nil || n != 0 {
+		t.Errorf("Expected no entry extended, got %d, %v", n, err)
+	}
+	if got, err := cache.Get("p:k"); err != nil || string(got) != "new" {
+		t.Errorf("Expected the new value kept, got %q, %v", got, err)
+	}
+
+	// The secondary gets the extended entries
+	if n, err := cache.TouchPrefix("p:", time.Hour); err != nil || n != 1 {
+		t.Fatalf("Expected 1 entry extended, got %d, %v", n, err)
+	}
+	meta, err := secondary.Inspect("p:k")
+	if err != nil || meta.TTLRemaining(time.Now()) < 59*time.Minute {
+		t.Errorf("Expected the entry extended in the secondary, got %v, %v", meta.ExpireAt, err)
+	}
+	if got, _ := secondary.Get("p:k"); string(got) != "new" {
+		t.Errorf("Expected the new value in the secondary, got %q", got)
+	}
+}
@@ -0,0 +1,19 @@
+package pie_cache
+
+import "context"
+
+// traceIDKey is the context key of trace IDs
+type traceIDKey struct{}
+
+// WithTraceID returns a context carrying id, which the Context variants of
+// cache operations such as GetContext add to the events they log, so a
+// cache problem can be matched to the request that ran into it
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceIDFrom returns the trace ID carried by ctx, or ""
+func TraceIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,46 @@
+package pie_cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceID(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	cache, err := NewWithStore(NewMemoryStore(), time.Minute, WithLogger(LoggerFunc(func(e Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	ctx := WithTraceID(context.Background(), "req-42")
+	if TraceIDFrom(ctx) != "req-42" || TraceIDFrom(context.Background()) != "" {
+		t.Fatal("TraceIDFrom does not return the stored ID")
+	}
+
+	_ = cache.SetWithTTLContext(ctx, "k", []byte("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := cache.GetContext(ctx, "k"); err != ErrExpired {
+		t.Fatalf("Expected ErrExpired, got %v", err)
+	}
+	_ = cache.Set("untraced", []byte("v"))
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %v", events)
+	}
+	if events[0].Type != EventWrite || events[0].TraceID != "req-42" {
+		t.Errorf("Expected traced write, got %+v", events[0])
+	}
+	if events[1].Type != EventExpired || events[1].TraceID != "req-42" {
+		t.Errorf("Expected traced expiry, got %+v", events[1])
+	}
+	if events[2].TraceID != "" {
+		t.Errorf("Expected untraced write, got %+v", events[2])
+	}
+}
@@ -0,0 +1,257 @@
+package pie_cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Transform encodes payloads before they are stored and decodes them after
+// they are read. Its name is recorded in every entry it encoded, so it must
+// be stable and unique among the transforms of a cache.
+type Transform interface {
+	Name() string
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// StreamTransform is a Transform that can also encode and decode streams,
+// so SetFromReader and GetReader need not hold whole payloads in memory.
+// Gzip implements it; AESGCM cannot, as it authenticates whole payloads.
+type StreamTransform interface {
+	Transform
+	// NewEncoder returns a writer encoding into w. Closing it flushes the
+	// encoded data but does not close w.
+	NewEncoder(w io.Writer) (io.WriteCloser, error)
+	// NewDecoder returns a reader decoding what it reads from r
+	NewDecoder(r io.Reader) (io.ReadCloser, error)
+}
+
+// TransformPolicy maps key patterns to the transform applied to matching
+// keys, e.g. {"secret:*": aes, "html:*": Gzip(), "img:*": nil}. A pattern
+// is an exact key or a prefix followed by "*"; the longest matching pattern
+// wins, and a nil transform stores payloads unchanged.
+type TransformPolicy map[string]Transform
+
+// WithTransformPolicy applies p to every written payload. Entries record
+// the transform that encoded them and are decoded on read even if the
+// policy has changed since, as long as the transform is still configured.
+func WithTransformPolicy(p TransformPolicy) Option {
+	return func(fc *FileCache) {
+		fc.transformPolicy = p
+	}
+}
+
+// transformRule is a compiled TransformPolicy entry
+type transformRule struct {
+	prefix    string
+	exact     bool
+	transform Transform
+}
+
+// transformer applies a compiled TransformPolicy
+type transformer struct {
+	rules  []transformRule      // Longest pattern first
+	byName map[string]Transform // For decoding
+}
+
+// compileTransforms checks the configured policy and prepares lookups
+func (fc *FileCache) compileTransforms() error {
+	if fc.transformPolicy == nil {
+		return nil
+	}
+
+	t := &transformer{byName: make(map[string]Transform)}
+	for pattern, tr := range fc.transformPolicy {
+		rule := transformRule{prefix: pattern, exact: true, transform: tr}
+		if strings.HasSuffix(pattern, "*") {
+			rule.prefix, rule.exact = strings.TrimSuffix(pattern, "*"), false
+		}
+		if strings.Contains(rule.prefix, "*") {
+			return fmt.Errorf("invalid transform pattern %q: * is only allowed at the end", pattern)
+		}
+		t.rules = append(t.rules, rule)
+
+		if tr == nil {
+			continue
+		}
+		if other, ok := t.byName[tr.Name()]; ok && other != tr {
+			return fmt.Errorf("invalid transform policy: two different transforms are named %q", tr.Name())
+		}
+		t.byName[tr.Name()] = tr
+	}
+	sort.Slice(t.rules, func(i, j int) bool {
+		if len(t.rules[i].prefix) != len(t.rules[j].prefix) {
+			return len(t.rules[i].prefix) > len(t.rules[j].prefix)
+		}
+		return t.rules[i].exact
+	})
+
+	fc.transforms = t
+	return nil
+}
+
+// forKey returns the transform for key, or nil
+func (t *transformer) forKey(key string) Transform {
+	for _, rule := range t.rules {
+		if rule.exact && key == rule.prefix || !rule.exact && strings.HasPrefix(key, rule.prefix) {
+			return rule.transform
+		}
+	}
+	return nil
+}
+
+// encodeItem applies the transform for item's key to its payload
+func (fc *FileCache) encodeItem(item *CacheItem) error {
+	if fc.transforms == nil {
+		return nil
+	}
+	tr := fc.transforms.forKey(item.Key)
+	if tr == nil {
+		return nil
+	}
+	data, err := tr.Encode(item.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload with %s: %v", tr.Name(), err)
+	}
+	item.Data, item.Encoding = data, tr.Name()
+	return nil
+}
+
+// decodeItemData reverses the transform recorded in item
+func (fc *FileCache) decodeItemData(item *CacheItem) error {
+	if item.Encoding == "" {
+		return nil
+	}
+	var tr Transform
+	if fc.transforms != nil {
+		tr = fc.transforms.byName[item.Encoding]
+	}
+	if tr == nil {
+		return fmt.Errorf("failed to decode payload: unknown encoding %q", item.Encoding)
+	}
+	data, err := tr.Decode(item.Data)
+	if err != nil {
+		return fmt.Errorf("failed to decode payload with %s: %v", tr.Name(), err)
+	}
+	item.Data, item.Encoding = data, ""
+	return nil
+}
+
+// Gzip returns a Transform compressing payloads with gzip
+func Gzip() Transform {
+	return gzipTransform{}
+}
+
+type gzipTransform struct{}
+
+func (gzipTransform) Name() string { return "gzip" }
+
+func (gzipTransform) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipTransform) Decode(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+func (gzipTransform) NewEncoder(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipTransform) NewDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// AESGCM returns a Transform encrypting payloads with AES-GCM under key,
+// which must be 16, 24 or 32 bytes long
+func AESGCM(key []byte) (Transform, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return &aesTransform{aead: aead}, nil
+}
+
+type aesTransform struct {
+	aead cipher.AEAD
+}
+
+func (t *aesTransform) Name() string { return "aesgcm" }
+
+func (t *aesTransform) Encode(data []byte) ([]byte, error) {
+	nonce := make([]byte, t.aead.NonceSize(), t.aead.NonceSize()+len(data)+t.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return t.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (t *aesTransform) Decode(data []byte) ([]byte, error) {
+	n := t.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("ciphertext too short")
+	}
+	return t.aead.Open(nil, data[:n], data[n:], nil)
+}
+
+// Pipeline returns a Transform applying ts in order when encoding and in
+// reverse order when decoding, e.g. Pipeline(Gzip(), aes) to compress
+// before encrypting
+func Pipeline(ts ...Transform) Transform {
+	return pipeline(ts)
+}
+
+type pipeline []Transform
+
+func (p pipeline) Name() string {
+	names := make([]string, len(p))
+	for i, t := range p {
+		names[i] = t.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (p pipeline) Encode(data []byte) ([]byte, error) {
+	for _, t := range p {
+		var err error
+		if data, err = t.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (p pipeline) Decode(data []byte) ([]byte, error) {
+	for i := len(p) - 1; i >= 0; i-- {
+		var err error
+		if data, err = p[i].Decode(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
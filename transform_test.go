@@ -0,0 +1,77 @@
+package pie_cache
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransformPolicy(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_transform")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	aes, err := AESGCM(bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatalf("AESGCM failed: %v", err)
+	}
+	policy := TransformPolicy{
+		"secret:*":     aes,
+		"html:*":       Gzip(),
+		"html:raw:*":   nil,
+		"secret:html*": Pipeline(Gzip(), aes),
+	}
+	cache, err := NewFileCache(tempDir, time.Minute, WithTransformPolicy(policy), WithHotCache(4))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	page := []byte(strings.Repeat("<p>hello</p>", 100))
+	tests := []struct {
+		key      string
+		encoding string
+	}{
+		{"secret:token", "aesgcm"},
+		{"html:index", "gzip"},
+		{"html:raw:index", ""},
+		{"secret:html:page", "gzip+aesgcm"},
+		{"img:logo", ""},
+	}
+	for _, tt := range tests {
+		if err := cache.Set(tt.key, page); err != nil {
+			t.Fatalf("Set %s failed: %v", tt.key, err)
+		}
+		path, _ := cache.getFilePath(tt.key)
+		raw, _ := os.ReadFile(path)
+		item, err := decodeItem(raw)
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", tt.key, err)
+		}
+		if item.Encoding != tt.encoding {
+			t.Errorf("%s: expected encoding %q, got %q", tt.key, tt.encoding, item.Encoding)
+		}
+		if tt.encoding != "" && bytes.Contains(item.Data, []byte("hello")) {
+			t.Errorf("%s: expected payload to be transformed on disk", tt.key)
+		}
+		// Read twice so the hot cache serves the decoded copy
+		for i := 0; i < 2; i++ {
+			if data, err := cache.Get(tt.key); err != nil || !bytes.Equal(data, page) {
+				t.Errorf("%s: expected original payload, got %d bytes, %v", tt.key, len(data), err)
+			}
+		}
+	}
+
+	// Without the transform configured the entry cannot be decoded
+	plain, _ := NewFileCache(tempDir, time.Minute)
+	if _, err := plain.Get("secret:token"); err == nil {
+		t.Error("Expected error reading an encrypted entry without the key")
+	}
+
+	if _, err := NewFileCache(tempDir, time.Minute, WithTransformPolicy(TransformPolicy{"a*b": Gzip()})); err == nil {
+		t.Error("Expected error for * inside a pattern")
+	}
+}
@@ -0,0 +1,133 @@
+package pie_cache
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// indexUsageName holds the footprint totals of an indexed cache
+const indexUsageName = indexPrefix + "usage"
+
+// NamespaceUsage is the footprint of the entries in a namespace
+type NamespaceUsage struct {
+	Bytes   int64 `json:"bytes"`   // Encoded size of the entries in the store
+	Entries int   `json:"entries"` // Number of entries, expired ones included
+}
+
+// DiskUsage reports how many bytes the cache entries take in the store and
+// how many there are. With WithIndex the totals are kept up to date as
+// entries are written and removed, so the call is cheap; RebuildIndex
+// recounts them. Without an index every entry is read.
+func (fc *FileCache) DiskUsage() (bytes int64, entries int, err error) {
+	usage, err := fc.DiskUsageByNamespace()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, u := range usage {
+		bytes += u.Bytes
+		entries += u.Entries
+	}
+	return bytes, entries, nil
+}
+
+// DiskUsageByNamespace breaks DiskUsage down by key namespace, as returned
+// by NamespaceOf. Keys without a namespace are counted under "".
+func (fc *FileCache) DiskUsageByNamespace() (map[string]NamespaceUsage, error) {
+	if fc.index != nil {
+		fc.index.usageMu.Lock()
+		defer fc.index.usageMu.Unlock()
+		usage := make(map[string]NamespaceUsage, len(fc.index.usage))
+		for ns, u := range fc.index.usage {
+			usage[ns] = u
+		}
+		return usage, nil
+	}
+
+	usage := make(map[string]NamespaceUsage)
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			return nil
+		}
+		ns := NamespaceOf(item.Key)
+		releaseItem(item)
+		u := usage[ns]
+		u.Bytes += int64(len(data))
+		u.Entries++
+		usage[ns] = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// bytes returns the stored size of e, falling back to the payload size for
+// entries indexed before encoded sizes were recorded
+func (e indexEntry) bytes() int64 {
+	if e.Bytes > 0 {
+		return int64(e.Bytes)
+	}
+	return int64(e.Size)
+}
+
+// account adds delta to the totals of namespace ns
+func (idx *keyIndex) account(ns string, delta NamespaceUsage) {
+	if delta == (NamespaceUsage{}) {
+		return
+	}
+	idx.usageMu.Lock()
+	u := idx.usage[ns]
+	u.Bytes += delta.Bytes
+	u.Entries += delta.Entries
+	if u.Entries <= 0 {
+		delete(idx.usage, ns)
+	} else {
+		idx.usage[ns] = u
+	}
+	idx.usageDirty = true
+	idx.usageMu.Unlock()
+}
+
+// loadUsage reads the persisted totals, counting them from the index when
+// they were never written
+func (idx *keyIndex) loadUsage() error {
+	idx.usageMu.Lock()
+	idx.usage = make(map[string]NamespaceUsage)
+	data, err := idx.store.Fetch(indexUsageName)
+	if err == nil && json.Unmarshal(data, &idx.usage) == nil {
+		idx.usageMu.Unlock()
+		return nil
+	}
+	idx.usageMu.Unlock()
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to read index: %v", err)
+	}
+
+	idx.each(func(key string, e indexEntry) {
+		idx.account(NamespaceOf(key), NamespaceUsage{Bytes: e.bytes(), Entries: 1})
+	})
+	return idx.saveUsage()
+}
+
+// saveUsage writes the totals if they changed
+func (idx *keyIndex) saveUsage() error {
+	idx.usageMu.Lock()
+	defer idx.usageMu.Unlock()
+	if !idx.usageDirty {
+		return nil
+	}
+	data, err := json.Marshal(idx.usage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index usage: %v", err)
+	}
+	if err := idx.store.Put(indexUsageName, data); err != nil {
+		return fmt.Errorf("failed to write index usage: %v", err)
+	}
+	idx.usageDirty = false
+	return nil
+}
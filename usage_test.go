@@ -0,0 +1,62 @@
+package pie_cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDiskUsage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_usage")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	plain, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = plain.Set("user:1", []byte("alice"))
+	_ = plain.Set("user:2", []byte("bob"))
+	_ = plain.Set("page:home", []byte("<html>"))
+	_ = plain.Set("loose", []byte("x"))
+
+	walked, err := plain.DiskUsageByNamespace()
+	if err != nil {
+		t.Fatalf("DiskUsageByNamespace failed: %v", err)
+	}
+	if walked["user"].Entries != 2 || walked["page"].Entries != 1 || walked[""].Entries != 1 {
+		t.Errorf("Unexpected usage %v", walked)
+	}
+	bytes, entries, _ := plain.DiskUsage()
+	if entries != 4 || bytes <= 0 {
+		t.Errorf("Expected 4 entries with bytes, got %d, %d", entries, bytes)
+	}
+
+	// The index starts from the same totals and keeps them current
+	cache, err := NewFileCache(tempDir, time.Minute, WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	if got, _, _ := cache.DiskUsage(); got != bytes {
+		t.Errorf("Expected indexed usage %d, got %d", bytes, got)
+	}
+	_ = cache.Set("user:1", []byte("alice, again"))
+	_ = cache.Delete("user:2")
+	_ = cache.Delete("loose")
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	walked, _ = plain.DiskUsageByNamespace()
+	cache, err = NewFileCache(tempDir, time.Minute, WithIndex(2))
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	defer cache.Close()
+	indexed, _ := cache.DiskUsageByNamespace()
+	if len(indexed) != 2 || indexed["user"] != walked["user"] || indexed["page"] != walked["page"] {
+		t.Errorf("Expected persisted usage %v, got %v", walked, indexed)
+	}
+}
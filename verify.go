@@ -0,0 +1,180 @@
+package pie_cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// orphanAge is how old a temporary file must be before Verify takes it to
+// be left by a crashed writer rather than a write in progress
+const orphanAge = time.Hour
+
+// VerifyReport lists the problems Verify found
+type VerifyReport struct {
+	Scanned   int      `json:"scanned"`   // Entries examined
+	Corrupt   []string `json:"corrupt"`   // Store names of entries that do not parse or fail their signature
+	Misplaced []string `json:"misplaced"` // Store names of entries not where their key belongs
+	TempFiles []string `json:"tempFiles"` // Leftover temporary files of interrupted writes, by store name
+	EmptyDirs []string `json:"emptyDirs"` // Directories holding nothing, by store name
+	Repaired  int      `json:"repaired"`  // Problems fixed, with repair set
+}
+
+// OK reports whether Verify found nothing wrong
+func (r VerifyReport) OK() bool {
+	return len(r.Corrupt) == 0 && len(r.Misplaced) == 0 && len(r.TempFiles) == 0 && len(r.EmptyDirs) == 0
+}
+
+// Verify scans every entry for files that do not parse or fail signature
+// or checksum checks and entries stored under a name their key does not
+// map to. On a FileStore it also looks for temporary files left by
+// interrupted writes and empty directories. With repair set, corrupt
+// entries, leftover files and empty directories are removed, and
+// misplaced entries are moved to where they belong unless a newer entry
+// for their key is already there.
+func (fc *FileCache) Verify(repair bool) (VerifyReport, error) {
+	var report VerifyReport
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		report.Scanned++
+
+		item, err := decodeItem(data)
+		if err == nil {
+			err = fc.verify(item)
+		}
+		if err == nil && fc.checksum && item.Checksum != "" {
+			payload := *item
+			if err = fc.decodeItemData(&payload); err == nil {
+				err = fc.verifyChecksum(&payload)
+			}
+		}
+		if err != nil {
+			report.Corrupt = append(report.Corrupt, name)
+			if repair && fc.store.Remove(name) == nil {
+				fc.logEvent(Event{Type: EventCorrupt, Path: name, Removed: true, Err: err})
+				report.Repaired++
+			}
+			return nil
+		}
+
+		if want, err := fc.entryName(item.Key); err != nil || want != name {
+			report.Misplaced = append(report.Misplaced, name)
+			if repair && fc.relocate(name, want, item, data) == nil {
+				report.Repaired++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if fs, ok := fc.store.(*FileStore); ok {
+		fc.verifyFiles(fs, repair, &report)
+	}
+	return report, nil
+}
+
+// relocate moves the entry stored as name to want, the name its key maps
+// to, dropping it instead if want is empty or already holds a newer entry
+func (fc *FileCache) relocate(name, want string, item *CacheItem, data []byte) error {
+	if want != "" {
+		keep := true
+		if existing, err := fc.store.Fetch(want); err == nil {
+			if other, err := decodeItem(existing); err == nil && !other.Created.Before(item.Created) {
+				keep = false
+			}
+		}
+		if keep {
+			if err := fc.store.Put(want, data); err != nil {
+				return err
+			}
+			if fc.index != nil {
+				fc.index.put(item.Key, indexEntry{Name: want, ExpireAt: item.ExpireAt, Size: len(item.Data), Bytes: len(data)})
+			}
+		}
+	}
+	return fc.store.Remove(name)
+}
+
+// verifyFiles finds leftover temporary files and empty directories below
+// the base directory of fs
+func (fc *FileCache) verifyFiles(fs *FileStore, repair bool, report *VerifyReport) {
+	_ = filepath.Walk(fs.baseDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), tempPrefix) && time.Since(info.ModTime()) > orphanAge {
+			report.TempFiles = append(report.TempFiles, fs.name(filePath))
+			if repair && os.Remove(filePath) == nil {
+				report.Repaired++
+			}
+		}
+		return nil
+	})
+
+	report.EmptyDirs = fs.pruneDirs(repair)
+	if repair {
+		report.Repaired += len(report.EmptyDirs)
+	}
+}
+
+// CompactDirs removes the empty directories below a FileStore, such as
+// those left by entries deleted before Remove pruned its parents, and
+// returns how many it removed. It does nothing on other stores.
+func (fc *FileCache) CompactDirs() (int, error) {
+	fs, ok := fc.store.(*FileStore)
+	if !ok {
+		return 0, nil
+	}
+	return len(fs.pruneDirs(true)), nil
+}
+
+// Relocate moves every entry not stored under the name its key maps to
+// with the current WithHash and WithPathScheme settings, and returns how
+// many it moved. Opening an existing cache with a different hash or path
+// scheme and calling Relocate migrates it; until then, entries in the old
+// layout are not found.
+func (fc *FileCache) Relocate() (int, error) {
+	type move struct {
+		name, want string
+	}
+	var moves []move
+	err := fc.store.Walk("", func(name string, data []byte) error {
+		if isMetaName(name) {
+			return nil
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			return nil
+		}
+		if want, err := fc.entryName(item.Key); err == nil && want != name {
+			moves = append(moves, move{name: name, want: want})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, m := range moves {
+		data, err := fc.store.Fetch(m.name)
+		if err != nil {
+			continue
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			continue
+		}
+		if err := fc.relocate(m.name, m.want, item, data); err != nil {
+			return moved, fmt.Errorf("failed to relocate %s: %v", m.name, err)
+		}
+		moved++
+	}
+	return moved, nil
+}
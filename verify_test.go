@@ -0,0 +1,115 @@
+package pie_cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_verify")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("good", []byte("v"))
+	_ = cache.Set("moved", []byte("v"))
+	_ = cache.Set("broken", []byte("v"))
+
+	movedPath, _ := cache.getFilePath("moved")
+	data, _ := os.ReadFile(movedPath)
+	_ = os.Remove(movedPath)
+	_ = os.MkdirAll(filepath.Join(tempDir, "zz", "zz", "zz"), 0755)
+	_ = os.WriteFile(filepath.Join(tempDir, "zz", "zz", "zz", "moved"), data, 0644)
+
+	brokenPath, _ := cache.getFilePath("broken")
+	_ = os.WriteFile(brokenPath, []byte("{not json"), 0644)
+
+	tmp := filepath.Join(tempDir, tempPrefix+"1")
+	_ = os.WriteFile(tmp, []byte("partial"), 0644)
+	old := time.Now().Add(-2 * orphanAge)
+	_ = os.Chtimes(tmp, old, old)
+	_ = os.WriteFile(filepath.Join(tempDir, tempPrefix+"2"), []byte("in progress"), 0644)
+	_ = os.MkdirAll(filepath.Join(tempDir, "aa", "bb"), 0755)
+
+	report, err := cache.Verify(false)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if report.Scanned != 3 || len(report.Corrupt) != 1 || len(report.Misplaced) != 1 ||
+		len(report.TempFiles) != 1 || len(report.EmptyDirs) != 2 || report.Repaired != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.OK() {
+		t.Error("Expected report not to be OK")
+	}
+	if report.TempFiles[0] != tempPrefix+"1" {
+		t.Errorf("Expected temp file by store name, got %q", report.TempFiles[0])
+	}
+	if !fileExists(tmp) {
+		t.Error("Verify without repair removed a file")
+	}
+
+	report, err = cache.Verify(true)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if report.Repaired < 5 {
+		t.Errorf("Expected at least 5 repairs, got %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "aa")); !os.IsNotExist(err) {
+		t.Error("Expected directories emptied by repair to be removed")
+	}
+	if data, err := cache.Get("moved"); err != nil || string(data) != "v" {
+		t.Errorf("Expected misplaced entry to be moved, got %q, %v", data, err)
+	}
+	if fileExists(brokenPath) || fileExists(tmp) {
+		t.Error("Expected corrupt entry and orphaned temp file to be removed")
+	}
+	if !fileExists(filepath.Join(tempDir, tempPrefix+"2")) {
+		t.Error("Expected recent temp file to be kept")
+	}
+
+	report, _ = cache.Verify(false)
+	if !report.OK() {
+		t.Errorf("Expected repaired cache to verify, got %+v", report)
+	}
+}
+
+func TestCompactDirs(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "pie_cache_compact")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cache, err := NewFileCache(tempDir, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	_ = cache.Set("kept", []byte("v"))
+	_ = cache.SetWithTTL("gone", []byte("v"), time.Millisecond)
+	gonePath, _ := cache.getFilePath("gone")
+	time.Sleep(5 * time.Millisecond)
+	if err := cache.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(gonePath)); !os.IsNotExist(err) {
+		t.Errorf("Expected purge to remove the entry's directory, got %v", err)
+	}
+
+	// Directories emptied behind the cache's back
+	_ = os.MkdirAll(filepath.Join(tempDir, "00", "11", "22"), 0755)
+	if n, err := cache.CompactDirs(); err != nil || n != 3 {
+		t.Errorf("Expected 3 directories removed, got %d, %v", n, err)
+	}
+	if data, err := cache.Get("kept"); err != nil || string(data) != "v" {
+		t.Errorf("Expected entry to survive compaction, got %q, %v", data, err)
+	}
+}